@@ -0,0 +1,51 @@
+package ecloudsdk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+)
+
+// UploadAbortedError is returned when an upload is interrupted, by context cancellation
+// or a failed chunk of UploadLargeReport, after the server may have partially received it.
+// UploadID identifies the server-side upload so it can be resumed or cleaned up
+// with AbortUpload. It matches ErrUploadAborted with errors.Is.
+type UploadAbortedError struct {
+	UploadID string // Server-side upload or visit transaction ID.
+	Cause    error  // The error that interrupted the upload.
+}
+
+func (e *UploadAbortedError) Error() string {
+	return fmt.Sprintf("upload %s aborted: %v", e.UploadID, e.Cause)
+}
+
+// Is makes errors.Is(err, ErrUploadAborted) report true.
+func (e *UploadAbortedError) Is(target error) bool {
+	return target == ErrUploadAborted
+}
+
+func (e *UploadAbortedError) Unwrap() error {
+	return e.Cause
+}
+
+// AbortUpload discards a partially received upload on the server.
+// Aborting an upload that no longer exists is not an error.
+func (c *DefaultEcloudClient) AbortUpload(ctx context.Context, uploadID string) error {
+	if uploadID == "" {
+		return fmt.Errorf("upload id must not be empty")
+	}
+
+	url := fmt.Sprintf("%s/api/uploads/%s", c.cfg().ApiBaseUrl, neturl.PathEscape(uploadID))
+	resp, err := c.performRequest(ctx, http.MethodDelete, url, nil, nil)
+	if err != nil {
+		return fmt.Errorf("unable to abort upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	return c.decodeError(resp)
+}
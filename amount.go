@@ -0,0 +1,47 @@
+package ecloudsdk
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MaxAmountDecimals is the number of decimal places accepted in payment
+// amounts by ValidateAmount.
+const MaxAmountDecimals = 2
+
+// maxExactAmount is the largest amount whose cents a float64 represents exactly (2^53 cents).
+const maxExactAmount = 1 << 53 / 100
+
+// ValidateAmount reports whether amount can be sent to ecloud without losing
+// precision: it must be finite, have at most MaxAmountDecimals decimal places
+// and be small enough for its cents to be represented exactly. Amounts
+// resulting from float arithmetic, like 4999.999999 or 0.1+0.2, fail with
+// ErrInvalidAmount.
+//
+// CreatePayment and RefundPayment apply it when Config.StrictAmounts is set.
+func ValidateAmount(amount float64) error {
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return fmt.Errorf("%w: %v is not a number", ErrInvalidAmount, amount)
+	}
+
+	if math.Abs(amount) > maxExactAmount {
+		return fmt.Errorf("%w: %v can't be represented exactly", ErrInvalidAmount, amount)
+	}
+
+	// The shortest representation that round-trips is the amount as written.
+	formatted := strconv.FormatFloat(amount, 'f', -1, 64)
+	if _, decimals, ok := strings.Cut(formatted, "."); ok && len(decimals) > MaxAmountDecimals {
+		return fmt.Errorf("%w: %s has more than %d decimal places", ErrInvalidAmount, formatted, MaxAmountDecimals)
+	}
+	return nil
+}
+
+// checkAmount validates amount when Config.StrictAmounts is set.
+func (c *DefaultEcloudClient) checkAmount(amount float64) error {
+	if !c.cfg().StrictAmounts {
+		return nil
+	}
+	return ValidateAmount(amount)
+}
@@ -0,0 +1,98 @@
+package ecloudsdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// JSONRespError encodes the response body returned by the API when there is an error.
+type JSONRespError struct {
+	Error   string `json:"error"`
+	Code    string `json:"code,omitempty"`    // Machine readable error code, if provided.
+	Message string `json:"message,omitempty"` // Alternative to Error used by some endpoints.
+}
+
+// APIError is returned by service methods when the server responds with an
+// unexpected status code. Use errors.As to inspect it, or errors.Is with the
+// status sentinels (ErrNotFound, ErrConflict, ErrUnprocessable, ...) and the
+// resource sentinels (ErrSubscriberNotFound, ErrRecordNotFound) to branch on it.
+type APIError struct {
+	StatusCode int    // HTTP status code.
+	Code       string // Machine readable error code, if provided by the server.
+	Message    string // Human readable error message.
+	RequestID  string // Server request ID (X-Request-Id), for support tickets.
+	Body       []byte // Raw response body.
+
+	// Resource specific sentinel matched on 404, e.g ErrSubscriberNotFound.
+	notFound error
+}
+
+func (e *APIError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = "empty response body"
+	}
+
+	if e.RequestID != "" {
+		return fmt.Sprintf("statusCode=%d remote error: %s (request_id=%s)", e.StatusCode, message, e.RequestID)
+	}
+	return fmt.Sprintf("statusCode=%d remote error: %s", e.StatusCode, message)
+}
+
+// Is matches the status sentinels and, for 404 responses, the resource sentinel.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrUnprocessable:
+		return e.StatusCode == http.StatusUnprocessableEntity
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServerError:
+		return e.StatusCode >= 500
+	}
+	return e.notFound != nil && target == e.notFound && e.StatusCode == http.StatusNotFound
+}
+
+// decodeError reads an error response into an *APIError.
+func (c *DefaultEcloudClient) decodeError(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("statusCode=%d: failed to read response body: %w", resp.StatusCode, err)
+	}
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Request-Id"),
+		Body:       body,
+	}
+
+	var jsonErr JSONRespError
+	if err := json.Unmarshal(body, &jsonErr); err == nil && (jsonErr.Error != "" || jsonErr.Message != "") {
+		apiErr.Code = jsonErr.Code
+		apiErr.Message = jsonErr.Error
+		if apiErr.Message == "" {
+			apiErr.Message = jsonErr.Message
+		}
+		return apiErr
+	}
+
+	// fallback: plain text or unknown structure
+	apiErr.Message = string(body)
+	return apiErr
+}
+
+// decodeResourceError is like decodeError, but a 404 response also matches notFound.
+func (c *DefaultEcloudClient) decodeResourceError(resp *http.Response, notFound error) error {
+	err := c.decodeError(resp)
+	if apiErr, ok := err.(*APIError); ok {
+		apiErr.notFound = notFound
+	}
+	return err
+}
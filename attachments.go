@@ -0,0 +1,229 @@
+package ecloudsdk
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+// Content types of attachments with specific validation. Attachments of
+// other types are uploaded as they are.
+const (
+	JPEGContentType  = "image/jpeg"
+	PNGContentType   = "image/png"
+	DICOMContentType = "application/dicom"
+)
+
+// Attachment is a file uploaded with a record besides its reports, e.g a
+// scan from a lab device or a DICOM study.
+type Attachment struct {
+	Name        string `json:"name"`         // File name e.g "chest-xray.dcm".
+	ContentType string `json:"content_type"` // MIME type e.g DICOMContentType.
+
+	// Content of the file. Only present when decoding queued records.
+	Data []byte `json:"data,omitempty"`
+
+	// Streamed alternative to Data, used only when Data is nil.
+	// A reader can be uploaded only once unless it implements io.Seeker.
+	Reader io.Reader `json:"-"`
+}
+
+// validate checks the metadata of the attachment.
+func (a *Attachment) validate() error {
+	if strings.TrimSpace(a.Name) == "" {
+		return fmt.Errorf("attachment missing Name")
+	}
+	if _, _, err := mime.ParseMediaType(a.ContentType); err != nil {
+		return fmt.Errorf("attachment %q has invalid ContentType %q", a.Name, a.ContentType)
+	}
+	if a.Data == nil && a.Reader == nil {
+		return fmt.Errorf("attachment %q has no content", a.Name)
+	}
+	return nil
+}
+
+// mediaType returns the content type of the attachment without parameters.
+func (a *Attachment) mediaType() string {
+	mediaType, _, _ := mime.ParseMediaType(a.ContentType)
+	return mediaType
+}
+
+// attachmentFieldName returns the multipart field of the i-th attachment.
+func attachmentFieldName(i int) string {
+	return fmt.Sprintf("attachment_%d", i)
+}
+
+// attachmentFormat checks files of a content type: head the first sniffLen
+// bytes, tail the last attachmentTailLen bytes if not nil.
+type attachmentFormat struct {
+	head func(head []byte) bool
+	tail func(tail []byte) bool
+}
+
+// attachmentTailLen is the number of bytes kept to check the end of a file.
+const attachmentTailLen = 64
+
+var attachmentFormats = map[string]attachmentFormat{
+	JPEGContentType: {
+		head: func(head []byte) bool { return bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}) },
+		// Some devices pad scans after the end of image marker.
+		tail: func(tail []byte) bool { return bytes.HasSuffix(bytes.TrimRight(tail, "\x00"), []byte{0xFF, 0xD9}) },
+	},
+	PNGContentType: {
+		head: func(head []byte) bool {
+			return bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")) && len(head) >= 16 && string(head[12:16]) == "IHDR"
+		},
+		tail: func(tail []byte) bool { return bytes.HasSuffix(tail, []byte("IEND\xaeB`\x82")) },
+	},
+	// DICOM Part 10 files start with a 128-byte preamble and the DICM prefix.
+	DICOMContentType: {
+		head: func(head []byte) bool { return len(head) >= 132 && string(head[128:132]) == "DICM" },
+	},
+}
+
+// invalidAttachment returns the error of an attachment failing the checks of its type.
+func invalidAttachment(a *Attachment) error {
+	return fmt.Errorf("%w %q: not a valid %s file", ErrInvalidAttachment, a.Name, a.mediaType())
+}
+
+// validateAttachment checks the content of an attachment held in memory.
+func validateAttachment(field string, a *Attachment, data []byte, maxSize int64) error {
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return fmt.Errorf("%w %q: exceeds maximum size of %d bytes", ErrInvalidAttachment, a.Name, maxSize)
+	}
+
+	mediaType := a.mediaType()
+	if mediaType == pdfContentType {
+		if err := checkContentType(field, pdfContentType, data); err != nil {
+			return err
+		}
+		return validatePDF(data, fmt.Errorf("%w %q", ErrInvalidAttachment, a.Name), 0)
+	}
+
+	format, ok := attachmentFormats[mediaType]
+	if !ok {
+		return nil
+	}
+
+	if err := checkContentType(field, mediaType, data); err != nil {
+		return err
+	}
+
+	if !format.head(data[:min(len(data), sniffLen)]) ||
+		(format.tail != nil && !format.tail(data[max(0, len(data)-attachmentTailLen):])) {
+		return invalidAttachment(a)
+	}
+	return nil
+}
+
+// attachmentStream returns the streamValidator of an attachment.
+func attachmentStream(field string, a *Attachment, maxSize int64) streamValidator {
+	return func(r io.Reader) (io.Reader, error) {
+		if a.mediaType() == pdfContentType {
+			return streamPDF(field, r, fmt.Errorf("%w %q", ErrInvalidAttachment, a.Name), maxSize)
+		}
+
+		br := bufio.NewReaderSize(r, sniffLen)
+		head, err := br.Peek(sniffLen)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("unable to read attachment %q: %w", a.Name, err)
+		}
+
+		format, ok := attachmentFormats[a.mediaType()]
+		if ok {
+			if err := checkContentType(field, a.mediaType(), head); err != nil {
+				return nil, err
+			}
+
+			if !format.head(head) {
+				return nil, invalidAttachment(a)
+			}
+		}
+		return &attachmentStreamValidator{r: br, attachment: a, tailCheck: format.tail, maxSize: maxSize}, nil
+	}
+}
+
+// attachmentStreamValidator checks the end of a streamed attachment and
+// enforces the maximum size. A failed check is returned as the read error.
+type attachmentStreamValidator struct {
+	r          io.Reader
+	attachment *Attachment
+	tailCheck  func(tail []byte) bool // Nil if the end isn't checked.
+	maxSize    int64
+
+	size int64
+	tail []byte
+}
+
+func (v *attachmentStreamValidator) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+
+	v.size += int64(n)
+	if v.maxSize > 0 && v.size > v.maxSize {
+		return n, fmt.Errorf("%w %q: exceeds maximum size of %d bytes", ErrInvalidAttachment,
+			v.attachment.Name, v.maxSize)
+	}
+
+	if v.tailCheck == nil {
+		return n, err
+	}
+
+	v.tail = append(v.tail, p[:n]...)
+	if len(v.tail) > attachmentTailLen {
+		v.tail = append(v.tail[:0], v.tail[len(v.tail)-attachmentTailLen:]...)
+	}
+
+	if err == io.EOF && !v.tailCheck(v.tail) {
+		return n, invalidAttachment(v.attachment)
+	}
+	return n, err
+}
+
+// attachmentParts validates the attachments of the record and returns them
+// in upload order, after the reports.
+func attachmentParts(record *PatientRecord, maxSize int64) ([]reportPart, error) {
+	var parts []reportPart
+	for i := range record.Attachments {
+		a := &record.Attachments[i]
+		field := attachmentFieldName(i)
+		part := reportPart{field: field, filename: a.Name, contentType: a.ContentType}
+
+		if a.Data != nil {
+			if err := validateAttachment(field, a, a.Data, maxSize); err != nil {
+				return nil, err
+			}
+			part.open, part.size, part.sha256 = bytesOpener(a.Data), int64(len(a.Data)), sha256Hex(a.Data)
+		} else {
+			open, err := streamOpener(field, a.Reader, attachmentStream(field, a, maxSize))
+			if err != nil {
+				return nil, err
+			}
+			part.open, part.size = open, readerSize(a.Reader)
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// attachmentFields returns the form fields describing the attachments of the
+// record. The content type is sent apart from the file so that it is kept
+// when the file is encrypted.
+func attachmentFields(record *PatientRecord) [][2]string {
+	var fields [][2]string
+	for i, a := range record.Attachments {
+		fields = append(fields, [2]string{attachmentFieldName(i) + "_content_type", a.ContentType})
+	}
+	return fields
+}
+
+// recordSize returns the size of the reports and attachments of record held in memory.
+func recordSize(record *PatientRecord) int64 {
+	size := int64(len(record.MedicalReport) + len(record.LabReport))
+	for _, a := range record.Attachments {
+		size += int64(len(a.Data))
+	}
+	return size
+}
@@ -0,0 +1,194 @@
+package ecloudsdk
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultCoverageRecheckInterval is how often the coverage of subscribers
+// with records awaiting payment is checked when
+// SyncManagerConfig.CoverageRecheckInterval is zero.
+const DefaultCoverageRecheckInterval = time.Hour
+
+// CoverageChecker reports whether a subscriber is covered. EcloudClient implements it.
+type CoverageChecker interface {
+	CheckCoverage(ctx context.Context, subscriberID uint, at time.Time) (*CoverageStatus, error)
+}
+
+// EventSource publishes client events. EcloudClient implements it.
+type EventSource interface {
+	Events(ctx context.Context) <-chan Event
+}
+
+// awaitingPayment holds the records of subscribers without coverage,
+// by subscriber ID.
+type awaitingPayment struct {
+	mu          sync.Mutex
+	subscribers map[uint]*parkedSubscriber
+}
+
+type parkedSubscriber struct {
+	records     map[uint]*PatientRecord // By VisitID.
+	lastChecked time.Time
+}
+
+// AwaitingPayment returns the records parked because their subscriber's
+// coverage lapsed, ordered by subscriber and visit. They are uploaded once
+// a payment is recorded or the subscriber is covered again.
+func (m *SyncManager) AwaitingPayment() []*PatientRecord {
+	m.awaiting.mu.Lock()
+	defer m.awaiting.mu.Unlock()
+
+	var records []*PatientRecord
+	for _, parked := range m.awaiting.subscribers {
+		for _, record := range parked.records {
+			records = append(records, record)
+		}
+	}
+
+	slices.SortFunc(records, func(a, b *PatientRecord) int {
+		return cmp.Or(cmp.Compare(a.SubscriberID, b.SubscriberID), cmp.Compare(a.VisitID, b.VisitID))
+	})
+	return records
+}
+
+// awaitPayment parks the record if its subscriber isn't covered, and reports
+// whether it did. Records are uploaded if coverage can't be checked.
+func (m *SyncManager) awaitPayment(ctx context.Context, record *PatientRecord) bool {
+	if m.coverage == nil {
+		return false
+	}
+
+	// Other records of a parked subscriber wait without another check.
+	if m.parkIfAwaiting(record) {
+		return true
+	}
+
+	status, err := m.coverage.CheckCoverage(ctx, record.SubscriberID, time.Now())
+	if err != nil {
+		m.logger.Debug("unable to check coverage of subscriber %d, uploading: %v\n", record.SubscriberID, err)
+		return false
+	}
+
+	if status.Active {
+		return false
+	}
+
+	m.park(record)
+	return true
+}
+
+// parkIfAwaiting parks the record if its subscriber already awaits payment.
+func (m *SyncManager) parkIfAwaiting(record *PatientRecord) bool {
+	m.awaiting.mu.Lock()
+	defer m.awaiting.mu.Unlock()
+
+	parked, ok := m.awaiting.subscribers[record.SubscriberID]
+	if ok {
+		parked.records[record.VisitID] = record
+	}
+	return ok
+}
+
+// isAwaiting reports whether the record is parked awaiting payment.
+func (m *SyncManager) isAwaiting(record *PatientRecord) bool {
+	m.awaiting.mu.Lock()
+	defer m.awaiting.mu.Unlock()
+
+	parked, ok := m.awaiting.subscribers[record.SubscriberID]
+	return ok && parked.records[record.VisitID] != nil
+}
+
+func (m *SyncManager) park(record *PatientRecord) {
+	m.awaiting.mu.Lock()
+	defer m.awaiting.mu.Unlock()
+
+	if m.awaiting.subscribers == nil {
+		m.awaiting.subscribers = make(map[uint]*parkedSubscriber)
+	}
+
+	parked, ok := m.awaiting.subscribers[record.SubscriberID]
+	if !ok {
+		parked = &parkedSubscriber{records: make(map[uint]*PatientRecord), lastChecked: time.Now()}
+		m.awaiting.subscribers[record.SubscriberID] = parked
+	}
+	parked.records[record.VisitID] = record
+	m.logger.Info("subscriber %d is not covered, record for visit %d awaits payment\n",
+		record.SubscriberID, record.VisitID)
+}
+
+// isPaymentRequired reports whether the server rejected an upload for lack of payment.
+func isPaymentRequired(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusPaymentRequired
+}
+
+// paymentEvents subscribes to the payments recorded by the client if the
+// CoverageChecker publishes events, or returns nil.
+func (m *SyncManager) paymentEvents(ctx context.Context) <-chan Event {
+	if source, ok := m.coverage.(EventSource); ok {
+		return source.Events(ctx)
+	}
+	return nil
+}
+
+// resumePaid uploads the records of the subscriber of a recorded payment.
+func (m *SyncManager) resumePaid(ctx context.Context, event Event) {
+	if event.Type == EventPaymentRecorded && event.Payment != nil {
+		m.resume(ctx, event.Payment.SubscriberID)
+	}
+}
+
+// resumeCovered checks the coverage of the subscribers that waited for
+// CoverageRecheckInterval, e.g paid at another terminal, and uploads the
+// records of those covered again.
+func (m *SyncManager) resumeCovered(ctx context.Context) {
+	m.awaiting.mu.Lock()
+	var due []uint
+	for subscriberID, parked := range m.awaiting.subscribers {
+		if time.Since(parked.lastChecked) >= m.recheckInterval {
+			parked.lastChecked = time.Now()
+			due = append(due, subscriberID)
+		}
+	}
+	m.awaiting.mu.Unlock()
+
+	for _, subscriberID := range due {
+		status, err := m.coverage.CheckCoverage(ctx, subscriberID, time.Now())
+		if err != nil {
+			m.logger.Debug("unable to check coverage of subscriber %d: %v\n", subscriberID, err)
+			continue
+		}
+
+		if status.Active {
+			m.resume(ctx, subscriberID)
+		}
+	}
+}
+
+// resume uploads the parked records of a subscriber.
+// Records of a subscriber still not covered are parked again.
+func (m *SyncManager) resume(ctx context.Context, subscriberID uint) {
+	m.awaiting.mu.Lock()
+	parked, ok := m.awaiting.subscribers[subscriberID]
+	delete(m.awaiting.subscribers, subscriberID)
+	m.awaiting.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	ctx = WithBackgroundPriority(ctx)
+	m.logger.Info("resuming %d records of subscriber %d\n", len(parked.records), subscriberID)
+	for _, record := range parked.records {
+		if ctx.Err() != nil {
+			return
+		}
+		m.upload(ctx, record)
+	}
+}
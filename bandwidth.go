@@ -0,0 +1,155 @@
+package ecloudsdk
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BandwidthUsage is a snapshot of the bytes exchanged with ecloud on a given day.
+type BandwidthUsage struct {
+	Day      time.Time // Start of the day (local time) the usage applies to.
+	Sent     int64     // Request body bytes sent.
+	Received int64     // Response body bytes received.
+	Budget   int64     // Daily budget in bytes. Zero means unlimited.
+}
+
+// Total returns the bytes sent and received.
+func (u BandwidthUsage) Total() int64 {
+	return u.Sent + u.Received
+}
+
+// Exceeded reports whether the daily budget has been used up.
+func (u BandwidthUsage) Exceeded() bool {
+	return u.Budget > 0 && u.Total() >= u.Budget
+}
+
+// bandwidthAccountant tracks bytes transferred per day against a budget.
+// Counters reset at local midnight.
+type bandwidthAccountant struct {
+	mu     sync.Mutex
+	budget int64
+	usage  BandwidthUsage
+	now    func() time.Time
+}
+
+func newBandwidthAccountant(budget int64) *bandwidthAccountant {
+	return &bandwidthAccountant{budget: budget, now: time.Now}
+}
+
+// rollover resets the counters when a new day has started. Caller must hold mu.
+func (a *bandwidthAccountant) rollover() {
+	now := a.now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if !a.usage.Day.Equal(day) {
+		a.usage = BandwidthUsage{Day: day}
+	}
+	a.usage.Budget = a.budget
+}
+
+func (a *bandwidthAccountant) setBudget(budget int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.budget = budget
+}
+
+func (a *bandwidthAccountant) addSent(n int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rollover()
+	a.usage.Sent += n
+}
+
+func (a *bandwidthAccountant) addReceived(n int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rollover()
+	a.usage.Received += n
+}
+
+func (a *bandwidthAccountant) snapshot() BandwidthUsage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rollover()
+	return a.usage
+}
+
+// countingReader counts bytes read through it.
+type countingReader struct {
+	r     io.Reader
+	count func(n int64)
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	if n > 0 {
+		cr.count(int64(n))
+	}
+	return n, err
+}
+
+// countBody counts the bytes of the request body, including bodies replayed
+// by the transport with GetBody, without changing its ContentLength.
+// The transport doesn't close the body: it belongs to the caller, e.g a file
+// rewound for the next attempt.
+func countBody(req *http.Request, count func(n int64)) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+	req.Body = &countingReadCloser{countingReader{r: req.Body, count: count}, io.NopCloser(nil)}
+
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil || body == http.NoBody {
+				return body, err
+			}
+			return &countingReadCloser{countingReader{r: body, count: count}, body}, nil
+		}
+	}
+}
+
+// countingReadCloser counts bytes read from a request or response body.
+type countingReadCloser struct {
+	countingReader
+	io.Closer
+}
+
+type backgroundKey struct{}
+
+// WithBackgroundPriority marks requests made with the returned context as background traffic.
+// Background requests are refused with ErrBandwidthBudgetExceeded once the daily
+// bandwidth budget is used up, while foreground requests only log a warning.
+// The SyncManager and WatchSubscribers mark their own requests as background.
+func WithBackgroundPriority(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, true)
+}
+
+// IsBackgroundPriority reports whether ctx was marked with WithBackgroundPriority.
+func IsBackgroundPriority(ctx context.Context) bool {
+	background, _ := ctx.Value(backgroundKey{}).(bool)
+	return background
+}
+
+// BandwidthUsage returns the bytes exchanged with ecloud today.
+func (c *DefaultEcloudClient) BandwidthUsage() BandwidthUsage {
+	return c.bandwidth.snapshot()
+}
+
+// checkBandwidth enforces the daily bandwidth budget before a request is sent.
+func (c *DefaultEcloudClient) checkBandwidth(ctx context.Context) error {
+	usage := c.bandwidth.snapshot()
+	if !usage.Exceeded() {
+		return nil
+	}
+
+	if IsBackgroundPriority(ctx) {
+		return ErrBandwidthBudgetExceeded
+	}
+
+	logWarn(c.logger, "daily bandwidth budget of %d bytes exceeded (%d bytes used)\n",
+		usage.Budget, usage.Total())
+	return nil
+}
@@ -0,0 +1,118 @@
+package ecloudsdk
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultBatchConcurrency is the number of concurrent uploads of
+// SyncMedicalRecordsBatch when BatchOptions.Concurrency is zero.
+const DefaultBatchConcurrency = 4
+
+// BatchOptions configures SyncMedicalRecordsBatch.
+type BatchOptions struct {
+	// Maximum number of records uploaded at the same time.
+	// Defaults to DefaultBatchConcurrency.
+	Concurrency int
+
+	// Called as each record finishes, e.g to acknowledge it in the HMS or
+	// report progress. Calls are serialized. Optional.
+	OnResult func(result BatchResult)
+}
+
+// BatchResult is the outcome of the upload of a record of a batch.
+type BatchResult struct {
+	Record *PatientRecord
+	Err    error // Nil if the record was uploaded.
+}
+
+// Succeeded reports whether the record was uploaded.
+func (r BatchResult) Succeeded() bool {
+	return r.Err == nil
+}
+
+// BatchReport is the outcome of SyncMedicalRecordsBatch.
+type BatchReport struct {
+	Results   []BatchResult // One per record, in the order of the records.
+	Succeeded int           // Number of records uploaded.
+	Failed    int           // Number of records that failed, see Failures.
+}
+
+// Failures returns the results of the records that failed.
+func (r *BatchReport) Failures() []BatchResult {
+	var failures []BatchResult
+	for _, result := range r.Results {
+		if !result.Succeeded() {
+			failures = append(failures, result)
+		}
+	}
+	return failures
+}
+
+// SyncMedicalRecordsBatch uploads records concurrently with a bounded pool of
+// workers, each record as with SyncMedicalRecords. A failed record doesn't
+// stop the others; once ctx is done, the remaining records fail with its error.
+//
+// The report lists the outcome of every record. The returned error is non-nil
+// if any record failed.
+func (c *DefaultEcloudClient) SyncMedicalRecordsBatch(ctx context.Context, records []*PatientRecord,
+	opts BatchOptions) (*BatchReport, error) {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	report := &BatchReport{Results: make([]BatchResult, len(records))}
+	indexes := make(chan int)
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for range min(concurrency, len(records)) {
+		wg.Go(func() {
+			for i := range indexes {
+				err := ctx.Err()
+				if err == nil {
+					err = c.SyncMedicalRecords(ctx, records[i])
+				}
+				if err != nil {
+					err = fmt.Errorf("visit %d: %w", visitIDOf(records[i]), err)
+				}
+
+				mu.Lock()
+				result := BatchResult{Record: records[i], Err: err}
+				report.Results[i] = result
+				if err != nil {
+					report.Failed++
+				} else {
+					report.Succeeded++
+				}
+				if opts.OnResult != nil {
+					safeCall(c.logger, "BatchOptions.OnResult", func() { opts.OnResult(result) })
+				}
+				mu.Unlock()
+			}
+		})
+	}
+
+	for i := range records {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if report.Failed > 0 {
+		return report, fmt.Errorf("%d of %d records failed to sync", report.Failed, len(records))
+	}
+	return report, nil
+}
+
+// visitIDOf returns the VisitID of record, or zero if it is nil.
+func visitIDOf(record *PatientRecord) uint {
+	if record == nil {
+		return 0
+	}
+	return record.VisitID
+}
@@ -0,0 +1,72 @@
+package ecloudsdk
+
+import (
+	"errors"
+	"io"
+)
+
+// BodyFactory returns a fresh request body for each attempt of a request.
+// If the returned reader implements io.Closer, it is closed after the attempt.
+type BodyFactory func() (io.Reader, error)
+
+// NewRetryableBody returns a request body that is recreated with factory before
+// every attempt, so requests with generated bodies remain retry-safe.
+// It is meant to be passed to DefaultEcloudClient.Do.
+func NewRetryableBody(factory BodyFactory) io.Reader {
+	return &retryableBody{factory: factory}
+}
+
+type retryableBody struct {
+	factory BodyFactory
+	r       io.Reader
+	err     error
+}
+
+// Read reads from the first body of the factory, when used outside of the client.
+func (b *retryableBody) Read(p []byte) (int, error) {
+	if b.r == nil && b.err == nil {
+		b.r, b.err = b.factory()
+	}
+
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.r.Read(p)
+}
+
+// errBodyNotReplayable is returned by the factory of a body that cannot be sent again.
+var errBodyNotReplayable = errors.New("request body cannot be replayed")
+
+// bodyFactory returns the factory producing the body of each attempt:
+//   - bodies created with NewRetryableBody use their factory;
+//   - io.Seeker bodies are rewound to their initial offset;
+//   - other bodies can only be sent once.
+func bodyFactory(body io.Reader) (factory BodyFactory, replayable bool, err error) {
+	switch b := body.(type) {
+	case nil:
+		return func() (io.Reader, error) { return nil, nil }, true, nil
+	case *retryableBody:
+		return b.factory, true, nil
+	case io.Seeker:
+		offset, err := b.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return func() (io.Reader, error) {
+			if _, err := b.Seek(offset, io.SeekStart); err != nil {
+				return nil, err
+			}
+			return body, nil
+		}, true, nil
+	}
+
+	sent := false
+	return func() (io.Reader, error) {
+		if sent {
+			return nil, errBodyNotReplayable
+		}
+		sent = true
+		return body, nil
+	}, false, nil
+}
@@ -0,0 +1,196 @@
+package ecloudsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Retries of each warm-up step, backing off exponentially from warmUpBaseDelay.
+const (
+	warmUpRetries   = 4
+	warmUpBaseDelay = time.Second
+	warmUpMaxDelay  = time.Minute
+)
+
+// lookupCache keeps the results of frequent lookups (GetBill, GetSubscriber and
+// GetPendingSubscribers) for Config.CacheTTL. Writes through the client
+// invalidate the entries they affect.
+type lookupCache struct {
+	mu          sync.Mutex
+	bill        cacheEntry[Bill]
+	pending     cacheEntry[[]*Subscriber]
+	subscribers map[uint]cacheEntry[Subscriber]
+}
+
+type cacheEntry[T any] struct {
+	value   T
+	expires time.Time
+}
+
+func (e cacheEntry[T]) fresh(now time.Time) bool {
+	return now.Before(e.expires)
+}
+
+func (l *lookupCache) getBill(now time.Time) (*Bill, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.bill.fresh(now) {
+		return nil, false
+	}
+	bill := l.bill.value
+	return &bill, true
+}
+
+func (l *lookupCache) putBill(bill Bill, expires time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bill = cacheEntry[Bill]{value: bill, expires: expires}
+}
+
+func (l *lookupCache) getSubscriber(id uint, now time.Time) (*Subscriber, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.subscribers[id]
+	if !ok || !entry.fresh(now) {
+		return nil, false
+	}
+	subscriber := entry.value
+	return &subscriber, true
+}
+
+func (l *lookupCache) putSubscribers(subscribers []*Subscriber, expires time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.subscribers == nil {
+		l.subscribers = make(map[uint]cacheEntry[Subscriber])
+	}
+	for _, subscriber := range subscribers {
+		l.subscribers[subscriber.ID] = cacheEntry[Subscriber]{value: *subscriber, expires: expires}
+	}
+}
+
+func (l *lookupCache) getPending(now time.Time) ([]*Subscriber, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.pending.fresh(now) {
+		return nil, false
+	}
+	return cloneSubscribers(l.pending.value), true
+}
+
+func (l *lookupCache) putPending(subscribers []*Subscriber, expires time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending = cacheEntry[[]*Subscriber]{value: cloneSubscribers(subscribers), expires: expires}
+}
+
+// invalidate drops the entries a write may have changed: the bill, the pending
+// list and the subscriber with the given ID, if not zero.
+func (l *lookupCache) invalidate(subscriberID uint) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.bill = cacheEntry[Bill]{}
+	l.pending = cacheEntry[[]*Subscriber]{}
+	delete(l.subscribers, subscriberID)
+}
+
+// reset drops every entry.
+func (l *lookupCache) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.bill = cacheEntry[Bill]{}
+	l.pending = cacheEntry[[]*Subscriber]{}
+	l.subscribers = nil
+}
+
+// cloneSubscribers copies the subscribers so callers can't modify cached values.
+func cloneSubscribers(subscribers []*Subscriber) []*Subscriber {
+	clones := slices.Clone(subscribers)
+	for i, subscriber := range clones {
+		clone := *subscriber
+		clones[i] = &clone
+	}
+	return clones
+}
+
+// cacheExpiry returns when entries cached now expire, or false if caching is disabled.
+func (c *DefaultEcloudClient) cacheExpiry() (time.Time, bool) {
+	ttl := c.cfg().CacheTTL
+	if ttl <= 0 {
+		return time.Time{}, false
+	}
+	return time.Now().Add(ttl), true
+}
+
+// WarmUp pre-fetches the bill, the hospital's subscribers (page by page) and the
+// pending subscribers into the lookup cache, so the first lookups of the day are
+// served from memory. It requires Config.CacheTTL and is meant to run in the
+// background after Login:
+//
+//	go client.WarmUp(ctx)
+//
+// Requests are marked with WithBackgroundPriority. Failed steps are retried with
+// exponential backoff, then skipped; their errors are joined in the result.
+func (c *DefaultEcloudClient) WarmUp(ctx context.Context) error {
+	if c.cfg().CacheTTL <= 0 {
+		return fmt.Errorf("cache warm-up requires Config.CacheTTL")
+	}
+
+	ctx = WithBackgroundPriority(ctx)
+	steps := []struct {
+		name  string
+		fetch func(ctx context.Context) error
+	}{
+		{"bill", func(ctx context.Context) error {
+			_, err := c.GetBill(ctx)
+			return err
+		}},
+		{"subscribers", func(ctx context.Context) error {
+			expires, _ := c.cacheExpiry()
+			for subscriber, err := range c.AllSubscribers(ctx, nil, nil) {
+				if err != nil {
+					return err
+				}
+				c.cache.putSubscribers([]*Subscriber{subscriber}, expires)
+			}
+			return nil
+		}},
+		{"pending subscribers", func(ctx context.Context) error {
+			_, err := c.GetPendingSubscribers(ctx)
+			return err
+		}},
+	}
+
+	policy := NewBackoffPolicy(warmUpRetries, warmUpBaseDelay, warmUpMaxDelay)
+
+	var errs []error
+	for _, step := range steps {
+		for attempt := 0; ; attempt++ {
+			err := step.fetch(ctx)
+			if err == nil {
+				break
+			}
+
+			if attempt >= warmUpRetries || !backoff(ctx, policy, attempt, nil) {
+				c.logger.Error("cache warm-up: unable to fetch %s: %v\n", step.name, err)
+				errs = append(errs, fmt.Errorf("unable to warm up %s: %w", step.name, err))
+				break
+			}
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
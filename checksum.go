@@ -0,0 +1,49 @@
+package ecloudsdk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// ReportSHA256Header carries the checksums of the reports of an upload as
+// comma separated field=hex pairs, e.g "lab_report=9f86d0...". It is only set
+// when every report is held in memory; the checksums of streamed reports are
+// only known once they are sent, so they are sent as form fields instead.
+const ReportSHA256Header = "X-Report-SHA256"
+
+// checksumFieldSuffix names the form field carrying the hex SHA-256 of a
+// report, e.g "lab_report_sha256".
+const checksumFieldSuffix = "_sha256"
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// checksumHeader returns the value of ReportSHA256Header for the reports,
+// or "" if a report is streamed.
+func checksumHeader(parts []reportPart) string {
+	pairs := make([]string, len(parts))
+	for i, part := range parts {
+		if part.sha256 == "" {
+			return ""
+		}
+		pairs[i] = part.field + "=" + part.sha256
+	}
+	return strings.Join(pairs, ",")
+}
+
+// verifyChecksums compares the checksums of the reports stored by the server,
+// by field, with those that were sent. Reports without a checksum in the
+// response are not verified, e.g with servers that don't return them.
+func verifyChecksums(sent, stored map[string]string) error {
+	for field, checksum := range stored {
+		if want, ok := sent[field]; ok && !strings.EqualFold(want, checksum) {
+			return fmt.Errorf("%w: %s sent with SHA-256 %s, stored with %s", ErrChecksumMismatch,
+				field, want, checksum)
+		}
+	}
+	return nil
+}
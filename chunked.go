@@ -0,0 +1,567 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+)
+
+// Defaults of ChunkedUploadOptions.
+const (
+	DefaultChunkSize              = 4 << 20
+	DefaultChunkedUploadThreshold = 16 << 20
+)
+
+// ChunkSHA256Header carries the hex SHA-256 of the chunk of a chunked upload.
+const ChunkSHA256Header = "X-Chunk-SHA256"
+
+// ChunkedUploadOptions configures UploadLargeReport.
+type ChunkedUploadOptions struct {
+	// Size of the chunks in bytes, capped at Capabilities.MaxChunkSize.
+	// Defaults to DefaultChunkSize.
+	ChunkSize int64
+
+	// Records whose reports total fewer bytes are uploaded in a single request
+	// as with SyncMedicalRecords. Defaults to DefaultChunkedUploadThreshold;
+	// a negative threshold chunks every record.
+	Threshold int64
+
+	// Upload to resume, from the UploadAbortedError of an earlier call.
+	// Chunks the server already received are skipped. A new upload is started
+	// if the server no longer has it, or if reports are encrypted: every call
+	// encrypts them with a new data key.
+	UploadID string
+}
+
+// UploadLargeReport uploads a record whose reports are too large to reliably
+// upload in one request, e.g scanned reports over a slow link. The reports are
+// sent in chunks, each with its checksum, so a failure only repeats the chunk
+// that failed rather than the whole upload.
+//
+// If the upload is interrupted, the error is an *UploadAbortedError; pass its
+// UploadID in opts to resume from the last chunk the server received, or
+// discard it with AbortUpload.
+//
+// Records under opts.Threshold, and all records if the deployment doesn't
+// support chunked uploads (see Capabilities), are uploaded with
+// SyncMedicalRecords instead. The record is validated as with
+// SyncMedicalRecords and EventRecordSynced is published once it is uploaded.
+func (c *DefaultEcloudClient) UploadLargeReport(ctx context.Context, patientRecord *PatientRecord,
+	opts *ChunkedUploadOptions) (err error) {
+	ctx, span := c.startSpan(ctx, "UploadLargeReport")
+	defer func() { span.end(err) }()
+
+	if opts == nil {
+		opts = &ChunkedUploadOptions{}
+	}
+
+	threshold := cmp.Or(opts.Threshold, DefaultChunkedUploadThreshold)
+	if opts.UploadID == "" && patientRecord != nil {
+		size, known := reportsSize(patientRecord, c.cfg().UploadMedicalReport)
+		if known && size < threshold {
+			return c.SyncMedicalRecords(ctx, patientRecord)
+		}
+	}
+
+	caps, err := c.GetCapabilities(ctx)
+	if err != nil {
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			return err
+		}
+		caps = &Capabilities{} // Deployments predating capabilities.
+	}
+
+	if !caps.ChunkedUploads {
+		return c.SyncMedicalRecords(ctx, patientRecord)
+	}
+
+	chunkSize := cmp.Or(opts.ChunkSize, DefaultChunkSize)
+	if caps.MaxChunkSize > 0 {
+		chunkSize = min(chunkSize, caps.MaxChunkSize)
+	}
+
+	record, err := c.prepareRecord(ctx, patientRecord)
+	if err != nil {
+		return err
+	}
+
+	files, err := c.chunkFiles(ctx, record)
+	defer closeChunkFiles(files)
+	if err != nil {
+		return err
+	}
+
+	// Encryption uses a new data key for every call, so the chunks already
+	// uploaded can't be completed.
+	uploadID := opts.UploadID
+	if uploadID != "" && c.keyProvider() != nil {
+		logWarn(c.logger, "encrypted upload %s can't be resumed, restarting it\n", uploadID)
+		if err := c.AbortUpload(ctx, uploadID); err != nil {
+			c.logger.Error("unable to abort upload %s: %v\n", uploadID, err)
+		}
+		uploadID = ""
+	}
+
+	var session *uploadSession
+	if uploadID != "" {
+		if session, err = c.resumeUpload(ctx, uploadID, files); err != nil {
+			return err
+		}
+	}
+
+	if session == nil {
+		if session, err = c.createUpload(ctx, record, files); err != nil {
+			return err
+		}
+	}
+
+	var total int64
+	for _, file := range files {
+		total += file.size
+	}
+
+	// Chunks received before a resume count as done.
+	progress := c.newProgress(ctx, "UploadLargeReport", syncedRecord(record, 0, c.cfg().HospitalNumber), total)
+	var done int64
+	for _, file := range files {
+		err := c.uploadChunks(ctx, session.ID, file, session.offset(file.field), chunkSize, func(offset int64) {
+			progress.set(done + offset)
+		})
+		if err != nil {
+			return &UploadAbortedError{UploadID: session.ID, Cause: err}
+		}
+		done += file.size
+	}
+
+	synced, err := c.completeUpload(ctx, session.ID, record, files)
+	if err != nil {
+		return &UploadAbortedError{UploadID: session.ID, Cause: err}
+	}
+
+	c.publish(ctx, Event{Type: EventRecordSynced, Record: synced})
+	return nil
+}
+
+// reportsSize returns the total size of the reports and attachments of
+// record, or false if one is a reader of unknown size.
+func reportsSize(record *PatientRecord, includeMedical bool) (int64, bool) {
+	size := int64(len(record.LabReport))
+	readers := []io.Reader{record.LabReportReader}
+	if includeMedical {
+		size += int64(len(record.MedicalReport))
+		readers = append(readers, record.MedicalReportReader)
+	}
+
+	for _, a := range record.Attachments {
+		if a.Data != nil {
+			size += int64(len(a.Data))
+		} else {
+			readers = append(readers, a.Reader)
+		}
+	}
+
+	for _, r := range readers {
+		if r == nil {
+			continue
+		}
+
+		n := readerSize(r)
+		if n < 0 {
+			return 0, false
+		}
+		size += n
+	}
+	return size, true
+}
+
+// readerSize returns the number of bytes left in r if it implements
+// io.Seeker, or -1.
+func readerSize(r io.Reader) int64 {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return -1
+	}
+
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if _, seekErr := seeker.Seek(offset, io.SeekStart); err != nil || seekErr != nil {
+		return -1
+	}
+	return end - offset
+}
+
+// chunkFile is a report of a chunked upload.
+type chunkFile struct {
+	field  string
+	r      io.ReaderAt
+	size   int64
+	sha256 string // Hex SHA-256 of the whole report.
+
+	spool *os.File // Copy of a report that can't be read at an offset.
+}
+
+func closeChunkFiles(files []*chunkFile) {
+	for _, file := range files {
+		if file.spool != nil {
+			file.spool.Close()
+			os.Remove(file.spool.Name())
+		}
+	}
+}
+
+// chunkFiles validates the reports and attachments of the record, encrypted
+// if report encryption is on, and returns them in upload order. Files given as
+// io.Reader are read once to validate and checksum them, and copied to a
+// temporary file if encrypted or unless they implement io.ReaderAt and
+// io.Seeker (e.g *os.File).
+func (c *DefaultEcloudClient) chunkFiles(ctx context.Context, record *PatientRecord) ([]*chunkFile, error) {
+	maxSize := c.maxReportSize()
+
+	type report struct {
+		field    string
+		data     []byte
+		r        io.Reader
+		validate func(data []byte) error // Validates data.
+		stream   streamValidator         // Validates r.
+	}
+
+	pdfReport := func(field string, data []byte, r io.Reader, invalid error) report {
+		validate := func(data []byte) error {
+			if err := checkContentType(field, pdfContentType, data); err != nil {
+				return err
+			}
+			return validatePDF(data, invalid, maxSize)
+		}
+		return report{field, data, r, validate, pdfStream(field, invalid, maxSize)}
+	}
+
+	var reports []report
+	if c.cfg().UploadMedicalReport {
+		reports = append(reports, pdfReport(medicalReportFieldName, record.MedicalReport,
+			record.MedicalReportReader, ErrInvalidMedicalReportPDF))
+	}
+	reports = append(reports, pdfReport(labReportFieldName, record.LabReport, record.LabReportReader,
+		ErrInvalidLabReportPDF))
+
+	for i := range record.Attachments {
+		a, field := &record.Attachments[i], attachmentFieldName(i)
+		validate := func(data []byte) error { return validateAttachment(field, a, data, maxSize) }
+		reports = append(reports, report{field, a.Data, a.Reader, validate, attachmentStream(field, a, maxSize)})
+	}
+
+	var files []*chunkFile
+	for _, report := range reports {
+		var sealer *reportSealer
+		if c.keyProvider() != nil && (report.data != nil || report.r != nil) {
+			var err error
+			if sealer, err = c.newReportSealer(ctx, report.field); err != nil {
+				return files, err
+			}
+		}
+
+		switch {
+		case report.data != nil:
+			if err := report.validate(report.data); err != nil {
+				return files, err
+			}
+
+			data := report.data
+			if sealer != nil {
+				var err error
+				if data, err = io.ReadAll(sealer.seal(bytes.NewReader(data))); err != nil {
+					return files, fmt.Errorf("unable to encrypt %s: %w", report.field, err)
+				}
+			}
+
+			files = append(files, &chunkFile{field: report.field, r: bytes.NewReader(data),
+				size: int64(len(data)), sha256: sha256Hex(data)})
+		case report.r != nil:
+			file, err := streamChunkFile(report.field, report.r, report.stream, sealer)
+			if file != nil {
+				files = append(files, file)
+			}
+			if err != nil {
+				return files, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// streamChunkFile validates and checksums a streamed file, encrypting it
+// with sealer unless it is nil.
+func streamChunkFile(field string, r io.Reader, validate streamValidator, sealer *reportSealer) (*chunkFile, error) {
+	file := &chunkFile{field: field}
+
+	var offset int64
+	ra, isReaderAt := r.(io.ReaderAt)
+	seeker, isSeeker := r.(io.Seeker)
+	if isReaderAt && isSeeker {
+		var err error
+		if offset, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", field, err)
+		}
+	}
+
+	validated, err := validate(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Encrypted reports are uploaded from their encrypted copy.
+	if sealer != nil {
+		validated, isReaderAt = sealer.seal(validated), false
+	}
+
+	hash := sha256.New()
+	var w io.Writer = hash
+	if !isReaderAt || !isSeeker {
+		file.spool, err = os.CreateTemp("", "ecloud-upload-*")
+		if err != nil {
+			return nil, fmt.Errorf("unable to buffer %s: %w", field, err)
+		}
+		ra, offset = file.spool, 0
+		w = io.MultiWriter(hash, file.spool)
+	}
+
+	// Failed checks of the PDF are returned as read errors.
+	file.size, err = io.Copy(w, validated)
+	if err != nil {
+		return file, err
+	}
+
+	file.r = io.NewSectionReader(ra, offset, file.size)
+	file.sha256 = hex.EncodeToString(hash.Sum(nil))
+	return file, nil
+}
+
+// uploadFile is the state of a report in an upload session.
+type uploadFile struct {
+	Field  string `json:"field"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	Offset int64  `json:"offset"` // Number of bytes received by the server.
+}
+
+// uploadSession is a chunked upload on the server.
+type uploadSession struct {
+	ID    string       `json:"id"`
+	Files []uploadFile `json:"files"`
+}
+
+// offset returns the number of bytes of a report received by the server.
+func (s *uploadSession) offset(field string) int64 {
+	for _, file := range s.Files {
+		if file.Field == field {
+			return file.Offset
+		}
+	}
+	return 0
+}
+
+// createUpload starts a chunked upload of the record.
+func (c *DefaultEcloudClient) createUpload(ctx context.Context, record *PatientRecord,
+	files []*chunkFile) (*uploadSession, error) {
+	payload := map[string]any{}
+	for _, field := range c.recordFields(record) {
+		payload[field[0]] = field[1]
+	}
+
+	uploads := make([]uploadFile, len(files))
+	for i, file := range files {
+		uploads[i] = uploadFile{Field: file.field, Size: file.size, SHA256: file.sha256}
+	}
+	payload["files"] = uploads
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	url := c.cfg().ApiBaseUrl + "/api/uploads"
+	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, c.decodeError(resp)
+	}
+
+	session := &uploadSession{}
+	err = json.NewDecoder(resp.Body).Decode(session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+
+	if session.ID == "" {
+		return nil, fmt.Errorf("unable to start upload: no upload id in response")
+	}
+	return session, nil
+}
+
+// resumeUpload fetches the state of an interrupted upload of the given
+// reports, or nil if the server no longer has it.
+func (c *DefaultEcloudClient) resumeUpload(ctx context.Context, uploadID string,
+	files []*chunkFile) (*uploadSession, error) {
+	url := fmt.Sprintf("%s/api/uploads/%s", c.cfg().ApiBaseUrl, neturl.PathEscape(uploadID))
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resume upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		logWarn(c.logger, "upload %s no longer exists, restarting it\n", uploadID)
+		return nil, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	session := &uploadSession{}
+	err = json.NewDecoder(resp.Body).Decode(session)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	session.ID = uploadID
+
+	// Never append the chunks of a report to the upload of another.
+	for _, file := range files {
+		i := 0
+		for i < len(session.Files) && session.Files[i].Field != file.field {
+			i++
+		}
+		if i == len(session.Files) || session.Files[i].SHA256 != file.sha256 {
+			return nil, fmt.Errorf("unable to resume upload %s: it is not an upload of this record's %s",
+				uploadID, file.field)
+		}
+	}
+	return session, nil
+}
+
+// uploadChunks uploads a report from offset to its end, calling uploaded with
+// the server's offset after each chunk. Each chunk is retried as configured;
+// the server's offset wins if it disagrees.
+func (c *DefaultEcloudClient) uploadChunks(ctx context.Context, uploadID string, file *chunkFile,
+	offset, chunkSize int64, uploaded func(offset int64)) error {
+	url := fmt.Sprintf("%s/api/uploads/%s/files/%s", c.cfg().ApiBaseUrl, neturl.PathEscape(uploadID), file.field)
+	rate := c.cfg().UploadRateLimit
+	buf := make([]byte, min(chunkSize, file.size))
+
+	for offset < file.size {
+		chunk := buf[:min(chunkSize, file.size-offset)]
+		if _, err := file.r.ReadAt(chunk, offset); err != nil && err != io.EOF {
+			return fmt.Errorf("unable to read %s: %w", file.field, err)
+		}
+
+		sum := sha256.Sum256(chunk)
+		headers := map[string]string{
+			"Content-Type":    "application/octet-stream",
+			"Content-Range":   fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(len(chunk))-1, file.size),
+			ChunkSHA256Header: hex.EncodeToString(sum[:]),
+		}
+
+		body := NewRetryableBody(func() (io.Reader, error) {
+			return newThrottledReader(ctx, bytes.NewReader(chunk), rate), nil
+		})
+		resp, err := c.performRequest(ctx, http.MethodPut, url, body, headers)
+		if err != nil {
+			return fmt.Errorf("unable to upload %s at offset %d: %w", file.field, offset, err)
+		}
+
+		next, err := c.chunkOffset(resp)
+		if err != nil {
+			return err
+		}
+
+		// A conflict reports the offset the server expects, e.g after a chunk
+		// was received but its response lost.
+		if next == offset || next < 0 || next > file.size {
+			return fmt.Errorf("unable to upload %s: server expects offset %d of %d", file.field, next, file.size)
+		}
+		offset = next
+		uploaded(offset)
+	}
+	return nil
+}
+
+// chunkOffset returns the offset the server expects next from the response
+// to a chunk, accepted (200) or conflicting with the server's offset (409).
+func (c *DefaultEcloudClient) chunkOffset(resp *http.Response) (int64, error) {
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read response: %w", err)
+	}
+
+	var result struct {
+		Offset *int64 `json:"offset"`
+	}
+	decodeErr := json.Unmarshal(data, &result)
+
+	switch {
+	case resp.StatusCode == http.StatusOK && decodeErr != nil:
+		return 0, fmt.Errorf("unable to decode json: %w", decodeErr)
+	case (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusConflict) && result.Offset != nil:
+		return *result.Offset, nil
+	case resp.StatusCode == http.StatusOK:
+		return 0, fmt.Errorf("unable to decode json: no offset in response")
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return 0, c.decodeError(resp)
+}
+
+// completeUpload finalizes an upload once the server has all of its chunks
+// and returns the metadata of the record, see syncedRecord.
+func (c *DefaultEcloudClient) completeUpload(ctx context.Context, uploadID string,
+	record *PatientRecord, files []*chunkFile) (*PatientRecord, error) {
+	url := fmt.Sprintf("%s/api/uploads/%s/complete", c.cfg().ApiBaseUrl, neturl.PathEscape(uploadID))
+	resp, err := c.performRequest(ctx, http.MethodPost, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to complete upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	// The body carries the record ID, the checksums of the stored reports
+	// and the warnings, if any.
+	var envelope struct {
+		ID        uint              `json:"id"`
+		Checksums map[string]string `json:"checksums"`
+		warningsEnvelope
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err == nil {
+		c.reportWarnings("UploadLargeReport", envelope.Warnings)
+	}
+
+	checksums := make(map[string]string, len(files))
+	for _, file := range files {
+		checksums[file.field] = file.sha256
+	}
+	if err := verifyChecksums(checksums, envelope.Checksums); err != nil {
+		return nil, err
+	}
+	return syncedRecord(record, envelope.ID, c.cfg().HospitalNumber), nil
+}
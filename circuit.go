@@ -0,0 +1,236 @@
+package ecloudsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults of CircuitBreakerPolicy.
+const (
+	DefaultFailureThreshold = 5
+	DefaultOpenTimeout      = 30 * time.Second
+)
+
+// CircuitBreaker stops requests to a failing server so they fail fast with
+// ErrCircuitOpen instead of waiting on timeouts and retries.
+// Set it with Config.CircuitBreaker. Implementations must be safe for concurrent use.
+type CircuitBreaker interface {
+	// Allow is called before each attempt. It returns an error wrapping
+	// ErrCircuitOpen to reject the attempt, or a function that is called
+	// with the outcome of the attempt.
+	Allow(req *http.Request) (done func(resp *http.Response, err error), err error)
+}
+
+// CircuitOpenError is returned when a request is rejected by the circuit breaker.
+type CircuitOpenError struct {
+	Circuit string    // The host or endpoint whose circuit is open.
+	RetryAt time.Time // When a probe request will be let through.
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: %s until %s", ErrCircuitOpen, e.Circuit, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitBreakerPolicy is the default CircuitBreaker.
+//
+// A circuit opens after FailureThreshold consecutive failures (network errors
+// and 5xx responses) and rejects requests for OpenTimeout. It then turns
+// half-open: up to HalfOpenProbes requests are let through and the circuit
+// closes once they all succeed, or opens again on the first failure.
+// Canceled requests don't count either way.
+type CircuitBreakerPolicy struct {
+	// Keep a circuit per endpoint (method and path, with numeric IDs
+	// ignored) rather than per host, so one broken endpoint doesn't block
+	// the others.
+	PerEndpoint bool
+
+	// Consecutive failures that open a circuit. Defaults to DefaultFailureThreshold.
+	FailureThreshold int
+
+	// How long an open circuit rejects requests. Defaults to DefaultOpenTimeout.
+	OpenTimeout time.Duration
+
+	// Requests let through while half-open. Defaults to 1.
+	HalfOpenProbes int
+
+	now func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// NewCircuitBreakerPolicy returns a per-host circuit breaker opening after threshold
+// consecutive failures for openTimeout.
+func NewCircuitBreakerPolicy(threshold int, openTimeout time.Duration) *CircuitBreakerPolicy {
+	return &CircuitBreakerPolicy{FailureThreshold: threshold, OpenTimeout: openTimeout}
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type circuit struct {
+	state     circuitState
+	failures  int       // Consecutive failures while closed.
+	openedAt  time.Time // When the circuit last opened.
+	probes    int       // Probes in flight while half-open.
+	successes int       // Successful probes while half-open.
+
+	// Incremented on every state change, so outcomes of requests allowed
+	// in a previous state are ignored.
+	generation int
+}
+
+// Allow implements CircuitBreaker.
+func (p *CircuitBreakerPolicy) Allow(req *http.Request) (func(*http.Response, error), error) {
+	key := p.key(req)
+	now := p.clock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.circuits == nil {
+		p.circuits = make(map[string]*circuit)
+	}
+
+	c := p.circuits[key]
+	if c == nil {
+		c = &circuit{}
+		p.circuits[key] = c
+	}
+
+	if c.state == circuitOpen {
+		retryAt := c.openedAt.Add(p.openTimeout())
+		if now.Before(retryAt) {
+			return nil, &CircuitOpenError{Circuit: key, RetryAt: retryAt}
+		}
+		c.setState(circuitHalfOpen)
+	}
+
+	if c.state == circuitHalfOpen {
+		if c.probes >= p.halfOpenProbes() {
+			return nil, &CircuitOpenError{Circuit: key, RetryAt: now.Add(p.openTimeout())}
+		}
+		c.probes++
+	}
+
+	generation := c.generation
+	return func(resp *http.Response, err error) {
+		p.record(c, generation, attemptOutcome(req.Context(), resp, err))
+	}, nil
+}
+
+// record updates the circuit with the outcome of a request.
+func (p *CircuitBreakerPolicy) record(c *circuit, generation int, result outcome) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if c.generation != generation {
+		return
+	}
+
+	switch c.state {
+	case circuitClosed:
+		switch result {
+		case outcomeCanceled:
+			return
+		case outcomeSuccess:
+			c.failures = 0
+			return
+		}
+
+		c.failures++
+		if c.failures >= p.failureThreshold() {
+			c.setState(circuitOpen)
+			c.openedAt = p.clock()
+		}
+	case circuitHalfOpen:
+		c.probes--
+		switch result {
+		case outcomeCanceled:
+			return
+		case outcomeFailure:
+			c.setState(circuitOpen)
+			c.openedAt = p.clock()
+			return
+		}
+
+		c.successes++
+		if c.successes >= p.halfOpenProbes() {
+			c.setState(circuitClosed)
+		}
+	}
+}
+
+func (c *circuit) setState(state circuitState) {
+	c.state = state
+	c.failures, c.probes, c.successes = 0, 0, 0
+	c.generation++
+}
+
+type outcome int
+
+const (
+	outcomeSuccess  outcome = iota
+	outcomeFailure          // Network errors and 5xx responses.
+	outcomeCanceled         // Canceled by the caller, doesn't count.
+)
+
+func attemptOutcome(ctx context.Context, resp *http.Response, err error) outcome {
+	switch {
+	case err != nil && (ctx.Err() != nil || errors.Is(err, context.Canceled)):
+		return outcomeCanceled
+	case err != nil, resp.StatusCode >= http.StatusInternalServerError:
+		return outcomeFailure
+	default:
+		return outcomeSuccess
+	}
+}
+
+func (p *CircuitBreakerPolicy) key(req *http.Request) string {
+	if !p.PerEndpoint {
+		return req.URL.Host
+	}
+
+	return req.Method + " " + req.URL.Host + endpointPattern(req.URL.Path)
+}
+
+func (p *CircuitBreakerPolicy) clock() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+func (p *CircuitBreakerPolicy) failureThreshold() int {
+	if p.FailureThreshold > 0 {
+		return p.FailureThreshold
+	}
+	return DefaultFailureThreshold
+}
+
+func (p *CircuitBreakerPolicy) openTimeout() time.Duration {
+	if p.OpenTimeout > 0 {
+		return p.OpenTimeout
+	}
+	return DefaultOpenTimeout
+}
+
+func (p *CircuitBreakerPolicy) halfOpenProbes() int {
+	if p.HalfOpenProbes > 0 {
+		return p.HalfOpenProbes
+	}
+	return 1
+}
@@ -0,0 +1,87 @@
+package ecloudsdk
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentUse exercises the client from many goroutines at once.
+// Run with -race to detect data races.
+func TestConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/api/auth/login":
+			return newJSONResponse(http.StatusOK, `{"token": "test-token", "user": {"id": 1, "eclinic_id": "test-id"}}`), nil
+		case "/api/billing/get_bill":
+			return newJSONResponse(http.StatusOK, `{"Amount": 5000}`), nil
+		case "/api/subscriptions":
+			return newJSONResponse(http.StatusOK, `{"id": 1, "patient_id": 2}`), nil
+		case "/api/records":
+			return newJSONResponse(http.StatusOK, `{}`), nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error":"not found"}`), nil
+	})
+	client.(*DefaultEcloudClient).retryPolicy = &noBackoffRetryPolicy{DefaultRetryPolicy{maxRetries: 1}}
+
+	if _, err := client.Login(ctx); err != nil {
+		t.Fatalf("Login() failed: %v", err)
+	}
+
+	operations := []func() error{
+		func() error {
+			_, err := client.Login(ctx)
+			return err
+		},
+		func() error {
+			_, err := client.GetBill(ctx)
+			return err
+		},
+		func() error {
+			_, err := client.Subscribe(ctx, &SubscribeRequest{PatientID: 2, PatientName: "Jane", RegisteredBy: "reception"})
+			return err
+		},
+		func() error {
+			return client.SyncMedicalRecords(ctx, &PatientRecord{
+				VisitID: 1, SubscriberID: 1, Title: "Lab", VisitTimestamp: time.Now(), LabReport: validPDFBytes,
+			})
+		},
+		func() error {
+			return client.Refresh(ctx)
+		},
+		func() error {
+			client.IsAuthenticated()
+			client.GetToken()
+			client.TokenExpiresAt()
+			client.BandwidthUsage()
+			client.Config()
+			_, err := client.GetUser()
+			return err
+		},
+		func() error {
+			return client.UpdateConfig(ctx, func(c *Config) {
+				c.Timeout = 10 * time.Second
+			})
+		},
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		for _, operation := range operations {
+			wg.Go(func() {
+				if err := operation(); err != nil {
+					t.Errorf("concurrent operation failed: %v", err)
+				}
+			})
+		}
+	}
+	wg.Wait()
+
+	if !client.IsAuthenticated() || client.GetToken() != "test-token" {
+		t.Error("expected the client to remain authenticated")
+	}
+}
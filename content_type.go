@@ -0,0 +1,65 @@
+package ecloudsdk
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// ContentTypeMismatchError is returned when an attachment's content does not match
+// the type expected for its field, e.g a Word document renamed to .pdf.
+// It matches ErrContentTypeMismatch with errors.Is.
+type ContentTypeMismatchError struct {
+	Field    string // Multipart field name e.g "lab_report".
+	Expected string // Expected MIME type.
+	Detected string // MIME type sniffed from the content.
+}
+
+func (e *ContentTypeMismatchError) Error() string {
+	return fmt.Sprintf("%s: expected content type %s, detected %s", e.Field, e.Expected, e.Detected)
+}
+
+func (e *ContentTypeMismatchError) Unwrap() error {
+	return ErrContentTypeMismatch
+}
+
+// sniffContentType detects the MIME type of data, without parameters.
+func sniffContentType(data []byte) string {
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// checkContentType returns a *ContentTypeMismatchError if data is confidently
+// identified as something other than the expected type.
+// Content that cannot be identified (plain text or octet-stream) is left to the
+// format specific validation.
+func checkContentType(field, expected string, data []byte) error {
+	detected := sniffContentType(data)
+	if detected == expected || detected == "text/plain" || detected == "application/octet-stream" {
+		return nil
+	}
+	return &ContentTypeMismatchError{Field: field, Expected: expected, Detected: detected}
+}
+
+// createFormFile is like multipart.Writer.CreateFormFile but sets the
+// part's Content-Type instead of application/octet-stream.
+func createFormFile(writer *multipart.Writer, field, filename, contentType string) (io.Writer, error) {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		escapeQuotes(field), escapeQuotes(filename)))
+	header.Set("Content-Type", contentType)
+	return writer.CreatePart(header)
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,117 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"time"
+)
+
+// CoverageWindow is a continuous period during which a subscriber's records are accessible.
+// Overlapping or back-to-back payments are merged into a single window.
+type CoverageWindow struct {
+	From time.Time `json:"valid_from"` // Start of the window (inclusive).
+	To   time.Time `json:"valid_to"`   // End of the window (exclusive).
+}
+
+// Contains reports whether t falls within the window.
+func (w CoverageWindow) Contains(t time.Time) bool {
+	return !t.Before(w.From) && t.Before(w.To)
+}
+
+// IsZero reports whether the window is empty.
+func (w CoverageWindow) IsZero() bool {
+	return w.From.IsZero() && w.To.IsZero()
+}
+
+// IsCoverageActive reports whether the subscriber is covered at the given time.
+// A payment covers the half-open interval [CreatedAt, ValidTo).
+// Voided payments and payments belonging to other subscribers are ignored.
+//
+// When coverage is active, the returned window is the merged window containing at.
+// Otherwise it is the most recent window that ended before at, or the zero window
+// if the subscriber was never covered before at.
+//
+// This is the reference implementation of the coverage rules; prefer it
+// (or CheckCoverage) over re-implementing the math in the HMS.
+func IsCoverageActive(subscriber *Subscriber, payments []*Payment, at time.Time) (bool, CoverageWindow) {
+	var windows []CoverageWindow
+	for _, payment := range payments {
+		if payment == nil || payment.VoidedAt != nil || payment.ValidTo.IsZero() ||
+			!payment.CreatedAt.Before(payment.ValidTo) {
+			continue
+		}
+
+		if subscriber != nil && payment.SubscriberID != 0 && payment.SubscriberID != subscriber.ID {
+			continue
+		}
+		windows = append(windows, CoverageWindow{From: payment.CreatedAt, To: payment.ValidTo})
+	}
+
+	slices.SortFunc(windows, func(a, b CoverageWindow) int {
+		return a.From.Compare(b.From)
+	})
+
+	var last CoverageWindow
+	for _, merged := range mergeWindows(windows) {
+		if merged.Contains(at) {
+			return true, merged
+		}
+
+		if !merged.To.After(at) {
+			last = merged
+		}
+	}
+	return false, last
+}
+
+// mergeWindows merges overlapping or adjacent windows sorted by From.
+func mergeWindows(windows []CoverageWindow) []CoverageWindow {
+	var merged []CoverageWindow
+	for _, window := range windows {
+		n := len(merged)
+		if n > 0 && !window.From.After(merged[n-1].To) {
+			if window.To.After(merged[n-1].To) {
+				merged[n-1].To = window.To
+			}
+			continue
+		}
+		merged = append(merged, window)
+	}
+	return merged
+}
+
+// CoverageStatus is the server's view of a subscriber's coverage.
+type CoverageStatus struct {
+	SubscriberID uint `json:"subscriber_id"`
+	Active       bool `json:"active"`
+	CoverageWindow
+}
+
+// CheckCoverage asks the server whether the subscriber is covered at the given time.
+// It applies the same rules as IsCoverageActive using the server's payment records.
+func (c *DefaultEcloudClient) CheckCoverage(ctx context.Context, subscriberID uint, at time.Time) (*CoverageStatus, error) {
+	query := neturl.Values{}
+	query.Set("at", at.Format(time.RFC3339))
+
+	url := fmt.Sprintf("%s/api/subscriptions/%d/coverage?%s", c.cfg().ApiBaseUrl, subscriberID, query.Encode())
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to check coverage: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
+	}
+
+	status := &CoverageStatus{}
+	err = json.NewDecoder(resp.Body).Decode(status)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return status, nil
+}
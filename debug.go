@@ -0,0 +1,198 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Redacted replaces credentials and PHI in debug dumps.
+const Redacted = "[REDACTED]"
+
+// maxDebugBody is the number of body bytes included in a debug dump.
+const maxDebugBody = 64 << 10
+
+// sensitiveHeaders are the headers redacted from debug dumps.
+var sensitiveHeaders = []string{
+	"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key",
+}
+
+// sensitiveFields are the JSON fields and query parameters redacted from
+// debug dumps, lower case and without separators (see normalizeField).
+var sensitiveFields = map[string]bool{
+	"password": true, "token": true, "accesstoken": true, "refreshtoken": true,
+	"jwt": true, "secret": true, "name": true, "patientname": true,
+	"fullname": true, "firstname": true, "lastname": true, "email": true,
+	"phone": true, "phonenumber": true, "address": true, "nextofkin": true,
+	"registeredby": true, "dateofbirth": true, "dob": true,
+}
+
+// emailPattern matches email addresses in free text e.g error messages.
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+func normalizeField(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// dumpRequest logs req at debug level when Config.Debug is set.
+// body is the attempt's body, before it is read by the transport.
+func (c *DefaultEcloudClient) dumpRequest(req *http.Request, body io.Reader) {
+	if !c.cfg().Debug {
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "request attempt=%d\n%s %s\n", RequestAttempt(req), req.Method, redactURL(req.URL))
+	writeHeaders(&b, req.Header)
+
+	// Only in-memory bodies are dumped, streamed uploads can't be read twice.
+	if r, ok := body.(*bytes.Reader); ok {
+		data := make([]byte, min(r.Len(), maxDebugBody+1))
+		n, _ := r.ReadAt(data, r.Size()-int64(r.Len()))
+		writeBody(&b, req.Header.Get("Content-Type"), data[:n], int64(r.Len()))
+	} else if body != nil {
+		b.WriteString("\n<streamed body omitted>\n")
+	}
+	c.logger.Debug("%s", b.String())
+}
+
+// dumpResponse logs resp at debug level when Config.Debug is set.
+// JSON bodies are buffered for the dump and left readable for the caller.
+func (c *DefaultEcloudClient) dumpResponse(req *http.Request, resp *http.Response) {
+	if !c.cfg().Debug {
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "response attempt=%d\n%s %s\n%d %s\n", RequestAttempt(req), req.Method, redactURL(req.URL),
+		resp.StatusCode, http.StatusText(resp.StatusCode))
+	writeHeaders(&b, resp.Header)
+
+	contentType := resp.Header.Get("Content-Type")
+	if isJSONContentType(contentType) {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxDebugBody+1))
+		resp.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(data), resp.Body), Closer: resp.Body}
+		writeBody(&b, contentType, data, max(resp.ContentLength, int64(len(data))))
+	} else if resp.ContentLength != 0 {
+		b.WriteString("\n<body omitted>\n")
+	}
+	c.logger.Debug("%s", b.String())
+}
+
+// readCloser reads from Reader and closes Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func writeHeaders(b *strings.Builder, header http.Header) {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		for _, value := range header[key] {
+			if slices.ContainsFunc(sensitiveHeaders, func(h string) bool { return strings.EqualFold(h, key) }) {
+				value = Redacted
+			}
+			fmt.Fprintf(b, "%s: %s\n", key, value)
+		}
+	}
+}
+
+// writeBody writes the redacted JSON body, or a placeholder for other content.
+func writeBody(b *strings.Builder, contentType string, data []byte, size int64) {
+	if len(data) == 0 {
+		return
+	}
+
+	if !isJSONContentType(contentType) {
+		fmt.Fprintf(b, "\n<%d bytes %s body omitted>\n", size, contentType)
+		return
+	}
+
+	if len(data) > maxDebugBody {
+		fmt.Fprintf(b, "\n<%d bytes JSON body omitted: too large>\n", size)
+		return
+	}
+
+	redactedBody, err := RedactJSON(data)
+	if err != nil {
+		fmt.Fprintf(b, "\n<%d bytes body omitted: invalid JSON>\n", size)
+		return
+	}
+	fmt.Fprintf(b, "\n%s\n", redactedBody)
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// redactURL returns the URL with sensitive query parameters and emails redacted.
+func redactURL(u *neturl.URL) string {
+	redactedURL := *u
+	redactedURL.User = nil
+
+	query := u.Query()
+	for key, values := range query {
+		for i, value := range values {
+			if sensitiveFields[normalizeField(key)] {
+				values[i] = Redacted
+			} else {
+				values[i] = emailPattern.ReplaceAllString(value, Redacted)
+			}
+		}
+	}
+	redactedURL.RawQuery = query.Encode()
+	redactedURL.Path = emailPattern.ReplaceAllString(u.Path, Redacted)
+	redactedURL.RawPath = ""
+	return redactedURL.String()
+}
+
+// RedactJSON returns data with credentials and PHI redacted: the values of
+// fields like "password", "token", "patient_name" and "email" anywhere in the
+// document, and email addresses in other strings. It is what Config.Debug
+// applies to request and response bodies.
+//
+// Free text other than email addresses (e.g a name in an error message) is
+// not recognized.
+func RedactJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	return json.Marshal(redactValue(document))
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if sensitiveFields[normalizeField(key)] && field != nil {
+				v[key] = Redacted
+			} else {
+				v[key] = redactValue(field)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	case string:
+		return emailPattern.ReplaceAllString(v, Redacted)
+	}
+	return value
+}
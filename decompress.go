@@ -0,0 +1,90 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ContentDecoder decompresses a response body sent with a Content-Encoding.
+type ContentDecoder func(r io.Reader) (io.ReadCloser, error)
+
+// contentDecoders returns the decoders for the response encodings accepted by the client:
+// gzip plus Config.ContentDecoders (e.g "zstd" backed by a third-party decoder).
+func (c *DefaultEcloudClient) contentDecoders() map[string]ContentDecoder {
+	decoders := map[string]ContentDecoder{
+		"gzip": func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	}
+
+	for encoding, decoder := range c.cfg().ContentDecoders {
+		decoders[strings.ToLower(encoding)] = decoder
+	}
+	return decoders
+}
+
+// acceptEncoding returns the Accept-Encoding header advertising the decoders.
+func acceptEncoding(decoders map[string]ContentDecoder) string {
+	return strings.Join(slices.Sorted(maps.Keys(decoders)), ", ")
+}
+
+// decodeBody replaces a compressed response body with a transparently decompressing one,
+// so service methods always read plain JSON. It returns the decoded encoding, if any.
+func decodeBody(resp *http.Response, decoders map[string]ContentDecoder) string {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	decoder, ok := decoders[encoding]
+	if !ok {
+		return ""
+	}
+
+	resp.Body = &decodingReadCloser{body: resp.Body, decoder: decoder}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return encoding
+}
+
+// bufferBody reads the response body into memory, so a truncated or corrupt
+// compressed body fails here rather than in the caller's decoder.
+func bufferBody(resp *http.Response) error {
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	return nil
+}
+
+// decodingReadCloser creates the decoder on the first Read, so empty bodies
+// (e.g HEAD requests) do not fail on a missing compression header.
+type decodingReadCloser struct {
+	body    io.ReadCloser
+	decoder ContentDecoder
+	r       io.ReadCloser
+	err     error
+}
+
+func (d *decodingReadCloser) Read(p []byte) (int, error) {
+	if d.r == nil && d.err == nil {
+		d.r, d.err = d.decoder(d.body)
+	}
+
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.r.Read(p)
+}
+
+func (d *decodingReadCloser) Close() error {
+	if d.r != nil {
+		d.r.Close()
+	}
+	return d.body.Close()
+}
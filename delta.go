@@ -0,0 +1,106 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// MarkRecordsUploaded records that the records covered by a payment were
+// uploaded, setting RecordsUploaded and LastUploaded, so other HMS instances
+// don't upload them again. Fails with ErrPaymentNotFound if there is no such payment.
+func (c *DefaultEcloudClient) MarkRecordsUploaded(ctx context.Context, paymentID uint) (*Payment, error) {
+	if paymentID == 0 {
+		return nil, fmt.Errorf("payment id must not be zero")
+	}
+
+	url := fmt.Sprintf("%s/api/payments/%d/records-uploaded", c.cfg().ApiBaseUrl, paymentID)
+	resp, err := c.performRequest(ctx, http.MethodPost, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to mark records uploaded: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrPaymentNotFound)
+	}
+
+	payment := &Payment{}
+	err = json.NewDecoder(resp.Body).Decode(payment)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+
+	c.cache.invalidate(payment.SubscriberID)
+	c.reportWarnings("MarkRecordsUploaded", payment.Warnings)
+	return payment, nil
+}
+
+// maxVisitsPerCheck is the number of visits checked per request by GetUnsyncedVisits.
+const maxVisitsPerCheck = 500
+
+// GetUnsyncedVisits returns the HMS visits of this hospital, among visitIDs,
+// that have no record on ecloud, in the order given and without duplicates.
+// Upload only those to avoid re-uploading records, e.g after restoring the
+// HMS database. Unlike RecordExists, it checks many visits per request.
+func (c *DefaultEcloudClient) GetUnsyncedVisits(ctx context.Context, visitIDs []uint) ([]uint, error) {
+	seen := make(map[uint]bool, len(visitIDs))
+	unique := make([]uint, 0, len(visitIDs))
+	for _, id := range visitIDs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	synced := make(map[uint]bool)
+	for start := 0; start < len(unique); start += maxVisitsPerCheck {
+		batch := unique[start:min(start+maxVisitsPerCheck, len(unique))]
+		ids, err := c.syncedVisits(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range ids {
+			synced[id] = true
+		}
+	}
+
+	unsynced := make([]uint, 0, len(unique))
+	for _, id := range unique {
+		if !synced[id] {
+			unsynced = append(unsynced, id)
+		}
+	}
+	return unsynced, nil
+}
+
+// syncedVisits returns the visits among visitIDs that have a record on ecloud.
+func (c *DefaultEcloudClient) syncedVisits(ctx context.Context, visitIDs []uint) ([]uint, error) {
+	data, err := json.Marshal(map[string][]uint{"visit_ids": visitIDs})
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/records/visits/%s/synced", c.cfg().ApiBaseUrl, c.cfg().HospitalNumber)
+	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to check synced visits: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	var result struct {
+		VisitIDs []uint `json:"visit_ids"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return result.VisitIDs, nil
+}
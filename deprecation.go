@@ -0,0 +1,128 @@
+package ecloudsdk
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Deprecation describes an endpoint the server has marked as deprecated
+// with the Deprecation (RFC 9745) and Sunset (RFC 8594) response headers.
+type Deprecation struct {
+	Endpoint     string    // Method and path e.g "GET /api/subscriptions/{id}".
+	DeprecatedAt time.Time // When the endpoint was deprecated. Zero if not specified.
+	Sunset       time.Time // When the endpoint will stop working. Zero if not announced.
+	Link         string    // Link header pointing to migration documentation, if any.
+	FirstSeen    time.Time // When the SDK first received the deprecation.
+}
+
+// deprecationTracker records deprecated endpoints seen in responses.
+type deprecationTracker struct {
+	mu        sync.Mutex
+	endpoints map[string]Deprecation
+}
+
+// observe records the deprecation headers of a response.
+// It returns the deprecation and whether this is the first time it was seen.
+func (t *deprecationTracker) observe(req *http.Request, resp *http.Response) (Deprecation, bool) {
+	deprecationHeader := resp.Header.Get("Deprecation")
+	sunsetHeader := resp.Header.Get("Sunset")
+	if deprecationHeader == "" && sunsetHeader == "" {
+		return Deprecation{}, false
+	}
+
+	endpoint := req.Method + " " + endpointPattern(req.URL.Path)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.endpoints == nil {
+		t.endpoints = make(map[string]Deprecation)
+	}
+
+	_, seen := t.endpoints[endpoint]
+	deprecation := Deprecation{
+		Endpoint:     endpoint,
+		DeprecatedAt: parseDeprecationDate(deprecationHeader),
+		Link:         resp.Header.Get("Link"),
+		FirstSeen:    time.Now(),
+	}
+
+	if sunset, err := http.ParseTime(sunsetHeader); err == nil {
+		deprecation.Sunset = sunset
+	}
+
+	if seen {
+		deprecation.FirstSeen = t.endpoints[endpoint].FirstSeen
+	}
+	t.endpoints[endpoint] = deprecation
+	return deprecation, !seen
+}
+
+func (t *deprecationTracker) list() []Deprecation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	deprecations := make([]Deprecation, 0, len(t.endpoints))
+	for _, deprecation := range t.endpoints {
+		deprecations = append(deprecations, deprecation)
+	}
+
+	slices.SortFunc(deprecations, func(a, b Deprecation) int {
+		return strings.Compare(a.Endpoint, b.Endpoint)
+	})
+	return deprecations
+}
+
+// parseDeprecationDate parses a Deprecation header value.
+// RFC 9745 uses a structured date ("@1688169599"); older drafts used
+// an HTTP date or the literal "true".
+func parseDeprecationDate(value string) time.Time {
+	if unix, ok := strings.CutPrefix(value, "@"); ok {
+		if seconds, err := strconv.ParseInt(unix, 10, 64); err == nil {
+			return time.Unix(seconds, 0).UTC()
+		}
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return date
+	}
+	return time.Time{}
+}
+
+// endpointPattern replaces numeric path segments with {id} so that
+// all calls to the same endpoint share one entry.
+func endpointPattern(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if _, err := strconv.ParseUint(segment, 10, 64); err == nil {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Deprecations returns the deprecated endpoints this client has called,
+// sorted by endpoint, so integrators can plan upgrades before the sunset date.
+func (c *DefaultEcloudClient) Deprecations() []Deprecation {
+	return c.deprecations.list()
+}
+
+// checkDeprecation logs a warning the first time a deprecated endpoint is called.
+func (c *DefaultEcloudClient) checkDeprecation(req *http.Request, resp *http.Response) {
+	deprecation, first := c.deprecations.observe(req, resp)
+	if !first {
+		return
+	}
+
+	if deprecation.Sunset.IsZero() {
+		logWarn(c.logger, "endpoint %s is deprecated\n", deprecation.Endpoint)
+		return
+	}
+
+	logWarn(c.logger, "endpoint %s is deprecated and will be removed on %s\n",
+		deprecation.Endpoint, deprecation.Sunset.Format(time.DateOnly))
+}
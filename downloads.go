@@ -0,0 +1,247 @@
+package ecloudsdk
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+
+	"github.com/abiiranathan/ecloud-sdk/pdf"
+)
+
+// ReportKind selects one of the reports of a record.
+type ReportKind string
+
+const (
+	ReportMedical ReportKind = "medical" // PatientRecord.MedicalReport.
+	ReportLab     ReportKind = "lab"     // PatientRecord.LabReport.
+)
+
+// RecordPage is a page of a subscriber's records. The records carry their
+// metadata only; download the reports with DownloadReport.
+type RecordPage struct {
+	Records    []*PatientRecord `json:"data"`
+	NextCursor string           `json:"next_cursor"` // Empty on the last page.
+	Total      int              `json:"total"`       // Number of records across all pages.
+}
+
+// HasMore reports whether there are more pages after this one.
+func (p *RecordPage) HasMore() bool {
+	return p.NextCursor != ""
+}
+
+// ListPatientRecords returns a page of the records synced for a subscriber,
+// most recent visit first unless opts.Sort is set.
+func (c *DefaultEcloudClient) ListPatientRecords(ctx context.Context, subscriberID uint, opts *ListOptions) (*RecordPage, error) {
+	query := neturl.Values{}
+	query.Set("subscriber_id", strconv.FormatUint(uint64(subscriberID), 10))
+	opts.apply(query)
+
+	url := c.cfg().ApiBaseUrl + "/api/records?" + query.Encode()
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list records: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
+	}
+
+	page := &RecordPage{}
+	err = json.NewDecoder(resp.Body).Decode(page)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return page, nil
+}
+
+// GetRecord returns the metadata of a synced record.
+// Fails with ErrRecordNotFound if there is no such record.
+func (c *DefaultEcloudClient) GetRecord(ctx context.Context, recordID uint) (*PatientRecord, error) {
+	url := fmt.Sprintf("%s/api/records/%d", c.cfg().ApiBaseUrl, recordID)
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch record: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrRecordNotFound)
+	}
+
+	record := &PatientRecord{}
+	err = json.NewDecoder(resp.Body).Decode(record)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return record, nil
+}
+
+// DownloadReport streams a report of a synced record to w and returns the
+// number of bytes written. Fails with ErrRecordNotFound if the record doesn't
+// exist or has no report of that kind.
+//
+// Nothing is written to w unless the server returns a PDF, but a download
+// failing midway leaves a partial report in w. Reports encrypted with
+// Config.ReportEncryptionKey or KeyProvider are decrypted and verified as
+// they are written; a tampered report fails with ErrReportDecryption.
+//
+// Compressed responses are decompressed. If the server sends the SHA-256 of
+// the report in ReportSHA256Header, a report not matching it fails with
+// ErrChecksumMismatch once written. Cancelling ctx stops the download midway
+// with the context error.
+func (c *DefaultEcloudClient) DownloadReport(ctx context.Context, recordID uint, kind ReportKind, w io.Writer) (int64, error) {
+	if kind != ReportMedical && kind != ReportLab {
+		return 0, fmt.Errorf("invalid report kind %q", kind)
+	}
+
+	url := fmt.Sprintf("%s/api/records/%d/reports/%s", c.cfg().ApiBaseUrl, recordID, kind)
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, map[string]string{"Accept": pdfContentType})
+	if err != nil {
+		return 0, fmt.Errorf("unable to download %s report: %w", kind, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, c.decodeResourceError(resp, ErrRecordNotFound)
+	}
+
+	progress := c.newProgress(ctx, "DownloadReport", &PatientRecord{ID: recordID}, resp.ContentLength)
+	download := newDownloadBody(ctx, resp, resp.Header.Get(ReportSHA256Header))
+
+	// Reports encrypted before upload are decrypted as they are downloaded.
+	body := bufio.NewReader(progress.reader(download))
+	if isEncryptedReport(body) {
+		field := labReportFieldName
+		if kind == ReportMedical {
+			field = medicalReportFieldName
+		}
+
+		report, err := c.openReport(ctx, body, field)
+		if err != nil {
+			return 0, fmt.Errorf("unable to decrypt %s report: %w", kind, err)
+		}
+		body = bufio.NewReader(report)
+	}
+
+	header, _ := body.Peek(8)
+	if _, err := pdf.Header(header); err != nil {
+		return 0, fmt.Errorf("downloaded %s report is not a PDF", kind)
+	}
+
+	n, err := io.Copy(w, body)
+	if err == nil {
+		// The decryption may stop before the end of the body, which the
+		// checksum covers.
+		_, err = io.Copy(io.Discard, download)
+	}
+	if closeErr := download.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, fmt.Errorf("unable to download %s report: %w", kind, err)
+	}
+	return n, nil
+}
+
+// downloadBody is the body of a streamed download, returned by
+// GetRecordThumbnail and read by DownloadReport:
+//   - compressed responses (Content-Encoding gzip, or Config.ContentDecoders)
+//     are decompressed as they are read;
+//   - once ctx is done, Read fails with the context error, and a Read blocked
+//     on the network is interrupted by the transport;
+//   - if the server sent the SHA-256 of the content, reading to the end or
+//     closing after reading every byte fails with ErrChecksumMismatch on a
+//     mismatch. Partial reads are not verified;
+//   - Close releases the connection and may be called more than once.
+type downloadBody struct {
+	body   io.ReadCloser
+	ctx    context.Context
+	size   int64  // Content-Length of the decoded body, -1 if unknown.
+	want   string // Hex SHA-256 of the content, empty if unknown.
+	hash   hash.Hash
+	n      int64
+	err    error // Sticky error of Read, io.EOF once read to the end.
+	closed bool
+}
+
+// newDownloadBody wraps the body of resp, verifying it against the hex
+// SHA-256 checksum unless it is empty.
+func newDownloadBody(ctx context.Context, resp *http.Response, checksum string) *downloadBody {
+	return &downloadBody{
+		body: resp.Body,
+		ctx:  ctx,
+		size: resp.ContentLength,
+		want: strings.TrimSpace(checksum),
+		hash: sha256.New(),
+	}
+}
+
+func (b *downloadBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	n, err := b.body.Read(p)
+	b.hash.Write(p[:n])
+	b.n += int64(n)
+
+	switch {
+	case err == io.EOF:
+		err = b.verify()
+		if err == nil {
+			err = io.EOF
+		}
+		b.err = err
+	case err != nil && b.ctx.Err() != nil:
+		err = b.ctx.Err() // Rather than the transport's view of the cancellation.
+	}
+	return n, err
+}
+
+// verify compares the checksum of the content read with the one sent by the server.
+func (b *downloadBody) verify() error {
+	if b.want == "" {
+		return nil
+	}
+
+	if sum := hex.EncodeToString(b.hash.Sum(nil)); !strings.EqualFold(sum, b.want) {
+		return fmt.Errorf("%w: downloaded with SHA-256 %s, expected %s", ErrChecksumMismatch, sum, b.want)
+	}
+	return nil
+}
+
+// Close closes the body. It returns ErrChecksumMismatch if every byte was read
+// but the content doesn't match its checksum.
+func (b *downloadBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	err := b.body.Close()
+	switch {
+	case b.err == nil && b.size >= 0 && b.n == b.size:
+		// Read up to the Content-Length without the final io.EOF.
+		if verifyErr := b.verify(); verifyErr != nil {
+			b.err = verifyErr
+			return verifyErr
+		}
+	case errors.Is(b.err, ErrChecksumMismatch):
+		return b.err
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// AlreadySubscribedError is returned by Subscribe when the patient already has
+// a subscription, so the UI can offer to open it instead. It matches
+// ErrAlreadySubscribed with errors.Is.
+type AlreadySubscribedError struct {
+	// The existing subscription. Nil if the server reported a conflict
+	// but the subscription could not be fetched.
+	Subscriber *Subscriber
+
+	// The server's 409 response, nil if the duplicate was detected by the
+	// pre-check of Config.CheckDuplicateSubscriptions.
+	Err error
+}
+
+func (e *AlreadySubscribedError) Error() string {
+	if e.Subscriber == nil {
+		return ErrAlreadySubscribed.Error()
+	}
+	return fmt.Sprintf("%s: subscriber %d (%s)", ErrAlreadySubscribed, e.Subscriber.ID, e.Subscriber.EclinicID)
+}
+
+func (e *AlreadySubscribedError) Is(target error) bool {
+	return target == ErrAlreadySubscribed
+}
+
+func (e *AlreadySubscribedError) Unwrap() error {
+	return e.Err
+}
+
+// checkNotSubscribed returns an *AlreadySubscribedError if the patient has a subscription.
+func (c *DefaultEcloudClient) checkNotSubscribed(ctx context.Context, patientID uint) error {
+	existing, err := c.GetPatientSubscription(ctx, patientID)
+	if errors.Is(err, ErrSubscriberNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to check for an existing subscription: %w", err)
+	}
+	return &AlreadySubscribedError{Subscriber: existing}
+}
+
+// alreadySubscribed converts the 409 response of Subscribe into an
+// *AlreadySubscribedError. The existing subscriber is taken from the
+// "subscriber" field of the response, or else looked up.
+func (c *DefaultEcloudClient) alreadySubscribed(ctx context.Context, apiErr *APIError, patientID uint) error {
+	var body struct {
+		Subscriber *Subscriber `json:"subscriber"`
+	}
+
+	if err := json.Unmarshal(apiErr.Body, &body); err == nil && body.Subscriber != nil {
+		return &AlreadySubscribedError{Subscriber: body.Subscriber, Err: apiErr}
+	}
+
+	existing, err := c.GetPatientSubscription(ctx, patientID)
+	if err != nil {
+		c.logger.Error("unable to fetch the existing subscription of patient %d: %v\n", patientID, err)
+	}
+	return &AlreadySubscribedError{Subscriber: existing, Err: apiErr}
+}
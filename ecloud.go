@@ -3,22 +3,44 @@ package ecloudsdk
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"iter"
 	"net/http"
-	"regexp"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
 // AuthProvider handles authentication and token management
 type AuthProvider interface {
 	Login(ctx context.Context) (*LoginResponse, error)
+	Refresh(ctx context.Context) error
+
+	// ValidateToken reports whether the server still accepts the current token.
+	ValidateToken(ctx context.Context) (*TokenInfo, error)
+
+	// Session returns a consistent snapshot of the authentication state.
+	Session() Session
+
+	// Deprecated: Use Session().Token.
 	GetToken() string
+
+	// Deprecated: Use Session().User and Session().Authenticated.
 	GetUser() (*User, error)
+
+	// Deprecated: Use Session().Authenticated.
 	IsAuthenticated() bool
-	Refresh(ctx context.Context) error
+
+	// TokenExpiresAt returns the expiry of the current token, or the zero time if unknown.
+	//
+	// Deprecated: Use Session().ExpiresAt.
+	TokenExpiresAt() time.Time
 }
 
 // HTTPClient abstracts HTTP operations for easier testing and customization
@@ -29,26 +51,83 @@ type HTTPClient interface {
 // BillingService handles all billing-related operations
 type BillingService interface {
 	GetBill(ctx context.Context) (*Bill, error)
+	GetBills(ctx context.Context, hospitalNumbers []HospitalNumber) (map[HospitalNumber]*Bill, error)
 }
 
 // SubscriptionService handles subscription management
 type SubscriptionService interface {
 	Subscribe(ctx context.Context, req *SubscribeRequest) (*Subscriber, error)
+	SubscribeAndPay(ctx context.Context, req *SubscribeAndPayRequest) (*Subscriber, *Payment, error)
+	SubscriptionStatus(ctx context.Context, patientID uint) (*SubscriptionStatus, error)
+	RequestDataExport(ctx context.Context, subscriberID uint) (*Operation, error)
+	RequestErasure(ctx context.Context, subscriberID uint, reason string) (*Operation, error)
 	GetSubscriber(ctx context.Context, subscriberID uint) (*Subscriber, error)
+	SubscriberExists(ctx context.Context, subscriberID uint) (bool, error)
+	UpdateSubscriber(ctx context.Context, subscriberID uint, req UpdateSubscriberRequest) (*Subscriber, error)
+	CancelSubscription(ctx context.Context, subscriberID uint, reason CancellationReason) error
 	GetPatientSubscription(ctx context.Context, patientID uint) (*Subscriber, error)
 	GetHospitalSubscribers(ctx context.Context) ([]*Subscriber, error)
+	ListSubscribers(ctx context.Context, filter *SubscriberFilter) ([]*Subscriber, error)
 	GetPendingSubscribers(ctx context.Context) ([]*Subscriber, error)
+	ListSubscribersPage(ctx context.Context, filter *SubscriberFilter, opts *ListOptions) (*SubscriberPage, error)
+	GetPendingSubscribersPage(ctx context.Context, opts *ListOptions) (*SubscriberPage, error)
+	AllSubscribers(ctx context.Context, filter *SubscriberFilter, opts *ListOptions) iter.Seq2[*Subscriber, error]
+	AllPendingSubscribers(ctx context.Context, opts *ListOptions) iter.Seq2[*Subscriber, error]
+	GetCommunicationPreferences(ctx context.Context, subscriberID uint) (*CommunicationPreferences, error)
+	UpdateCommunicationPreferences(ctx context.Context, subscriberID uint, prefs *CommunicationPreferences) (*CommunicationPreferences, error)
+	WatchSubscribers(ctx context.Context, interval time.Duration) (<-chan SubscriberChange, error)
+	WatchSubscribersMatching(ctx context.Context, filter *SubscriberFilter, interval time.Duration) (<-chan SubscriberChange, error)
+	CheckCoverage(ctx context.Context, subscriberID uint, at time.Time) (*CoverageStatus, error)
+	SendVerification(ctx context.Context, subscriberID uint, channel VerificationChannel) (*Verification, error)
+	ConfirmVerification(ctx context.Context, subscriberID uint, code string) (*Verification, error)
+	GetSubscriberQRCode(ctx context.Context, subscriberID uint) ([]byte, error)
+	ResolveQRCode(ctx context.Context, token string) (*Subscriber, error)
+	AddSubscriberNote(ctx context.Context, subscriberID uint, text, createdBy string) (*SubscriberNote, error)
+	ListSubscriberNotes(ctx context.Context, subscriberID uint) ([]*SubscriberNote, error)
+	SetSubscriberFlag(ctx context.Context, subscriberID uint, name string, value bool, updatedBy string) (*SubscriberFlag, error)
+	GetSubscriberFlags(ctx context.Context, subscriberID uint) ([]*SubscriberFlag, error)
 }
 
 // PaymentService handles payment operations
 type PaymentService interface {
 	CreatePayment(ctx context.Context, subscriberID uint, amountToPay float64, registeredBy string) (*Payment, error)
 	GetSubscriberPayments(ctx context.Context, subscriberID uint) ([]*Payment, error)
+	GetSubscriberPaymentsPage(ctx context.Context, subscriberID uint, opts *PaymentListOptions) (*PaymentPage, error)
+	ListPayments(ctx context.Context, opts *PaymentListOptions) (*PaymentPage, error)
+	AllPayments(ctx context.Context, opts *PaymentListOptions) iter.Seq2[*Payment, error]
+	PaymentsSince(ctx context.Context, checkpoint PaymentCheckpoint) ([]*Payment, PaymentCheckpoint, error)
+	ExportSignedPaymentReport(ctx context.Context, period ReportPeriod) (*SignedPaymentReport, error)
+	RefundPayment(ctx context.Context, paymentID uint, amount float64, reason string) (*Refund, error)
+	VoidPayment(ctx context.Context, paymentID uint) (*Payment, error)
+	MarkRecordsUploaded(ctx context.Context, paymentID uint) (*Payment, error)
 }
 
 // RecordsService handles medical records synchronization
 type RecordsService interface {
 	SyncMedicalRecords(ctx context.Context, patientRecord *PatientRecord) error
+	SyncMedicalRecordsV2(ctx context.Context, patientRecord *PatientRecord) (*SyncResult, error)
+	SyncMedicalRecordsFromFiles(ctx context.Context, patientRecord *PatientRecord, files ReportFiles) error
+	SyncVisit(ctx context.Context, records []*PatientRecord) error
+	SyncMedicalRecordsBatch(ctx context.Context, records []*PatientRecord, opts BatchOptions) (*BatchReport, error)
+	UploadLargeReport(ctx context.Context, patientRecord *PatientRecord, opts *ChunkedUploadOptions) error
+	AbortUpload(ctx context.Context, uploadID string) error
+	GetRecordThumbnail(ctx context.Context, recordID uint, size int) (io.ReadCloser, error)
+	RequestTextExtraction(ctx context.Context, recordID uint) (*ExtractedText, error)
+	GetExtractedText(ctx context.Context, recordID uint) (*ExtractedText, error)
+	SearchRecords(ctx context.Context, query RecordQuery, opts *ListOptions) (*RecordSearchResult, error)
+	ResolveVisit(ctx context.Context, visitID uint) ([]*RecordLink, error)
+	ResolveRecord(ctx context.Context, recordID uint) (*RecordLink, error)
+	RecordExists(ctx context.Context, visitID uint) (bool, error)
+	GetUnsyncedVisits(ctx context.Context, visitIDs []uint) ([]uint, error)
+	ListPatientRecords(ctx context.Context, subscriberID uint, opts *ListOptions) (*RecordPage, error)
+	GetRecord(ctx context.Context, recordID uint) (*PatientRecord, error)
+	DownloadReport(ctx context.Context, recordID uint, kind ReportKind, w io.Writer) (int64, error)
+	DownloadReportToFile(ctx context.Context, recordID uint, kind ReportKind, path string) (int64, error)
+	GetUploadLeaderboard(ctx context.Context, period ReportPeriod) (*UploadLeaderboard, error)
+	ListInboundPatientUploads(ctx context.Context) ([]*InboundUpload, error)
+	DownloadInboundUpload(ctx context.Context, uploadID uint, w io.Writer) (int64, error)
+	AcceptInboundUpload(ctx context.Context, uploadID, visitID uint) (*InboundUpload, error)
+	RejectInboundUpload(ctx context.Context, uploadID uint, reason string) (*InboundUpload, error)
 }
 
 // Logger interface for pluggable logging
@@ -70,6 +149,11 @@ type DefaultRetryPolicy struct {
 	maxRetries int
 }
 
+// NewDefaultRetryPolicy returns a DefaultRetryPolicy that retries up to maxRetries times.
+func NewDefaultRetryPolicy(maxRetries int) *DefaultRetryPolicy {
+	return &DefaultRetryPolicy{maxRetries: maxRetries}
+}
+
 func (p *DefaultRetryPolicy) ShouldRetry(attempt int, err error, resp *http.Response) bool {
 	if attempt >= p.maxRetries {
 		return false
@@ -96,7 +180,41 @@ func (p *DefaultRetryPolicy) MaxRetries() int {
 	return p.maxRetries
 }
 
-// Main client interface that composes all services
+// retryPolicyFor returns the retry policy for the endpoint at rawURL.
+// The longest matching prefix in Config.RetryPolicies wins,
+// falling back to the global policy.
+func (c *DefaultEcloudClient) retryPolicyFor(rawURL string, fallback RetryPolicy) RetryPolicy {
+	policies := c.cfg().RetryPolicies
+	if len(policies) == 0 {
+		return fallback
+	}
+
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return fallback
+	}
+
+	policy := fallback
+	longest := -1
+	for prefix, value := range policies {
+		if value != nil && strings.HasPrefix(u.Path, prefix) && len(prefix) > longest {
+			policy = value
+			longest = len(prefix)
+		}
+	}
+	return policy
+}
+
+// Main client interface that composes all services.
+// The embedded services are kept for compatibility; prefer the per-service
+// accessors, so callers and their mocks only depend on the service they use.
+//
+// A client is safe for concurrent use by multiple goroutines and should be
+// shared rather than created per request. Concurrent token refreshes are
+// coalesced into one login, and UpdateConfig only affects requests started
+// after it returns. Values passed to the client (records, requests, filters)
+// must not be modified until the call returns, and readers in PatientRecord
+// must not be shared between concurrent uploads.
 type EcloudClient interface {
 	AuthProvider
 	BillingService
@@ -104,21 +222,101 @@ type EcloudClient interface {
 	PaymentService
 	RecordsService
 
+	// Per-service views of the client. They share its config, transport and session.
+	Auth() AuthProvider
+	Billing() BillingService
+	Subscriptions() SubscriptionService
+	Payments() PaymentService
+	Records() RecordsService
+
+	ClientCore
+}
+
+// ClientCore groups the client-wide operations shared by EcloudClient and EcloudClientV2.
+type ClientCore interface {
 	// Returns a copy of the config.
 	Config() Config
+
+	// Atomically updates the config, re-authenticating if credentials changed.
+	UpdateConfig(ctx context.Context, update func(*Config)) error
+
+	// Returns the bytes exchanged with ecloud today.
+	BandwidthUsage() BandwidthUsage
+
+	// Reports the TLS parameters negotiated with the server.
+	NegotiatedTLS(ctx context.Context) (*TLSParameters, error)
+
+	// Returns the deprecated endpoints this client has called.
+	Deprecations() []Deprecation
+
+	// Fetches the capabilities of the ecloud deployment.
+	GetCapabilities(ctx context.Context) (*Capabilities, error)
+
+	// Fetches the features licensed to the hospital.
+	GetEntitlements(ctx context.Context) (*Entitlements, error)
+
+	// Fetches the hospital's validation rules and applies them to later uploads.
+	LoadValidationRules(ctx context.Context) (*ValidationRules, error)
+
+	// Pre-fetches frequent lookups into the cache. Requires Config.CacheTTL.
+	WarmUp(ctx context.Context) error
+
+	// Uploads the request journal to ecloud's audit endpoint.
+	ShipJournal(ctx context.Context) error
+
+	// Ships the request journal periodically until ctx is done.
+	RunJournalShipper(ctx context.Context, interval time.Duration)
+
+	// Subscribes to the events published by the client.
+	Events(ctx context.Context) <-chan Event
+
+	// Sends a custom request through the client's auth, retry and transport pipeline.
+	Do(ctx context.Context, method, path string, body io.Reader, headers map[string]string) (*http.Response, error)
 }
 
 // DefaultEcloudClient implements all interfaces
 type DefaultEcloudClient struct {
+	// mu guards config, httpClient and retryPolicy, which UpdateConfig may swap.
+	mu          sync.RWMutex
 	config      *Config
 	httpClient  HTTPClient
-	logger      Logger
 	retryPolicy RetryPolicy
 
-	// Authentication state
-	jwtToken      string
-	user          User
-	authenticated bool
+	logger    Logger
+	bandwidth *bandwidthAccountant
+
+	deprecations deprecationTracker
+	residency    residencyCheck
+
+	// Authentication state, guarded by authMu.
+	authMu         sync.RWMutex
+	jwtToken       string
+	tokenExpiresAt time.Time
+	user           User
+	authenticated  bool
+
+	// Coalesces concurrent token refreshes.
+	refresh refreshFlight
+
+	// Subscriptions created by Events.
+	events eventBus
+
+	// Lookups cached for Config.CacheTTL.
+	cache lookupCache
+
+	// Request journal kept in Config.JournalDir.
+	journal journal
+}
+
+// refreshFlight ensures a single Login call is in flight for concurrent refreshes.
+type refreshFlight struct {
+	mu   sync.Mutex
+	call *refreshCall
+}
+
+type refreshCall struct {
+	done chan struct{}
+	err  error
 }
 
 func NewEcloudClient(config *Config) (EcloudClient, error) {
@@ -126,39 +324,129 @@ func NewEcloudClient(config *Config) (EcloudClient, error) {
 		return nil, err
 	}
 
-	client := &DefaultEcloudClient{config: config}
+	client := &DefaultEcloudClient{
+		config:    config,
+		bandwidth: newBandwidthAccountant(config.DailyBandwidthBudget),
+	}
 
 	// Set defaults if not provided
-	if config.HTTPClient != nil {
-		client.httpClient = config.HTTPClient
-	} else {
-		client.httpClient = &http.Client{Timeout: config.Timeout}
-	}
+	client.httpClient, client.retryPolicy = newTransport(config)
 
 	if config.Logger != nil {
-		client.logger = config.Logger
+		client.logger = safeLogger{config.Logger}
 	} else {
 		client.logger = &NoOpLogger{}
 	}
 
-	if config.RetryPolicy != nil {
-		client.retryPolicy = config.RetryPolicy
-	} else {
-		client.retryPolicy = &DefaultRetryPolicy{maxRetries: 3}
+	return client, nil
+}
+
+// newTransport returns the HTTP client and retry policy for the config,
+// falling back to the defaults for those not provided.
+func newTransport(config *Config) (HTTPClient, RetryPolicy) {
+	var httpClient HTTPClient = config.HTTPClient
+	if httpClient == nil {
+		httpClient = newHTTPClient(config)
 	}
+	httpClient = chainMiddleware(httpClient, config.Middleware)
 
-	return client, nil
+	var retryPolicy RetryPolicy = config.RetryPolicy
+	if retryPolicy == nil {
+		retryPolicy = defaultRetryPolicy(config)
+	}
+	return httpClient, retryPolicy
+}
+
+// Auth returns the authentication view of the client.
+func (c *DefaultEcloudClient) Auth() AuthProvider {
+	return c
+}
+
+// Billing returns the billing view of the client.
+func (c *DefaultEcloudClient) Billing() BillingService {
+	return c
+}
+
+// Subscriptions returns the subscription view of the client.
+func (c *DefaultEcloudClient) Subscriptions() SubscriptionService {
+	return c
+}
+
+// Payments returns the payment view of the client.
+func (c *DefaultEcloudClient) Payments() PaymentService {
+	return c
+}
+
+// Records returns the medical records view of the client.
+func (c *DefaultEcloudClient) Records() RecordsService {
+	return c
 }
 
 func (c *DefaultEcloudClient) Config() Config {
-	return *c.config
+	return *c.cfg()
+}
+
+// cfg returns the current config. The returned config must not be modified.
+func (c *DefaultEcloudClient) cfg() *Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.config
+}
+
+// transport returns the current HTTP client and retry policy.
+func (c *DefaultEcloudClient) transport() (HTTPClient, RetryPolicy) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.httpClient, c.retryPolicy
 }
 
 // Authentication implementation
-func (c *DefaultEcloudClient) Login(ctx context.Context) (*LoginResponse, error) {
+
+// Login authenticates with the configured credentials.
+// Transient failures (network errors and 5xx responses) are retried under the
+// retry policy and reported as ErrAuthUnavailable once retries are exhausted.
+// Rejected credentials are terminal and reported as ErrInvalidCredentials.
+//
+// If Config.TokenStore holds an unexpired session for the configured account,
+// it is resumed without sending the credentials.
+func (c *DefaultEcloudClient) Login(ctx context.Context) (_ *LoginResponse, err error) {
+	ctx, span := c.startSpan(ctx, "Login")
+	defer func() { span.end(err) }()
+
+	if loginResp, ok := c.restoreToken(ctx); ok {
+		return loginResp, nil
+	}
+	return c.authenticate(ctx)
+}
+
+// authenticate logs in with the configured credentials, retrying transient failures.
+func (c *DefaultEcloudClient) authenticate(ctx context.Context) (*LoginResponse, error) {
+	_, retryPolicy := c.transport()
+
+	for attempt := 0; ; attempt++ {
+		loginResp, err := c.login(ctx)
+		if err == nil {
+			return loginResp, nil
+		}
+
+		retry := ctx.Err() == nil && errors.Is(err, ErrAuthUnavailable) &&
+			attempt < retryPolicy.MaxRetries() && retryPolicy.ShouldRetry(attempt, err, nil)
+		if !retry {
+			return nil, err
+		}
+
+		c.logger.Debug("login failed, retrying: %v\n", err)
+		if !backoff(ctx, retryPolicy, attempt, nil) {
+			return nil, err
+		}
+	}
+}
+
+// login performs a single login attempt.
+func (c *DefaultEcloudClient) login(ctx context.Context) (*LoginResponse, error) {
 	loginReq := LoginRequest{
-		EclinicID: c.config.EclinicId,
-		Password:  c.config.Password,
+		EclinicID: c.cfg().EclinicId,
+		Password:  c.cfg().Password,
 	}
 
 	body, err := json.Marshal(loginReq)
@@ -166,14 +454,24 @@ func (c *DefaultEcloudClient) Login(ctx context.Context) (*LoginResponse, error)
 		return nil, err
 	}
 
-	url := c.config.ApiBaseUrl + "/api/auth/login"
+	// Login is retried by the caller and must never trigger a token refresh itself.
+	ctx = context.WithValue(ctx, loginRequestKey{}, true)
+
+	url := c.cfg().ApiBaseUrl + "/api/auth/login"
 	resp, err := c.performRequest(ctx, "POST", url, bytes.NewReader(body), nil)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrAuthUnavailable, err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusUnauthorized:
+		c.deleteToken(ctx)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, c.decodeError(resp))
+	case resp.StatusCode >= 500:
+		return nil, fmt.Errorf("%w: %w", ErrAuthUnavailable, c.decodeError(resp))
+	default:
 		return nil, c.decodeError(resp)
 	}
 
@@ -187,37 +485,115 @@ func (c *DefaultEcloudClient) Login(ctx context.Context) (*LoginResponse, error)
 	}
 
 	// Update client state
+	expiresAt, _ := parseTokenExpiry(loginResp.Token)
+
+	c.authMu.Lock()
 	c.jwtToken = loginResp.Token
+	c.tokenExpiresAt = expiresAt
 	c.user = loginResp.User
 	c.authenticated = true
+	c.authMu.Unlock()
+
+	c.saveToken(ctx, &loginResp, expiresAt)
 
 	c.logger.Info("successfully authenticated user: %s\n", loginResp.User.EclinicID)
 	return &loginResp, nil
 }
 
 func (c *DefaultEcloudClient) GetToken() string {
+	c.authMu.RLock()
+	defer c.authMu.RUnlock()
 	return c.jwtToken
 }
 
 func (c *DefaultEcloudClient) GetUser() (*User, error) {
+	c.authMu.RLock()
+	defer c.authMu.RUnlock()
+
 	if !c.authenticated {
 		return nil, ErrNotAuthenticated
 	}
-	return &c.user, nil
+
+	user := c.user
+	return &user, nil
 }
 
 func (c *DefaultEcloudClient) IsAuthenticated() bool {
+	c.authMu.RLock()
+	defer c.authMu.RUnlock()
 	return c.authenticated && c.jwtToken != ""
 }
 
+// authState returns the current token and whether the client has logged in.
+func (c *DefaultEcloudClient) authState() (string, bool) {
+	c.authMu.RLock()
+	defer c.authMu.RUnlock()
+	return c.jwtToken, c.authenticated
+}
+
+// Refresh obtains a new token by logging in again.
+// Use errors.Is with ErrInvalidCredentials and ErrAuthUnavailable to tell
+// rejected credentials apart from a temporarily unreachable server.
+//
+// Concurrent calls share a single Login call and its result.
 func (c *DefaultEcloudClient) Refresh(ctx context.Context) error {
-	_, err := c.Login(ctx)
-	return err
+	return c.refreshToken(ctx, nil)
+}
+
+// refreshStaleToken refreshes the token after it was rejected with a 401,
+// unless another goroutine already replaced the stale token.
+func (c *DefaultEcloudClient) refreshStaleToken(ctx context.Context, staleToken string) error {
+	return c.refreshToken(ctx, &staleToken)
+}
+
+// refreshToken logs in again, joining a refresh already in flight.
+// If staleToken is not nil and the current token differs from it,
+// the token was refreshed in the meantime and no Login call is made.
+func (c *DefaultEcloudClient) refreshToken(ctx context.Context, staleToken *string) error {
+	c.refresh.mu.Lock()
+	if call := c.refresh.call; call != nil {
+		c.refresh.mu.Unlock()
+
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return fmt.Errorf("token refresh failed: %w", ctx.Err())
+		}
+	}
+
+	if staleToken != nil && c.GetToken() != *staleToken {
+		c.refresh.mu.Unlock()
+		return nil
+	}
+
+	call := &refreshCall{done: make(chan struct{})}
+	c.refresh.call = call
+	c.refresh.mu.Unlock()
+
+	if _, err := c.authenticate(ctx); err != nil {
+		call.err = fmt.Errorf("token refresh failed: %w", err)
+	}
+
+	c.refresh.mu.Lock()
+	c.refresh.call = nil
+	c.refresh.mu.Unlock()
+
+	close(call.done)
+	return call.err
 }
 
 // Billing implementation
-func (c *DefaultEcloudClient) GetBill(ctx context.Context) (*Bill, error) {
-	url := c.config.ApiBaseUrl + "/api/billing/get_bill"
+func (c *DefaultEcloudClient) GetBill(ctx context.Context) (_ *Bill, err error) {
+	ctx, span := c.startSpan(ctx, "GetBill")
+	defer func() { span.end(err) }()
+
+	expires, caching := c.cacheExpiry()
+	if bill, ok := c.cache.getBill(time.Now()); ok && caching {
+		return bill, nil
+	}
+
+	url := c.cfg().ApiBaseUrl + "/api/billing/get_bill"
 	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
 	if err != nil {
 		return nil, err
@@ -233,30 +609,181 @@ func (c *DefaultEcloudClient) GetBill(ctx context.Context) (*Bill, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to decode json for bill: %w", err)
 	}
+
+	c.reportWarnings("GetBill", subscription.Warnings)
+	if caching {
+		c.cache.putBill(*subscription, expires)
+	}
 	return subscription, nil
 }
 
+// GetBills fetches the bills for several facilities of a hospital group at once.
+// The result maps each hospital number to its bill.
+// If the server does not expose the bulk endpoint, the bills are fetched
+// a few at a time, one request per hospital. A response missing one of the
+// hospitals fails.
+func (c *DefaultEcloudClient) GetBills(ctx context.Context, hospitalNumbers []HospitalNumber) (map[HospitalNumber]*Bill, error) {
+	bills := make(map[HospitalNumber]*Bill, len(hospitalNumbers))
+	if len(hospitalNumbers) == 0 {
+		return bills, nil
+	}
+
+	for _, hospitalNumber := range hospitalNumbers {
+		if err := hospitalNumber.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(map[string][]HospitalNumber{"hospital_numbers": hospitalNumbers})
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	url := c.cfg().ApiBaseUrl + "/api/billing/get_bills"
+	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch bills: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		// Bulk endpoint absent on this deployment.
+		return c.getBillsParallel(ctx, hospitalNumbers)
+	default:
+		return nil, c.decodeError(resp)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&bills)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json for bills: %w", err)
+	}
+
+	for _, hospitalNumber := range hospitalNumbers {
+		if bills[hospitalNumber] == nil {
+			return nil, fmt.Errorf("bills response is missing hospital %s", hospitalNumber)
+		}
+	}
+	return bills, nil
+}
+
+// billConcurrency bounds the get_bill requests of getBillsParallel.
+const billConcurrency = 4
+
+// getBillsParallel fetches the bill of each hospital number with a bounded
+// pool of workers, one get_bill request per hospital. The first error cancels
+// the other requests.
+func (c *DefaultEcloudClient) getBillsParallel(ctx context.Context, hospitalNumbers []HospitalNumber) (map[HospitalNumber]*Bill, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+	)
+
+	bills := make(map[HospitalNumber]*Bill, len(hospitalNumbers))
+	queue := make(chan HospitalNumber)
+	for range min(billConcurrency, len(hospitalNumbers)) {
+		wg.Go(func() {
+			for hospitalNumber := range queue {
+				bill, err := c.getHospitalBill(ctx, hospitalNumber)
+
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("hospital %s: %w", hospitalNumber, err)
+					cancel()
+				}
+				if err == nil {
+					bills[hospitalNumber] = bill
+				}
+				mu.Unlock()
+			}
+		})
+	}
+
+	for _, hospitalNumber := range hospitalNumbers {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- hospitalNumber
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return bills, nil
+}
+
+func (c *DefaultEcloudClient) getHospitalBill(ctx context.Context, hospitalNumber HospitalNumber) (*Bill, error) {
+	target := c.cfg().ApiBaseUrl + "/api/billing/get_bill?hospital_number=" + neturl.QueryEscape(hospitalNumber.String())
+	resp, err := c.performRequest(ctx, http.MethodGet, target, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	bill := &Bill{}
+	err = json.NewDecoder(resp.Body).Decode(bill)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json for bill: %w", err)
+	}
+	return bill, nil
+}
+
 // Subscription implementation
-func (c *DefaultEcloudClient) Subscribe(ctx context.Context, req *SubscribeRequest) (*Subscriber, error) {
+func (c *DefaultEcloudClient) Subscribe(ctx context.Context, req *SubscribeRequest) (_ *Subscriber, err error) {
+	ctx, span := c.startSpan(ctx, "Subscribe")
+	defer func() { span.end(err) }()
+
+	if err := c.checkResidency(ctx); err != nil {
+		return nil, err
+	}
+
+	if c.cfg().CheckDuplicateSubscriptions {
+		if err := c.checkNotSubscribed(ctx, req.PatientID); err != nil {
+			return nil, err
+		}
+	}
+
 	sub := &Subscriber{
-		PatientID:      req.PatientID,
-		PatientName:    req.PatientName,
-		Email:          req.Email,
-		RegisteredBy:   req.RegisteredBy,
-		HospitalNumber: c.config.HospitalNumber,
-		HospitalName:   c.config.HospitalName,
+		PatientID:       req.PatientID,
+		PatientName:     req.PatientName,
+		Email:           req.Email,
+		RegisteredBy:    req.RegisteredBy,
+		HospitalNumber:  c.cfg().HospitalNumber,
+		HospitalName:    c.cfg().HospitalName,
+		ResidencyRegion: c.cfg().ResidencyRegion,
 	}
 
-	url := c.config.ApiBaseUrl + "/api/subscriptions"
+	url := c.cfg().ApiBaseUrl + "/api/subscriptions"
+
+	key := idempotencyKeyFor(ctx)
+	headers := map[string]string{IdempotencyKeyHeader: key}
 
 	data, _ := json.Marshal(sub)
-	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), nil)
+	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), headers)
 	if err != nil {
 		return nil, fmt.Errorf("unable to subscribe patient: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, c.decodeError(resp)
+		err := c.decodeError(resp)
+		if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusConflict {
+			return nil, c.alreadySubscribed(ctx, apiErr, req.PatientID)
+		}
+		return nil, err
 	}
 
 	// Decode subscription into same struct
@@ -264,11 +791,24 @@ func (c *DefaultEcloudClient) Subscribe(ctx context.Context, req *SubscribeReque
 	if err != nil {
 		return nil, fmt.Errorf("unable to decode json: %w", err)
 	}
+
+	sub.IdempotencyKey = key
+	c.cache.invalidate(sub.ID)
+	c.reportWarnings("Subscribe", sub.Warnings)
+	c.publish(ctx, Event{Type: EventSubscriberCreated, Subscriber: sub})
 	return sub, nil
 }
 
-func (c *DefaultEcloudClient) GetSubscriber(ctx context.Context, subscriberID uint) (*Subscriber, error) {
-	url := fmt.Sprintf("%s/api/subscriptions/%d", c.config.ApiBaseUrl, subscriberID)
+func (c *DefaultEcloudClient) GetSubscriber(ctx context.Context, subscriberID uint) (_ *Subscriber, err error) {
+	ctx, span := c.startSpan(ctx, "GetSubscriber")
+	defer func() { span.end(err) }()
+
+	expires, caching := c.cacheExpiry()
+	if subscriber, ok := c.cache.getSubscriber(subscriberID, time.Now()); ok && caching {
+		return subscriber, nil
+	}
+
+	url := fmt.Sprintf("%s/api/subscriptions/%d", c.cfg().ApiBaseUrl, subscriberID)
 
 	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
 	if err != nil {
@@ -276,7 +816,7 @@ func (c *DefaultEcloudClient) GetSubscriber(ctx context.Context, subscriberID ui
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, c.decodeError(resp)
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
 	}
 
 	subscriber := &Subscriber{}
@@ -284,12 +824,20 @@ func (c *DefaultEcloudClient) GetSubscriber(ctx context.Context, subscriberID ui
 	if err != nil {
 		return nil, fmt.Errorf("unable to decode subscriber json: %w", err)
 	}
+
+	c.reportWarnings("GetSubscriber", subscriber.Warnings)
+	if caching {
+		c.cache.putSubscribers([]*Subscriber{subscriber}, expires)
+	}
 	return subscriber, nil
 }
 
-func (c *DefaultEcloudClient) GetPatientSubscription(ctx context.Context, patientID uint) (*Subscriber, error) {
+func (c *DefaultEcloudClient) GetPatientSubscription(ctx context.Context, patientID uint) (_ *Subscriber, err error) {
+	ctx, span := c.startSpan(ctx, "GetPatientSubscription")
+	defer func() { span.end(err) }()
+
 	url := fmt.Sprintf("%s/api/subscriptions/check_subscription/%s/%d",
-		c.config.ApiBaseUrl, c.config.HospitalNumber, patientID)
+		c.cfg().ApiBaseUrl, c.cfg().HospitalNumber, patientID)
 
 	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
 	if err != nil {
@@ -297,7 +845,7 @@ func (c *DefaultEcloudClient) GetPatientSubscription(ctx context.Context, patien
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, c.decodeError(resp)
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
 	}
 
 	subscriber := new(Subscriber)
@@ -305,15 +853,26 @@ func (c *DefaultEcloudClient) GetPatientSubscription(ctx context.Context, patien
 	if err != nil {
 		return nil, fmt.Errorf("unable to decode json: %w", err)
 	}
+
+	c.reportWarnings("GetPatientSubscription", subscriber.Warnings)
 	return subscriber, nil
 }
 
+// GetHospitalSubscribers returns all the hospital subscribers in one response.
+// Use AllSubscribers or ListSubscribersPage for hospitals with many subscribers.
 func (c *DefaultEcloudClient) GetHospitalSubscribers(ctx context.Context) ([]*Subscriber, error) {
-	target := c.config.ApiBaseUrl + "/api/subscriptions?hospital_number=" + c.config.HospitalNumber
+	return c.ListSubscribers(ctx, nil)
+}
+
+// ListSubscribers returns the hospital subscribers matching filter.
+// A nil filter returns all subscribers.
+func (c *DefaultEcloudClient) ListSubscribers(ctx context.Context, filter *SubscriberFilter) ([]*Subscriber, error) {
+	target := c.subscribersURL(filter)
 	resp, err := c.performRequest(ctx, http.MethodGet, target, nil, nil)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, c.decodeError(resp)
@@ -328,12 +887,18 @@ func (c *DefaultEcloudClient) GetHospitalSubscribers(ctx context.Context) ([]*Su
 }
 
 func (c *DefaultEcloudClient) GetPendingSubscribers(ctx context.Context) ([]*Subscriber, error) {
-	url := fmt.Sprintf("%s/api/subscriptions/pending/%s", c.config.ApiBaseUrl, c.config.HospitalNumber)
+	expires, caching := c.cacheExpiry()
+	if subscribers, ok := c.cache.getPending(time.Now()); ok && caching {
+		return subscribers, nil
+	}
+
+	url := fmt.Sprintf("%s/api/subscriptions/pending/%s", c.cfg().ApiBaseUrl, c.cfg().HospitalNumber)
 
 	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
 	if err != nil {
 		return nil, fmt.Errorf("unable to fetch pending subscribers: %w", err)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, c.decodeError(resp)
@@ -344,11 +909,73 @@ func (c *DefaultEcloudClient) GetPendingSubscribers(ctx context.Context) ([]*Sub
 	if err != nil {
 		return nil, fmt.Errorf("unable to decode json: %w", err)
 	}
+	if caching {
+		c.cache.putPending(subscribers, expires)
+	}
 	return subscribers, nil
 }
 
+// GetCommunicationPreferences returns the SMS/email opt-in choices of a subscriber.
+// The HMS should consult these before triggering any notification.
+func (c *DefaultEcloudClient) GetCommunicationPreferences(ctx context.Context, subscriberID uint) (*CommunicationPreferences, error) {
+	url := fmt.Sprintf("%s/api/subscriptions/%d/preferences", c.cfg().ApiBaseUrl, subscriberID)
+
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch communication preferences: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
+	}
+
+	prefs := &CommunicationPreferences{}
+	err = json.NewDecoder(resp.Body).Decode(prefs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return prefs, nil
+}
+
+// UpdateCommunicationPreferences replaces the SMS/email opt-in choices of a subscriber
+// and returns the preferences as stored by the server.
+func (c *DefaultEcloudClient) UpdateCommunicationPreferences(ctx context.Context, subscriberID uint,
+	prefs *CommunicationPreferences) (*CommunicationPreferences, error) {
+	if prefs == nil {
+		return nil, fmt.Errorf("communication preferences must not be nil")
+	}
+
+	url := fmt.Sprintf("%s/api/subscriptions/%d/preferences", c.cfg().ApiBaseUrl, subscriberID)
+
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	resp, err := c.performRequest(ctx, http.MethodPut, url, bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to update communication preferences: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
+	}
+
+	updated := &CommunicationPreferences{}
+	err = json.NewDecoder(resp.Body).Decode(updated)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return updated, nil
+}
+
 // Create or renew payment.
-func (c *DefaultEcloudClient) CreatePayment(ctx context.Context, subscriberID uint, amountToPay float64, registeredBy string) (*Payment, error) {
+func (c *DefaultEcloudClient) CreatePayment(ctx context.Context, subscriberID uint, amountToPay float64, registeredBy string) (_ *Payment, err error) {
+	ctx, span := c.startSpan(ctx, "CreatePayment")
+	defer func() { span.end(err) }()
+
 	// validate the parameters
 	if subscriberID == 0 {
 		return nil, fmt.Errorf("subscriber id must not be zero")
@@ -356,6 +983,9 @@ func (c *DefaultEcloudClient) CreatePayment(ctx context.Context, subscriberID ui
 	if amountToPay < 0 {
 		return nil, fmt.Errorf("amount to be paid must be greater then zero")
 	}
+	if err := c.checkAmount(amountToPay); err != nil {
+		return nil, err
+	}
 	if registeredBy == "" {
 		return nil, fmt.Errorf("eclinic user making the payment (registered_by) must not be empty")
 	}
@@ -367,20 +997,23 @@ func (c *DefaultEcloudClient) CreatePayment(ctx context.Context, subscriberID ui
 		RegisteredBy: registeredBy,
 	}
 
-	url := fmt.Sprintf("%s/api/payments", c.config.ApiBaseUrl)
+	url := fmt.Sprintf("%s/api/payments", c.cfg().ApiBaseUrl)
 
 	data, err := json.Marshal(payment)
 	if err != nil {
 		return nil, fmt.Errorf("json.Marshal error: %w", err)
 	}
 
-	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), nil)
+	key := idempotencyKeyFor(ctx)
+	headers := map[string]string{IdempotencyKeyHeader: key}
+
+	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), headers)
 	if err != nil {
 		return nil, fmt.Errorf("unable to subscribe patient: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, c.decodeError(resp)
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
 	}
 
 	// Decode subscription into same struct
@@ -388,11 +1021,18 @@ func (c *DefaultEcloudClient) CreatePayment(ctx context.Context, subscriberID ui
 	if err != nil {
 		return nil, fmt.Errorf("unable to decode json: %w", err)
 	}
+
+	payment.IdempotencyKey = key
+	c.cache.invalidate(subscriberID)
+	c.reportWarnings("CreatePayment", payment.Warnings)
+	c.publish(ctx, Event{Type: EventPaymentRecorded, Payment: payment})
 	return payment, nil
 }
 
+// GetSubscriberPayments returns all the payments of a subscriber in one response.
+// Use GetSubscriberPaymentsPage to filter by date or page through long histories.
 func (c *DefaultEcloudClient) GetSubscriberPayments(ctx context.Context, subscriberID uint) ([]*Payment, error) {
-	url := fmt.Sprintf("%s/api/payments/list/%d", c.config.ApiBaseUrl, subscriberID)
+	url := fmt.Sprintf("%s/api/payments/list/%d", c.cfg().ApiBaseUrl, subscriberID)
 
 	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
 	if err != nil {
@@ -400,7 +1040,7 @@ func (c *DefaultEcloudClient) GetSubscriberPayments(ctx context.Context, subscri
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, c.decodeError(resp)
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
 	}
 
 	payments := []*Payment{}
@@ -411,41 +1051,55 @@ func (c *DefaultEcloudClient) GetSubscriberPayments(ctx context.Context, subscri
 	return payments, nil
 }
 
-// Compile regex patterns once at package level
-var (
-	pdfHeaderPattern = regexp.MustCompile(`^%PDF-1\.\d`)
-	pdfFooterPattern = regexp.MustCompile(`%%EOF\s*$`)
-)
+// ExportSignedPaymentReport downloads the hospital's payment report for the given period
+// together with its detached signature, and verifies the signature with
+// Config.ReportPublicKey before returning it. A report signed with another
+// key, or for another hospital or period, fails with ErrInvalidReportSignature.
+// The returned report is suitable for submission to revenue authority audits.
+func (c *DefaultEcloudClient) ExportSignedPaymentReport(ctx context.Context, period ReportPeriod) (*SignedPaymentReport, error) {
+	if err := period.Validate(); err != nil {
+		return nil, err
+	}
 
-// isValidPDF checks if the provided byte slice contains a valid PDF file
-func isValidPDF(data []byte) bool {
-	// Check if data is empty
-	if len(data) == 0 {
-		return false
+	config := c.cfg()
+	if len(config.ReportPublicKey) != ed25519.PublicKeySize || config.ReportKeyID == "" {
+		return nil, ErrReportPublicKeyRequired
 	}
 
-	// Check PDF header (first 8 bytes should contain "%PDF-1." followed by a digit)
-	if len(data) < 8 {
-		return false
+	query := neturl.Values{}
+	query.Set("hospital_number", c.cfg().HospitalNumber.String())
+	query.Set("from", period.From.Format(time.RFC3339))
+	query.Set("to", period.To.Format(time.RFC3339))
+
+	url := c.cfg().ApiBaseUrl + "/api/payments/export/signed?" + query.Encode()
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to export payment report: %w", err)
 	}
+	defer resp.Body.Close()
 
-	// PDF header pattern: %PDF-1.\d
-	if !pdfHeaderPattern.Match(data[:8]) {
-		return false
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
 	}
 
-	// Check PDF footer (should contain "%%EOF" somewhere at the end)
-	// Check the last 1024 bytes to find the EOF marker
-	endBytes := data[max(0, len(data)-1024):]
-	if !pdfFooterPattern.Match(endBytes) {
-		return false
+	report := &SignedPaymentReport{}
+	err = json.NewDecoder(resp.Body).Decode(report)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
 	}
 
-	// Check for startxref and cross-reference table
-	if !bytes.Contains(data, []byte("startxref")) {
-		return false
+	switch {
+	case report.KeyID != config.ReportKeyID:
+		return nil, fmt.Errorf("%w: signed with key %q, expected %q", ErrInvalidReportSignature, report.KeyID, config.ReportKeyID)
+	case !report.Verify(config.ReportPublicKey):
+		return nil, ErrInvalidReportSignature
+	case report.HospitalNumber != config.HospitalNumber:
+		return nil, fmt.Errorf("%w: signed for hospital %s", ErrInvalidReportSignature, report.HospitalNumber)
+	case !report.Period.From.Equal(period.From) || !report.Period.To.Equal(period.To):
+		return nil, fmt.Errorf("%w: signed for period %s to %s", ErrInvalidReportSignature,
+			formatSignedTime(report.Period.From), formatSignedTime(report.Period.To))
 	}
-	return true
+	return report, nil
 }
 
 const (
@@ -454,87 +1108,210 @@ const (
 
 	medicalReportFieldName = "medical_report"
 	medicalReportFileName  = "medical_report.pdf"
+
+	pdfContentType = "application/pdf"
 )
 
 // Records implementation
+
+// SyncMedicalRecords uploads a record. Use SyncMedicalRecordsV2 to get the
+// record ID and stored files.
 func (c *DefaultEcloudClient) SyncMedicalRecords(ctx context.Context, patientRecord *PatientRecord) error {
-	if err := patientRecord.Validate(); err != nil {
-		return fmt.Errorf("validation error: %w", err)
+	_, err := c.SyncMedicalRecordsV2(ctx, patientRecord)
+	return err
+}
+
+// syncRecord validates and uploads a single record, adding the given headers to the request.
+// It returns the metadata of the uploaded record, see syncedRecord, and what ecloud stored.
+func (c *DefaultEcloudClient) syncRecord(ctx context.Context, patientRecord *PatientRecord,
+	extraHeaders map[string]string) (*PatientRecord, *SyncResult, error) {
+	patientRecord, err := c.prepareRecord(ctx, patientRecord)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parts, err := c.reportParts(patientRecord)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	var buffer bytes.Buffer
-	var part io.Writer
-	var err error
+	parts, err = c.encryptReports(ctx, parts)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields := c.recordFields(patientRecord)
 
-	// Create a new multipart request
-	writer := multipart.NewWriter(&buffer)
+	// Stream the multipart body instead of buffering the reports in memory.
+	body := newMultipartBody(parts, fields)
 
-	// Check if facility turned off medical report uploads.
-	if c.config.UploadMedicalReport && patientRecord.MedicalReport != nil {
-		// If a medical report exists, add it to multipart request.
-		if !isValidPDF(patientRecord.LabReport) {
-			return ErrInvalidMedicalReportPDF
+	total := int64(0)
+	for _, part := range parts {
+		if part.size < 0 {
+			total = -1
+			break
 		}
+		total += part.size
+	}
+	body.progress = c.newProgress(ctx, "SyncMedicalRecords",
+		syncedRecord(patientRecord, 0, c.cfg().HospitalNumber), total)
 
-		part, err = writer.CreateFormFile(medicalReportFieldName, medicalReportFileName)
+	// Create custom headers to set content type for the form-data.
+	headers := map[string]string{"Content-Type": body.contentType()}
+	if checksums := checksumHeader(parts); checksums != "" {
+		headers[ReportSHA256Header] = checksums
+	}
+	for key, value := range extraHeaders {
+		headers[key] = value
+	}
+
+	// Construct upload url.
+	url := c.cfg().ApiBaseUrl + "/api/records"
+
+	// Throttle every attempt to the configured upload rate.
+	rate := c.cfg().UploadRateLimit
+	open := func() (io.Reader, error) {
+		r, err := body.open()
 		if err != nil {
-			return fmt.Errorf("error creating form file: %w", err)
+			return nil, err
 		}
+		return newThrottledReader(ctx, r, rate), nil
+	}
 
-		_, err = part.Write(patientRecord.MedicalReport)
-		if err != nil {
-			return fmt.Errorf("error writing form file: %w", err)
+	// Perform the request
+	resp, err := c.performRequest(ctx, http.MethodPost, url, NewRetryableBody(open), headers)
+
+	// Report failed streaming checks (e.g an invalid PDF) over the transport error.
+	if err := body.wait(); err != nil {
+		if resp != nil {
+			resp.Body.Close()
 		}
+		return nil, nil, err
+	}
 
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to sync medical records: %w", err)
 	}
+	defer resp.Body.Close()
 
-	// If a lab report exists, add it to multipart request.
-	if patientRecord.LabReport != nil {
-		if !isValidPDF(patientRecord.LabReport) {
-			return ErrInvalidLabReportPDF
+	// The body carries the record ID, the stored files and their checksums
+	// and the warnings, if any. Records processed asynchronously carry them
+	// in the result of their operation.
+	result := &SyncResult{}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(result); err == nil {
+			c.reportWarnings("SyncMedicalRecords", result.Warnings)
 		}
-
-		part, err = writer.CreateFormFile(labReportFieldName, labReportFileName)
+	case http.StatusAccepted:
+		op, err := c.newOperation(resp)
 		if err != nil {
-			return fmt.Errorf("error creating form file: %w", err)
+			return nil, nil, fmt.Errorf("unable to sync medical records: %w", err)
+		}
+
+		if err := op.Wait(ctx); err != nil {
+			return nil, nil, fmt.Errorf("unable to sync medical records: %w", err)
+		}
+
+		if err := op.Decode(result); err != nil {
+			return nil, nil, err
+		}
+		result.Operation = op
+		c.reportWarnings("SyncMedicalRecords", result.Warnings)
+	default:
+		return nil, nil, c.decodeError(resp)
+	}
+
+	if err := verifyChecksums(body.checksums, result.Checksums); err != nil {
+		return nil, nil, err
+	}
+	return syncedRecord(patientRecord, result.RecordID, c.cfg().HospitalNumber), result, nil
+}
+
+// prepareRecord normalizes and validates a record before its upload and checks
+// that the deployment can store it. The caller's record is left untouched.
+func (c *DefaultEcloudClient) prepareRecord(ctx context.Context, patientRecord *PatientRecord) (*PatientRecord, error) {
+	// Normalize the title on a copy to leave the caller's record untouched.
+	if normalizer := c.cfg().TitleNormalizer; normalizer != nil && patientRecord != nil {
+		var title string
+		var err error
+		panicErr := safeCall(c.logger, "TitleNormalizer", func() {
+			title, err = normalizer.NormalizeTitle(patientRecord)
+		})
+		if panicErr != nil {
+			return nil, fmt.Errorf("unable to normalize title: %w", panicErr)
 		}
 
-		_, err = part.Write(patientRecord.LabReport)
 		if err != nil {
-			return fmt.Errorf("error writing form file: %w", err)
+			return nil, fmt.Errorf("unable to normalize title: %w", err)
 		}
+
+		normalized := *patientRecord
+		normalized.Title = title
+		patientRecord = &normalized
 	}
 
-	// We don't expect any errors here.
-	_ = writer.WriteField("hospital_number", c.config.HospitalNumber)
-	_ = writer.WriteField("visit_id", fmt.Sprintf("%d", patientRecord.VisitID))
-	_ = writer.WriteField("subscriber_id", fmt.Sprintf("%d", patientRecord.SubscriberID))
-	_ = writer.WriteField("visit_timestamp", patientRecord.VisitTimestamp.Format(time.RFC3339))
-	_ = writer.WriteField("title", patientRecord.Title)
+	if err := patientRecord.Validate(); err != nil {
+		return nil, fmt.Errorf("validation error: %w", err)
+	}
 
-	// Close the multipart writer to flush.
-	err = writer.Close()
+	patientRecord, err := c.convertToPDFA(ctx, patientRecord)
 	if err != nil {
-		return fmt.Errorf("error closing multipart writer: %w", err)
+		return nil, err
 	}
 
-	// Get content type header.
-	contentType := writer.FormDataContentType()
+	if err := c.cfg().ValidationRules.Validate(patientRecord); err != nil {
+		return nil, fmt.Errorf("validation error: %w", err)
+	}
 
-	// Create custom headers to set content type for the form-data.
-	headers := map[string]string{"Content-Type": contentType}
+	if c.cfg().Environment == EnvironmentSandbox {
+		if err := validateSandboxRecord(patientRecord); err != nil {
+			return nil, fmt.Errorf("validation error: %w", err)
+		}
+	}
 
-	// Construct upload url.
-	url := c.config.ApiBaseUrl + "/api/records"
+	if err := c.checkResidency(ctx); err != nil {
+		return nil, err
+	}
+	return patientRecord, nil
+}
 
-	// Perform the request
-	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(buffer.Bytes()), headers)
-	if err != nil {
-		return fmt.Errorf("unable to sync medical records: %w", err)
+// recordFields returns the form fields of a record upload, in upload order.
+func (c *DefaultEcloudClient) recordFields(patientRecord *PatientRecord) [][2]string {
+	fields := [][2]string{
+		{"hospital_number", c.cfg().HospitalNumber.String()},
+		{"visit_id", fmt.Sprintf("%d", patientRecord.VisitID)},
+		{"subscriber_id", fmt.Sprintf("%d", patientRecord.SubscriberID)},
+		{"visit_timestamp", patientRecord.VisitTimestamp.Format(time.RFC3339)},
+		{"title", patientRecord.Title},
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return c.decodeError(resp)
+	if c.cfg().Environment == EnvironmentSandbox {
+		fields = append(fields, [2]string{"environment", string(EnvironmentSandbox)})
+	}
+
+	if c.cfg().ResidencyRegion != "" {
+		fields = append(fields, [2]string{"residency_region", c.cfg().ResidencyRegion})
+	}
+
+	if c.keyProvider() != nil {
+		fields = append(fields, [2]string{"report_encryption", ReportEncryptionScheme})
+	}
+	return append(fields, attachmentFields(patientRecord)...)
+}
+
+// syncedRecord returns the metadata of an uploaded record, without the
+// content of its reports and attachments.
+func syncedRecord(record *PatientRecord, id uint, hospitalNumber HospitalNumber) *PatientRecord {
+	synced := *record
+	synced.ID = id
+	synced.HospitalNumber = hospitalNumber
+	synced.MedicalReport, synced.LabReport = nil, nil
+	synced.MedicalReportReader, synced.LabReportReader = nil, nil
+	synced.files = nil
+
+	synced.Attachments = slices.Clone(record.Attachments)
+	for i := range synced.Attachments {
+		synced.Attachments[i].Data, synced.Attachments[i].Reader = nil, nil
 	}
-	return nil
+	return &synced
 }
@@ -2,14 +2,40 @@
 package ecloudsdk
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
 	"time"
+
+	"github.com/abiiranathan/ecloud-sdk/pdf"
 )
 
 // mockHTTPClient is a mock implementation of the HTTPClient interface.
@@ -33,6 +59,10 @@ func newTestClient(doFunc func(req *http.Request) (*http.Response, error)) (Eclo
 		Password:       "test-password",
 		HospitalNumber: "HOS-123",
 		HospitalName:   "Test Hospital",
+		EclinicBaseUrl: "http://eclinic",
+
+		UploadMedicalReport: true,
+		RetryBaseDelay:      time.Millisecond, // Keep retries of failed responses fast.
 		HTTPClient: &mockHTTPClient{
 			DoFunc: doFunc,
 		},
@@ -50,14 +80,14 @@ func newJSONResponse(statusCode int, body string) *http.Response {
 	}
 }
 
-// A minimal valid PDF byte slice to pass the isValidPDF check.
+// A minimal valid PDF byte slice to pass the pdf.Validate check.
 var validPDFBytes = []byte("%PDF-1.7\n" +
 	"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
 	"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
 	"3 0 obj << /Type /Page /MediaBox [0 0 612 792] >> endobj\n" +
-	"xref\n0 4\n0000000000 65535 f \n0000000010 00000 n \n0000000059 00000 n \n0000000112 00000 n \n" +
+	"xref\n0 4\n0000000000 65535 f \n0000000009 00000 n \n0000000058 00000 n \n0000000115 00000 n \n" +
 	"trailer << /Size 4 /Root 1 0 R >>\n" +
-	"startxref\n178\n" +
+	"startxref\n172\n" +
 	"%%EOF")
 
 func TestNewEcloudClient(t *testing.T) {
@@ -68,6 +98,7 @@ func TestNewEcloudClient(t *testing.T) {
 			Password:       "test-password",
 			HospitalNumber: "HOS-123",
 			HospitalName:   "Test Hospital",
+			EclinicBaseUrl: "http://eclinic",
 		}
 		client, err := NewEcloudClient(config)
 		if err != nil {
@@ -145,6 +176,98 @@ func TestLogin(t *testing.T) {
 	})
 }
 
+// noBackoffRetryPolicy retries like the default policy without sleeping.
+type noBackoffRetryPolicy struct{ DefaultRetryPolicy }
+
+func (p *noBackoffRetryPolicy) BackoffDuration(attempt int) time.Duration { return 0 }
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Retries transient failures", func(t *testing.T) {
+		var calls atomic.Int32
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			switch calls.Add(1) {
+			case 1:
+				return nil, fmt.Errorf("connection reset by peer")
+			case 2:
+				return newJSONResponse(http.StatusServiceUnavailable, `{"error":"maintenance"}`), nil
+			}
+			return newJSONResponse(http.StatusOK, `{"token": "fresh-token"}`), nil
+		})
+		client.(*DefaultEcloudClient).retryPolicy = &noBackoffRetryPolicy{DefaultRetryPolicy{maxRetries: 3}}
+
+		if err := client.Refresh(ctx); err != nil {
+			t.Fatalf("Refresh() failed: %v", err)
+		}
+		if client.GetToken() != "fresh-token" {
+			t.Errorf("expected token 'fresh-token', got '%s'", client.GetToken())
+		}
+	})
+
+	t.Run("Invalid credentials are terminal", func(t *testing.T) {
+		var calls atomic.Int32
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			return newJSONResponse(http.StatusUnauthorized, `{"error":"invalid credentials"}`), nil
+		})
+		client.(*DefaultEcloudClient).retryPolicy = &noBackoffRetryPolicy{DefaultRetryPolicy{maxRetries: 3}}
+		client.(*DefaultEcloudClient).authenticated = true
+
+		err := client.Refresh(ctx)
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("expected error %v, got %v", ErrInvalidCredentials, err)
+		}
+		if calls.Load() != 1 {
+			t.Errorf("expected a single login attempt, got %d", calls.Load())
+		}
+	})
+
+	t.Run("Transient failures exhausted", func(t *testing.T) {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("no route to host")
+		})
+		client.(*DefaultEcloudClient).retryPolicy = &noBackoffRetryPolicy{DefaultRetryPolicy{maxRetries: 2}}
+
+		err := client.Refresh(ctx)
+		if !errors.Is(err, ErrAuthUnavailable) {
+			t.Errorf("expected error %v, got %v", ErrAuthUnavailable, err)
+		}
+	})
+	t.Run("Concurrent refreshes are coalesced", func(t *testing.T) {
+		var logins atomic.Int32
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/api/auth/login" {
+				logins.Add(1)
+				time.Sleep(20 * time.Millisecond)
+				return newJSONResponse(http.StatusOK, `{"token": "fresh-token"}`), nil
+			}
+
+			if req.Header.Get("Authorization") != "Bearer fresh-token" {
+				return newJSONResponse(http.StatusUnauthorized, `{"error":"token expired"}`), nil
+			}
+			return newJSONResponse(http.StatusOK, `{"Amount": 5000}`), nil
+		})
+		client.(*DefaultEcloudClient).retryPolicy = &noBackoffRetryPolicy{DefaultRetryPolicy{maxRetries: 3}}
+		client.(*DefaultEcloudClient).jwtToken = "expired-token"
+		client.(*DefaultEcloudClient).authenticated = true
+
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Go(func() {
+				if _, err := client.GetBill(ctx); err != nil {
+					t.Errorf("GetBill() failed: %v", err)
+				}
+			})
+		}
+		wg.Wait()
+
+		if logins.Load() != 1 {
+			t.Errorf("expected a single login, got %d", logins.Load())
+		}
+	})
+}
+
 func TestGetBill(t *testing.T) {
 	ctx := context.Background()
 	mockResponse := `{"Amount": 5000.0, "Duration": 2592000000000000}` // 30 days in nanoseconds
@@ -179,6 +302,101 @@ func TestGetBill(t *testing.T) {
 	}
 }
 
+func TestGetBills(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Bulk endpoint", func(t *testing.T) {
+		mockResponse := `{"HOS-1": {"Amount": 5000}, "HOS-2": {"Amount": 7000}}`
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != "/api/billing/get_bills" {
+				return nil, fmt.Errorf("unexpected path: %s", req.URL.Path)
+			}
+			return newJSONResponse(http.StatusOK, mockResponse), nil
+		})
+
+		bills, err := client.GetBills(ctx, []HospitalNumber{"HOS-1", "HOS-2"})
+		if err != nil {
+			t.Fatalf("GetBills() failed: %v", err)
+		}
+		if len(bills) != 2 || bills["HOS-2"].Amount != 7000 {
+			t.Errorf("unexpected bills: %+v", bills)
+		}
+	})
+
+	t.Run("Fallback to parallel fan-out", func(t *testing.T) {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/api/billing/get_bills" {
+				return newJSONResponse(http.StatusNotFound, `{"error":"not found"}`), nil
+			}
+			switch req.URL.Query().Get("hospital_number") {
+			case "HOS-1":
+				return newJSONResponse(http.StatusOK, `{"Amount": 5000}`), nil
+			case "HOS-2":
+				return newJSONResponse(http.StatusOK, `{"Amount": 7000}`), nil
+			}
+			return newJSONResponse(http.StatusBadRequest, `{"error":"unknown hospital"}`), nil
+		})
+
+		bills, err := client.GetBills(ctx, []HospitalNumber{"HOS-1", "HOS-2"})
+		if err != nil {
+			t.Fatalf("GetBills() failed: %v", err)
+		}
+		if bills["HOS-1"].Amount != 5000 || bills["HOS-2"].Amount != 7000 {
+			t.Errorf("unexpected bills: %+v", bills)
+		}
+	})
+
+	t.Run("Bulk response missing a hospital", func(t *testing.T) {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			return newJSONResponse(http.StatusOK, `{"HOS-1": {"Amount": 5000}}`), nil
+		})
+
+		if _, err := client.GetBills(ctx, []HospitalNumber{"HOS-1", "HOS-2"}); err == nil || !strings.Contains(err.Error(), "HOS-2") {
+			t.Errorf("expected the missing hospital to fail, got %v", err)
+		}
+	})
+
+	t.Run("Bounded fan-out stops at the first error", func(t *testing.T) {
+		var mu sync.Mutex
+		var inFlight, maxInFlight, requests int
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/api/billing/get_bills" {
+				return newJSONResponse(http.StatusNotFound, `{"error":"not found"}`), nil
+			}
+			mu.Lock()
+			requests++
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+			}()
+
+			time.Sleep(5 * time.Millisecond)
+			if req.URL.Query().Get("hospital_number") == "HOS-1" {
+				return newJSONResponse(http.StatusBadRequest, `{"error":"unknown hospital"}`), nil
+			}
+			return newJSONResponse(http.StatusOK, `{"Amount": 5000}`), nil
+		})
+
+		var hospitalNumbers []HospitalNumber
+		for i := range 50 {
+			hospitalNumbers = append(hospitalNumbers, HospitalNumber(fmt.Sprintf("HOS-%d", i+1)))
+		}
+		if _, err := client.GetBills(ctx, hospitalNumbers); err == nil || !strings.Contains(err.Error(), "HOS-1:") {
+			t.Errorf("expected HOS-1 to fail, got %v", err)
+		}
+		if maxInFlight > billConcurrency {
+			t.Errorf("expected at most %d concurrent requests, got %d", billConcurrency, maxInFlight)
+		}
+		if requests >= len(hospitalNumbers) {
+			t.Errorf("expected the error to cancel the remaining requests, got %d requests", requests)
+		}
+	})
+}
+
 func TestSubscription(t *testing.T) {
 	ctx := context.Background()
 	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
@@ -212,6 +430,34 @@ func TestSubscription(t *testing.T) {
 	})
 }
 
+func TestWarnings(t *testing.T) {
+	respBody := `{"id": 101, "warnings": ["subscriber near expiry", {"code": "W42", "message": "email bounced"}]}`
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return newJSONResponse(http.StatusOK, respBody), nil
+	})
+
+	var handled []Warning
+	client.(*DefaultEcloudClient).config.WarningHandler = func(operation string, warning Warning) {
+		if operation != "GetSubscriber" {
+			t.Errorf("expected operation GetSubscriber, got %s", operation)
+		}
+		handled = append(handled, warning)
+	}
+
+	subscriber, err := client.GetSubscriber(context.Background(), 101)
+	if err != nil {
+		t.Fatalf("GetSubscriber() failed: %v", err)
+	}
+
+	expected := []Warning{{Message: "subscriber near expiry"}, {Code: "W42", Message: "email bounced"}}
+	if !slices.Equal(subscriber.Warnings, expected) {
+		t.Errorf("expected warnings %v, got %v", expected, subscriber.Warnings)
+	}
+	if !slices.Equal(handled, expected) {
+		t.Errorf("expected handled warnings %v, got %v", expected, handled)
+	}
+}
+
 func TestPayment(t *testing.T) {
 	ctx := context.Background()
 
@@ -254,6 +500,107 @@ func TestPayment(t *testing.T) {
 	})
 }
 
+func TestExportSignedPaymentReport(t *testing.T) {
+	ctx := context.Background()
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	period := ReportPeriod{
+		From: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+	newSignedReport := func() *SignedPaymentReport {
+		return &SignedPaymentReport{
+			HospitalNumber: "HOS-123",
+			Period:         period,
+			Report:         []byte("id,amount\n1,5000\n"),
+			ContentType:    "text/csv",
+			KeyID:          "2025-01",
+			GeneratedAt:    time.Date(2025, 2, 1, 6, 0, 0, 0, time.UTC),
+		}
+	}
+	sign := func(report *SignedPaymentReport) *SignedPaymentReport {
+		report.Signature = ed25519.Sign(privateKey, report.SignedData())
+		return report
+	}
+
+	newReportClient := func(report *SignedPaymentReport) EcloudClient {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path != "/api/payments/export/signed" {
+				return nil, fmt.Errorf("unexpected path: %s", req.URL.Path)
+			}
+			body, _ := json.Marshal(report)
+			return newJSONResponse(http.StatusOK, string(body)), nil
+		})
+		config := client.(*DefaultEcloudClient).config
+		config.ReportPublicKey, config.ReportKeyID = publicKey, "2025-01"
+		return client
+	}
+
+	t.Run("Valid signature", func(t *testing.T) {
+		client := newReportClient(sign(newSignedReport()))
+		signed, err := client.ExportSignedPaymentReport(ctx, period)
+		if err != nil {
+			t.Fatalf("ExportSignedPaymentReport() failed: %v", err)
+		}
+		if !bytes.Equal(signed.Report, newSignedReport().Report) || !signed.Period.From.Equal(period.From) {
+			t.Errorf("unexpected report %+v", signed)
+		}
+		if !signed.Verify(publicKey) {
+			t.Error("expected the returned report to verify")
+		}
+	})
+
+	tests := []struct {
+		name   string
+		report func() *SignedPaymentReport
+	}{
+		{"Tampered report", func() *SignedPaymentReport {
+			report := sign(newSignedReport())
+			report.Report = []byte("id,amount\n1,50\n")
+			return report
+		}},
+		{"Unsigned envelope changed", func() *SignedPaymentReport {
+			report := sign(newSignedReport())
+			report.GeneratedAt = report.GeneratedAt.Add(time.Hour)
+			return report
+		}},
+		{"Another period", func() *SignedPaymentReport {
+			report := newSignedReport()
+			report.Period.To = time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+			return sign(report)
+		}},
+		{"Another hospital", func() *SignedPaymentReport {
+			report := newSignedReport()
+			report.HospitalNumber = "HOS-456"
+			return sign(report)
+		}},
+		{"Another key", func() *SignedPaymentReport {
+			report := newSignedReport()
+			report.KeyID = "2024-12"
+			return sign(report)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newReportClient(tt.report())
+			if _, err := client.ExportSignedPaymentReport(ctx, period); !errors.Is(err, ErrInvalidReportSignature) {
+				t.Errorf("expected error %v, got %v", ErrInvalidReportSignature, err)
+			}
+		})
+	}
+
+	t.Run("Key ID required", func(t *testing.T) {
+		client := newReportClient(sign(newSignedReport()))
+		client.(*DefaultEcloudClient).config.ReportKeyID = ""
+		if _, err := client.ExportSignedPaymentReport(ctx, period); !errors.Is(err, ErrReportPublicKeyRequired) {
+			t.Errorf("expected error %v, got %v", ErrReportPublicKeyRequired, err)
+		}
+	})
+}
+
 func TestSyncMedicalRecords(t *testing.T) {
 	ctx := context.Background()
 
@@ -295,11 +642,14 @@ func TestSyncMedicalRecords(t *testing.T) {
 			}
 
 			// Check lab report file
-			labFile, _, err := req.FormFile(labReportFieldName)
+			labFile, labHeader, err := req.FormFile(labReportFieldName)
 			if err != nil {
 				t.Fatalf("expected file '%s', but not found: %v", labReportFieldName, err)
 			}
 			defer labFile.Close()
+			if ct := labHeader.Header.Get("Content-Type"); ct != "application/pdf" {
+				t.Errorf("expected lab report content type application/pdf, got %s", ct)
+			}
 			labData, _ := io.ReadAll(labFile)
 			if !bytes.Equal(labData, validPDFBytes) {
 				t.Error("lab report content mismatch")
@@ -350,11 +700,70 @@ func TestSyncMedicalRecords(t *testing.T) {
 			t.Fatal("expected an error for invalid PDF, but got nil")
 		}
 
-		if err != ErrInvalidLabReportPDF {
+		if !errors.Is(err, ErrInvalidLabReportPDF) || !errors.Is(err, pdf.ErrNotPDF) {
 			t.Errorf("expected error %v, got %v", ErrInvalidLabReportPDF, err)
 		}
 	})
 
+	t.Run("Failure on invalid medical report with valid lab report", func(t *testing.T) {
+		patientRecord := &PatientRecord{
+			VisitID:        999,
+			SubscriberID:   101,
+			Title:          "Annual Checkup",
+			VisitTimestamp: time.Now(),
+			MedicalReport:  bytes.Replace(validPDFBytes, []byte("/Count 1"), []byte("/Count 0"), 1),
+			LabReport:      validPDFBytes,
+		}
+
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			t.Fatal("http.Do should not have been called for client-side validation failure")
+			return nil, nil
+		})
+
+		err := client.SyncMedicalRecords(ctx, patientRecord)
+		if !errors.Is(err, ErrInvalidMedicalReportPDF) || !errors.Is(err, pdf.ErrNoPages) {
+			t.Errorf("expected error %v, got %v", ErrInvalidMedicalReportPDF, err)
+		}
+	})
+
+	t.Run("Failure on report above Config.MaxReportSize", func(t *testing.T) {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			t.Fatal("http.Do should not have been called for client-side validation failure")
+			return nil, nil
+		})
+		client.(*DefaultEcloudClient).config.MaxReportSize = int64(len(validPDFBytes) - 1)
+
+		err := client.SyncMedicalRecords(ctx, &PatientRecord{VisitID: 999, SubscriberID: 101,
+			Title: "Annual Checkup", VisitTimestamp: time.Now(), LabReport: validPDFBytes})
+		if !errors.Is(err, ErrInvalidLabReportPDF) || !errors.Is(err, pdf.ErrTooLarge) {
+			t.Errorf("expected error %v, got %v", pdf.ErrTooLarge, err)
+		}
+	})
+
+	t.Run("Failure on renamed document", func(t *testing.T) {
+		patientRecord := &PatientRecord{
+			VisitID:        999,
+			SubscriberID:   101,
+			Title:          "Annual Checkup",
+			VisitTimestamp: time.Now(),
+			LabReport:      []byte("PK\x03\x04\x14\x00\x06\x00word/document.xml"), // .docx is a zip archive.
+		}
+
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			t.Fatal("http.Do should not have been called for client-side validation failure")
+			return nil, nil
+		})
+
+		err := client.SyncMedicalRecords(ctx, patientRecord)
+		var mismatch *ContentTypeMismatchError
+		if !errors.As(err, &mismatch) {
+			t.Fatalf("expected *ContentTypeMismatchError, got %v", err)
+		}
+		if mismatch.Field != labReportFieldName || mismatch.Detected != "application/zip" {
+			t.Errorf("unexpected mismatch error: %+v", mismatch)
+		}
+	})
+
 	t.Run("Failure on server error", func(t *testing.T) {
 		patientRecord := &PatientRecord{
 			VisitID:        999,
@@ -380,6 +789,41 @@ func TestSyncMedicalRecords(t *testing.T) {
 	})
 }
 
+func TestValidationRules(t *testing.T) {
+	record := &PatientRecord{
+		VisitID:        999,
+		SubscriberID:   101,
+		Title:          "ANC Visit",
+		VisitTimestamp: time.Now(),
+		MedicalReport:  validPDFBytes,
+	}
+
+	rules := &ValidationRules{AllowedTitles: []string{"anc visit", "Delivery"}}
+	if err := rules.Validate(record); err != nil {
+		t.Errorf("expected record to pass, got %v", err)
+	}
+
+	rules.RequiredFields = []string{FieldLabReport}
+	if err := rules.Validate(record); err == nil {
+		t.Error("expected error for missing lab report, got nil")
+	}
+
+	rules = &ValidationRules{MaxReportSize: 10}
+	if err := rules.Validate(record); err == nil {
+		t.Error("expected error for oversized report, got nil")
+	}
+
+	rules = &ValidationRules{AllowedTitles: []string{"Delivery"}}
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		t.Fatal("http.Do should not have been called for client-side validation failure")
+		return nil, nil
+	})
+	client.(*DefaultEcloudClient).config.ValidationRules = rules
+	if err := client.SyncMedicalRecords(context.Background(), record); err == nil {
+		t.Error("expected SyncMedicalRecords to enforce validation rules")
+	}
+}
+
 // Test for one of the getter methods to ensure the pattern works
 func TestGetHospitalSubscribers(t *testing.T) {
 	ctx := context.Background()
@@ -416,3 +860,5104 @@ func TestGetHospitalSubscribers(t *testing.T) {
 		t.Errorf("expected second subscriber name 'Bob', got '%s'", subscribers[1].PatientName)
 	}
 }
+
+// closeCountingBody counts the calls to Close of a response body.
+type closeCountingBody struct {
+	io.Reader
+	closes *atomic.Int32
+}
+
+func (b closeCountingBody) Close() error {
+	b.closes.Add(1)
+	return nil
+}
+
+func TestSubscriberListsCloseBody(t *testing.T) {
+	var responses, closes atomic.Int32
+	status := http.StatusOK
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		responses.Add(1)
+		resp := newJSONResponse(status, `[{"id": 1, "patient_name": "Alice"}]`)
+		if status != http.StatusOK {
+			resp = newJSONResponse(status, `{"error": "invalid filter"}`)
+		}
+		resp.Body = closeCountingBody{Reader: resp.Body, closes: &closes}
+		return resp, nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+	ctx := context.Background()
+
+	client.GetHospitalSubscribers(ctx)
+	client.GetPendingSubscribers(ctx)
+	status = http.StatusBadRequest
+	client.ListSubscribers(ctx, nil)
+
+	if responses.Load() != 3 || closes.Load() < responses.Load() {
+		t.Errorf("expected every response body to be closed, %d of %d closed", closes.Load(), responses.Load())
+	}
+}
+
+func TestWatchSubscribers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var polls atomic.Int32
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch polls.Add(1) {
+		case 1:
+			resp := newJSONResponse(http.StatusOK, `[{"id": 1, "patient_name": "Alice"}, {"id": 2, "patient_name": "Bob"}]`)
+			resp.Header.Set("ETag", `"v1"`)
+			return resp, nil
+		case 2:
+			if req.Header.Get("If-None-Match") != `"v1"` {
+				t.Errorf("expected If-None-Match \"v1\", got %q", req.Header.Get("If-None-Match"))
+			}
+			return newJSONResponse(http.StatusNotModified, ""), nil
+		default:
+			resp := newJSONResponse(http.StatusOK, `[{"id": 1, "patient_name": "Alice N."}, {"id": 3, "patient_name": "Carol"}]`)
+			resp.Header.Set("ETag", `"v2"`)
+			return resp, nil
+		}
+	})
+
+	changes, err := client.WatchSubscribers(ctx, time.Millisecond)
+	if err != nil {
+		t.Fatalf("WatchSubscribers() failed: %v", err)
+	}
+
+	// Initial snapshot.
+	for range 2 {
+		if change := <-changes; change.Type != SubscriberAdded {
+			t.Errorf("expected initial change to be added, got %v", change.Type)
+		}
+	}
+
+	got := map[uint]SubscriberChangeType{}
+	for range 3 {
+		change := <-changes
+		got[change.Subscriber.ID] = change.Type
+	}
+
+	expected := map[uint]SubscriberChangeType{
+		1: SubscriberUpdated,
+		2: SubscriberRemoved,
+		3: SubscriberAdded,
+	}
+	for id, changeType := range expected {
+		if got[id] != changeType {
+			t.Errorf("expected change %v for subscriber %d, got %v", changeType, id, got[id])
+		}
+	}
+}
+
+func TestBandwidthBudget(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return newJSONResponse(http.StatusOK, `{"Amount": 5000}`), nil
+	})
+	client.(*DefaultEcloudClient).bandwidth.budget = 10
+
+	// The first call uses up the budget.
+	if _, err := client.GetBill(ctx); err != nil {
+		t.Fatalf("GetBill() failed: %v", err)
+	}
+
+	usage := client.BandwidthUsage()
+	if usage.Received != int64(len(`{"Amount": 5000}`)) {
+		t.Errorf("expected %d bytes received, got %d", len(`{"Amount": 5000}`), usage.Received)
+	}
+
+	if !usage.Exceeded() {
+		t.Fatal("expected budget to be exceeded")
+	}
+
+	// Foreground calls only warn.
+	if _, err := client.GetBill(ctx); err != nil {
+		t.Errorf("expected foreground call to succeed, got %v", err)
+	}
+
+	// Background calls are paused.
+	_, err := client.GetBill(WithBackgroundPriority(ctx))
+	if !errors.Is(err, ErrBandwidthBudgetExceeded) {
+		t.Errorf("expected error %v, got %v", ErrBandwidthBudgetExceeded, err)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	t.Run("Strict config", func(t *testing.T) {
+		if tlsConfig(&Config{}) != nil {
+			t.Error("expected default TLS config when no TLS setting is configured")
+		}
+
+		conf := tlsConfig(&Config{StrictTLS: true})
+		if conf.MinVersion != tls.VersionTLS12 {
+			t.Errorf("expected minimum version TLS 1.2, got %s", tls.VersionName(conf.MinVersion))
+		}
+		if !slices.Equal(conf.CipherSuites, StrictCipherSuites) {
+			t.Error("expected strict cipher suites")
+		}
+
+		conf = tlsConfig(&Config{StrictTLS: true, MinTLSVersion: tls.VersionTLS13})
+		if conf.MinVersion != tls.VersionTLS13 {
+			t.Errorf("expected minimum version TLS 1.3, got %s", tls.VersionName(conf.MinVersion))
+		}
+	})
+
+	t.Run("Negotiated parameters", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		client, err := NewEcloudClient(&Config{
+			ApiBaseUrl:     server.URL,
+			EclinicId:      "test-id",
+			Password:       "test-password",
+			HospitalNumber: "HOS-123",
+			HospitalName:   "Test Hospital",
+			EclinicBaseUrl: "http://eclinic",
+			HTTPClient:     server.Client(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		params, err := client.NegotiatedTLS(context.Background())
+		if err != nil {
+			t.Fatalf("NegotiatedTLS() failed: %v", err)
+		}
+		if params.Version == "" || params.CipherSuite == "" {
+			t.Errorf("expected negotiated TLS parameters, got %+v", params)
+		}
+	})
+}
+
+func TestTemplateTitleNormalizer(t *testing.T) {
+	normalizer := &TemplateTitleNormalizer{
+		Aliases:  map[string]string{"opd": "Outpatient", "opd visit": "Outpatient"},
+		Template: "{visit_type} - {date}",
+	}
+
+	visitTime := time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC)
+	tests := map[string]string{
+		" OPD  visit": "Outpatient - 2025-03-14",
+		"opd":         "Outpatient - 2025-03-14",
+		"Maternity":   "Maternity - 2025-03-14",
+	}
+
+	for title, expected := range tests {
+		got, err := normalizer.NormalizeTitle(&PatientRecord{Title: title, VisitTimestamp: visitTime})
+		if err != nil {
+			t.Fatalf("NormalizeTitle(%q) failed: %v", title, err)
+		}
+		if got != expected {
+			t.Errorf("NormalizeTitle(%q): expected %q, got %q", title, expected, got)
+		}
+	}
+}
+
+func TestSlowCallThreshold(t *testing.T) {
+	client, _ := newTestClient(nil)
+	c := client.(*DefaultEcloudClient)
+	c.config.SlowCallThreshold = time.Second
+	c.config.SlowCallThresholds = map[string]time.Duration{
+		"/api/records":               time.Minute,
+		"/api/subscriptions":         2 * time.Second,
+		"/api/subscriptions/pending": 3 * time.Second,
+	}
+
+	tests := map[string]time.Duration{
+		"/api/billing/get_bill":            time.Second,
+		"/api/records":                     time.Minute,
+		"/api/subscriptions/12":            2 * time.Second,
+		"/api/subscriptions/pending/HOS-1": 3 * time.Second,
+	}
+	for path, expected := range tests {
+		if got := c.slowCallThreshold(path); got != expected {
+			t.Errorf("slowCallThreshold(%q): expected %s, got %s", path, expected, got)
+		}
+	}
+
+	var logs bytes.Buffer
+	c.logger = NewLogger(&logs)
+	c.checkSlowCall("/api/billing/get_bill", RequestTiming{Method: "GET", Total: 1500 * time.Millisecond})
+	if !strings.Contains(logs.String(), "slow call method=GET") {
+		t.Errorf("expected slow call warning, got %q", logs.String())
+	}
+}
+
+func TestTraceHooks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Amount": 5000}`))
+	}))
+	defer server.Close()
+
+	var gotConn atomic.Bool
+	var timings []RequestTiming
+	client, err := NewEcloudClient(&Config{
+		ApiBaseUrl:     server.URL,
+		EclinicId:      "test-id",
+		Password:       "test-password",
+		HospitalNumber: "HOS-123",
+		HospitalName:   "Test Hospital",
+		EclinicBaseUrl: "http://eclinic",
+		ClientTrace: &httptrace.ClientTrace{
+			GotConn: func(httptrace.GotConnInfo) { gotConn.Store(true) },
+		},
+		TimingHandler: func(timing RequestTiming) { timings = append(timings, timing) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.GetBill(context.Background()); err != nil {
+		t.Fatalf("GetBill() failed: %v", err)
+	}
+
+	if !gotConn.Load() {
+		t.Error("expected user ClientTrace to be called")
+	}
+	if len(timings) != 1 {
+		t.Fatalf("expected 1 timing, got %d", len(timings))
+	}
+	if timings[0].Method != http.MethodGet || timings[0].Total <= 0 || timings[0].TTFB <= 0 {
+		t.Errorf("unexpected timing: %+v", timings[0])
+	}
+}
+
+func TestSyncVisit(t *testing.T) {
+	ctx := context.Background()
+	records := []*PatientRecord{
+		{VisitID: 999, SubscriberID: 101, Title: "Lab", VisitTimestamp: time.Now(), LabReport: validPDFBytes},
+		{VisitID: 999, SubscriberID: 101, Title: "Imaging", VisitTimestamp: time.Now(), LabReport: validPDFBytes},
+	}
+
+	newVisitClient := func(failUpload bool, calls *[]string) EcloudClient {
+		var mu sync.Mutex
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			*calls = append(*calls, req.Method+" "+req.URL.Path)
+			mu.Unlock()
+
+			switch {
+			case req.URL.Path == "/api/records/transactions":
+				return newJSONResponse(http.StatusOK, `{"id": "tx-1"}`), nil
+			case req.URL.Path == "/api/records":
+				if req.Header.Get(transactionHeader) != "tx-1" {
+					t.Errorf("expected transaction header tx-1, got %q", req.Header.Get(transactionHeader))
+				}
+				if failUpload {
+					return newJSONResponse(http.StatusBadRequest, `{"error":"bad record"}`), nil
+				}
+			}
+			return newJSONResponse(http.StatusOK, `{}`), nil
+		})
+		return client
+	}
+
+	t.Run("Commit", func(t *testing.T) {
+		var calls []string
+		if err := newVisitClient(false, &calls).SyncVisit(ctx, records); err != nil {
+			t.Fatalf("SyncVisit() failed: %v", err)
+		}
+
+		expected := []string{
+			"POST /api/records/transactions",
+			"POST /api/records",
+			"POST /api/records",
+			"POST /api/records/transactions/tx-1/commit",
+		}
+		if !slices.Equal(calls, expected) {
+			t.Errorf("expected calls %v, got %v", expected, calls)
+		}
+	})
+
+	t.Run("Cancelled mid-upload", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			switch req.URL.Path {
+			case "/api/records/transactions":
+				return newJSONResponse(http.StatusOK, `{"id": "tx-2"}`), nil
+			case "/api/records":
+				cancel()
+				return nil, req.Context().Err()
+			}
+			return newJSONResponse(http.StatusOK, `{}`), nil
+		})
+		client.(*DefaultEcloudClient).retryPolicy = &noBackoffRetryPolicy{DefaultRetryPolicy{maxRetries: 3}}
+
+		err := client.SyncVisit(ctx, records)
+		var aborted *UploadAbortedError
+		if !errors.As(err, &aborted) || aborted.UploadID != "tx-2" {
+			t.Fatalf("expected *UploadAbortedError for tx-2, got %v", err)
+		}
+		if !errors.Is(err, ErrUploadAborted) || !errors.Is(err, context.Canceled) {
+			t.Errorf("expected error to match ErrUploadAborted and context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("Abort on failed upload", func(t *testing.T) {
+		var calls []string
+		if err := newVisitClient(true, &calls).SyncVisit(ctx, records); err == nil {
+			t.Fatal("expected SyncVisit() to fail")
+		}
+
+		if calls[len(calls)-1] != "DELETE /api/records/transactions/tx-1" {
+			t.Errorf("expected transaction to be aborted, got calls %v", calls)
+		}
+	})
+}
+
+func TestDeprecations(t *testing.T) {
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		resp := newJSONResponse(http.StatusOK, `{"id": 1}`)
+		resp.Header.Set("Deprecation", "@1735689600")
+		resp.Header.Set("Sunset", "Wed, 31 Dec 2025 23:59:59 GMT")
+		return resp, nil
+	})
+
+	var logs bytes.Buffer
+	client.(*DefaultEcloudClient).logger = NewLogger(&logs)
+
+	for _, id := range []uint{1, 2} {
+		if _, err := client.GetSubscriber(context.Background(), id); err != nil {
+			t.Fatalf("GetSubscriber() failed: %v", err)
+		}
+	}
+
+	if count := strings.Count(logs.String(), "is deprecated"); count != 1 {
+		t.Errorf("expected a single deprecation warning, got %d", count)
+	}
+
+	deprecations := client.Deprecations()
+	if len(deprecations) != 1 {
+		t.Fatalf("expected 1 deprecation, got %d", len(deprecations))
+	}
+
+	deprecation := deprecations[0]
+	if deprecation.Endpoint != "GET /api/subscriptions/{id}" {
+		t.Errorf("unexpected endpoint %q", deprecation.Endpoint)
+	}
+	if !deprecation.DeprecatedAt.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected deprecation date %s", deprecation.DeprecatedAt)
+	}
+	if !deprecation.Sunset.Equal(time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC)) {
+		t.Errorf("unexpected sunset date %s", deprecation.Sunset)
+	}
+}
+
+func TestHospitalNumber(t *testing.T) {
+	hn, err := ParseHospitalNumber("  kla-4521 ")
+	if err != nil {
+		t.Fatalf("ParseHospitalNumber() failed: %v", err)
+	}
+	if hn != "KLA-4521" {
+		t.Errorf("expected KLA-4521, got %s", hn)
+	}
+	if hn.Region() != "KLA" {
+		t.Errorf("expected region KLA, got %q", hn.Region())
+	}
+
+	for _, invalid := range []string{"HOS123", "HOS-", "H-1", "HOS-12a", "HOS--123"} {
+		if _, err := ParseHospitalNumber(invalid); !errors.Is(err, ErrInvalidHospitalNumber) {
+			t.Errorf("ParseHospitalNumber(%q): expected error %v, got %v", invalid, ErrInvalidHospitalNumber, err)
+		}
+	}
+	if _, err := ParseHospitalNumber(""); err != ErrHospitalNumberRequired {
+		t.Errorf("expected error %v, got %v", ErrHospitalNumberRequired, err)
+	}
+}
+
+func TestIsCoverageActive(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) }
+	subscriber := &Subscriber{ID: 101}
+	voided := day(6)
+	payments := []*Payment{
+		{SubscriberID: 101, CreatedAt: day(10), ValidTo: day(20)},
+		{SubscriberID: 101, CreatedAt: day(1), ValidTo: day(5)},
+		{SubscriberID: 101, CreatedAt: day(20), ValidTo: day(25)}, // Renewal back-to-back.
+		{SubscriberID: 202, CreatedAt: day(5), ValidTo: day(10)},  // Someone else.
+		{SubscriberID: 101, CreatedAt: day(5), ValidTo: day(10), VoidedAt: &voided},
+	}
+
+	tests := []struct {
+		at     time.Time
+		active bool
+		window CoverageWindow
+	}{
+		{day(3), true, CoverageWindow{day(1), day(5)}},
+		{day(7), false, CoverageWindow{day(1), day(5)}},
+		{day(20), true, CoverageWindow{day(10), day(25)}},
+		{day(25), false, CoverageWindow{day(10), day(25)}},
+		{time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC), false, CoverageWindow{}},
+	}
+
+	for _, tt := range tests {
+		active, window := IsCoverageActive(subscriber, payments, tt.at)
+		if active != tt.active || window != tt.window {
+			t.Errorf("IsCoverageActive(at=%s): expected (%t, %v), got (%t, %v)",
+				tt.at.Format(time.DateOnly), tt.active, tt.window, active, window)
+		}
+	}
+}
+
+func TestResidencyRegion(t *testing.T) {
+	ctx := context.Background()
+
+	var capabilityCalls atomic.Int32
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/api/capabilities" {
+			capabilityCalls.Add(1)
+			return newJSONResponse(http.StatusOK, `{"residency_regions": ["UG", "KE"]}`), nil
+		}
+
+		var sub Subscriber
+		if err := json.NewDecoder(req.Body).Decode(&sub); err != nil {
+			return nil, err
+		}
+		if sub.ResidencyRegion != "ug" {
+			t.Errorf("expected residency region ug, got %q", sub.ResidencyRegion)
+		}
+		return newJSONResponse(http.StatusOK, `{"id": 101}`), nil
+	})
+
+	c := client.(*DefaultEcloudClient)
+	c.config.ResidencyRegion = "ug"
+	for range 2 {
+		if _, err := client.Subscribe(ctx, &SubscribeRequest{PatientID: 1}); err != nil {
+			t.Fatalf("Subscribe() failed: %v", err)
+		}
+	}
+	if capabilityCalls.Load() != 1 {
+		t.Errorf("expected capabilities to be fetched once, got %d", capabilityCalls.Load())
+	}
+
+	c.config.ResidencyRegion = "TZ"
+	c.residency.checked = false
+	_, err := client.Subscribe(ctx, &SubscribeRequest{PatientID: 1})
+	if !errors.Is(err, ErrResidencyUnsupported) {
+		t.Errorf("expected error %v, got %v", ErrResidencyUnsupported, err)
+	}
+}
+
+func TestUpdateConfig(t *testing.T) {
+	ctx := context.Background()
+
+	var passwords []string
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		var login LoginRequest
+		if err := json.NewDecoder(req.Body).Decode(&login); err != nil {
+			return nil, err
+		}
+		passwords = append(passwords, login.Password)
+		return newJSONResponse(http.StatusOK, `{"token": "token-`+login.Password+`"}`), nil
+	})
+
+	if _, err := client.Login(ctx); err != nil {
+		t.Fatalf("Login() failed: %v", err)
+	}
+
+	err := client.UpdateConfig(ctx, func(config *Config) {
+		config.Password = "rotated"
+	})
+	if err != nil {
+		t.Fatalf("UpdateConfig() failed: %v", err)
+	}
+
+	if !slices.Equal(passwords, []string{"test-password", "rotated"}) {
+		t.Errorf("expected re-authentication with rotated password, got logins %v", passwords)
+	}
+	if client.GetToken() != "token-rotated" {
+		t.Errorf("expected token 'token-rotated', got '%s'", client.GetToken())
+	}
+	if client.Config().Password != "rotated" {
+		t.Error("expected config to be updated")
+	}
+
+	// Invalid updates are rejected and leave the config untouched.
+	err = client.UpdateConfig(ctx, func(config *Config) {
+		config.ApiBaseUrl = ""
+	})
+	if err != ErrApiBaseURLRequired {
+		t.Errorf("expected error %v, got %v", ErrApiBaseURLRequired, err)
+	}
+	if client.Config().ApiBaseUrl != "http://testhost" {
+		t.Error("expected config to be unchanged after invalid update")
+	}
+}
+
+func TestEntitlements(t *testing.T) {
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/api/entitlements" {
+			t.Errorf("unexpected path %s", req.URL.Path)
+		}
+		return newJSONResponse(http.StatusOK, `{
+			"hospital_number": "HOS-123",
+			"features": [
+				{"feature": "sms"},
+				{"feature": "teleconsult", "expires_at": "2020-01-01T00:00:00Z"}
+			]
+		}`), nil
+	})
+
+	entitlements, err := client.GetEntitlements(context.Background())
+	if err != nil {
+		t.Fatalf("GetEntitlements() failed: %v", err)
+	}
+
+	if !entitlements.HasFeature(FeatureSMS) {
+		t.Error("expected sms to be licensed")
+	}
+	if entitlements.HasFeature(FeatureTeleconsult) {
+		t.Error("expected expired teleconsult license to be inactive")
+	}
+	if !entitlements.HasFeatureAt(FeatureTeleconsult, time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("expected teleconsult to be licensed before expiry")
+	}
+	if entitlements.HasFeature(FeatureEmail) {
+		t.Error("expected email to be unlicensed")
+	}
+}
+
+func TestSubscriberFilter(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		query := req.URL.Query()
+		if got := query["status"]; !slices.Equal(got, []string{"active", "expired"}) {
+			t.Errorf("expected statuses [active expired], got %v", got)
+		}
+		if query.Get("created_from") != "2025-01-01T00:00:00Z" || query.Get("created_to") != "2025-02-01T00:00:00Z" {
+			t.Errorf("unexpected created range: %s", req.URL.RawQuery)
+		}
+		if query.Get("registered_by") != "Dr. Ann" {
+			t.Errorf("expected registered_by 'Dr. Ann', got '%s'", query.Get("registered_by"))
+		}
+		if query.Get("has_email") != "false" {
+			t.Errorf("expected has_email=false, got '%s'", query.Get("has_email"))
+		}
+		if query.Get("hospital_number") != "HOS-123" {
+			t.Errorf("expected hospital_number HOS-123, got '%s'", query.Get("hospital_number"))
+		}
+		return newJSONResponse(http.StatusOK, `[{"id": 1, "patient_name": "Jane"}]`), nil
+	})
+
+	filter := NewSubscriberFilter().
+		ByStatus(SubscriberActive, SubscriberExpired).
+		CreatedBetween(from, to).
+		RegisteredBy("Dr. Ann").
+		HasEmail(false)
+
+	subscribers, err := client.ListSubscribers(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("ListSubscribers() failed: %v", err)
+	}
+	if len(subscribers) != 1 {
+		t.Errorf("expected 1 subscriber, got %d", len(subscribers))
+	}
+
+	if query := (*SubscriberFilter)(nil).Query(); len(query) != 0 {
+		t.Errorf("expected nil filter to encode no parameters, got %v", query)
+	}
+}
+
+type panickingLogger struct{}
+
+func (panickingLogger) Debug(msg string, args ...any) { panic("debug") }
+func (panickingLogger) Info(msg string, args ...any)  { panic("info") }
+func (panickingLogger) Error(msg string, args ...any) { panic("error") }
+
+func TestPanicRecovery(t *testing.T) {
+	respBody := `{"id": 101, "warnings": ["subscriber near expiry"]}`
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		return newJSONResponse(http.StatusOK, respBody), nil
+	})
+
+	t.Run("Panicking callback", func(t *testing.T) {
+		var buf bytes.Buffer
+		client.(*DefaultEcloudClient).logger = NewLogger(&buf)
+		client.(*DefaultEcloudClient).config.WarningHandler = func(operation string, warning Warning) {
+			panic("handler bug")
+		}
+
+		subscriber, err := client.GetSubscriber(context.Background(), 101)
+		if err != nil {
+			t.Fatalf("GetSubscriber() failed: %v", err)
+		}
+		if subscriber.ID != 101 {
+			t.Errorf("expected subscriber 101, got %d", subscriber.ID)
+		}
+		if !strings.Contains(buf.String(), "recovered panic in WarningHandler: handler bug") {
+			t.Errorf("expected recovered panic to be logged, got %q", buf.String())
+		}
+	})
+
+	t.Run("Panicking logger", func(t *testing.T) {
+		client.(*DefaultEcloudClient).logger = safeLogger{panickingLogger{}}
+		client.(*DefaultEcloudClient).config.WarningHandler = nil
+
+		if _, err := client.GetSubscriber(context.Background(), 101); err != nil {
+			t.Fatalf("GetSubscriber() failed: %v", err)
+		}
+	})
+
+	t.Run("PanicError", func(t *testing.T) {
+		err := safeCall(&NoOpLogger{}, "TitleNormalizer", func() { panic("boom") })
+
+		var panicErr *PanicError
+		if !errors.As(err, &panicErr) {
+			t.Fatalf("expected *PanicError, got %v", err)
+		}
+		if panicErr.Source != "TitleNormalizer" || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+			t.Errorf("unexpected panic error: %+v", panicErr)
+		}
+	})
+}
+
+// staticResolver resolves every host to addrs, or fails with err.
+type staticResolver struct {
+	addrs   []string
+	err     error
+	lookups atomic.Int32
+}
+
+func (r *staticResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.lookups.Add(1)
+	return r.addrs, r.err
+}
+
+func TestResolver(t *testing.T) {
+	t.Run("Fallback and cache", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"Amount": 5000}`))
+		}))
+		defer server.Close()
+
+		_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+		broken := &staticResolver{err: errors.New("clinic router DNS failure")}
+		fallback := &staticResolver{addrs: []string{"127.0.0.1"}}
+
+		client, err := NewEcloudClient(&Config{
+			ApiBaseUrl:     "http://ecloud.test:" + port,
+			EclinicId:      "test-id",
+			Password:       "test-password",
+			HospitalNumber: "HOS-123",
+			HospitalName:   "Test Hospital",
+			EclinicBaseUrl: "http://eclinic",
+			Resolver:       CachingResolver(FallbackResolver(broken, fallback), time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for range 2 {
+			// Drop pooled connections so that every call dials.
+			client.(*DefaultEcloudClient).httpClient.(*http.Client).CloseIdleConnections()
+
+			if _, err := client.GetBill(context.Background()); err != nil {
+				t.Fatalf("GetBill() failed: %v", err)
+			}
+		}
+
+		if broken.lookups.Load() != 1 || fallback.lookups.Load() != 1 {
+			t.Errorf("expected a single cached lookup, got %d and %d",
+				broken.lookups.Load(), fallback.lookups.Load())
+		}
+	})
+
+	t.Run("Stale entry on failure", func(t *testing.T) {
+		upstream := &staticResolver{addrs: []string{"10.0.0.1"}}
+		resolver := CachingResolver(upstream, time.Minute).(*cachingResolver)
+
+		now := time.Now()
+		resolver.now = func() time.Time { return now }
+		if _, err := resolver.LookupHost(context.Background(), "ecloud.test"); err != nil {
+			t.Fatal(err)
+		}
+
+		now = now.Add(time.Hour)
+		upstream.err = errors.New("timeout")
+		addrs, err := resolver.LookupHost(context.Background(), "ecloud.test")
+		if err != nil || !slices.Equal(addrs, []string{"10.0.0.1"}) {
+			t.Errorf("expected stale addresses, got %v, %v", addrs, err)
+		}
+	})
+
+	t.Run("DoH", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("name") != "ecloud.test" {
+				t.Errorf("unexpected name %q", r.URL.Query().Get("name"))
+			}
+
+			switch r.URL.Query().Get("type") {
+			case "1":
+				w.Write([]byte(`{"Status": 0, "Answer": [
+					{"type": 5, "data": "edge.ecloud.test."},
+					{"type": 1, "data": "203.0.113.7"}
+				]}`))
+			default:
+				w.Write([]byte(`{"Status": 0}`))
+			}
+		}))
+		defer server.Close()
+
+		resolver := &DoHResolver{URL: server.URL, Client: server.Client()}
+		addrs, err := resolver.LookupHost(context.Background(), "ecloud.test")
+		if err != nil {
+			t.Fatalf("LookupHost() failed: %v", err)
+		}
+		if !slices.Equal(addrs, []string{"203.0.113.7"}) {
+			t.Errorf("expected [203.0.113.7], got %v", addrs)
+		}
+	})
+}
+
+func TestKeepAlive(t *testing.T) {
+	config := &Config{
+		TCPKeepAlive:      net.KeepAliveConfig{Enable: true, Idle: 10 * time.Second, Interval: 5 * time.Second},
+		HeartbeatInterval: 20 * time.Second,
+	}
+
+	dialer := newDialer(config)
+	if dialer.KeepAliveConfig != config.TCPKeepAlive {
+		t.Errorf("expected keep-alive config %+v, got %+v", config.TCPKeepAlive, dialer.KeepAliveConfig)
+	}
+
+	transport := newHTTPClient(config).Transport.(*http.Transport)
+	if transport.HTTP2 == nil || transport.HTTP2.SendPingTimeout != 20*time.Second {
+		t.Errorf("expected HTTP/2 heartbeat every 20s, got %+v", transport.HTTP2)
+	}
+
+	if heartbeatConfig(&Config{}) != nil {
+		t.Error("expected heartbeat to be disabled by default")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	resp, err := newHTTPClient(config).Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with keep-alive dialer failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+// newTestJWT returns an unsigned JWT expiring at exp.
+func newTestJWT(exp time.Time) string {
+	claims := fmt.Sprintf(`{"sub":"test-id","exp":%d}`, exp.Unix())
+	return "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".signature"
+}
+
+func TestTokenExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	expiring := newTestJWT(time.Now().Add(10 * time.Second))
+	fresh := newTestJWT(time.Now().Add(time.Hour))
+
+	var logins atomic.Int32
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/api/auth/login" {
+			token := expiring
+			if logins.Add(1) > 1 {
+				token = fresh
+			}
+			return newJSONResponse(http.StatusOK, `{"token": "`+token+`"}`), nil
+		}
+
+		if req.Header.Get("Authorization") != "Bearer "+fresh {
+			t.Error("expected the request to carry the refreshed token")
+		}
+		return newJSONResponse(http.StatusOK, `{"Amount": 5000}`), nil
+	})
+
+	if _, err := client.Login(ctx); err != nil {
+		t.Fatalf("Login() failed: %v", err)
+	}
+
+	expiresAt, _ := parseTokenExpiry(expiring)
+	if !client.TokenExpiresAt().Equal(expiresAt) {
+		t.Errorf("expected token to expire at %s, got %s", expiresAt, client.TokenExpiresAt())
+	}
+
+	// The token expires within the default one minute margin.
+	if _, err := client.GetBill(ctx); err != nil {
+		t.Fatalf("GetBill() failed: %v", err)
+	}
+	if logins.Load() != 2 {
+		t.Errorf("expected a proactive refresh, got %d logins", logins.Load())
+	}
+
+	if _, ok := parseTokenExpiry("test-token"); ok {
+		t.Error("expected no expiry for an opaque token")
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	newConfig := func(env Environment, baseURL string) *Config {
+		return &Config{
+			Environment:    env,
+			ApiBaseUrl:     baseURL,
+			EclinicId:      "test-id",
+			Password:       "test-password",
+			HospitalNumber: "HOS-123",
+			HospitalName:   "Test Hospital",
+			EclinicBaseUrl: "http://eclinic",
+		}
+	}
+
+	t.Run("Preset base URL", func(t *testing.T) {
+		config := newConfig(EnvironmentProduction, "")
+		if err := config.Validate(); err != nil {
+			t.Fatalf("Validate() failed: %v", err)
+		}
+		if config.ApiBaseUrl != ProductionBaseURL {
+			t.Errorf("expected base URL %s, got %s", ProductionBaseURL, config.ApiBaseUrl)
+		}
+
+		// The sandbox has no well-known host.
+		if err := newConfig(EnvironmentSandbox, "").Validate(); !errors.Is(err, ErrApiBaseURLRequired) {
+			t.Errorf("expected error %v, got %v", ErrApiBaseURLRequired, err)
+		}
+		if err := newConfig(EnvironmentSandbox, "https://sandbox.ecloud.example.com").Validate(); err != nil {
+			t.Errorf("expected the configured sandbox URL to be valid, got %v", err)
+		}
+	})
+
+	t.Run("Mismatched base URL", func(t *testing.T) {
+		err := newConfig(EnvironmentSandbox, ProductionBaseURL+"/").Validate()
+		if !errors.Is(err, ErrEnvironmentMismatch) {
+			t.Errorf("expected error %v, got %v", ErrEnvironmentMismatch, err)
+		}
+
+		err = newConfig("staging", "http://testhost").Validate()
+		if !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("expected error %v, got %v", ErrInvalidConfig, err)
+		}
+	})
+
+	t.Run("Sandbox uploads", func(t *testing.T) {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			if err := req.ParseMultipartForm(10 << 20); err != nil {
+				return nil, err
+			}
+			if v := req.FormValue("title"); v != "Annual Checkup" {
+				t.Errorf("expected the title unchanged, got '%s'", v)
+			}
+			if v := req.FormValue("environment"); v != "sandbox" {
+				t.Errorf("expected environment 'sandbox', got '%s'", v)
+			}
+			return newJSONResponse(http.StatusOK, `{}`), nil
+		})
+		client.(*DefaultEcloudClient).config.Environment = EnvironmentSandbox
+
+		record := &PatientRecord{
+			VisitID:        999,
+			SubscriberID:   101,
+			Title:          "Annual Checkup",
+			VisitTimestamp: time.Now().Add(-time.Hour),
+			LabReport:      validPDFBytes,
+		}
+		if err := client.SyncMedicalRecords(context.Background(), record); err != nil {
+			t.Fatalf("SyncMedicalRecords() failed: %v", err)
+		}
+
+		record.VisitTimestamp = time.Now().Add(time.Hour)
+		if err := client.SyncMedicalRecords(context.Background(), record); err == nil {
+			t.Error("expected sandbox to reject a visit in the future")
+		}
+	})
+}
+
+func TestTokenStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewFileTokenStore(filepath.Join(t.TempDir(), "ecloud", "tokens.json"))
+	token := newTestJWT(time.Now().Add(time.Hour))
+
+	var logins atomic.Int32
+	newClient := func() EcloudClient {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/api/auth/introspect" {
+				return newJSONResponse(http.StatusOK, `{"active": true}`), nil
+			}
+			logins.Add(1)
+			return newJSONResponse(http.StatusOK, `{"token": "`+token+`", "user": {"eclinic_id": "test-id"}}`), nil
+		})
+		client.(*DefaultEcloudClient).config.TokenStore = store
+		return client
+	}
+
+	if _, err := newClient().Login(ctx); err != nil {
+		t.Fatalf("Login() failed: %v", err)
+	}
+
+	// A restarted application resumes the stored session.
+	restarted := newClient()
+	loginResp, err := restarted.Login(ctx)
+	if err != nil {
+		t.Fatalf("Login() failed: %v", err)
+	}
+	if logins.Load() != 1 {
+		t.Errorf("expected the stored session to be resumed, got %d logins", logins.Load())
+	}
+	if loginResp.Token != token || restarted.GetToken() != token || !restarted.IsAuthenticated() {
+		t.Error("expected the stored token to be restored")
+	}
+	if user, _ := restarted.GetUser(); user.EclinicID != "test-id" {
+		t.Errorf("expected stored user 'test-id', got '%s'", user.EclinicID)
+	}
+
+	// Refresh always sends the credentials.
+	if err := restarted.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() failed: %v", err)
+	}
+	if logins.Load() != 2 {
+		t.Errorf("expected refresh to log in, got %d logins", logins.Load())
+	}
+
+	if err := store.Delete(ctx, "http://testhost|test-id"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if stored, err := store.Get(ctx, "http://testhost|test-id"); err != nil || stored != nil {
+		t.Errorf("expected deleted token, got %+v, %v", stored, err)
+	}
+}
+
+func TestGetRecordThumbnail(t *testing.T) {
+	ctx := context.Background()
+	png := []byte("\x89PNG\r\n\x1a\nthumbnail")
+
+	var calls atomic.Int32
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		calls.Add(1)
+		if req.URL.Path != "/api/records/42/thumbnail" || req.URL.Query().Get("size") != "128" {
+			t.Errorf("unexpected request %s", req.URL)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(bytes.NewReader(png)),
+			Header:     http.Header{"Content-Type": []string{"image/png"}},
+		}, nil
+	})
+	client.(*DefaultEcloudClient).config.ThumbnailCacheDir = t.TempDir()
+
+	for range 2 {
+		thumbnail, err := client.GetRecordThumbnail(ctx, 42, 128)
+		if err != nil {
+			t.Fatalf("GetRecordThumbnail() failed: %v", err)
+		}
+
+		data, _ := io.ReadAll(thumbnail)
+		thumbnail.Close()
+		if !bytes.Equal(data, png) {
+			t.Errorf("unexpected thumbnail %q", data)
+		}
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("expected the second thumbnail to be served from the cache, got %d requests", calls.Load())
+	}
+
+	if _, err := client.GetRecordThumbnail(ctx, 42, 4096); err == nil {
+		t.Error("expected an error for an oversized thumbnail")
+	}
+}
+
+func TestDownloadBody(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nthumbnail")
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(png)
+	zw.Close()
+
+	checksum := sha256Hex(png)
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		resp := &http.Response{
+			StatusCode:    http.StatusOK,
+			Body:          io.NopCloser(bytes.NewReader(png)),
+			Header:        http.Header{ReportSHA256Header: []string{checksum}},
+			ContentLength: int64(len(png)),
+		}
+
+		switch req.URL.Query().Get("size") {
+		case "64": // Compressed.
+			resp.Body = io.NopCloser(bytes.NewReader(compressed.Bytes()))
+			resp.Header.Set("Content-Encoding", "gzip")
+			resp.ContentLength = int64(compressed.Len())
+		case "128": // Corrupted.
+			resp.Header.Set(ReportSHA256Header, strings.Repeat("0", 64))
+		}
+		return resp, nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+	ctx := context.Background()
+
+	thumbnail, err := client.GetRecordThumbnail(ctx, 1, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(thumbnail); err != nil || !bytes.Equal(data, png) {
+		t.Errorf("expected the decompressed thumbnail, got %q, %v", data, err)
+	}
+	if err := thumbnail.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+
+	thumbnail, _ = client.GetRecordThumbnail(ctx, 1, 128)
+	if _, err := io.ReadAll(thumbnail); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch reading to the end, got %v", err)
+	}
+	if err := thumbnail.Close(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch on Close, got %v", err)
+	}
+
+	// Every byte read without reaching io.EOF is verified on Close.
+	thumbnail, _ = client.GetRecordThumbnail(ctx, 1, 128)
+	io.ReadFull(thumbnail, make([]byte, len(png)))
+	if err := thumbnail.Close(); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch on Close after reading every byte, got %v", err)
+	}
+
+	// Partial reads are not verified, and Close may be called twice.
+	thumbnail, _ = client.GetRecordThumbnail(ctx, 1, 128)
+	io.ReadFull(thumbnail, make([]byte, 4))
+	if err := thumbnail.Close(); err != nil {
+		t.Errorf("expected a partial read to close cleanly, got %v", err)
+	}
+	if err := thumbnail.Close(); err != nil {
+		t.Errorf("expected a second Close to succeed, got %v", err)
+	}
+
+	// Reads fail once the context is done.
+	cancelCtx, cancel := context.WithCancel(ctx)
+	thumbnail, _ = client.GetRecordThumbnail(cancelCtx, 1, 256)
+	if _, err := io.ReadFull(thumbnail, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := thumbnail.Read(make([]byte, 4)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if err := thumbnail.Close(); err != nil {
+		t.Errorf("expected a cancelled read to close cleanly, got %v", err)
+	}
+}
+
+func TestDownloadReportChecksum(t *testing.T) {
+	ctx := context.Background()
+	cancelCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		resp := newJSONResponse(http.StatusOK, "")
+		resp.Body = io.NopCloser(bytes.NewReader(validPDFBytes))
+		resp.Header.Set(ReportSHA256Header, sha256Hex(validPDFBytes))
+
+		switch req.URL.Path {
+		case "/api/records/2/reports/lab":
+			resp.Header.Set(ReportSHA256Header, strings.Repeat("0", 64))
+		case "/api/records/3/reports/lab":
+			// The download is cancelled midway.
+			half := len(validPDFBytes) / 2
+			resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(validPDFBytes[:half]),
+				readerFunc(func(p []byte) (int, error) {
+					cancel()
+					return 0, errors.New("use of closed network connection")
+				})))
+		}
+		return resp, nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+
+	var buf bytes.Buffer
+	if _, err := client.Records().DownloadReport(ctx, 1, ReportLab, &buf); err != nil || !bytes.Equal(buf.Bytes(), validPDFBytes) {
+		t.Errorf("expected the verified report, got %v", err)
+	}
+
+	if _, err := client.Records().DownloadReport(ctx, 2, ReportLab, io.Discard); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+
+	buf.Reset()
+	if _, err := client.Records().DownloadReport(cancelCtx, 3, ReportLab, &buf); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if buf.Len() >= len(validPDFBytes) {
+		t.Errorf("expected the download to stop midway, got %d bytes", buf.Len())
+	}
+}
+
+// readerFunc is an io.Reader backed by a function.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestResponseDecompression(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(`{"Amount": 5000}`))
+	zw.Close()
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Accept-Encoding") != "base64, gzip" {
+			t.Errorf("unexpected Accept-Encoding %q", req.Header.Get("Accept-Encoding"))
+		}
+
+		resp := newJSONResponse(http.StatusOK, "")
+		if req.URL.Path == "/api/billing/get_bill" {
+			resp.Header.Set("Content-Encoding", "gzip")
+			resp.Body = io.NopCloser(bytes.NewReader(compressed.Bytes()))
+		} else {
+			resp.Header.Set("Content-Encoding", "base64")
+			resp.Body = io.NopCloser(strings.NewReader(base64.StdEncoding.EncodeToString([]byte(`{"id": 7}`))))
+		}
+		return resp, nil
+	})
+	client.(*DefaultEcloudClient).config.ContentDecoders = map[string]ContentDecoder{
+		"base64": func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(base64.NewDecoder(base64.StdEncoding, r)), nil
+		},
+	}
+
+	bill, err := client.GetBill(context.Background())
+	if err != nil {
+		t.Fatalf("GetBill() failed: %v", err)
+	}
+	if bill.Amount != 5000 {
+		t.Errorf("expected amount 5000, got %v", bill.Amount)
+	}
+
+	subscriber, err := client.GetSubscriber(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("GetSubscriber() failed: %v", err)
+	}
+	if subscriber.ID != 7 {
+		t.Errorf("expected subscriber 7, got %d", subscriber.ID)
+	}
+}
+
+func TestStreamingUpload(t *testing.T) {
+	ctx := context.Background()
+
+	newRecord := func(report io.Reader) *PatientRecord {
+		return &PatientRecord{
+			VisitID:         999,
+			SubscriberID:    101,
+			Title:           "Annual Checkup",
+			VisitTimestamp:  time.Now(),
+			LabReportReader: report,
+		}
+	}
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if err := req.ParseMultipartForm(10 << 20); err != nil {
+			return nil, err
+		}
+
+		file, _, err := req.FormFile(labReportFieldName)
+		if err != nil {
+			t.Fatalf("expected file '%s': %v", labReportFieldName, err)
+		}
+		defer file.Close()
+
+		data, _ := io.ReadAll(file)
+		if !bytes.Equal(data, validPDFBytes) {
+			t.Error("lab report content mismatch")
+		}
+		return newJSONResponse(http.StatusOK, `{}`), nil
+	})
+
+	t.Run("Success", func(t *testing.T) {
+		// iotest.OneByteReader forces the markers to be split across reads.
+		err := client.SyncMedicalRecords(ctx, newRecord(iotest.OneByteReader(bytes.NewReader(validPDFBytes))))
+		if err != nil {
+			t.Fatalf("SyncMedicalRecords() failed: %v", err)
+		}
+	})
+
+	t.Run("Truncated PDF", func(t *testing.T) {
+		truncated := validPDFBytes[:len(validPDFBytes)-10]
+		err := client.SyncMedicalRecords(ctx, newRecord(bytes.NewReader(truncated)))
+		if !errors.Is(err, ErrInvalidLabReportPDF) {
+			t.Errorf("expected error %v, got %v", ErrInvalidLabReportPDF, err)
+		}
+	})
+
+	t.Run("Not a PDF", func(t *testing.T) {
+		err := client.SyncMedicalRecords(ctx, newRecord(strings.NewReader("plain text report")))
+		if !errors.Is(err, ErrInvalidLabReportPDF) {
+			t.Errorf("expected error %v, got %v", ErrInvalidLabReportPDF, err)
+		}
+	})
+
+	t.Run("Exceeds maximum size", func(t *testing.T) {
+		client.(*DefaultEcloudClient).config.ValidationRules = &ValidationRules{MaxReportSize: 100}
+		defer func() { client.(*DefaultEcloudClient).config.ValidationRules = nil }()
+
+		err := client.SyncMedicalRecords(ctx, newRecord(bytes.NewReader(validPDFBytes)))
+		if err == nil || !strings.Contains(err.Error(), "exceeds maximum size") {
+			t.Errorf("expected size error, got %v", err)
+		}
+	})
+}
+
+func TestQRCode(t *testing.T) {
+	ctx := context.Background()
+	png := []byte("\x89PNG\r\n\x1a\nqr")
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/api/subscriptions/101/qrcode":
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(png)), Header: make(http.Header)}, nil
+		case "/api/subscriptions/qrcode/resolve":
+			var body map[string]string
+			json.NewDecoder(req.Body).Decode(&body)
+			if body["token"] != "qr-token" {
+				t.Errorf("expected token 'qr-token', got '%s'", body["token"])
+			}
+			return newJSONResponse(http.StatusOK, `{"id": 101, "patient_name": "Jane"}`), nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error":"not found"}`), nil
+	})
+
+	image, err := client.GetSubscriberQRCode(ctx, 101)
+	if err != nil {
+		t.Fatalf("GetSubscriberQRCode() failed: %v", err)
+	}
+	if !bytes.Equal(image, png) {
+		t.Errorf("unexpected QR code %q", image)
+	}
+
+	subscriber, err := client.ResolveQRCode(ctx, "qr-token\n")
+	if err != nil {
+		t.Fatalf("ResolveQRCode() failed: %v", err)
+	}
+	if subscriber.ID != 101 {
+		t.Errorf("expected subscriber 101, got %d", subscriber.ID)
+	}
+
+	if _, err := client.ResolveQRCode(ctx, "  "); err == nil {
+		t.Error("expected an error for an empty token")
+	}
+}
+
+func TestRetrySafeBodies(t *testing.T) {
+	ctx := context.Background()
+
+	// newFlakyClient fails the first attempt after reading the body and
+	// records the body received by every attempt.
+	newFlakyClient := func(bodies *[]string) EcloudClient {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			data, _ := io.ReadAll(req.Body)
+			*bodies = append(*bodies, string(data))
+			if len(*bodies) == 1 {
+				return nil, fmt.Errorf("connection reset by peer")
+			}
+			return newJSONResponse(http.StatusOK, `{}`), nil
+		})
+		client.(*DefaultEcloudClient).retryPolicy = &noBackoffRetryPolicy{DefaultRetryPolicy{maxRetries: 3}}
+		return client
+	}
+
+	t.Run("Seeker is rewound", func(t *testing.T) {
+		var bodies []string
+		resp, err := newFlakyClient(&bodies).Do(ctx, http.MethodPost, "/api/custom", strings.NewReader("payload"), nil)
+		if err != nil {
+			t.Fatalf("Do() failed: %v", err)
+		}
+		resp.Body.Close()
+
+		if !slices.Equal(bodies, []string{"payload", "payload"}) {
+			t.Errorf("expected the full body on every attempt, got %q", bodies)
+		}
+	})
+
+	t.Run("Retryable body", func(t *testing.T) {
+		var bodies []string
+		var created int
+		body := NewRetryableBody(func() (io.Reader, error) {
+			created++
+			return strings.NewReader(fmt.Sprintf("attempt-%d", created)), nil
+		})
+
+		resp, err := newFlakyClient(&bodies).Do(ctx, http.MethodPost, "/api/custom", body, nil)
+		if err != nil {
+			t.Fatalf("Do() failed: %v", err)
+		}
+		resp.Body.Close()
+
+		if !slices.Equal(bodies, []string{"attempt-1", "attempt-2"}) {
+			t.Errorf("expected a new body per attempt, got %q", bodies)
+		}
+	})
+
+	t.Run("Other readers are sent once", func(t *testing.T) {
+		var bodies []string
+		body := io.MultiReader(strings.NewReader("payload"))
+
+		_, err := newFlakyClient(&bodies).Do(ctx, http.MethodPost, "/api/custom", body, nil)
+		if err == nil {
+			t.Fatal("expected the failed attempt to be reported")
+		}
+		if len(bodies) != 1 {
+			t.Errorf("expected a single attempt, got %d", len(bodies))
+		}
+	})
+
+	t.Run("Streamed upload is retried", func(t *testing.T) {
+		var bodies []string
+		record := &PatientRecord{
+			VisitID:         999,
+			SubscriberID:    101,
+			Title:           "Annual Checkup",
+			VisitTimestamp:  time.Now(),
+			LabReportReader: bytes.NewReader(validPDFBytes),
+		}
+
+		if err := newFlakyClient(&bodies).SyncMedicalRecords(ctx, record); err != nil {
+			t.Fatalf("SyncMedicalRecords() failed: %v", err)
+		}
+		if len(bodies) != 2 || bodies[0] != bodies[1] || !strings.Contains(bodies[1], "%%EOF") {
+			t.Errorf("expected the same complete upload on both attempts, got %d attempts", len(bodies))
+		}
+	})
+}
+
+func TestAPIError(t *testing.T) {
+	ctx := context.Background()
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/api/subscriptions/404":
+			resp := newJSONResponse(http.StatusNotFound, `{"error":"no such subscriber","code":"subscriber_not_found"}`)
+			resp.Header.Set("X-Request-Id", "req-123")
+			return resp, nil
+		case "/api/billing/get_bill":
+			return newJSONResponse(http.StatusServiceUnavailable, "maintenance"), nil
+		}
+		return newJSONResponse(http.StatusConflict, `{"message":"already exists"}`), nil
+	})
+
+	_, err := client.GetSubscriber(ctx, 404)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an *APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Code != "subscriber_not_found" || apiErr.RequestID != "req-123" {
+		t.Errorf("unexpected APIError %+v", apiErr)
+	}
+	if !errors.Is(err, ErrSubscriberNotFound) || !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected error to match ErrSubscriberNotFound and ErrNotFound, got %v", err)
+	}
+	if errors.Is(err, ErrRecordNotFound) || errors.Is(err, ErrServerError) {
+		t.Errorf("error matched an unrelated sentinel: %v", err)
+	}
+	if want := "statusCode=404 remote error: no such subscriber (request_id=req-123)"; apiErr.Error() != want {
+		t.Errorf("expected %q, got %q", want, apiErr.Error())
+	}
+
+	_, err = client.GetBill(ctx)
+	if !errors.Is(err, ErrServerError) || errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a server error, got %v", err)
+	}
+	if errors.As(err, &apiErr) && apiErr.Message != "maintenance" {
+		t.Errorf("expected plain text message, got %q", apiErr.Message)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	httpClient := &mockHTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return newJSONResponse(http.StatusOK, `{}`), nil
+	}}
+	policy := &noBackoffRetryPolicy{DefaultRetryPolicy{maxRetries: 1}}
+
+	client, err := NewClient(
+		WithBaseURL("http://testhost"),
+		WithCredentials("test-id", "test-password"),
+		WithHospital("HOS-123", "Test Hospital"),
+		WithEclinicBaseURL("http://eclinic"),
+		WithHTTPClient(httpClient),
+		WithLogger(&NoOpLogger{}),
+		WithRetryPolicy(policy),
+		WithTimeout(5*time.Second),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+
+	config := client.Config()
+	if config.ApiBaseUrl != "http://testhost" || config.EclinicId != "test-id" || config.Password != "test-password" {
+		t.Errorf("unexpected config %+v", config)
+	}
+	if config.Timeout != 5*time.Second {
+		t.Errorf("expected timeout 5s, got %v", config.Timeout)
+	}
+	if client.(*DefaultEcloudClient).retryPolicy != policy {
+		t.Error("expected the retry policy option to be used")
+	}
+	if client.(*DefaultEcloudClient).httpClient != httpClient {
+		t.Error("expected the HTTP client option to be used")
+	}
+
+	t.Run("WithConfig is not mutated", func(t *testing.T) {
+		base := Config{
+			ApiBaseUrl:     "http://testhost",
+			EclinicId:      "test-id",
+			Password:       "test-password",
+			HospitalNumber: "HOS-123",
+			HospitalName:   "Test Hospital",
+			EclinicBaseUrl: "http://eclinic",
+		}
+		client, err := NewClient(WithConfig(base), WithBaseURL("http://other"))
+		if err != nil {
+			t.Fatalf("NewClient() failed: %v", err)
+		}
+		if client.Config().ApiBaseUrl != "http://other" {
+			t.Errorf("expected later options to override WithConfig, got %q", client.Config().ApiBaseUrl)
+		}
+		if base.Timeout != 0 || base.RetryPolicy != nil {
+			t.Error("expected the base config to be left untouched")
+		}
+	})
+
+	if _, err := NewClient(WithBaseURL("http://testhost")); !errors.Is(err, ErrEclinicIDRequired) {
+		t.Errorf("expected ErrEclinicIDRequired, got %v", err)
+	}
+}
+
+func TestRetryPolicies(t *testing.T) {
+	ctx := context.Background()
+	attempts := map[string]int{}
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		attempts[req.URL.Path]++
+		return nil, errors.New("connection reset")
+	})
+	impl := client.(*DefaultEcloudClient)
+	impl.retryPolicy = &noBackoffRetryPolicy{DefaultRetryPolicy{maxRetries: 1}}
+	impl.config.RetryPolicies = map[string]RetryPolicy{
+		"/api/billing":           &noBackoffRetryPolicy{DefaultRetryPolicy{maxRetries: 3}},
+		"/api/billing/get_bills": &noBackoffRetryPolicy{DefaultRetryPolicy{maxRetries: 4}},
+	}
+
+	client.GetBill(ctx)
+	client.GetBills(ctx, []HospitalNumber{"HOS-1"})
+	client.GetSubscriber(ctx, 1)
+
+	want := map[string]int{
+		"/api/billing/get_bill":  4,
+		"/api/billing/get_bills": 5, // longest prefix wins
+		"/api/subscriptions/1":   2, // global policy
+	}
+	for path, n := range want {
+		if attempts[path] != n {
+			t.Errorf("expected %d attempts for %s, got %d", n, path, attempts[path])
+		}
+	}
+}
+
+func TestServiceAccessors(t *testing.T) {
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/api/subscriptions/7" {
+			return newJSONResponse(http.StatusOK, `{"id": 7}`), nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error":"not found"}`), nil
+	})
+
+	var subscriptions SubscriptionService = client.Subscriptions()
+	subscriber, err := subscriptions.GetSubscriber(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("GetSubscriber() failed: %v", err)
+	}
+	if subscriber.ID != 7 {
+		t.Errorf("expected subscriber 7, got %d", subscriber.ID)
+	}
+
+	// All views share the client's session.
+	client.(*DefaultEcloudClient).jwtToken = "shared-token"
+	if client.Auth().GetToken() != "shared-token" {
+		t.Error("expected the auth view to share the client's session")
+	}
+	if client.Payments() == nil || client.Records() == nil || client.Billing() == nil {
+		t.Error("expected non-nil service views")
+	}
+}
+
+func TestSubscriberNotesAndFlags(t *testing.T) {
+	ctx := context.Background()
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch {
+		case req.Method == http.MethodPost && req.URL.Path == "/api/subscriptions/5/notes":
+			var body map[string]string
+			json.NewDecoder(req.Body).Decode(&body)
+			if body["text"] != "prefers SMS in Luganda" || body["created_by"] != "reception" {
+				t.Errorf("unexpected note body %v", body)
+			}
+			return newJSONResponse(http.StatusOK, `{"id": 1, "subscriber_id": 5, "text": "prefers SMS in Luganda", "created_by": "reception"}`), nil
+		case req.Method == http.MethodGet && req.URL.Path == "/api/subscriptions/5/notes":
+			return newJSONResponse(http.StatusOK, `[{"id": 1, "text": "prefers SMS in Luganda", "created_by": "reception"}]`), nil
+		case req.Method == http.MethodPut && req.URL.Path == "/api/subscriptions/5/flags/vip":
+			var body map[string]any
+			json.NewDecoder(req.Body).Decode(&body)
+			if body["value"] != true || body["updated_by"] != "admin" {
+				t.Errorf("unexpected flag body %v", body)
+			}
+			return newJSONResponse(http.StatusOK, `{"name": "vip", "value": true, "updated_by": "admin"}`), nil
+		case req.Method == http.MethodGet && req.URL.Path == "/api/subscriptions/5/flags":
+			return newJSONResponse(http.StatusOK, `[{"name": "vip", "value": true, "updated_by": "admin"}]`), nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error":"not found"}`), nil
+	})
+
+	note, err := client.AddSubscriberNote(ctx, 5, "  prefers SMS in Luganda ", "reception")
+	if err != nil {
+		t.Fatalf("AddSubscriberNote() failed: %v", err)
+	}
+	if note.ID != 1 || note.CreatedBy != "reception" {
+		t.Errorf("unexpected note %+v", note)
+	}
+
+	notes, err := client.ListSubscriberNotes(ctx, 5)
+	if err != nil {
+		t.Fatalf("ListSubscriberNotes() failed: %v", err)
+	}
+	if len(notes) != 1 {
+		t.Errorf("expected 1 note, got %d", len(notes))
+	}
+
+	flag, err := client.SetSubscriberFlag(ctx, 5, "vip", true, "admin")
+	if err != nil {
+		t.Fatalf("SetSubscriberFlag() failed: %v", err)
+	}
+	if !flag.Value || flag.UpdatedBy != "admin" {
+		t.Errorf("unexpected flag %+v", flag)
+	}
+
+	flags, err := client.GetSubscriberFlags(ctx, 5)
+	if err != nil {
+		t.Fatalf("GetSubscriberFlags() failed: %v", err)
+	}
+	if len(flags) != 1 || flags[0].Name != "vip" {
+		t.Errorf("unexpected flags %+v", flags)
+	}
+
+	if _, err := client.AddSubscriberNote(ctx, 5, " ", "reception"); err == nil {
+		t.Error("expected an error for an empty note")
+	}
+	if _, err := client.ListSubscriberNotes(ctx, 6); !errors.Is(err, ErrSubscriberNotFound) {
+		t.Errorf("expected ErrSubscriberNotFound, got %v", err)
+	}
+}
+
+func TestTextExtraction(t *testing.T) {
+	ctx := context.Background()
+	requested := false
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/api/records/9/text" {
+			return newJSONResponse(http.StatusNotFound, `{"error":"record not found"}`), nil
+		}
+		if req.Method == http.MethodPost {
+			requested = true
+			return newJSONResponse(http.StatusAccepted, `{"record_id": 9, "status": "pending"}`), nil
+		}
+		return newJSONResponse(http.StatusOK, `{"record_id": 9, "status": "completed", "text": "malaria negative", "pages": ["malaria negative"]}`), nil
+	})
+
+	job, err := client.RequestTextExtraction(ctx, 9)
+	if err != nil {
+		t.Fatalf("RequestTextExtraction() failed: %v", err)
+	}
+	if !requested || job.Status != ExtractionPending || job.Status.Done() {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	extracted, err := client.GetExtractedText(ctx, 9)
+	if err != nil {
+		t.Fatalf("GetExtractedText() failed: %v", err)
+	}
+	if !extracted.Status.Done() || extracted.Text != "malaria negative" || len(extracted.Pages) != 1 {
+		t.Errorf("unexpected extracted text %+v", extracted)
+	}
+
+	if _, err := client.GetExtractedText(ctx, 10); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	ctx := context.Background()
+	var queries []neturl.Values
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		query := req.URL.Query()
+		queries = append(queries, query)
+
+		switch query.Get("cursor") {
+		case "":
+			return newJSONResponse(http.StatusOK, `{"data": [{"id": 1}, {"id": 2}], "next_cursor": "c2", "total": 3}`), nil
+		case "c2":
+			return newJSONResponse(http.StatusOK, `{"data": [{"id": 3}], "next_cursor": "", "total": 3}`), nil
+		}
+		return newJSONResponse(http.StatusBadRequest, `{"error":"bad cursor"}`), nil
+	})
+
+	page, err := client.ListSubscribersPage(ctx, NewSubscriberFilter().ByStatus(SubscriberActive), &ListOptions{PerPage: 2, Sort: "-created_at"})
+	if err != nil {
+		t.Fatalf("ListSubscribersPage() failed: %v", err)
+	}
+	if len(page.Subscribers) != 2 || page.Total != 3 || !page.HasMore() {
+		t.Errorf("unexpected page %+v", page)
+	}
+	if q := queries[0]; q.Get("per_page") != "2" || q.Get("sort") != "-created_at" || q.Get("status") != "active" || q.Get("hospital_number") != "HOS-123" {
+		t.Errorf("unexpected query %v", q)
+	}
+
+	var ids []uint
+	for subscriber, err := range client.AllSubscribers(ctx, nil, &ListOptions{PerPage: 2}) {
+		if err != nil {
+			t.Fatalf("AllSubscribers() failed: %v", err)
+		}
+		ids = append(ids, subscriber.ID)
+	}
+	if !slices.Equal(ids, []uint{1, 2, 3}) {
+		t.Errorf("expected subscribers [1 2 3], got %v", ids)
+	}
+
+	// Breaking early does not fetch further pages.
+	queries = nil
+	for range client.AllPendingSubscribers(ctx, nil) {
+		break
+	}
+	if len(queries) != 1 || queries[0].Get("per_page") != strconv.Itoa(DefaultPerPage) {
+		t.Errorf("expected a single page request with the default page size, got %v", queries)
+	}
+
+	for _, err := range client.AllSubscribers(ctx, nil, &ListOptions{Cursor: "bad"}) {
+		if err == nil {
+			t.Error("expected an error for a bad cursor")
+		}
+	}
+}
+
+func TestSearchRecords(t *testing.T) {
+	ctx := context.Background()
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/api/records/search" {
+			return newJSONResponse(http.StatusNotFound, `{"error":"not found"}`), nil
+		}
+
+		q := req.URL.Query()
+		if q.Get("q") != "CT report" || q.Get("subscriber_id") != "7" || q.Get("from") != from.Format(time.RFC3339) ||
+			q.Get("to") != to.Format(time.RFC3339) || !slices.Equal(q["tag"], []string{"radiology"}) || q.Get("per_page") != "10" {
+			t.Errorf("unexpected query %v", q)
+		}
+		return newJSONResponse(http.StatusOK, `{"data": [{"record": {"id": 3, "title": "CT Head"}, "score": 1.5,
+			"highlights": [{"field": "text", "snippet": "CT report normal", "matches": [[0, 9]]}]}], "next_cursor": "n", "total": 11}`), nil
+	})
+
+	result, err := client.SearchRecords(ctx, RecordQuery{SubscriberID: 7, Text: " CT report ", From: from, To: to, Tags: []string{"radiology"}},
+		&ListOptions{PerPage: 10})
+	if err != nil {
+		t.Fatalf("SearchRecords() failed: %v", err)
+	}
+	if len(result.Hits) != 1 || result.Total != 11 || !result.HasMore() {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	hit := result.Hits[0]
+	if hit.Record.ID != 3 || len(hit.Highlights) != 1 || hit.Highlights[0].Matches[0] != [2]int{0, 9} {
+		t.Errorf("unexpected hit %+v", hit)
+	}
+
+	if _, err := client.SearchRecords(ctx, RecordQuery{}, nil); err == nil {
+		t.Error("expected an error for an empty query")
+	}
+	if _, err := client.SearchRecords(ctx, RecordQuery{From: to, To: from}, nil); err == nil {
+		t.Error("expected an error for an inverted date range")
+	}
+}
+
+func TestUploadRateLimit(t *testing.T) {
+	t.Run("Throttled reader", func(t *testing.T) {
+		r := newThrottledReader(context.Background(), bytes.NewReader(make([]byte, 4000)), 1000).(*throttledReader)
+
+		clock := time.Unix(0, 0)
+		r.now = func() time.Time { return clock }
+		r.start = clock
+		clock = clock.Add(time.Second)
+
+		n, err := r.Read(make([]byte, 4000))
+		if err != nil {
+			t.Fatalf("Read() failed: %v", err)
+		}
+		if n != 512 {
+			t.Errorf("expected reads to be limited to the burst size, got %d", n)
+		}
+
+		// Reading is blocked until the clock catches up with the rate.
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		r.ctx = ctx
+		if _, err := r.Read(make([]byte, 4000)); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the read to wait for the rate, got %v", err)
+		}
+
+		clock = clock.Add(10 * time.Second)
+		if _, err := r.Read(make([]byte, 4000)); err != nil {
+			t.Errorf("expected no wait once within the rate, got %v", err)
+		}
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		src := bytes.NewReader(nil)
+		if newThrottledReader(context.Background(), src, 0) != io.Reader(src) {
+			t.Error("expected the reader to be returned unchanged")
+		}
+	})
+
+	t.Run("Upload", func(t *testing.T) {
+		var received int
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			data, _ := io.ReadAll(req.Body)
+			received = len(data)
+			return newJSONResponse(http.StatusOK, `{}`), nil
+		})
+		client.(*DefaultEcloudClient).config.UploadRateLimit = 1 << 20
+
+		err := client.SyncMedicalRecords(context.Background(), &PatientRecord{
+			VisitID: 1, SubscriberID: 1, Title: "Lab", VisitTimestamp: time.Now(), LabReport: validPDFBytes,
+		})
+		if err != nil {
+			t.Fatalf("SyncMedicalRecords() failed: %v", err)
+		}
+		if received < len(validPDFBytes) {
+			t.Errorf("expected the full body to be uploaded, got %d bytes", received)
+		}
+	})
+}
+
+func TestUpdateAndCancelSubscription(t *testing.T) {
+	ctx := context.Background()
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch {
+		case req.Method == http.MethodPatch && req.URL.Path == "/api/subscriptions/4":
+			var body map[string]any
+			json.NewDecoder(req.Body).Decode(&body)
+			if body["email"] != "jane@example.com" || body["updated_by"] != "reception" {
+				t.Errorf("unexpected update body %v", body)
+			}
+			if _, ok := body["patient_name"]; ok {
+				t.Error("expected unchanged fields to be omitted")
+			}
+			return newJSONResponse(http.StatusOK, `{"id": 4, "email": "jane@example.com"}`), nil
+		case req.Method == http.MethodPost && req.URL.Path == "/api/subscriptions/4/cancel":
+			var body map[string]string
+			json.NewDecoder(req.Body).Decode(&body)
+			if body["reason"] != "opt_out" {
+				t.Errorf("unexpected cancellation reason %q", body["reason"])
+			}
+			return &http.Response{StatusCode: http.StatusNoContent, Body: http.NoBody, Header: make(http.Header)}, nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error":"not found"}`), nil
+	})
+
+	email := "jane@example.com"
+	subscriber, err := client.UpdateSubscriber(ctx, 4, UpdateSubscriberRequest{Email: &email, UpdatedBy: "reception"})
+	if err != nil {
+		t.Fatalf("UpdateSubscriber() failed: %v", err)
+	}
+	if subscriber.Email != email {
+		t.Errorf("expected email %q, got %q", email, subscriber.Email)
+	}
+
+	if err := client.CancelSubscription(ctx, 4, CancellationOptOut); err != nil {
+		t.Fatalf("CancelSubscription() failed: %v", err)
+	}
+	if err := client.CancelSubscription(ctx, 5, CancellationOptOut); !errors.Is(err, ErrSubscriberNotFound) {
+		t.Errorf("expected ErrSubscriberNotFound, got %v", err)
+	}
+
+	invalid := "not-an-email"
+	blank := " "
+	for _, req := range []UpdateSubscriberRequest{
+		{UpdatedBy: "reception"},
+		{Email: &invalid, UpdatedBy: "reception"},
+		{PatientName: &blank, UpdatedBy: "reception"},
+		{Email: &email},
+	} {
+		if _, err := client.UpdateSubscriber(ctx, 4, req); err == nil {
+			t.Errorf("expected a validation error for %+v", req)
+		}
+	}
+}
+
+func TestCommunicationPreferences(t *testing.T) {
+	ctx := context.Background()
+
+	var stored CommunicationPreferences
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/api/subscriptions/7/preferences":
+			if req.Method == http.MethodPut {
+				if err := json.NewDecoder(req.Body).Decode(&stored); err != nil {
+					t.Errorf("unable to decode preferences: %v", err)
+				}
+				return newJSONResponse(http.StatusOK, fmt.Sprintf(
+					`{"sms": %t, "email": %t, "updated_at": "2025-01-02T00:00:00Z"}`, stored.SMS, stored.Email)), nil
+			}
+			return newJSONResponse(http.StatusOK, `{"sms": true, "email": false, "updated_at": "2025-01-01T00:00:00Z"}`), nil
+		case "/api/subscriptions/8/preferences":
+			return newJSONResponse(http.StatusInternalServerError, `{"error": "database unavailable"}`), nil
+		case "/api/subscriptions/9/preferences":
+			return newJSONResponse(http.StatusOK, `{"sms": "yes"}`), nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error": "subscriber not found"}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+
+	prefs, err := client.GetCommunicationPreferences(ctx, 7)
+	if err != nil {
+		t.Fatalf("GetCommunicationPreferences() failed: %v", err)
+	}
+	if !prefs.SMS || prefs.Email || !prefs.UpdatedAt.Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected preferences %+v", prefs)
+	}
+
+	updated, err := client.UpdateCommunicationPreferences(ctx, 7, &CommunicationPreferences{Email: true})
+	if err != nil {
+		t.Fatalf("UpdateCommunicationPreferences() failed: %v", err)
+	}
+	if stored.SMS || !stored.Email {
+		t.Errorf("unexpected preferences sent %+v", stored)
+	}
+	if updated.SMS || !updated.Email || updated.UpdatedAt.IsZero() {
+		t.Errorf("unexpected updated preferences %+v", updated)
+	}
+
+	if _, err := client.GetCommunicationPreferences(ctx, 1); !errors.Is(err, ErrSubscriberNotFound) {
+		t.Errorf("expected ErrSubscriberNotFound, got %v", err)
+	}
+	if _, err := client.UpdateCommunicationPreferences(ctx, 1, &CommunicationPreferences{}); !errors.Is(err, ErrSubscriberNotFound) {
+		t.Errorf("expected ErrSubscriberNotFound, got %v", err)
+	}
+
+	var apiErr *APIError
+	if _, err := client.GetCommunicationPreferences(ctx, 8); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected a 500 APIError, got %v", err)
+	}
+	if _, err := client.UpdateCommunicationPreferences(ctx, 8, &CommunicationPreferences{}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected a 500 APIError, got %v", err)
+	}
+
+	if _, err := client.GetCommunicationPreferences(ctx, 9); err == nil || !strings.Contains(err.Error(), "unable to decode json") {
+		t.Errorf("expected a decoding error, got %v", err)
+	}
+	if _, err := client.UpdateCommunicationPreferences(ctx, 7, nil); err == nil {
+		t.Error("expected an error for nil preferences")
+	}
+}
+
+func TestVerification(t *testing.T) {
+	ctx := context.Background()
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		var body map[string]string
+		json.NewDecoder(req.Body).Decode(&body)
+
+		switch req.URL.Path {
+		case "/api/subscriptions/7/verification":
+			if body["channel"] != "sms" {
+				t.Errorf("unexpected verification body %v", body)
+			}
+			return newJSONResponse(http.StatusOK, `{"subscriber_id": 7, "channel": "sms", "verified": false,
+				"sent_at": "2025-01-01T10:00:00Z", "expires_at": "2025-01-01T10:10:00Z"}`), nil
+		case "/api/subscriptions/7/verification/confirm":
+			if body["code"] != "123456" {
+				return newJSONResponse(http.StatusUnprocessableEntity, `{"error": "invalid verification code"}`), nil
+			}
+			return newJSONResponse(http.StatusOK, `{"subscriber_id": 7, "channel": "sms", "verified": true,
+				"verified_at": "2025-01-01T10:05:00Z"}`), nil
+		case "/api/subscriptions/8/verification", "/api/subscriptions/8/verification/confirm":
+			return newJSONResponse(http.StatusInternalServerError, `{"error": "sms gateway unavailable"}`), nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error": "subscriber not found"}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+
+	sent, err := client.SendVerification(ctx, 7, VerificationSMS)
+	if err != nil {
+		t.Fatalf("SendVerification() failed: %v", err)
+	}
+	if sent.Verified || sent.Channel != VerificationSMS || !sent.ExpiresAt.After(sent.SentAt) {
+		t.Errorf("unexpected verification %+v", sent)
+	}
+
+	if _, err := client.ConfirmVerification(ctx, 7, "000000"); !errors.Is(err, ErrUnprocessable) {
+		t.Errorf("expected ErrUnprocessable for an invalid code, got %v", err)
+	}
+
+	confirmed, err := client.ConfirmVerification(ctx, 7, "123456")
+	if err != nil {
+		t.Fatalf("ConfirmVerification() failed: %v", err)
+	}
+	if !confirmed.Verified || confirmed.VerifiedAt.IsZero() {
+		t.Errorf("expected a verified contact, got %+v", confirmed)
+	}
+
+	var apiErr *APIError
+	if _, err := client.SendVerification(ctx, 8, VerificationEmail); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected a 500 APIError, got %v", err)
+	}
+	if _, err := client.ConfirmVerification(ctx, 8, "123456"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected a 500 APIError, got %v", err)
+	}
+	if _, err := client.SendVerification(ctx, 1, VerificationEmail); !errors.Is(err, ErrSubscriberNotFound) {
+		t.Errorf("expected ErrSubscriberNotFound, got %v", err)
+	}
+
+	if _, err := client.SendVerification(ctx, 7, "whatsapp"); err == nil {
+		t.Error("expected an error for an unsupported channel")
+	}
+	if _, err := client.ConfirmVerification(ctx, 7, ""); err == nil {
+		t.Error("expected an error for an empty code")
+	}
+}
+
+func TestRefundAndVoidPayment(t *testing.T) {
+	ctx := WithIdempotencyKey(context.Background(), "receipt-8")
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/api/payments/8/refund":
+			if key := req.Header.Get(IdempotencyKeyHeader); key != "receipt-8" {
+				t.Errorf("expected the idempotency key receipt-8, got %q", key)
+			}
+			var body map[string]any
+			json.NewDecoder(req.Body).Decode(&body)
+			if body["amount"] != 5000.0 || body["reason"] != "wrong amount" {
+				t.Errorf("unexpected refund body %v", body)
+			}
+			return newJSONResponse(http.StatusOK, `{"id": 1, "payment_id": 8, "amount": 5000, "reason": "wrong amount",
+				"payment": {"id": 8, "amount": 20000, "refunded_amount": 5000}}`), nil
+		case "/api/payments/8/void":
+			return newJSONResponse(http.StatusOK, `{"id": 8, "voided_at": "2025-01-02T00:00:00Z"}`), nil
+		case "/api/payments/9/void":
+			return newJSONResponse(http.StatusConflict, `{"error":"payment already refunded"}`), nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error":"payment not found"}`), nil
+	})
+
+	refund, err := client.RefundPayment(ctx, 8, 5000, " wrong amount ")
+	if err != nil {
+		t.Fatalf("RefundPayment() failed: %v", err)
+	}
+	if refund.Amount != 5000 || refund.Payment == nil || refund.Payment.RefundedAmount != 5000 {
+		t.Errorf("unexpected refund %+v", refund)
+	}
+
+	payment, err := client.VoidPayment(ctx, 8)
+	if err != nil {
+		t.Fatalf("VoidPayment() failed: %v", err)
+	}
+	if payment.VoidedAt == nil {
+		t.Error("expected the payment to be voided")
+	}
+
+	if _, err := client.VoidPayment(ctx, 9); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected ErrConflict, got %v", err)
+	}
+	if _, err := client.RefundPayment(ctx, 10, 1, "duplicate"); !errors.Is(err, ErrPaymentNotFound) {
+		t.Errorf("expected ErrPaymentNotFound, got %v", err)
+	}
+
+	for _, amount := range []float64{0, -1, math.NaN()} {
+		if _, err := client.RefundPayment(ctx, 8, amount, "wrong amount"); err == nil {
+			t.Errorf("expected a validation error for amount %v", amount)
+		}
+	}
+	if _, err := client.RefundPayment(ctx, 8, 1, " "); err == nil {
+		t.Error("expected a validation error for an empty reason")
+	}
+}
+
+func TestListPayments(t *testing.T) {
+	ctx := context.Background()
+	day := time.Date(2025, 5, 6, 0, 0, 0, 0, time.UTC)
+	var queries []neturl.Values
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		queries = append(queries, req.URL.Query())
+		switch req.URL.Path {
+		case "/api/payments":
+			if req.URL.Query().Get("cursor") == "" {
+				return newJSONResponse(http.StatusOK, `{"data": [{"id": 1, "amount": 1000}], "next_cursor": "p2", "total": 2, "total_amount": 3000}`), nil
+			}
+			return newJSONResponse(http.StatusOK, `{"data": [{"id": 2, "amount": 2000}], "total": 2, "total_amount": 3000}`), nil
+		case "/api/payments/list/4":
+			return newJSONResponse(http.StatusOK, `{"data": [{"id": 3}], "total": 1}`), nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error":"not found"}`), nil
+	})
+
+	opts := &PaymentListOptions{From: day, To: day.AddDate(0, 0, 1), RegisteredBy: "cashier", ListOptions: ListOptions{PerPage: 1}}
+	page, err := client.ListPayments(ctx, opts)
+	if err != nil {
+		t.Fatalf("ListPayments() failed: %v", err)
+	}
+	if len(page.Payments) != 1 || page.TotalAmount != 3000 || !page.HasMore() {
+		t.Errorf("unexpected page %+v", page)
+	}
+	if q := queries[0]; q.Get("from") != day.Format(time.RFC3339) || q.Get("to") != day.AddDate(0, 0, 1).Format(time.RFC3339) ||
+		q.Get("registered_by") != "cashier" || q.Get("per_page") != "1" || q.Get("hospital_number") != "HOS-123" {
+		t.Errorf("unexpected query %v", q)
+	}
+
+	var ids []uint
+	for payment, err := range client.AllPayments(ctx, opts) {
+		if err != nil {
+			t.Fatalf("AllPayments() failed: %v", err)
+		}
+		ids = append(ids, payment.ID)
+	}
+	if !slices.Equal(ids, []uint{1, 2}) {
+		t.Errorf("expected payments [1 2], got %v", ids)
+	}
+	if q := queries[len(queries)-1]; q.Get("cursor") != "p2" || q.Get("registered_by") != "cashier" {
+		t.Errorf("expected the filters to be kept across pages, got %v", q)
+	}
+
+	subscriberPage, err := client.GetSubscriberPaymentsPage(ctx, 4, nil)
+	if err != nil {
+		t.Fatalf("GetSubscriberPaymentsPage() failed: %v", err)
+	}
+	if len(subscriberPage.Payments) != 1 {
+		t.Errorf("expected 1 payment, got %d", len(subscriberPage.Payments))
+	}
+	if _, err := client.GetSubscriberPaymentsPage(ctx, 5, nil); !errors.Is(err, ErrSubscriberNotFound) {
+		t.Errorf("expected ErrSubscriberNotFound, got %v", err)
+	}
+
+	if _, err := client.ListPayments(ctx, &PaymentListOptions{From: day, To: day}); err == nil {
+		t.Error("expected an error for an empty date range")
+	}
+}
+
+func TestSession(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	token := newTestJWT(expiresAt)
+
+	client, err := NewEcloudClientV2(&Config{
+		ApiBaseUrl:     "http://testhost",
+		EclinicId:      "test-id",
+		Password:       "test-password",
+		HospitalNumber: "HOS-123",
+		HospitalName:   "Test Hospital",
+		EclinicBaseUrl: "http://eclinic",
+		HTTPClient: &mockHTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+			return newJSONResponse(http.StatusOK, fmt.Sprintf(`{"token": %q, "user": {"id": 7, "eclinic_id": "test-id"}}`, token)), nil
+		}},
+		Logger: &NoOpLogger{},
+	})
+	if err != nil {
+		t.Fatalf("NewEcloudClientV2() failed: %v", err)
+	}
+
+	if session := client.Session(); session.Authenticated || session.Token != "" {
+		t.Errorf("expected an empty session before login, got %+v", session)
+	}
+
+	if _, err := client.Login(context.Background()); err != nil {
+		t.Fatalf("Login() failed: %v", err)
+	}
+
+	session := client.Session()
+	if !session.Authenticated || session.Token != token || session.User.ID != 7 || !session.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("unexpected session %+v", session)
+	}
+	if session.Expired(time.Now()) || !session.Expired(expiresAt) {
+		t.Error("unexpected session expiry")
+	}
+	if (Session{Token: "opaque"}).Expired(time.Now()) {
+		t.Error("expected a token of unknown expiry not to be expired")
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	var keys []string
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		keys = append(keys, req.Header.Get(IdempotencyKeyHeader))
+		if len(keys)%2 == 1 {
+			return nil, errors.New("connection reset")
+		}
+		if req.URL.Path == "/api/payments" {
+			return newJSONResponse(http.StatusOK, `{"id": 1, "amount": 100}`), nil
+		}
+		return newJSONResponse(http.StatusOK, `{"id": 1}`), nil
+	})
+	client.(*DefaultEcloudClient).retryPolicy = &noBackoffRetryPolicy{DefaultRetryPolicy{maxRetries: 1}}
+
+	payment, err := client.CreatePayment(ctx, 1, 100, "cashier")
+	if err != nil {
+		t.Fatalf("CreatePayment() failed: %v", err)
+	}
+	if keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("expected the same key on every attempt, got %q", keys)
+	}
+	if payment.IdempotencyKey != keys[0] {
+		t.Errorf("expected the payment to expose key %q, got %q", keys[0], payment.IdempotencyKey)
+	}
+
+	subscriber, err := client.Subscribe(ctx, &SubscribeRequest{PatientID: 1, PatientName: "Jane", RegisteredBy: "reception"})
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+	if keys[2] == keys[0] || keys[2] != keys[3] || subscriber.IdempotencyKey != keys[2] {
+		t.Errorf("expected a new key per operation, got %q", keys)
+	}
+
+	payment, err = client.CreatePayment(WithIdempotencyKey(ctx, "receipt-42"), 1, 100, "cashier")
+	if err != nil {
+		t.Fatalf("CreatePayment() failed: %v", err)
+	}
+	if keys[4] != "receipt-42" || keys[5] != "receipt-42" || payment.IdempotencyKey != "receipt-42" {
+		t.Errorf("expected the caller's key, got %q", keys)
+	}
+}
+
+func TestContextHeaders(t *testing.T) {
+	var got http.Header
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		got = req.Header.Clone()
+		return newJSONResponse(http.StatusOK, `{"Amount": 5000}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+
+	ctx := WithHeader(context.Background(), "X-Tenant-Id", "branch-1")
+	child := WithHeader(ctx, "Baggage", "visit=7")
+	child = WithHeader(child, "Authorization", "Bearer spoofed")
+
+	if _, err := client.GetBill(child); err != nil {
+		t.Fatalf("GetBill() failed: %v", err)
+	}
+	if got.Get("X-Tenant-Id") != "branch-1" || got.Get("Baggage") != "visit=7" {
+		t.Errorf("expected the context headers to be sent, got %v", got)
+	}
+	if got.Get("Authorization") != "Bearer test-token" {
+		t.Errorf("expected the SDK's Authorization header to win, got %q", got.Get("Authorization"))
+	}
+
+	if HeadersFrom(ctx).Get("Baggage") != "" {
+		t.Error("expected WithHeader not to modify the parent context")
+	}
+}
+
+func TestBackoffPolicy(t *testing.T) {
+	t.Run("Full jitter with cap", func(t *testing.T) {
+		policy := NewBackoffPolicy(5, 100*time.Millisecond, time.Second)
+		var ceilings []time.Duration
+		policy.random = func(n time.Duration) time.Duration {
+			ceilings = append(ceilings, n)
+			return n / 2
+		}
+
+		for attempt := range 5 {
+			policy.BackoffDuration(attempt)
+		}
+		want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+		if !slices.Equal(ceilings, want) {
+			t.Errorf("expected backoff ceilings %v, got %v", want, ceilings)
+		}
+
+		if d := NewBackoffPolicy(100, time.Second, time.Minute).BackoffDuration(99); d < 0 || d >= time.Minute {
+			t.Errorf("expected a capped backoff, got %v", d)
+		}
+	})
+
+	t.Run("Retry-After", func(t *testing.T) {
+		policy := NewBackoffPolicy(3, time.Millisecond, 10*time.Second)
+
+		resp := newJSONResponse(http.StatusTooManyRequests, `{}`)
+		resp.Header.Set("Retry-After", "3")
+		if d := policy.BackoffFor(0, resp); d != 3*time.Second {
+			t.Errorf("expected 3s, got %v", d)
+		}
+
+		resp.Header.Set("Retry-After", "3600")
+		if d := policy.BackoffFor(0, resp); d != 10*time.Second {
+			t.Errorf("expected Retry-After to be capped at 10s, got %v", d)
+		}
+
+		now := time.Now()
+		resp.Header.Set("Retry-After", now.Add(5*time.Second).UTC().Format(http.TimeFormat))
+		if d, ok := retryAfter(resp, now); !ok || d <= 3*time.Second || d > 5*time.Second {
+			t.Errorf("expected about 5s from an HTTP date, got %v", d)
+		}
+	})
+
+	t.Run("ShouldRetry", func(t *testing.T) {
+		policy := NewBackoffPolicy(1, time.Millisecond, time.Millisecond)
+		for code, want := range map[int]bool{429: true, 500: true, 503: true, 400: false, 404: false, 501: false} {
+			if got := policy.ShouldRetry(0, nil, &http.Response{StatusCode: code}); got != want {
+				t.Errorf("ShouldRetry(%d) = %v, want %v", code, got, want)
+			}
+		}
+		if policy.ShouldRetry(0, context.Canceled, nil) {
+			t.Error("expected cancelled requests not to be retried")
+		}
+		if policy.ShouldRetry(1, errors.New("connection reset"), nil) {
+			t.Error("expected no retry once retries are exhausted")
+		}
+	})
+
+	t.Run("429 is retried after Retry-After", func(t *testing.T) {
+		var calls atomic.Int32
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			if calls.Add(1) == 1 {
+				resp := newJSONResponse(http.StatusTooManyRequests, `{"error":"slow down"}`)
+				resp.Header.Set("Retry-After", "0")
+				return resp, nil
+			}
+			return newJSONResponse(http.StatusOK, `{"Amount": 5000}`), nil
+		})
+
+		if _, err := client.GetBill(context.Background()); err != nil {
+			t.Fatalf("GetBill() failed: %v", err)
+		}
+		if calls.Load() != 2 {
+			t.Errorf("expected 2 attempts, got %d", calls.Load())
+		}
+	})
+
+	t.Run("Backoff does not outlive the context", func(t *testing.T) {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			resp := newJSONResponse(http.StatusServiceUnavailable, `{"error":"maintenance"}`)
+			resp.Header.Set("Retry-After", "60")
+			return resp, nil
+		})
+		client.(*DefaultEcloudClient).retryPolicy = NewBackoffPolicy(3, time.Millisecond, time.Minute)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		start := time.Now()
+		_, err := client.GetBill(ctx)
+		if !errors.Is(err, ErrServerError) {
+			t.Errorf("expected the 503 to be returned, got %v", err)
+		}
+		if time.Since(start) > 500*time.Millisecond {
+			t.Errorf("expected to give up without sleeping past the deadline, took %v", time.Since(start))
+		}
+	})
+
+	t.Run("Configured from Config", func(t *testing.T) {
+		policy := defaultRetryPolicy(&Config{MaxRetries: 5, RetryMaxDelay: time.Second})
+		if policy.Retries != 5 || policy.BaseDelay != DefaultRetryBaseDelay || policy.MaxDelay != time.Second {
+			t.Errorf("unexpected policy %+v", policy)
+		}
+		if policy := defaultRetryPolicy(&Config{MaxRetries: -1}); policy.MaxRetries() != 0 {
+			t.Errorf("expected negative MaxRetries to disable retries, got %d", policy.MaxRetries())
+		}
+	})
+}
+
+func TestPaymentsSince(t *testing.T) {
+	ctx := context.Background()
+	responses := map[string]string{
+		"0": `{"data": [{"id": 10, "sequence": 1}, {"id": 11, "sequence": 2}, {"id": 12, "sequence": 4}], "watermark": 2}`,
+		"2": `{"data": [{"id": 12, "sequence": 4}, {"id": 9, "sequence": 3}], "watermark": 4}`,
+		"5": `{"data": [], "watermark": 5}`,
+	}
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/api/payments/feed" {
+			return newJSONResponse(http.StatusNotFound, `{"error":"not found"}`), nil
+		}
+		body, ok := responses[req.URL.Query().Get("after")]
+		if !ok {
+			return newJSONResponse(http.StatusBadRequest, `{"error":"unexpected checkpoint"}`), nil
+		}
+		return newJSONResponse(http.StatusOK, body), nil
+	})
+
+	payments, next, err := client.PaymentsSince(ctx, 0)
+	if err != nil {
+		t.Fatalf("PaymentsSince() failed: %v", err)
+	}
+	if len(payments) != 2 || next != 2 {
+		t.Errorf("expected the payments below the watermark and checkpoint 2, got %d payments and %d", len(payments), next)
+	}
+
+	// A feed that goes backwards is rejected rather than risking duplicates.
+	if _, next, err := client.PaymentsSince(ctx, 2); err == nil || next != 2 {
+		t.Errorf("expected an out of order error keeping checkpoint 2, got %v and %d", err, next)
+	}
+
+	payments, next, err = client.PaymentsSince(ctx, 5)
+	if err != nil {
+		t.Fatalf("PaymentsSince() failed: %v", err)
+	}
+	if len(payments) != 0 || next != 5 {
+		t.Errorf("expected no payments and an unchanged checkpoint, got %d and %d", len(payments), next)
+	}
+}
+
+// fakeKeychain is an in-memory keychain for testing KeychainTokenStore.
+type fakeKeychain map[string][]byte
+
+func (k fakeKeychain) get(ctx context.Context, service, account string) ([]byte, error) {
+	return k[service+"/"+account], nil
+}
+
+func (k fakeKeychain) set(ctx context.Context, service, account string, secret []byte) error {
+	k[service+"/"+account] = secret
+	return nil
+}
+
+func (k fakeKeychain) delete(ctx context.Context, service, account string) error {
+	delete(k, service+"/"+account)
+	return nil
+}
+
+func TestKeychainTokenStore(t *testing.T) {
+	ctx := context.Background()
+	keychain := fakeKeychain{}
+	store := NewKeychainTokenStore("")
+	store.keychain = keychain
+
+	stored, err := store.Get(ctx, "key")
+	if err != nil || stored != nil {
+		t.Fatalf("expected no token, got %v, %v", stored, err)
+	}
+
+	token := &StoredToken{Token: "secret-token", User: User{EclinicID: "test-id"}}
+	if err := store.Set(ctx, "key", token); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if _, ok := keychain[DefaultKeychainService+"/key"]; !ok {
+		t.Errorf("expected the token under the default service, got %v", keychain)
+	}
+
+	stored, err = store.Get(ctx, "key")
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if stored.Token != "secret-token" || stored.User.EclinicID != "test-id" {
+		t.Errorf("unexpected token %+v", stored)
+	}
+
+	if err := store.Delete(ctx, "key"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if stored, _ := store.Get(ctx, "key"); stored != nil {
+		t.Error("expected the token to be deleted")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	newSubscription := func(size int, policy OverflowPolicy) *eventSubscription {
+		return &eventSubscription{
+			size:     size,
+			policy:   policy,
+			spillDir: t.TempDir(),
+			logger:   &NoOpLogger{},
+			ready:    make(chan struct{}, 1),
+			space:    make(chan struct{}, 1),
+			done:     make(chan struct{}),
+		}
+	}
+
+	paymentEvent := func(id uint) Event {
+		return Event{Type: EventPaymentRecorded, Payment: &Payment{ID: id}}
+	}
+
+	drain := func(sub *eventSubscription) []uint {
+		var ids []uint
+		for {
+			event, ok := sub.next()
+			if !ok {
+				return ids
+			}
+			ids = append(ids, event.Payment.ID)
+		}
+	}
+
+	t.Run("Payment recorded", func(t *testing.T) {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			return newJSONResponse(http.StatusOK, `{"id": 202, "subscriber_id": 101, "amount": 5000}`), nil
+		})
+		client.(*DefaultEcloudClient).jwtToken = "test-token"
+
+		ctx, cancel := context.WithCancel(context.Background())
+		events := client.Events(ctx)
+
+		if _, err := client.CreatePayment(ctx, 101, 5000, "clerk01"); err != nil {
+			t.Fatalf("CreatePayment() failed: %v", err)
+		}
+
+		select {
+		case event := <-events:
+			if event.Type != EventPaymentRecorded || event.Payment.ID != 202 || event.Time.IsZero() {
+				t.Errorf("unexpected event %+v", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected a payment event")
+		}
+
+		cancel()
+		for range events {
+		}
+		if subs := client.(*DefaultEcloudClient).events.subscribers(); len(subs) != 0 {
+			t.Errorf("expected the subscription to be removed, got %d", len(subs))
+		}
+	})
+
+	t.Run("Lifecycle", func(t *testing.T) {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			io.Copy(io.Discard, req.Body)
+			switch req.URL.Path {
+			case "/api/subscriptions":
+				return newJSONResponse(http.StatusOK, `{"id": 101, "patient_id": 7, "patient_name": "Jane"}`), nil
+			case "/api/records":
+				return newJSONResponse(http.StatusOK, `{"id": 55}`), nil
+			}
+			return newJSONResponse(http.StatusNotFound, `{}`), nil
+		})
+		client.(*DefaultEcloudClient).jwtToken = "test-token"
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := client.Events(ctx)
+
+		if _, err := client.Subscribe(ctx, &SubscribeRequest{PatientID: 7, PatientName: "Jane"}); err != nil {
+			t.Fatalf("Subscribe() failed: %v", err)
+		}
+		record := &PatientRecord{VisitID: 9, SubscriberID: 101, Title: "CBC", VisitTimestamp: time.Now(), LabReport: validPDFBytes}
+		if err := client.SyncMedicalRecords(ctx, record); err != nil {
+			t.Fatalf("SyncMedicalRecords() failed: %v", err)
+		}
+
+		created := <-events
+		if created.Type != EventSubscriberCreated || created.Subscriber.ID != 101 || created.Subscriber.PatientName != "Jane" {
+			t.Errorf("unexpected event %+v", created)
+		}
+
+		synced := <-events
+		if synced.Type != EventRecordSynced || synced.Record.ID != 55 || synced.Record.VisitID != 9 ||
+			synced.Record.HospitalNumber != "HOS-123" || synced.Record.LabReport != nil {
+			t.Errorf("unexpected event %+v", synced)
+		}
+		if record.ID != 0 || record.LabReport == nil {
+			t.Error("the caller's record must not be modified")
+		}
+	})
+
+	t.Run("Drop oldest", func(t *testing.T) {
+		sub := newSubscription(2, OverflowDropOldest)
+		for id := range uint(4) {
+			sub.publish(context.Background(), paymentEvent(id+1))
+		}
+
+		if ids := drain(sub); !slices.Equal(ids, []uint{3, 4}) {
+			t.Errorf("expected the newest events, got %v", ids)
+		}
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		sub := newSubscription(1, OverflowBlock)
+		sub.publish(context.Background(), paymentEvent(1))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		sub.publish(ctx, paymentEvent(2)) // Dropped once ctx is done.
+
+		published := make(chan struct{})
+		go func() {
+			sub.publish(context.Background(), paymentEvent(3))
+			close(published)
+		}()
+
+		if event, _ := sub.next(); event.Payment.ID != 1 {
+			t.Errorf("expected event 1, got %d", event.Payment.ID)
+		}
+		<-published
+
+		if ids := drain(sub); !slices.Equal(ids, []uint{3}) {
+			t.Errorf("expected the blocked event, got %v", ids)
+		}
+	})
+
+	t.Run("Spill to disk", func(t *testing.T) {
+		sub := newSubscription(1, OverflowSpillToDisk)
+		for id := range uint(3) {
+			sub.publish(context.Background(), paymentEvent(id+1))
+		}
+
+		if event, _ := sub.next(); event.Payment.ID != 1 {
+			t.Errorf("expected event 1, got %d", event.Payment.ID)
+		}
+		sub.publish(context.Background(), paymentEvent(4))
+
+		if ids := drain(sub); !slices.Equal(ids, []uint{2, 3, 4}) {
+			t.Errorf("expected the events in order, got %v", ids)
+		}
+
+		info, err := sub.spill.file.Stat()
+		if err != nil || info.Size() != 0 {
+			t.Errorf("expected the drained spill file to be truncated, got %v, %v", info, err)
+		}
+
+		sub.out = make(chan Event)
+		sub.close()
+		if entries, _ := os.ReadDir(sub.spillDir); len(entries) != 0 {
+			t.Errorf("expected the spill file to be removed, got %v", entries)
+		}
+
+		// Spilled events hold patient data, so they aren't written to the
+		// system temporary directory by default.
+		config := Config{ApiBaseUrl: "http://testhost", EclinicId: "id", Password: "pw", HospitalNumber: "HOS-123",
+			HospitalName: "Test", EclinicBaseUrl: "http://eclinic", EventOverflow: OverflowSpillToDisk}
+		if err := config.Validate(); !errors.Is(err, ErrEventSpillDirRequired) {
+			t.Errorf("expected ErrEventSpillDirRequired, got %v", err)
+		}
+		config.EventSpillDir = t.TempDir()
+		if err := config.Validate(); err != nil {
+			t.Errorf("expected the config with a spill directory to be valid, got %v", err)
+		}
+	})
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	newPolicy := func() *CircuitBreakerPolicy {
+		policy := NewCircuitBreakerPolicy(2, time.Minute)
+		policy.now = func() time.Time { return now }
+		return policy
+	}
+
+	request := func(path string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "http://testhost"+path, nil)
+	}
+
+	failed := &http.Response{StatusCode: http.StatusServiceUnavailable}
+	succeeded := &http.Response{StatusCode: http.StatusOK}
+
+	attempt := func(policy *CircuitBreakerPolicy, path string, resp *http.Response, err error) error {
+		done, allowErr := policy.Allow(request(path))
+		if allowErr != nil {
+			return allowErr
+		}
+		done(resp, err)
+		return nil
+	}
+
+	t.Run("Opens and closes", func(t *testing.T) {
+		policy := newPolicy()
+		attempt(policy, "/api/bills", failed, nil)
+		attempt(policy, "/api/bills", nil, errors.New("connection reset"))
+
+		err := attempt(policy, "/api/bills", succeeded, nil)
+		var openErr *CircuitOpenError
+		if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &openErr) {
+			t.Fatalf("expected ErrCircuitOpen, got %v", err)
+		}
+		if !openErr.RetryAt.Equal(now.Add(time.Minute)) {
+			t.Errorf("expected retry at %v, got %v", now.Add(time.Minute), openErr.RetryAt)
+		}
+
+		now = now.Add(time.Minute)
+		done, err := policy.Allow(request("/api/bills"))
+		if err != nil {
+			t.Fatalf("expected a half-open probe, got %v", err)
+		}
+		if _, err := policy.Allow(request("/api/bills")); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("expected a single probe, got %v", err)
+		}
+
+		done(succeeded, nil)
+		if err := attempt(policy, "/api/bills", succeeded, nil); err != nil {
+			t.Errorf("expected the circuit to close, got %v", err)
+		}
+	})
+
+	t.Run("Failed probe reopens", func(t *testing.T) {
+		policy := newPolicy()
+		attempt(policy, "/api/bills", failed, nil)
+		attempt(policy, "/api/bills", failed, nil)
+
+		now = now.Add(time.Minute)
+		attempt(policy, "/api/bills", failed, nil)
+		if err := attempt(policy, "/api/bills", succeeded, nil); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("expected the circuit to reopen, got %v", err)
+		}
+	})
+
+	t.Run("Successes and cancellations", func(t *testing.T) {
+		policy := newPolicy()
+		attempt(policy, "/api/bills", failed, nil)
+		attempt(policy, "/api/bills", succeeded, nil)
+		attempt(policy, "/api/bills", failed, nil)
+		attempt(policy, "/api/bills", nil, context.Canceled)
+
+		if err := attempt(policy, "/api/bills", succeeded, nil); err != nil {
+			t.Errorf("expected non-consecutive failures to keep the circuit closed, got %v", err)
+		}
+	})
+
+	t.Run("Per endpoint", func(t *testing.T) {
+		policy := newPolicy()
+		policy.PerEndpoint = true
+		attempt(policy, "/api/subscriptions/1/payments", failed, nil)
+		attempt(policy, "/api/subscriptions/2/payments", failed, nil)
+
+		if err := attempt(policy, "/api/subscriptions/3/payments", succeeded, nil); !errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("expected IDs to share a circuit, got %v", err)
+		}
+		if err := attempt(policy, "/api/bills", succeeded, nil); err != nil {
+			t.Errorf("expected other endpoints to be allowed, got %v", err)
+		}
+	})
+
+	t.Run("Client fails fast", func(t *testing.T) {
+		var calls atomic.Int32
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			return nil, errors.New("connection refused")
+		})
+		client.(*DefaultEcloudClient).jwtToken = "test-token"
+		client.(*DefaultEcloudClient).retryPolicy = &noBackoffRetryPolicy{DefaultRetryPolicy{maxRetries: 5}}
+		client.(*DefaultEcloudClient).config.CircuitBreaker = NewCircuitBreakerPolicy(2, time.Minute)
+
+		if _, err := client.GetBill(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected ErrCircuitOpen, got %v", err)
+		}
+		if calls.Load() != 2 {
+			t.Errorf("expected 2 attempts before the circuit opened, got %d", calls.Load())
+		}
+	})
+}
+
+func TestCacheWarmUp(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		calls[req.URL.Path]++
+		mu.Unlock()
+
+		switch req.URL.Path {
+		case "/api/billing/get_bill":
+			return newJSONResponse(http.StatusOK, `{"hospital_number": "HOS-123"}`), nil
+		case "/api/subscriptions":
+			if req.URL.Query().Get("cursor") == "" {
+				return newJSONResponse(http.StatusOK, `{"data": [{"id": 1}], "next_cursor": "c2"}`), nil
+			}
+			return newJSONResponse(http.StatusOK, `{"data": [{"id": 2}]}`), nil
+		case "/api/subscriptions/pending/HOS-123":
+			return newJSONResponse(http.StatusOK, `[{"id": 3}]`), nil
+		case "/api/payments":
+			return newJSONResponse(http.StatusOK, `{"id": 9, "subscriber_id": 1}`), nil
+		case "/api/subscriptions/1":
+			return newJSONResponse(http.StatusOK, `{"id": 1, "patient_name": "Renewed"}`), nil
+		}
+		return nil, fmt.Errorf("unexpected path: %s", req.URL.Path)
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+	ctx := context.Background()
+
+	if err := client.WarmUp(ctx); err == nil {
+		t.Error("expected WarmUp to require CacheTTL")
+	}
+
+	client.(*DefaultEcloudClient).config.CacheTTL = time.Minute
+	if err := client.WarmUp(ctx); err != nil {
+		t.Fatalf("WarmUp() failed: %v", err)
+	}
+	if calls["/api/subscriptions"] != 2 {
+		t.Errorf("expected both subscriber pages to be fetched, got %d", calls["/api/subscriptions"])
+	}
+
+	if _, err := client.GetBill(ctx); err != nil {
+		t.Fatalf("GetBill() failed: %v", err)
+	}
+	if subscriber, err := client.GetSubscriber(ctx, 2); err != nil || subscriber.ID != 2 {
+		t.Fatalf("expected subscriber 2 from the cache, got %v, %v", subscriber, err)
+	}
+	pending, err := client.GetPendingSubscribers(ctx)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("expected the pending list from the cache, got %v, %v", pending, err)
+	}
+	pending[0].PatientName = "modified"
+
+	if calls["/api/billing/get_bill"] != 1 || calls["/api/subscriptions/pending/HOS-123"] != 1 {
+		t.Errorf("expected lookups to be served from the cache, got %v", calls)
+	}
+	if pending, _ := client.GetPendingSubscribers(ctx); pending[0].PatientName != "" {
+		t.Error("expected cached values to be copied")
+	}
+
+	if _, err := client.CreatePayment(ctx, 1, 5000, "clerk01"); err != nil {
+		t.Fatalf("CreatePayment() failed: %v", err)
+	}
+	subscriber, err := client.GetSubscriber(ctx, 1)
+	if err != nil || subscriber.PatientName != "Renewed" {
+		t.Errorf("expected the payment to invalidate subscriber 1, got %v, %v", subscriber, err)
+	}
+	client.GetBill(ctx)
+	if calls["/api/billing/get_bill"] != 2 {
+		t.Errorf("expected the payment to invalidate the bill, got %d calls", calls["/api/billing/get_bill"])
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var order []string
+	var attempts []int
+	var calls int
+
+	trace := func(name string) Middleware {
+		return func(next HTTPClient) HTTPClient {
+			return HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.Do(req)
+			})
+		}
+	}
+
+	tenant := func(next HTTPClient) HTTPClient {
+		return HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Tenant-Id", "branch-7")
+			attempts = append(attempts, RequestAttempt(req))
+			return next.Do(req)
+		})
+	}
+
+	client, err := NewClient(
+		WithBaseURL("http://testhost"),
+		WithCredentials("test-id", "test-password"),
+		WithHospital("HOS-123", "Test Hospital"),
+		WithEclinicBaseURL("http://eclinic"),
+		WithLogger(&NoOpLogger{}),
+		WithRetryPolicy(&noBackoffRetryPolicy{DefaultRetryPolicy{maxRetries: 2}}),
+		WithHTTPClient(&mockHTTPClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+			calls++
+			if req.Header.Get("X-Tenant-Id") != "branch-7" {
+				t.Errorf("expected the middleware header, got %q", req.Header.Get("X-Tenant-Id"))
+			}
+			if calls == 1 {
+				return newJSONResponse(http.StatusServiceUnavailable, `{"error": "down"}`), nil
+			}
+			return newJSONResponse(http.StatusOK, `{}`), nil
+		}}),
+		WithMiddleware(trace("outer"), trace("inner")),
+		WithMiddleware(tenant),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+
+	if _, err := client.GetBill(context.Background()); err != nil {
+		t.Fatalf("GetBill() failed: %v", err)
+	}
+
+	if want := []string{"outer", "inner", "outer", "inner"}; !slices.Equal(order, want) {
+		t.Errorf("expected middleware order %v, got %v", want, order)
+	}
+	if !slices.Equal(attempts, []int{0, 1}) {
+		t.Errorf("expected attempts [0 1], got %v", attempts)
+	}
+}
+
+func TestDuplicateSubscriptionGuard(t *testing.T) {
+	ctx := context.Background()
+	request := &SubscribeRequest{PatientID: 42, PatientName: "Jane", RegisteredBy: "clerk01"}
+
+	t.Run("Pre-check", func(t *testing.T) {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			if req.Method == http.MethodPost {
+				t.Fatal("expected no subscription to be created")
+			}
+			return newJSONResponse(http.StatusOK, `{"id": 7, "patient_id": 42}`), nil
+		})
+		client.(*DefaultEcloudClient).config.CheckDuplicateSubscriptions = true
+
+		_, err := client.Subscribe(ctx, request)
+		var dupErr *AlreadySubscribedError
+		if !errors.Is(err, ErrAlreadySubscribed) || !errors.As(err, &dupErr) || dupErr.Subscriber.ID != 7 {
+			t.Fatalf("expected AlreadySubscribedError for subscriber 7, got %v", err)
+		}
+	})
+
+	t.Run("Pre-check passes", func(t *testing.T) {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			if req.Method == http.MethodGet {
+				return newJSONResponse(http.StatusNotFound, `{"error": "not subscribed"}`), nil
+			}
+			return newJSONResponse(http.StatusOK, `{"id": 8, "patient_id": 42}`), nil
+		})
+		client.(*DefaultEcloudClient).config.CheckDuplicateSubscriptions = true
+
+		if sub, err := client.Subscribe(ctx, request); err != nil || sub.ID != 8 {
+			t.Fatalf("expected subscriber 8, got %v, %v", sub, err)
+		}
+	})
+
+	t.Run("Server conflict", func(t *testing.T) {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			return newJSONResponse(http.StatusConflict,
+				`{"error": "already subscribed", "subscriber": {"id": 7, "patient_id": 42}}`), nil
+		})
+
+		_, err := client.Subscribe(ctx, request)
+		var dupErr *AlreadySubscribedError
+		if !errors.As(err, &dupErr) || dupErr.Subscriber.ID != 7 {
+			t.Fatalf("expected AlreadySubscribedError for subscriber 7, got %v", err)
+		}
+		if !errors.Is(err, ErrConflict) {
+			t.Errorf("expected the API error to be wrapped, got %v", err)
+		}
+	})
+
+	t.Run("Server conflict without subscriber", func(t *testing.T) {
+		client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			if req.Method == http.MethodGet {
+				if !strings.HasSuffix(req.URL.Path, "/HOS-123/42") {
+					t.Errorf("unexpected lookup %s", req.URL.Path)
+				}
+				return newJSONResponse(http.StatusOK, `{"id": 9, "patient_id": 42}`), nil
+			}
+			return newJSONResponse(http.StatusConflict, `{"error": "already subscribed"}`), nil
+		})
+
+		_, err := client.Subscribe(ctx, request)
+		var dupErr *AlreadySubscribedError
+		if !errors.As(err, &dupErr) || dupErr.Subscriber == nil || dupErr.Subscriber.ID != 9 {
+			t.Fatalf("expected the existing subscriber to be looked up, got %v", err)
+		}
+	})
+}
+
+func TestResolveVisitAndRecord(t *testing.T) {
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/api/records/visits/HOS-123/55":
+			return newJSONResponse(http.StatusOK, `[{"record_id": 9, "visit_id": 55}, {"record_id": 10, "visit_id": 55}]`), nil
+		case "/api/records/visits/HOS-123/56":
+			return newJSONResponse(http.StatusOK, `[]`), nil
+		case "/api/records/9/link":
+			return newJSONResponse(http.StatusOK, `{"record_id": 9, "visit_id": 55, "patient_id": 42}`), nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error": "record not found"}`), nil
+	})
+	ctx := context.Background()
+
+	links, err := client.ResolveVisit(ctx, 55)
+	if err != nil || len(links) != 2 || links[1].RecordID != 10 {
+		t.Fatalf("expected 2 records for visit 55, got %v, %v", links, err)
+	}
+	if _, err := client.ResolveVisit(ctx, 56); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound for a visit without records, got %v", err)
+	}
+
+	link, err := client.ResolveRecord(ctx, 9)
+	if err != nil || link.VisitID != 55 || link.PatientID != 42 {
+		t.Fatalf("expected record 9 to link to visit 55, got %+v, %v", link, err)
+	}
+	if _, err := client.ResolveRecord(ctx, 11); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound, got %v", err)
+	}
+}
+
+type fakeTracer struct {
+	mu    sync.Mutex
+	spans []*fakeSpan
+}
+
+func (t *fakeTracer) Start(ctx context.Context, operation string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	span := &fakeSpan{name: operation, id: len(t.spans) + 1, attributes: map[string]any{}}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+type fakeSpan struct {
+	name       string
+	id         int
+	attributes map[string]any
+	err        error
+	ended      bool
+}
+
+func (s *fakeSpan) SetAttributes(attributes ...Attribute) {
+	for _, attribute := range attributes {
+		s.attributes[attribute.Key] = attribute.Value
+	}
+}
+
+func (s *fakeSpan) RecordError(err error) { s.err = err }
+func (s *fakeSpan) End()                  { s.ended = true }
+
+func (s *fakeSpan) TraceParent() string {
+	return fmt.Sprintf("00-4bf92f3577b34da6a3ce929d0e0e4736-%016x-01", s.id)
+}
+
+func TestTracing(t *testing.T) {
+	var traceParents []string
+	calls := 0
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		traceParents = append(traceParents, req.Header.Get("traceparent"))
+		calls++
+		if req.Body != nil {
+			io.Copy(io.Discard, req.Body) // Sent like a real transport would.
+		}
+		switch {
+		case req.Method == http.MethodGet:
+			return newJSONResponse(http.StatusNotFound, `{"error": "not subscribed"}`), nil
+		case calls == 2:
+			return newJSONResponse(http.StatusServiceUnavailable, `{"error": "down"}`), nil
+		}
+		return newJSONResponse(http.StatusOK, `{"id": 8}`), nil
+	})
+	tracer := &fakeTracer{}
+	client.(*DefaultEcloudClient).config.TracerProvider = tracer
+	client.(*DefaultEcloudClient).config.CheckDuplicateSubscriptions = true
+
+	_, err := client.Subscribe(context.Background(), &SubscribeRequest{PatientID: 42, RegisteredBy: "clerk01"})
+	if err != nil {
+		t.Fatalf("Subscribe() failed: %v", err)
+	}
+
+	if len(tracer.spans) != 2 || tracer.spans[0].name != "Subscribe" || tracer.spans[1].name != "GetPatientSubscription" {
+		t.Fatalf("expected Subscribe and GetPatientSubscription spans, got %v", tracer.spans)
+	}
+
+	subscribe, lookup := tracer.spans[0], tracer.spans[1]
+	if !subscribe.ended || subscribe.err != nil {
+		t.Errorf("expected Subscribe span to end without error, got %+v", subscribe)
+	}
+	if subscribe.attributes[AttributeHTTPStatusCode] != http.StatusOK || subscribe.attributes[AttributeRetryCount] != 1 {
+		t.Errorf("unexpected Subscribe attributes %v", subscribe.attributes)
+	}
+	if subscribe.attributes[AttributeRequestBodySize] == nil {
+		t.Error("expected the request body size")
+	}
+	if !errors.Is(lookup.err, ErrSubscriberNotFound) || lookup.attributes[AttributeHTTPStatusCode] != http.StatusNotFound {
+		t.Errorf("expected the lookup span to record the 404, got %+v", lookup)
+	}
+
+	want := []string{lookup.TraceParent(), subscribe.TraceParent(), subscribe.TraceParent()}
+	if !slices.Equal(traceParents, want) {
+		t.Errorf("expected traceparent headers %v, got %v", want, traceParents)
+	}
+}
+
+type recordingMetrics struct {
+	mu       sync.Mutex
+	requests []RequestMetric
+}
+
+func (m *recordingMetrics) ObserveRequest(request RequestMetric) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, request)
+}
+
+func TestMetrics(t *testing.T) {
+	calls := 0
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		calls++
+		if req.Body != nil {
+			io.Copy(io.Discard, req.Body)
+		}
+		if calls == 1 {
+			return newJSONResponse(http.StatusServiceUnavailable, `{"error": "down"}`), nil
+		}
+		return newJSONResponse(http.StatusOK, `{"id": 1, "subscriber_id": 7}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+	metrics := &recordingMetrics{}
+	client.(*DefaultEcloudClient).config.Metrics = metrics
+
+	if _, err := client.CreatePayment(context.Background(), 7, 5000, "clerk01"); err != nil {
+		t.Fatalf("CreatePayment() failed: %v", err)
+	}
+
+	if len(metrics.requests) != 2 {
+		t.Fatalf("expected 2 attempts, got %+v", metrics.requests)
+	}
+
+	failed, retried := metrics.requests[0], metrics.requests[1]
+	if failed.ErrorClass != ErrorClassServer || failed.StatusCode != http.StatusServiceUnavailable || failed.Retry() {
+		t.Errorf("unexpected first attempt %+v", failed)
+	}
+	if retried.ErrorClass != ErrorClassNone || !retried.Retry() || retried.Endpoint != "/api/payments" || retried.BytesSent == 0 {
+		t.Errorf("unexpected retry %+v", retried)
+	}
+
+	for _, tt := range []struct {
+		resp *http.Response
+		err  error
+		want string
+	}{
+		{nil, errors.New("connection refused"), ErrorClassNetwork},
+		{nil, context.DeadlineExceeded, ErrorClassTimeout},
+		{nil, &CircuitOpenError{}, ErrorClassCircuitOpen},
+		{&http.Response{StatusCode: http.StatusTooManyRequests}, nil, ErrorClassRateLimited},
+		{&http.Response{StatusCode: http.StatusNotFound}, nil, ErrorClassClient},
+	} {
+		if got := errorClass(context.Background(), tt.resp, tt.err); got != tt.want {
+			t.Errorf("errorClass(%v, %v) = %q, want %q", tt.resp, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestPDFAConversion(t *testing.T) {
+	ctx := context.Background()
+	pdfa := bytes.Replace(validPDFBytes, []byte("%PDF-1.7\n"), []byte("%PDF-1.7\n% <pdfaid:part>2</pdfaid:part>\n"), 1)
+
+	if IsPDFA(validPDFBytes) || !IsPDFA(pdfa) {
+		t.Fatal("expected only the document with PDF/A identification to be detected")
+	}
+
+	var uploaded []string
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if err := req.ParseMultipartForm(10 << 20); err != nil {
+			return nil, err
+		}
+		for _, field := range []string{"medical_report", "lab_report"} {
+			if files := req.MultipartForm.File[field]; len(files) == 1 {
+				file, _ := files[0].Open()
+				data, _ := io.ReadAll(file)
+				file.Close()
+				uploaded = append(uploaded, field+"="+strconv.FormatBool(IsPDFA(data)))
+			}
+		}
+		return newJSONResponse(http.StatusOK, `{}`), nil
+	})
+
+	conversions := 0
+	client.(*DefaultEcloudClient).config.PDFAConverter = PDFAConverterFunc(func(ctx context.Context, pdf []byte) ([]byte, error) {
+		conversions++
+		return pdfa, nil
+	})
+
+	original := slices.Clone(validPDFBytes)
+	record := &PatientRecord{
+		VisitID:             999,
+		SubscriberID:        101,
+		Title:               "Annual Checkup",
+		VisitTimestamp:      time.Now(),
+		MedicalReportReader: bytes.NewReader(validPDFBytes),
+		LabReport:           pdfa,
+	}
+	if err := client.SyncMedicalRecords(ctx, record); err != nil {
+		t.Fatalf("SyncMedicalRecords() failed: %v", err)
+	}
+
+	if conversions != 1 {
+		t.Errorf("expected only the non-conforming report to be converted, got %d conversions", conversions)
+	}
+	if !slices.Equal(uploaded, []string{"medical_report=true", "lab_report=true"}) {
+		t.Errorf("expected PDF/A uploads, got %v", uploaded)
+	}
+	if !bytes.Equal(validPDFBytes, original) || record.MedicalReport != nil {
+		t.Error("expected the caller's record to be left untouched")
+	}
+
+	client.(*DefaultEcloudClient).config.PDFAConverter = PDFAConverterFunc(func(ctx context.Context, pdf []byte) ([]byte, error) {
+		return nil, errors.New("gs not installed")
+	})
+	record.MedicalReportReader = nil
+	record.MedicalReport = validPDFBytes
+	if err := client.SyncMedicalRecords(ctx, record); err == nil || !strings.Contains(err.Error(), "gs not installed") {
+		t.Errorf("expected the conversion error, got %v", err)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	type upload struct {
+		headers http.Header
+		entries []JournalEntry
+	}
+
+	var uploads []upload
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/api/audit/journal" {
+			resp := newJSONResponse(http.StatusOK, `{}`)
+			resp.Header.Set("X-Request-Id", "req-1")
+			return resp, nil
+		}
+
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		data, _ := io.ReadAll(zr)
+
+		if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != req.Header.Get(JournalSHA256Header) {
+			t.Errorf("segment hash mismatch")
+		}
+
+		var entries []JournalEntry
+		for line := range strings.Lines(string(data)) {
+			var entry JournalEntry
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Errorf("invalid journal line %q: %v", line, err)
+			}
+			entries = append(entries, entry)
+		}
+		uploads = append(uploads, upload{headers: req.Header.Clone(), entries: entries})
+		return newJSONResponse(http.StatusCreated, `{}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+
+	dir := t.TempDir()
+	config := &client.(*DefaultEcloudClient).config
+	(*config).JournalDir = dir
+	(*config).JournalSegmentSize = 300 // About two entries per segment.
+
+	ctx := context.Background()
+	for range 3 {
+		client.GetBill(ctx)
+	}
+	client.GetSubscriber(ctx, 42)
+
+	if err := client.ShipJournal(ctx); err != nil {
+		t.Fatalf("ShipJournal() failed: %v", err)
+	}
+
+	var entries []JournalEntry
+	previous := ""
+	for _, upload := range uploads {
+		entries = append(entries, upload.entries...)
+		if upload.headers.Get(JournalPreviousHeader) != previous {
+			t.Errorf("expected previous chain %q, got %q", previous, upload.headers.Get(JournalPreviousHeader))
+		}
+		sum := sha256.Sum256([]byte(previous + upload.headers.Get(JournalSHA256Header)))
+		if chain := upload.headers.Get(JournalChainHeader); chain != hex.EncodeToString(sum[:]) {
+			t.Errorf("unexpected chain %q", chain)
+		}
+		previous = upload.headers.Get(JournalChainHeader)
+	}
+
+	if len(uploads) < 2 || len(entries) != 4 {
+		t.Fatalf("expected 4 entries in several segments, got %d entries in %d segments", len(entries), len(uploads))
+	}
+	if last := entries[3]; last.Path != "/api/subscriptions/42" || last.StatusCode != http.StatusOK || last.RequestID != "req-1" {
+		t.Errorf("unexpected entry %+v", last)
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 || files[0].Name() != "journal.chain" {
+		t.Errorf("expected only the chain to remain after shipping, got %v", files)
+	}
+	if chain, _ := os.ReadFile(filepath.Join(dir, "journal.chain")); string(chain) != previous {
+		t.Errorf("expected the chain to be persisted, got %q", chain)
+	}
+}
+
+// infoLogger is a Logger without the optional Warn and Log methods.
+type infoLogger struct {
+	lines []string
+}
+
+func (l *infoLogger) Debug(msg string, args ...any) {}
+func (l *infoLogger) Info(msg string, args ...any) {
+	l.lines = append(l.lines, fmt.Sprintf(msg, args...))
+}
+func (l *infoLogger) Error(msg string, args ...any) {}
+
+func TestSlogLogger(t *testing.T) {
+	client, _ := newTestClient(nil)
+	c := client.(*DefaultEcloudClient)
+	c.config.SlowCallThreshold = time.Second
+
+	var out bytes.Buffer
+	c.logger = safeLogger{NewSlogLogger(slog.New(slog.NewJSONHandler(&out, nil)))}
+	c.checkSlowCall("/api/billing/get_bill", RequestTiming{Method: "GET", Total: 1500 * time.Millisecond})
+	c.reportWarnings("GetBill", []Warning{{Message: "billing is read-only"}})
+
+	var records []map[string]any
+	for line := range strings.Lines(out.String()) {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid slog record %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d: %s", len(records), out.String())
+	}
+
+	slow := records[0]
+	if slow["level"] != "WARN" || slow["msg"] != "slow call" || slow["method"] != "GET" {
+		t.Errorf("unexpected slow call record: %v", slow)
+	}
+
+	warning := records[1]
+	if warning["level"] != "WARN" || warning["msg"] != "GetBill: server warning: billing is read-only" {
+		t.Errorf("unexpected server warning record: %v", warning)
+	}
+
+	// Loggers with only Debug, Info and Error keep receiving warnings through Info.
+	legacy := &infoLogger{}
+	c.logger = safeLogger{legacy}
+	c.checkSlowCall("/api/billing/get_bill", RequestTiming{Method: "GET", Total: 1500 * time.Millisecond})
+	if len(legacy.lines) != 1 || !strings.HasPrefix(legacy.lines[0], "warning: slow call method=GET") {
+		t.Errorf("unexpected legacy logs: %q", legacy.lines)
+	}
+}
+
+func TestDebugDumpRedaction(t *testing.T) {
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		resp := newJSONResponse(http.StatusOK, `{"id": 7, "patient_id": 1, "patient_name": "Jane Doe",`+
+			`"email": "jane@example.com", "notes": [{"text": "call jane@example.com"}]}`)
+		resp.Header.Set("Content-Type", "application/json")
+		return resp, nil
+	})
+
+	var logs bytes.Buffer
+	c := client.(*DefaultEcloudClient)
+	c.config.Debug = true
+	c.logger = NewLogger(&logs)
+	c.jwtToken = "secret-token"
+
+	subscriber, err := client.Subscribe(context.Background(), &SubscribeRequest{
+		PatientID: 1, PatientName: "Jane Doe", Email: "jane@example.com", RegisteredBy: "Dr. Okello",
+	})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if subscriber.PatientName != "Jane Doe" || subscriber.ID != 7 {
+		t.Errorf("response body was not preserved: %+v", subscriber)
+	}
+
+	dump := logs.String()
+	for _, leaked := range []string{"Jane Doe", "jane@example.com", "secret-token", "Dr. Okello"} {
+		if strings.Contains(dump, leaked) {
+			t.Errorf("debug dump leaks %q:\n%s", leaked, dump)
+		}
+	}
+	for _, expected := range []string{"POST http://testhost/api/subscriptions", "Authorization: [REDACTED]", `"patient_id":1`, "200 OK"} {
+		if !strings.Contains(dump, expected) {
+			t.Errorf("debug dump is missing %q:\n%s", expected, dump)
+		}
+	}
+
+	redacted, err := RedactJSON([]byte(`{"password": "hunter2", "nested": [{"Email": "a@b.co"}], "note": "mail a@b.co"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(redacted) != `{"nested":[{"Email":"[REDACTED]"}],"note":"mail [REDACTED]","password":"[REDACTED]"}` {
+		t.Errorf("unexpected RedactJSON result: %s", redacted)
+	}
+}
+
+func TestReadRouting(t *testing.T) {
+	var mu sync.Mutex
+	var urls []string
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		urls = append(urls, req.Method+" "+req.URL.String())
+		mu.Unlock()
+		return newJSONResponse(http.StatusOK, `{"id": 1}`), nil
+	})
+
+	c := client.(*DefaultEcloudClient)
+	c.config.ReadBaseUrl = "http://replica/"
+	c.config.ReadRoutes = map[string]bool{
+		"/api/subscriptions":                    true,
+		"/api/subscriptions/check_subscription": false,
+	}
+
+	ctx := context.Background()
+	client.GetSubscriber(ctx, 1)
+	client.GetPatientSubscription(ctx, 2)
+	client.Subscribe(ctx, &SubscribeRequest{PatientID: 2})
+	client.GetBill(ctx)
+
+	expected := []string{
+		"GET http://replica/api/subscriptions/1",
+		"GET http://testhost/api/subscriptions/check_subscription/HOS-123/2",
+		"POST http://testhost/api/subscriptions",
+		"GET http://testhost/api/billing/get_bill",
+	}
+	if !slices.Equal(urls, expected) {
+		t.Errorf("expected requests %q, got %q", expected, urls)
+	}
+
+	if got := c.routeRead(http.MethodGet, "http://elsewhere/api/subscriptions/1"); got != "http://elsewhere/api/subscriptions/1" {
+		t.Errorf("URLs outside ApiBaseUrl must not be routed, got %s", got)
+	}
+}
+
+func TestRecordDownloads(t *testing.T) {
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/api/records":
+			if req.URL.Query().Get("subscriber_id") != "5" {
+				t.Errorf("unexpected query %s", req.URL.RawQuery)
+			}
+			return newJSONResponse(http.StatusOK, `{"data": [{"id": 9, "title": "CBC"}], "total": 1}`), nil
+		case "/api/records/9":
+			return newJSONResponse(http.StatusOK, `{"id": 9, "subscriber_id": 5, "title": "CBC"}`), nil
+		case "/api/records/9/reports/lab":
+			if accept := req.Header.Get("Accept"); accept != "application/pdf" {
+				t.Errorf("expected Accept application/pdf, got %s", accept)
+			}
+			return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header),
+				Body: io.NopCloser(bytes.NewReader(validPDFBytes))}, nil
+		case "/api/records/9/reports/medical":
+			return &http.Response{StatusCode: http.StatusOK, Header: make(http.Header),
+				Body: io.NopCloser(strings.NewReader("<html>login</html>"))}, nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error": "record not found"}`), nil
+	})
+	ctx := context.Background()
+
+	page, err := client.ListPatientRecords(ctx, 5, nil)
+	if err != nil || len(page.Records) != 1 || page.Records[0].ID != 9 || page.HasMore() {
+		t.Fatalf("unexpected page %+v, err %v", page, err)
+	}
+
+	record, err := client.GetRecord(ctx, 9)
+	if err != nil || record.SubscriberID != 5 {
+		t.Fatalf("unexpected record %+v, err %v", record, err)
+	}
+
+	if _, err := client.GetRecord(ctx, 10); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound, got %v", err)
+	}
+
+	var pdf bytes.Buffer
+	n, err := client.DownloadReport(ctx, 9, ReportLab, &pdf)
+	if err != nil || n != int64(len(validPDFBytes)) || !bytes.Equal(pdf.Bytes(), validPDFBytes) {
+		t.Errorf("unexpected download of %d bytes, err %v", n, err)
+	}
+
+	var other bytes.Buffer
+	if _, err := client.DownloadReport(ctx, 9, ReportMedical, &other); err == nil || other.Len() != 0 {
+		t.Errorf("expected non-PDF download to fail without writing, got %v and %d bytes", err, other.Len())
+	}
+
+	if _, err := client.DownloadReport(ctx, 9, "xray", &other); err == nil {
+		t.Error("expected invalid report kind to fail")
+	}
+}
+
+func TestStrictAmounts(t *testing.T) {
+	tenth, fifth := 0.1, 0.2 // Not constants, so the sum is computed in float64.
+	tests := map[float64]bool{
+		5000:          true,
+		4999.99:       true,
+		0.5:           true,
+		4999.999999:   false,
+		tenth + fifth: false,
+		math.NaN():    false,
+		math.Inf(1):   false,
+		1e14 + 0.25:   false,
+		90071992.547:  false,
+	}
+	for amount, valid := range tests {
+		err := ValidateAmount(amount)
+		if valid && err != nil {
+			t.Errorf("ValidateAmount(%v): unexpected error %v", amount, err)
+		}
+		if !valid && !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("ValidateAmount(%v): expected ErrInvalidAmount, got %v", amount, err)
+		}
+	}
+
+	var requests atomic.Int32
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		return newJSONResponse(http.StatusOK, `{"id": 1, "subscriber_id": 1, "amount": 4999.999999}`), nil
+	})
+	ctx := context.Background()
+
+	// Without strict mode amounts are sent as they are.
+	if _, err := client.CreatePayment(ctx, 1, 4999.999999, "admin"); err != nil {
+		t.Fatalf("CreatePayment failed: %v", err)
+	}
+
+	client.(*DefaultEcloudClient).config.StrictAmounts = true
+	if _, err := client.CreatePayment(ctx, 1, 4999.999999, "admin"); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("expected ErrInvalidAmount, got %v", err)
+	}
+	if _, err := client.RefundPayment(ctx, 1, tenth+fifth, "typo"); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("expected ErrInvalidAmount, got %v", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("expected invalid amounts not to be sent, got %d requests", requests.Load())
+	}
+}
+
+func TestSyncMedicalRecordsBatch(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			peak := maxInFlight.Load()
+			if n <= peak || maxInFlight.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+
+		io.Copy(io.Discard, req.Body)
+		time.Sleep(10 * time.Millisecond)
+		return newJSONResponse(http.StatusOK, `{"status": "ok"}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+
+	var records []*PatientRecord
+	for i := range 6 {
+		records = append(records, &PatientRecord{
+			VisitID:        uint(i + 1),
+			SubscriberID:   101,
+			Title:          "Checkup",
+			VisitTimestamp: time.Now(),
+			LabReport:      validPDFBytes,
+		})
+	}
+	records[3].Title = "" // Fails validation.
+
+	var results []BatchResult
+	report, err := client.SyncMedicalRecordsBatch(context.Background(), records, BatchOptions{
+		Concurrency: 2,
+		OnResult:    func(result BatchResult) { results = append(results, result) },
+	})
+	if err == nil {
+		t.Error("expected an error for the failed record")
+	}
+
+	if report.Succeeded != 5 || report.Failed != 1 || len(results) != 6 {
+		t.Fatalf("unexpected report %+v with %d results", report, len(results))
+	}
+
+	failures := report.Failures()
+	if len(failures) != 1 || failures[0].Record != records[3] || !strings.Contains(failures[0].Err.Error(), "visit 4") {
+		t.Errorf("unexpected failures %+v", failures)
+	}
+
+	if peak := maxInFlight.Load(); peak > 2 {
+		t.Errorf("expected at most 2 concurrent uploads, got %d", peak)
+	}
+
+	// A cancelled context fails the records without uploading them.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, _ = client.SyncMedicalRecordsBatch(ctx, records[:2], BatchOptions{})
+	if report.Failed != 2 || !errors.Is(report.Results[0].Err, context.Canceled) {
+		t.Errorf("expected cancelled records to fail, got %+v", report)
+	}
+}
+
+func TestUploadQueue(t *testing.T) {
+	var offline, reject atomic.Bool
+	var uploads atomic.Int32
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		io.Copy(io.Discard, req.Body)
+		if offline.Load() {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("network is unreachable")}
+		}
+		if reject.Load() {
+			return newJSONResponse(http.StatusUnprocessableEntity, `{"error": "unknown subscriber"}`), nil
+		}
+		uploads.Add(1)
+		return newJSONResponse(http.StatusOK, `{"status": "ok"}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+
+	queue, err := NewUploadQueue(client, UploadQueueConfig{Dir: t.TempDir(), PollInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRecord := func(visitID uint) *PatientRecord {
+		return &PatientRecord{
+			VisitID:         visitID,
+			SubscriberID:    101,
+			Title:           "Checkup",
+			VisitTimestamp:  time.Now(),
+			LabReportReader: bytes.NewReader(validPDFBytes),
+		}
+	}
+	ctx := context.Background()
+
+	offline.Store(true)
+	queued, err := queue.Sync(ctx, newRecord(1))
+	if err != nil || !queued {
+		t.Fatalf("expected the record to be queued, got %t, %v", queued, err)
+	}
+
+	invalid := newRecord(2)
+	invalid.Title = ""
+	if queued, err := queue.Sync(ctx, invalid); err == nil || queued {
+		t.Errorf("expected invalid records to fail without being queued, got %t, %v", queued, err)
+	}
+
+	status, _ := queue.Status(ctx)
+	if status.Pending != 1 || status.LastError == "" || status.Oldest.IsZero() || status.NextAttempt.IsZero() {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	if n, err := queue.Flush(ctx); n != 0 || err == nil {
+		t.Errorf("expected Flush to fail while offline, got %d, %v", n, err)
+	}
+
+	// The queue is persisted and its reports were read from the reader.
+	offline.Store(false)
+	restarted, _ := NewUploadQueue(client, UploadQueueConfig{Dir: queue.store.(*FileQueueStore).dir})
+	if n, err := restarted.Flush(ctx); n != 1 || err != nil {
+		t.Fatalf("expected Flush to upload the record, got %d, %v", n, err)
+	}
+
+	// Rejected records are kept aside instead of being retried.
+	reject.Store(true)
+	item, err := queue.Enqueue(ctx, newRecord(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Flush(ctx)
+	if status, _ := queue.Status(ctx); status.Failed != 1 || status.Pending != 0 {
+		t.Errorf("expected a failed record, got %+v", status)
+	}
+	queue.Remove(ctx, item.ID)
+	reject.Store(false)
+
+	// A successful upload retries the queue at once.
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go queue.Run(runCtx)
+
+	offline.Store(true)
+	queue.Sync(ctx, newRecord(4))
+	offline.Store(false)
+	uploads.Store(0)
+	if queued, err := queue.Sync(ctx, newRecord(5)); queued || err != nil {
+		t.Fatalf("expected the record to be uploaded, got %t, %v", queued, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		status, _ := queue.Status(ctx)
+		if status.Pending == 0 && status.Failed == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the queue to drain, got %+v", status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if uploads.Load() != 2 {
+		t.Errorf("expected 2 uploads, got %d", uploads.Load())
+	}
+}
+
+func TestUploadQueueSpill(t *testing.T) {
+	var offline atomic.Bool
+	var bodies [][]byte
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		if offline.Load() {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("network is unreachable")}
+		}
+		bodies = append(bodies, body)
+		return newJSONResponse(http.StatusOK, `{"status": "ok"}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+
+	spillDir := t.TempDir()
+	config := UploadQueueConfig{
+		Dir:          t.TempDir(),
+		SpillDir:     spillDir,
+		MaxSpillSize: int64(2 * len(validPDFBytes)),
+		PollInterval: time.Hour,
+	}
+	queue, err := NewUploadQueue(client, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newRecord := func(visitID uint, report []byte) *PatientRecord {
+		return &PatientRecord{
+			VisitID:         visitID,
+			SubscriberID:    101,
+			Title:           "Checkup",
+			VisitTimestamp:  time.Now(),
+			LabReportReader: bytes.NewReader(report),
+		}
+	}
+	spilled := func() int {
+		entries, _ := os.ReadDir(spillDir)
+		return len(entries)
+	}
+	ctx := context.Background()
+
+	// Both records share their report, which is stored once.
+	offline.Store(true)
+	for _, visitID := range []uint{1, 2} {
+		if queued, err := queue.Sync(ctx, newRecord(visitID, validPDFBytes)); !queued || err != nil {
+			t.Fatalf("expected the record to be queued, got %t, %v", queued, err)
+		}
+	}
+	if n := spilled(); n != 1 {
+		t.Errorf("expected 1 spilled file, got %d", n)
+	}
+
+	items, _ := queue.store.List(ctx)
+	for _, item := range items {
+		if item.Record.LabReport != nil || item.Spilled == nil || item.Spilled.LabReport == "" {
+			t.Errorf("expected the report of visit %d to be spilled, got %+v", item.Record.VisitID, item)
+		}
+	}
+
+	// Random bytes don't compress.
+	large := make([]byte, 2*len(validPDFBytes))
+	rand.Read(large)
+	if _, err := queue.Enqueue(ctx, newRecord(3, large)); !errors.Is(err, ErrSpillFull) {
+		t.Errorf("expected ErrSpillFull, got %v", err)
+	}
+	if n := spilled(); n != 1 {
+		t.Errorf("expected the rejected file to be removed, got %d spilled files", n)
+	}
+
+	// Files no queued record references are removed on restart, the others
+	// once the last record using them is uploaded.
+	// Other files are left alone.
+	orphan := []byte("left by a crash")
+	os.WriteFile(filepath.Join(spillDir, sha256Hex(orphan)), orphan, 0o600)
+	os.WriteFile(filepath.Join(spillDir, ".spill-123"), orphan, 0o600)
+	os.WriteFile(filepath.Join(spillDir, "notes.txt"), []byte("not spilled"), 0o600)
+	offline.Store(false)
+	restarted, _ := NewUploadQueue(client, config)
+	if n, err := restarted.Flush(ctx); n != 2 || err != nil {
+		t.Fatalf("expected Flush to upload 2 records, got %d, %v", n, err)
+	}
+	for _, body := range bodies {
+		if !bytes.Contains(body, validPDFBytes) {
+			t.Error("expected the spilled report to be uploaded")
+		}
+	}
+	if n := spilled(); n != 1 {
+		t.Errorf("expected only notes.txt left in the spill directory, got %d files", n)
+	}
+	if _, err := os.Stat(filepath.Join(spillDir, "notes.txt")); err != nil {
+		t.Errorf("expected the unrelated file to be kept, got %v", err)
+	}
+
+	// The queued records would be taken for orphans.
+	config.SpillDir = config.Dir
+	if _, err := NewUploadQueue(client, config); err == nil {
+		t.Error("expected a SpillDir equal to Dir to be rejected")
+	}
+}
+
+func TestQueueCompression(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := NewFileQueueStore(dir)
+
+	// Uncompressed records, e.g queued by an older SDK, are compressed by the
+	// queue, not by List, which may run concurrently with uploads.
+	record, _ := json.Marshal(&PatientRecord{VisitID: 1, SubscriberID: 101, Title: "Checkup",
+		LabReport: validPDFBytes})
+	legacy := fmt.Sprintf(`{"id": "legacy", "record": %s, "enqueued_at": "2024-01-01T00:00:00Z",
+		"failed": true, "version": 2}`, record)
+	os.WriteFile(filepath.Join(dir, "legacy.json"), []byte(legacy), 0o600)
+
+	items, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || !bytes.Equal(items[0].Record.LabReport, validPDFBytes) {
+		t.Fatalf("expected the legacy record, got %+v", items)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "legacy.json")); string(data) != legacy {
+		t.Errorf("expected List not to rewrite the legacy record, got %q", data)
+	}
+
+	queue, err := NewUploadQueue(&fakeRecordsService{}, UploadQueueConfig{Store: store, PollInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.process(ctx, false, false); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "legacy.json"))
+	if !bytes.HasPrefix(data, []byte(queueFileMagic+"gzip ")) {
+		t.Errorf("expected the legacy record to be compressed, got %q", data)
+	}
+
+	// A record that doesn't match its checksum is set aside.
+	corrupt := func(path string) {
+		data, _ := os.ReadFile(path)
+		header, err := readQueueFileHeader(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil || header == nil {
+			t.Fatalf("expected a header in %s, got %v", path, err)
+		}
+
+		corrupted := *header
+		corrupted.sha256 = strings.Repeat("0", 64)
+		os.WriteFile(path, bytes.Replace(data, []byte(header.String()), []byte(corrupted.String()), 1), 0o600)
+	}
+	corrupt(filepath.Join(dir, "legacy.json"))
+	if items, err := store.List(ctx); len(items) != 0 || err != nil {
+		t.Errorf("expected the corrupted record to be skipped, got %v, %v", items, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "legacy.json.corrupt")); err != nil {
+		t.Errorf("expected the corrupted record to be kept aside: %v", err)
+	}
+
+	// Other encodings can be plugged in.
+	store.Compression = &QueueCompression{
+		Encoding:  "deflate",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.BestSpeed) },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil },
+	}
+	item := &QueuedRecord{ID: "deflated", Record: &PatientRecord{VisitID: 2, LabReport: validPDFBytes}}
+	if err := store.Put(ctx, item); err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := store.List(ctx); len(items) != 1 || !bytes.Equal(items[0].Record.LabReport, validPDFBytes) {
+		t.Errorf("expected the deflated record, got %+v", items)
+	}
+
+	store.Compression = GzipQueueCompression(42)
+	if err := store.Put(ctx, item); err == nil {
+		t.Error("expected an invalid gzip level to fail")
+	}
+
+	// Spilled reports are compressed and checked too.
+	var attempts atomic.Int32
+	var offline atomic.Bool
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		if offline.Load() {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("network is unreachable")}
+		}
+		// The retry reads the report again.
+		if attempts.Add(1) == 1 {
+			return newJSONResponse(http.StatusBadGateway, `{"error": "bad gateway"}`), nil
+		}
+		if !bytes.Contains(body, validPDFBytes) {
+			t.Error("expected the spilled report to be uploaded")
+		}
+		return newJSONResponse(http.StatusOK, `{"status": "ok"}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+
+	spillDir := t.TempDir()
+	queue, _ = NewUploadQueue(client, UploadQueueConfig{Dir: t.TempDir(), SpillDir: spillDir,
+		Compression: GzipQueueCompression(gzip.BestSpeed)})
+	newRecord := func(visitID uint) *PatientRecord {
+		return &PatientRecord{VisitID: visitID, SubscriberID: 101, Title: "Checkup",
+			VisitTimestamp: time.Now(), LabReport: validPDFBytes}
+	}
+
+	offline.Store(true)
+	queue.Sync(ctx, newRecord(3))
+	offline.Store(false)
+
+	spilled := filepath.Join(spillDir, sha256Hex(validPDFBytes))
+	if data, _ := os.ReadFile(spilled); !bytes.HasPrefix(data, []byte(queueFileMagic+"gzip ")) {
+		t.Errorf("expected the spilled report to be compressed, got %q", data)
+	}
+	if n, err := queue.Flush(ctx); n != 1 || err != nil || attempts.Load() != 2 {
+		t.Fatalf("expected the record uploaded on the second attempt, got %d, %v after %d attempts",
+			n, err, attempts.Load())
+	}
+
+	offline.Store(true)
+	queue.Sync(ctx, newRecord(4))
+	offline.Store(false)
+
+	corrupt(spilled)
+	queue.Flush(ctx)
+	status, _ := queue.Status(ctx)
+	if status.Failed != 1 || !strings.Contains(status.LastError, ErrQueueCorrupted.Error()) {
+		t.Errorf("expected the record with a corrupted report to fail, got %+v", status)
+	}
+}
+
+func TestQueueMigrations(t *testing.T) {
+	// Version 2 renamed "tries" to "attempts".
+	defer func(migrations []func(map[string]json.RawMessage) error) { queueMigrations = migrations }(queueMigrations)
+	queueMigrations = []func(map[string]json.RawMessage) error{
+		func(fields map[string]json.RawMessage) error {
+			fields["attempts"] = fields["tries"]
+			delete(fields, "tries")
+			return nil
+		},
+	}
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := NewFileQueueStore(dir)
+
+	record, _ := json.Marshal(&PatientRecord{VisitID: 1, SubscriberID: 101, Title: "Checkup",
+		LabReport: validPDFBytes})
+	old := fmt.Sprintf(`{"id": "old", "record": %s, "enqueued_at": "2024-01-01T00:00:00Z", "tries": 3}`, record)
+	newer := fmt.Sprintf(`{"id": "newer", "record": %s, "enqueued_at": "2024-01-02T00:00:00Z", "version": 9}`, record)
+	os.WriteFile(filepath.Join(dir, "old.json"), []byte(old), 0o600)
+	os.WriteFile(filepath.Join(dir, "newer.json"), []byte(newer), 0o600)
+
+	items, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].ID != "old" || items[0].Attempts != 3 || items[0].Version != 2 ||
+		!bytes.Equal(items[0].Record.LabReport, validPDFBytes) {
+		t.Fatalf("expected the old record to be migrated, got %+v", items)
+	}
+
+	// The migrated record is rewritten, the newer one kept as it was.
+	if err := store.migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	data, _, _ := store.read("old")
+	if !strings.Contains(string(data), `"version":2`) || strings.Contains(string(data), `"tries"`) {
+		t.Errorf("expected the old record to be rewritten, got %s", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "newer.json")); string(data) != newer {
+		t.Errorf("expected the newer record to be kept, got %s", data)
+	}
+
+	var item QueuedRecord
+	if err := json.Unmarshal([]byte(newer), &item); !errors.Is(err, ErrQueueVersionUnsupported) {
+		t.Errorf("expected ErrQueueVersionUnsupported, got %v", err)
+	}
+}
+
+func TestExistenceChecks(t *testing.T) {
+	var methods []string
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		methods = append(methods, req.Method+" "+req.URL.Path)
+		switch req.URL.Path {
+		case "/api/subscriptions/1":
+			return newJSONResponse(http.StatusOK, ``), nil
+		case "/api/subscriptions/2":
+			return newJSONResponse(http.StatusNotFound, ``), nil
+		case "/api/subscriptions/3":
+			return newJSONResponse(http.StatusForbidden, `{"error": "forbidden"}`), nil
+		case "/api/records/visits/HOS-123/7", "/api/records/visits/HOS-123/8":
+			if req.Method == http.MethodHead {
+				return newJSONResponse(http.StatusMethodNotAllowed, ``), nil
+			}
+			if strings.HasSuffix(req.URL.Path, "/7") {
+				return newJSONResponse(http.StatusOK, `[{"record_id": 9}]`), nil
+			}
+			return newJSONResponse(http.StatusOK, `[]`), nil
+		}
+		return newJSONResponse(http.StatusNotFound, ``), nil
+	})
+	ctx := context.Background()
+
+	if exists, err := client.SubscriberExists(ctx, 1); !exists || err != nil {
+		t.Errorf("expected subscriber 1 to exist, got %t, %v", exists, err)
+	}
+	if exists, err := client.SubscriberExists(ctx, 2); exists || err != nil {
+		t.Errorf("expected subscriber 2 not to exist, got %t, %v", exists, err)
+	}
+	if _, err := client.SubscriberExists(ctx, 3); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected ErrForbidden, got %v", err)
+	}
+	if methods[0] != "HEAD /api/subscriptions/1" {
+		t.Errorf("expected a HEAD request, got %s", methods[0])
+	}
+
+	// Deployments without HEAD support fall back to GET.
+	if exists, err := client.RecordExists(ctx, 7); !exists || err != nil {
+		t.Errorf("expected visit 7 to have records, got %t, %v", exists, err)
+	}
+	if exists, err := client.RecordExists(ctx, 8); exists || err != nil {
+		t.Errorf("expected visit 8 to have no records, got %t, %v", exists, err)
+	}
+}
+
+func TestGzipDecodeRetry(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(`{"Amount": 5000, "Currency": "UGX"}`))
+	zw.Close()
+	truncated := compressed.Bytes()[:compressed.Len()-6]
+
+	var encodings []string
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		encodings = append(encodings, req.Header.Get("Accept-Encoding"))
+		if req.Header.Get("Accept-Encoding") == "identity" {
+			return newJSONResponse(http.StatusOK, `{"Amount": 5000}`), nil
+		}
+		resp := newJSONResponse(http.StatusOK, "")
+		resp.Header.Set("Content-Encoding", "gzip")
+		resp.Body = io.NopCloser(bytes.NewReader(truncated))
+		return resp, nil
+	})
+
+	var logs bytes.Buffer
+	client.(*DefaultEcloudClient).logger = NewLogger(&logs)
+
+	bill, err := client.GetBill(context.Background())
+	if err != nil {
+		t.Fatalf("GetBill failed: %v", err)
+	}
+	if bill.Amount != 5000 {
+		t.Errorf("unexpected bill %+v", bill)
+	}
+
+	if len(encodings) != 2 || encodings[1] != "identity" {
+		t.Errorf("expected one uncompressed re-request, got Accept-Encoding %q", encodings)
+	}
+	if !strings.Contains(logs.String(), "[WARN]: undecodable gzip response to GET /api/billing/get_bill") {
+		t.Errorf("expected the incident to be logged, got %q", logs.String())
+	}
+}
+
+func TestUploadLargeReport(t *testing.T) {
+	largePDF := slices.Concat([]byte("%PDF-1.7\n"), bytes.Repeat([]byte("%"), 200), validPDFBytes[9:])
+	largeSum := sha256.Sum256(largePDF)
+
+	var (
+		received   []byte
+		failAt     = int64(-1)
+		chunks     int
+		singleShot int
+		created    map[string]any
+	)
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch {
+		case req.URL.Path == "/api/capabilities":
+			return newJSONResponse(http.StatusOK, `{"chunked_uploads": true, "max_chunk_size": 64}`), nil
+		case req.URL.Path == "/api/records":
+			singleShot++
+			io.Copy(io.Discard, req.Body)
+			return newJSONResponse(http.StatusOK, `{"id": 1}`), nil
+		case req.Method == http.MethodPost && req.URL.Path == "/api/uploads":
+			json.NewDecoder(req.Body).Decode(&created)
+			received = nil
+			return newJSONResponse(http.StatusCreated, `{"id": "up-1"}`), nil
+		case req.Method == http.MethodGet && req.URL.Path == "/api/uploads/up-1":
+			return newJSONResponse(http.StatusOK, fmt.Sprintf(`{"files": [{"field": "lab_report", "sha256": "%x", "offset": %d}]}`,
+				largeSum, len(received))), nil
+		case req.Method == http.MethodPut && req.URL.Path == "/api/uploads/up-1/files/lab_report":
+			chunk, _ := io.ReadAll(req.Body)
+			var start, end, total int64
+			fmt.Sscanf(req.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+			if start == failAt {
+				failAt = -1
+				return newJSONResponse(http.StatusServiceUnavailable, `{"error": "unavailable"}`), nil
+			}
+			if sum := sha256.Sum256(chunk); req.Header.Get(ChunkSHA256Header) != hex.EncodeToString(sum[:]) {
+				return newJSONResponse(http.StatusUnprocessableEntity, `{"error": "checksum mismatch"}`), nil
+			}
+			if start != int64(len(received)) || end-start+1 != int64(len(chunk)) || total != int64(len(largePDF)) {
+				return newJSONResponse(http.StatusConflict, fmt.Sprintf(`{"offset": %d}`, len(received))), nil
+			}
+			chunks++
+			received = append(received, chunk...)
+			return newJSONResponse(http.StatusOK, fmt.Sprintf(`{"offset": %d}`, len(received))), nil
+		case req.Method == http.MethodPost && req.URL.Path == "/api/uploads/up-1/complete":
+			if !bytes.Equal(received, largePDF) {
+				return newJSONResponse(http.StatusUnprocessableEntity, `{"error": "incomplete"}`), nil
+			}
+			return newJSONResponse(http.StatusOK, `{"id": 88}`), nil
+		}
+		return newJSONResponse(http.StatusNotFound, ``), nil
+	})
+	c := client.(*DefaultEcloudClient)
+	c.jwtToken = "test-token"
+	c.retryPolicy = &DefaultRetryPolicy{maxRetries: 0}
+	ctx := context.Background()
+
+	newRecord := func() *PatientRecord {
+		return &PatientRecord{VisitID: 5, SubscriberID: 101, Title: "Scan", VisitTimestamp: time.Now()}
+	}
+
+	t.Run("SmallRecord", func(t *testing.T) {
+		record := newRecord()
+		record.LabReport = validPDFBytes
+		if err := client.UploadLargeReport(ctx, record, nil); err != nil {
+			t.Fatalf("UploadLargeReport failed: %v", err)
+		}
+		if singleShot != 1 || chunks != 0 {
+			t.Errorf("expected a single-shot upload, got %d uploads and %d chunks", singleShot, chunks)
+		}
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		record := newRecord()
+		record.LabReport = largePDF
+		opts := &ChunkedUploadOptions{ChunkSize: 100, Threshold: -1}
+
+		failAt = 128
+		err := client.UploadLargeReport(ctx, record, opts)
+		var aborted *UploadAbortedError
+		if !errors.As(err, &aborted) || aborted.UploadID != "up-1" {
+			t.Fatalf("expected UploadAbortedError for up-1, got %v", err)
+		}
+		if chunks != 2 || created["visit_id"] != "5" || created["files"] == nil {
+			t.Fatalf("expected 2 chunks of the max size after starting the upload, got %d, %v", chunks, created)
+		}
+
+		// Resume from a stream that can't be read at an offset.
+		record.LabReport = nil
+		record.LabReportReader = struct{ io.Reader }{bytes.NewReader(largePDF)}
+		opts.UploadID = aborted.UploadID
+		if err := client.UploadLargeReport(ctx, record, opts); err != nil {
+			t.Fatalf("resumed UploadLargeReport failed: %v", err)
+		}
+
+		wantChunks := (len(largePDF) + 63) / 64
+		if chunks != wantChunks {
+			t.Errorf("expected %d chunks in total, got %d", wantChunks, chunks)
+		}
+	})
+
+	t.Run("MismatchedResume", func(t *testing.T) {
+		record := newRecord()
+		record.LabReport = validPDFBytes
+		err := client.UploadLargeReport(ctx, record, &ChunkedUploadOptions{UploadID: "up-1"})
+		if err == nil || !strings.Contains(err.Error(), "not an upload of this record") {
+			t.Errorf("expected a mismatched upload error, got %v", err)
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		unsupported, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/api/capabilities" {
+				return newJSONResponse(http.StatusNotFound, ``), nil
+			}
+			io.Copy(io.Discard, req.Body)
+			return newJSONResponse(http.StatusOK, `{"id": 1}`), nil
+		})
+		unsupported.(*DefaultEcloudClient).jwtToken = "test-token"
+
+		record := newRecord()
+		record.LabReport = largePDF
+		if err := unsupported.UploadLargeReport(ctx, record, &ChunkedUploadOptions{Threshold: -1}); err != nil {
+			t.Errorf("expected a single-shot upload, got %v", err)
+		}
+	})
+}
+
+func TestUploadChecksums(t *testing.T) {
+	want := sha256Hex(validPDFBytes)
+	var (
+		header, field string
+		stored        = want
+	)
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		header = req.Header.Get(ReportSHA256Header)
+		if err := req.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("ParseMultipartForm failed: %v", err)
+		}
+		field = req.FormValue("lab_report_sha256")
+		return newJSONResponse(http.StatusOK, fmt.Sprintf(`{"id": 3, "checksums": {"lab_report": %q}}`, stored)), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+	ctx := context.Background()
+
+	record := &PatientRecord{VisitID: 1, SubscriberID: 101, Title: "Checkup", VisitTimestamp: time.Now(),
+		LabReport: validPDFBytes}
+	if err := client.SyncMedicalRecords(ctx, record); err != nil {
+		t.Fatalf("SyncMedicalRecords failed: %v", err)
+	}
+	if header != "lab_report="+want || field != want {
+		t.Errorf("expected checksum %s in header and form, got %q and %q", want, header, field)
+	}
+
+	// Streamed reports are only checksummed in the form.
+	record.LabReport = nil
+	record.LabReportReader = bytes.NewReader(validPDFBytes)
+	stored = strings.Repeat("0", 64)
+	err := client.SyncMedicalRecords(ctx, record)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if header != "" || field != want {
+		t.Errorf("expected checksum %s in the form only, got %q and %q", want, header, field)
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTokenStore()
+	token := newTestJWT(time.Now().Add(time.Hour))
+	store.Set(ctx, "http://testhost|test-id", &StoredToken{Token: "revoked", User: User{EclinicID: "test-id"}})
+
+	var paths []string
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.URL.Path)
+		if req.URL.Path == "/api/auth/introspect" {
+			if req.Header.Get("Authorization") == "Bearer revoked" {
+				return newJSONResponse(http.StatusUnauthorized, `{"error": "token revoked"}`), nil
+			}
+			return newJSONResponse(http.StatusOK, `{"active": true, "eclinic_id": "test-id"}`), nil
+		}
+		return newJSONResponse(http.StatusOK, `{"token": "`+token+`", "user": {"eclinic_id": "test-id"}}`), nil
+	})
+	client.(*DefaultEcloudClient).config.TokenStore = store
+
+	if _, err := client.ValidateToken(ctx); !errors.Is(err, ErrNotAuthenticated) {
+		t.Errorf("expected ErrNotAuthenticated without a token, got %v", err)
+	}
+
+	// A revoked stored token is replaced at login, without a refresh attempt.
+	if _, err := client.Login(ctx); err != nil {
+		t.Fatalf("Login() failed: %v", err)
+	}
+	if !slices.Equal(paths, []string{"/api/auth/introspect", "/api/auth/login"}) {
+		t.Errorf("expected introspection then login, got %v", paths)
+	}
+	if client.GetToken() != token {
+		t.Errorf("expected a new token, got %q", client.GetToken())
+	}
+
+	info, err := client.ValidateToken(ctx)
+	if err != nil || !info.Active || info.EclinicID != "test-id" {
+		t.Errorf("expected an active token for test-id, got %+v, %v", info, err)
+	}
+}
+
+func TestReportEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	largePDF := slices.Concat([]byte("%PDF-1.7\n"), bytes.Repeat([]byte("%"), 150_000), validPDFBytes[9:])
+
+	var stored []byte
+	var encryption, contentType string
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.Method == http.MethodGet {
+			resp := newJSONResponse(http.StatusOK, "")
+			resp.Body = io.NopCloser(bytes.NewReader(stored))
+			return resp, nil
+		}
+
+		if err := req.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("ParseMultipartForm failed: %v", err)
+		}
+		encryption = req.FormValue("report_encryption")
+		file, header, _ := req.FormFile("lab_report")
+		contentType = header.Header.Get("Content-Type")
+		stored, _ = io.ReadAll(file)
+		return newJSONResponse(http.StatusOK, `{"id": 4}`), nil
+	})
+	c := client.(*DefaultEcloudClient)
+	c.jwtToken = "test-token"
+	c.config.ReportEncryptionKey = key
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name   string
+		record *PatientRecord
+	}{
+		{"Bytes", &PatientRecord{LabReport: validPDFBytes}},
+		{"Stream", &PatientRecord{LabReportReader: struct{ io.Reader }{bytes.NewReader(largePDF)}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want := tc.record.LabReport
+			if want == nil {
+				want = largePDF
+			}
+			tc.record.VisitID, tc.record.SubscriberID, tc.record.Title = 1, 101, "Checkup"
+			tc.record.VisitTimestamp = time.Now()
+
+			if err := client.SyncMedicalRecords(ctx, tc.record); err != nil {
+				t.Fatalf("SyncMedicalRecords failed: %v", err)
+			}
+			if encryption != ReportEncryptionScheme || contentType != "application/octet-stream" {
+				t.Errorf("expected an encrypted upload, got %q, %q", encryption, contentType)
+			}
+			if bytes.Contains(stored, []byte("%PDF")) {
+				t.Fatal("expected the uploaded report to be encrypted")
+			}
+
+			var downloaded bytes.Buffer
+			if _, err := client.DownloadReport(ctx, 4, ReportLab, &downloaded); err != nil {
+				t.Fatalf("DownloadReport failed: %v", err)
+			}
+			if !bytes.Equal(downloaded.Bytes(), want) {
+				t.Error("expected the downloaded report to be decrypted")
+			}
+		})
+	}
+
+	// Tampered and truncated reports fail to decrypt.
+	for _, corrupt := range []func([]byte) []byte{
+		func(b []byte) []byte { b[len(b)-1] ^= 1; return b },
+		func(b []byte) []byte { return b[:len(b)-20] },
+	} {
+		stored = corrupt(bytes.Clone(stored))
+		if _, err := client.DownloadReport(ctx, 4, ReportLab, io.Discard); !errors.Is(err, ErrReportDecryption) {
+			t.Errorf("expected ErrReportDecryption, got %v", err)
+		}
+	}
+
+	// A report encrypted for another field is rejected.
+	if _, err := client.DownloadReport(ctx, 4, ReportMedical, io.Discard); !errors.Is(err, ErrReportDecryption) {
+		t.Errorf("expected ErrReportDecryption, got %v", err)
+	}
+
+	if _, err := NewEcloudClient(&Config{ApiBaseUrl: "http://testhost", EclinicId: "id", Password: "pw",
+		HospitalNumber: "HOS-123", HospitalName: "Test", EclinicBaseUrl: "http://eclinic",
+		ReportEncryptionKey: key[:16]}); !errors.Is(err, ErrInvalidEncryptionKey) {
+		t.Errorf("expected ErrInvalidEncryptionKey, got %v", err)
+	}
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	var leaked string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = r.Header.Get("Authorization")
+		w.Write([]byte(`{}`))
+	}))
+	defer other.Close()
+
+	var api *httptest.Server
+	api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/moved":
+			http.Redirect(w, r, "/api/final", http.StatusFound)
+		case "/api/proxy":
+			http.Redirect(w, r, other.URL+"/api/final", http.StatusFound)
+		case "/api/loop":
+			http.Redirect(w, r, "/api/loop", http.StatusFound)
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer api.Close()
+
+	newClient := func(policy *RedirectPolicy) *DefaultEcloudClient {
+		client, _ := NewEcloudClient(&Config{ApiBaseUrl: api.URL, EclinicId: "id", Password: "pw",
+			HospitalNumber: "HOS-123", HospitalName: "Test", EclinicBaseUrl: "http://eclinic",
+			RedirectPolicy: policy, Logger: &NoOpLogger{}})
+		c := client.(*DefaultEcloudClient)
+		c.jwtToken, c.authenticated = "secret", true
+		return c
+	}
+	ctx := context.Background()
+
+	c := newClient(nil)
+	resp, err := c.Do(ctx, http.MethodGet, "/api/moved", nil, nil)
+	if err != nil {
+		t.Fatalf("expected a same-host redirect to be followed, got %v", err)
+	}
+	resp.Body.Close()
+
+	for _, path := range []string{"/api/proxy", "/api/loop"} {
+		if _, err := c.Do(ctx, http.MethodGet, path, nil, nil); !errors.Is(err, ErrRedirectRejected) {
+			t.Errorf("%s: expected ErrRedirectRejected, got %v", path, err)
+		}
+	}
+
+	resp, err = newClient(&RedirectPolicy{AllowCrossHost: true}).Do(ctx, http.MethodGet, "/api/proxy", nil, nil)
+	if err != nil {
+		t.Fatalf("expected a cross-host redirect to be followed, got %v", err)
+	}
+	resp.Body.Close()
+	if leaked != "" {
+		t.Errorf("expected the Authorization header to be stripped, got %q", leaked)
+	}
+
+	if _, err := newClient(&RedirectPolicy{MaxRedirects: -1}).Do(ctx, http.MethodGet, "/api/moved", nil, nil); !errors.Is(err, ErrRedirectRejected) {
+		t.Errorf("expected redirects to be disabled, got %v", err)
+	}
+}
+
+func TestAllowedHosts(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer other.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/proxy" {
+			http.Redirect(w, r, other.URL+"/api/final", http.StatusFound)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer api.Close()
+
+	apiHost := strings.TrimPrefix(api.URL, "http://")
+	config := Config{ApiBaseUrl: api.URL, EclinicId: "id", Password: "pw", HospitalNumber: "HOS-123",
+		HospitalName: "Test", EclinicBaseUrl: "http://eclinic", Logger: &NoOpLogger{},
+		RedirectPolicy: &RedirectPolicy{AllowCrossHost: true}, AllowedHosts: []string{strings.ToUpper(apiHost)}}
+
+	client, err := NewEcloudClient(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.(*DefaultEcloudClient)
+	ctx := context.Background()
+
+	resp, err := c.Do(ctx, http.MethodGet, "/api/ok", nil, nil)
+	if err != nil {
+		t.Fatalf("expected the allowed host to be contacted, got %v", err)
+	}
+	resp.Body.Close()
+
+	// Both servers listen on 127.0.0.1, the entry's port tells them apart.
+	if _, err := c.Do(ctx, http.MethodGet, "/api/proxy", nil, nil); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("expected the redirect to be rejected, got %v", err)
+	}
+
+	if _, err := c.Do(ctx, http.MethodGet, "@evil.example.com/api", nil, nil); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("expected the injected host to be rejected, got %v", err)
+	}
+
+	injected := config
+	injected.ApiBaseUrl = "https://evil.example.com"
+	if _, err := NewEcloudClient(&injected); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("expected the base URL to be rejected, got %v", err)
+	}
+
+	err = c.UpdateConfig(ctx, func(config *Config) { config.ReadBaseUrl = "https://replica.example.com" })
+	if !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("expected the read base URL to be rejected, got %v", err)
+	}
+
+	doh := config
+	doh.Resolver = CachingResolver(FallbackResolver(net.DefaultResolver, &DoHResolver{}), time.Hour)
+	if _, err := NewEcloudClient(&doh); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("expected the DoH endpoint to be rejected, got %v", err)
+	}
+
+	doh.AllowedHosts = append(doh.AllowedHosts, "1.1.1.1")
+	if _, err := NewEcloudClient(&doh); err != nil {
+		t.Errorf("expected the listed DoH endpoint to be allowed, got %v", err)
+	}
+
+	err = c.UpdateConfig(ctx, func(config *Config) { config.AllowedHosts = []string{"127.0.0.1"} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = c.Do(ctx, http.MethodGet, "/api/proxy", nil, nil)
+	if err != nil {
+		t.Fatalf("expected an entry without port to allow any port, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestProgress(t *testing.T) {
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.Method == http.MethodGet {
+			resp := newJSONResponse(http.StatusOK, "")
+			resp.Body = io.NopCloser(bytes.NewReader(validPDFBytes))
+			resp.ContentLength = int64(len(validPDFBytes))
+			return resp, nil
+		}
+		io.Copy(io.Discard, req.Body)
+		return newJSONResponse(http.StatusOK, `{"id": 6}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+
+	var updates []Progress
+	ctx := WithProgress(context.Background(), func(progress Progress) {
+		updates = append(updates, progress)
+	})
+
+	record := &PatientRecord{VisitID: 1, SubscriberID: 101, Title: "Checkup", VisitTimestamp: time.Now(),
+		LabReportReader: bytes.NewReader(validPDFBytes)}
+	if err := client.SyncMedicalRecords(ctx, record); err != nil {
+		t.Fatalf("SyncMedicalRecords failed: %v", err)
+	}
+
+	last := updates[len(updates)-1]
+	if last.Operation != "SyncMedicalRecords" || last.Total != int64(len(validPDFBytes)) || last.Fraction() != 1 {
+		t.Errorf("expected a complete upload of %d bytes, got %+v", len(validPDFBytes), last)
+	}
+	if last.Record.VisitID != 1 || last.Record.LabReportReader != nil {
+		t.Errorf("expected the record metadata without reports, got %+v", last.Record)
+	}
+
+	updates = nil
+	if _, err := client.DownloadReport(ctx, 6, ReportLab, io.Discard); err != nil {
+		t.Fatalf("DownloadReport failed: %v", err)
+	}
+	last = updates[len(updates)-1]
+	if last.Operation != "DownloadReport" || last.Record.ID != 6 || last.Fraction() != 1 {
+		t.Errorf("expected a complete download of record 6, got %+v", last)
+	}
+
+	// Totals of encrypted streams account for the encryption overhead.
+	client.(*DefaultEcloudClient).config.ReportEncryptionKey = bytes.Repeat([]byte{7}, 32)
+	sealer, _ := client.(*DefaultEcloudClient).newReportSealer(ctx, labReportFieldName)
+	for _, n := range []int{0, 1, encryptionSegmentSize, encryptionSegmentSize + 1} {
+		sealed, _ := io.ReadAll(sealer.seal(bytes.NewReader(make([]byte, n))))
+		if size := sealer.sealedSize(int64(n)); size != int64(len(sealed)) {
+			t.Errorf("expected a sealed size of %d for %d bytes, got %d", len(sealed), n, size)
+		}
+	}
+
+	// Transfers without a ProgressFunc report nothing.
+	updates = nil
+	client.DownloadReport(context.Background(), 6, ReportLab, io.Discard)
+	if len(updates) != 0 {
+		t.Errorf("expected no progress, got %d updates", len(updates))
+	}
+}
+
+func TestGetUploadLeaderboard(t *testing.T) {
+	ctx := context.Background()
+	period := ReportPeriod{
+		From: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/api/records/stats/uploads" {
+			return nil, fmt.Errorf("unexpected path: %s", req.URL.Path)
+		}
+		if req.URL.Query().Get("from") != "2025-01-01T00:00:00Z" || req.URL.Query().Get("to") != "2025-03-01T00:00:00Z" {
+			return nil, fmt.Errorf("unexpected period: %s", req.URL.RawQuery)
+		}
+		return newJSONResponse(http.StatusOK, `{"entries": [
+			{"registered_by": "Dr. Okello", "month": "2025-02-01T00:00:00Z", "records": 7},
+			{"registered_by": "Dr. Okello", "month": "2025-01-01T00:00:00Z", "records": 3},
+			{"registered_by": "Dr. Nambi", "month": "2025-01-01T00:00:00Z", "records": 5}
+		]}`), nil
+	})
+
+	leaderboard, err := client.GetUploadLeaderboard(ctx, period)
+	if err != nil {
+		t.Fatalf("GetUploadLeaderboard() failed: %v", err)
+	}
+
+	var got []string
+	for _, entry := range leaderboard.Entries {
+		got = append(got, fmt.Sprintf("%s %s %d", entry.Month.Format("2006-01"), entry.Clinician, entry.Records))
+	}
+	want := []string{"2025-01 Dr. Nambi 5", "2025-01 Dr. Okello 3", "2025-02 Dr. Okello 7"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected entries %v, got %v", want, got)
+	}
+
+	totals := leaderboard.Totals()
+	if len(totals) != 2 || totals[0].Clinician != "Dr. Okello" || totals[0].Records != 10 {
+		t.Errorf("unexpected totals: %+v", totals)
+	}
+
+	if _, err := client.GetUploadLeaderboard(ctx, ReportPeriod{}); err != ErrInvalidReportPeriod {
+		t.Errorf("expected error %v, got %v", ErrInvalidReportPeriod, err)
+	}
+}
+
+func TestInboundUploads(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch {
+		case req.Method == http.MethodGet && req.URL.Path == "/api/inbound-uploads":
+			if req.URL.Query().Get("status") != "pending" || req.URL.Query().Get("hospital_number") != "HOS-123" {
+				return nil, fmt.Errorf("unexpected query: %s", req.URL.RawQuery)
+			}
+			return newJSONResponse(http.StatusOK, `[{"id": 7, "subscriber_id": 101, "title": "2019 X-ray",
+				"filename": "xray.pdf", "status": "pending"}]`), nil
+		case req.Method == http.MethodGet && req.URL.Path == "/api/inbound-uploads/7/file":
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(validPDFBytes))}, nil
+		case req.Method == http.MethodPost && req.URL.Path == "/api/inbound-uploads/7/accept":
+			var body map[string]uint
+			json.NewDecoder(req.Body).Decode(&body)
+			return newJSONResponse(http.StatusOK, fmt.Sprintf(`{"id": 7, "status": "accepted", "visit_id": %d,
+				"record_id": 55}`, body["visit_id"])), nil
+		case req.Method == http.MethodPost && req.URL.Path == "/api/inbound-uploads/7/reject":
+			return newJSONResponse(http.StatusConflict, `{"error": "upload already reviewed"}`), nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error": "not found"}`), nil
+	})
+
+	uploads, err := client.ListInboundPatientUploads(ctx)
+	if err != nil {
+		t.Fatalf("ListInboundPatientUploads() failed: %v", err)
+	}
+	if len(uploads) != 1 || uploads[0].ID != 7 || uploads[0].Status != InboundUploadPending {
+		t.Fatalf("unexpected uploads: %+v", uploads)
+	}
+
+	var file bytes.Buffer
+	if _, err := client.DownloadInboundUpload(ctx, 7, &file); err != nil || !bytes.Equal(file.Bytes(), validPDFBytes) {
+		t.Errorf("DownloadInboundUpload() = %v, content mismatch: %t", err, !bytes.Equal(file.Bytes(), validPDFBytes))
+	}
+
+	accepted, err := client.AcceptInboundUpload(ctx, 7, 909)
+	if err != nil {
+		t.Fatalf("AcceptInboundUpload() failed: %v", err)
+	}
+	if accepted.Status != InboundUploadAccepted || accepted.VisitID != 909 || accepted.RecordID != 55 {
+		t.Errorf("unexpected accepted upload: %+v", accepted)
+	}
+
+	if _, err := client.RejectInboundUpload(ctx, 7, "Not legible"); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected error %v, got %v", ErrConflict, err)
+	}
+
+	if _, err := client.RejectInboundUpload(ctx, 7, " "); err == nil {
+		t.Error("expected an error for an empty rejection reason")
+	}
+
+	if _, err := client.AcceptInboundUpload(ctx, 8, 909); !errors.Is(err, ErrInboundUploadNotFound) {
+		t.Errorf("expected error %v, got %v", ErrInboundUploadNotFound, err)
+	}
+}
+
+func TestSyncAttachments(t *testing.T) {
+	jpeg := slices.Concat([]byte{0xFF, 0xD8, 0xFF, 0xE0, 0, 0x10, 'J', 'F', 'I', 'F', 0}, make([]byte, 32), []byte{0xFF, 0xD9})
+	png := slices.Concat([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), make([]byte, 17),
+		[]byte("\x00\x00\x00\x00IEND\xaeB`\x82"))
+	dicom := slices.Concat(make([]byte, 128), []byte("DICM"), make([]byte, 64))
+
+	type part struct{ filename, contentType string }
+	var parts map[string]part
+	var fields neturl.Values
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		// Failed checks of streamed attachments abort the body.
+		if err := req.ParseMultipartForm(1 << 20); err != nil {
+			return nil, err
+		}
+		parts, fields = make(map[string]part), neturl.Values(req.MultipartForm.Value)
+		for field, files := range req.MultipartForm.File {
+			parts[field] = part{files[0].Filename, files[0].Header.Get("Content-Type")}
+		}
+		return newJSONResponse(http.StatusOK, `{"id": 3}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+	ctx := context.Background()
+
+	record := &PatientRecord{VisitID: 1, SubscriberID: 101, Title: "Chest X-ray", VisitTimestamp: time.Now(),
+		Attachments: []Attachment{
+			{Name: "scan.jpg", ContentType: JPEGContentType, Data: jpeg},
+			{Name: "scan.png", ContentType: PNGContentType, Reader: bytes.NewReader(png)},
+			{Name: "study.dcm", ContentType: DICOMContentType, Data: dicom},
+			{Name: "notes.csv", ContentType: "text/csv", Reader: strings.NewReader("a,b\n")},
+		}}
+	if err := client.SyncMedicalRecords(ctx, record); err != nil {
+		t.Fatalf("SyncMedicalRecords failed: %v", err)
+	}
+
+	want := map[string]part{
+		"attachment_0": {"scan.jpg", JPEGContentType},
+		"attachment_1": {"scan.png", PNGContentType},
+		"attachment_2": {"study.dcm", DICOMContentType},
+		"attachment_3": {"notes.csv", "text/csv"},
+	}
+	for field, p := range want {
+		if parts[field] != p {
+			t.Errorf("expected part %s to be %+v, got %+v", field, p, parts[field])
+		}
+		if fields.Get(field+"_content_type") != p.contentType {
+			t.Errorf("expected %s_content_type %s, got %q", field, p.contentType, fields.Get(field+"_content_type"))
+		}
+	}
+	if fields.Get("attachment_0_sha256") != sha256Hex(jpeg) {
+		t.Errorf("expected the checksum of the JPEG attachment")
+	}
+
+	invalid := []struct {
+		name       string
+		attachment Attachment
+		want       error
+	}{
+		{"truncated JPEG", Attachment{Name: "a.jpg", ContentType: JPEGContentType, Data: jpeg[:20]}, ErrInvalidAttachment},
+		{"truncated PNG stream", Attachment{Name: "a.png", ContentType: PNGContentType,
+			Reader: bytes.NewReader(png[:30])}, ErrInvalidAttachment},
+		{"DICOM without prefix", Attachment{Name: "a.dcm", ContentType: DICOMContentType,
+			Data: make([]byte, 200)}, ErrInvalidAttachment},
+		{"invalid PDF", Attachment{Name: "a.pdf", ContentType: "application/pdf",
+			Data: validPDFBytes[:len(validPDFBytes)-5]}, ErrInvalidAttachment},
+		{"PNG labelled as JPEG", Attachment{Name: "a.jpg", ContentType: JPEGContentType, Data: png}, ErrContentTypeMismatch},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			record.Attachments = []Attachment{tt.attachment}
+			if err := client.SyncMedicalRecords(ctx, record); !errors.Is(err, tt.want) {
+				t.Errorf("expected error %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	record.Attachments = []Attachment{{Name: "scan.jpg", ContentType: "not a type", Data: jpeg}}
+	if err := client.SyncMedicalRecords(ctx, record); err == nil {
+		t.Error("expected an error for an invalid content type")
+	}
+}
+
+func TestSyncMedicalRecordsFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	png := slices.Concat([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), make([]byte, 17),
+		[]byte("\x00\x00\x00\x00IEND\xaeB`\x82"))
+	paths := map[string][]byte{
+		"lab.pdf":   validPDFBytes,
+		"study.dcm": slices.Concat(make([]byte, 128), []byte("DICM"), make([]byte, 64)),
+		"scan":      png, // No extension: detected from the content.
+	}
+	for name, data := range paths {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	contentTypes := map[string]string{}
+	var lab []byte
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if err := req.ParseMultipartForm(1 << 20); err != nil {
+			return nil, err
+		}
+		for field, files := range req.MultipartForm.File {
+			contentTypes[files[0].Filename] = files[0].Header.Get("Content-Type")
+			if field == labReportFieldName {
+				f, _ := files[0].Open()
+				lab, _ = io.ReadAll(f)
+				f.Close()
+			}
+		}
+		return newJSONResponse(http.StatusOK, `{"id": 3}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+	ctx := context.Background()
+
+	record := &PatientRecord{VisitID: 1, SubscriberID: 101, Title: "Chest X-ray", VisitTimestamp: time.Now()}
+	err := client.SyncMedicalRecordsFromFiles(ctx, record, ReportFiles{
+		LabReport:   filepath.Join(dir, "lab.pdf"),
+		Attachments: []string{filepath.Join(dir, "study.dcm"), filepath.Join(dir, "scan")},
+	})
+	if err != nil {
+		t.Fatalf("SyncMedicalRecordsFromFiles failed: %v", err)
+	}
+
+	if !bytes.Equal(lab, validPDFBytes) {
+		t.Error("lab report content mismatch")
+	}
+	if contentTypes["study.dcm"] != DICOMContentType || contentTypes["scan"] != PNGContentType {
+		t.Errorf("unexpected attachment content types: %v", contentTypes)
+	}
+	if record.LabReportReader != nil || len(record.Attachments) != 0 {
+		t.Error("expected the caller's record to be left untouched")
+	}
+
+	err = client.SyncMedicalRecordsFromFiles(ctx, record, ReportFiles{LabReport: filepath.Join(dir, "missing.pdf")})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected error %v, got %v", os.ErrNotExist, err)
+	}
+
+	// The helpers keep the files open until Close.
+	if err := record.AttachLabReportFile(filepath.Join(dir, "lab.pdf")); err != nil {
+		t.Fatalf("AttachLabReportFile failed: %v", err)
+	}
+	file := record.LabReportReader.(*os.File)
+	if err := record.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := file.Read(make([]byte, 1)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected the file to be closed, got %v", err)
+	}
+}
+
+func TestSyncMedicalRecordsV2(t *testing.T) {
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		io.Copy(io.Discard, req.Body)
+		return newJSONResponse(http.StatusOK, `{
+			"id": 42,
+			"files": {"lab_report": "https://files.example.com/42/lab_report.pdf"},
+			"duplicate": true,
+			"created_at": "2024-03-01T10:00:00Z",
+			"updated_at": "2024-03-02T10:00:00Z"
+		}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+
+	result, err := client.Records().SyncMedicalRecordsV2(context.Background(), &PatientRecord{
+		VisitID:        1,
+		SubscriberID:   101,
+		Title:          "Checkup",
+		VisitTimestamp: time.Now(),
+		LabReport:      validPDFBytes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	if result.RecordID != 42 || !result.Duplicate || !result.CreatedAt.Equal(created) ||
+		result.Files["lab_report"] != "https://files.example.com/42/lab_report.pdf" {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestDeltaSync(t *testing.T) {
+	var checks int
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/api/payments/9/records-uploaded":
+			return newJSONResponse(http.StatusOK, `{"id": 9, "subscriber_id": 101, "records_uploaded": true,
+				"last_uploaded": "2024-03-01T10:00:00Z"}`), nil
+		case "/api/payments/10/records-uploaded":
+			return newJSONResponse(http.StatusNotFound, `{"error": "payment not found"}`), nil
+		case "/api/records/visits/HOS-123/synced":
+			checks++
+			var body struct {
+				VisitIDs []uint `json:"visit_ids"`
+			}
+			json.NewDecoder(req.Body).Decode(&body)
+
+			// Even visits are synced.
+			var synced []uint
+			for _, id := range body.VisitIDs {
+				if id%2 == 0 {
+					synced = append(synced, id)
+				}
+			}
+			data, _ := json.Marshal(map[string][]uint{"visit_ids": synced})
+			return newJSONResponse(http.StatusOK, string(data)), nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error": "not found"}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+	ctx := context.Background()
+
+	payment, err := client.Payments().MarkRecordsUploaded(ctx, 9)
+	if err != nil || !payment.RecordsUploaded || payment.LastUploaded == nil {
+		t.Fatalf("expected the payment to be marked, got %+v, %v", payment, err)
+	}
+	if _, err := client.Payments().MarkRecordsUploaded(ctx, 10); !errors.Is(err, ErrPaymentNotFound) {
+		t.Errorf("expected ErrPaymentNotFound, got %v", err)
+	}
+
+	visitIDs := []uint{3, 2, 3}
+	for id := uint(4); id <= 600; id++ {
+		visitIDs = append(visitIDs, id)
+	}
+
+	unsynced, err := client.Records().GetUnsyncedVisits(ctx, visitIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checks != 2 {
+		t.Errorf("expected the visits to be checked in 2 requests, got %d", checks)
+	}
+	if len(unsynced) != 299 || unsynced[0] != 3 || unsynced[1] != 5 || unsynced[298] != 599 {
+		t.Errorf("unexpected unsynced visits %v", unsynced)
+	}
+}
+
+func TestDownloadReportToFile(t *testing.T) {
+	sum := sha256.Sum256(validPDFBytes)
+	checksum := hex.EncodeToString(sum[:])
+	half := len(validPDFBytes) / 2
+
+	var requests []*http.Request
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req)
+		resp := newJSONResponse(http.StatusOK, "")
+		resp.Header.Set("ETag", `"v1"`)
+		resp.Header.Set(ReportSHA256Header, checksum)
+
+		switch {
+		case req.Header.Get("Range") != "":
+			resp.StatusCode = http.StatusPartialContent
+			resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", half, len(validPDFBytes)-1, len(validPDFBytes)))
+			resp.Body = io.NopCloser(bytes.NewReader(validPDFBytes[half:]))
+		case len(requests) == 1:
+			// The link drops halfway through the first download.
+			resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(validPDFBytes[:half]),
+				iotest.ErrReader(errors.New("connection reset"))))
+		default:
+			resp.Header.Set(ReportSHA256Header, strings.Repeat("0", 64))
+			resp.Body = io.NopCloser(bytes.NewReader(validPDFBytes))
+		}
+		return resp, nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "lab.pdf")
+
+	if _, err := client.Records().DownloadReportToFile(ctx, 1, ReportLab, path); err == nil {
+		t.Fatal("expected the interrupted download to fail")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no report before the download completes, got %v", err)
+	}
+
+	n, err := client.Records().DownloadReportToFile(ctx, 1, ReportLab, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := requests[1].Header; got.Get("Range") != fmt.Sprintf("bytes=%d-", half) || got.Get("If-Range") != `"v1"` {
+		t.Errorf("expected the download to resume, got Range %q, If-Range %q", got.Get("Range"), got.Get("If-Range"))
+	}
+
+	data, _ := os.ReadFile(path)
+	if n != int64(len(validPDFBytes)) || !bytes.Equal(data, validPDFBytes) {
+		t.Errorf("expected the complete report, got %d bytes", n)
+	}
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Errorf("expected the partial file to be removed, got %v", err)
+	}
+
+	// A report that doesn't match its checksum is discarded.
+	other := filepath.Join(t.TempDir(), "lab.pdf")
+	if _, err := client.Records().DownloadReportToFile(ctx, 1, ReportLab, other); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+	for _, p := range []string{other, other + ".part", other + ".part.json"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be removed, got %v", p, err)
+		}
+	}
+}
+
+func TestSubscribeAndPay(t *testing.T) {
+	var keys []string
+	var failPayment bool
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		keys = append(keys, req.Header.Get(IdempotencyKeyHeader))
+		switch req.URL.Path {
+		case "/api/subscriptions":
+			return newJSONResponse(http.StatusOK, `{"id": 7, "patient_id": 1, "patient_name": "Jane"}`), nil
+		case "/api/payments":
+			if failPayment {
+				return newJSONResponse(http.StatusBadRequest, `{"error": "card declined"}`), nil
+			}
+			return newJSONResponse(http.StatusOK, `{"id": 3, "subscriber_id": 7, "amount": 50000}`), nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error": "not found"}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+
+	req := &SubscribeAndPayRequest{
+		SubscribeRequest: SubscribeRequest{PatientID: 1, PatientName: "Jane", RegisteredBy: "reception"},
+		Amount:           50000,
+	}
+	ctx := WithIdempotencyKey(context.Background(), "receipt-1")
+
+	subscriber, payment, err := client.Subscriptions().SubscribeAndPay(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subscriber.ID != 7 || payment.ID != 3 || payment.SubscriberID != 7 {
+		t.Errorf("unexpected subscriber %+v and payment %+v", subscriber, payment)
+	}
+	if len(keys) != 2 || keys[0] != "receipt-1-subscribe" || keys[1] != "receipt-1-payment" {
+		t.Errorf("expected a key per step, got %v", keys)
+	}
+
+	failPayment = true
+	subscriber, payment, err = client.Subscriptions().SubscribeAndPay(ctx, req)
+	var partial *PartialSubscriptionError
+	if !errors.As(err, &partial) || !errors.Is(err, ErrPartialSubscription) || partial.Subscriber.ID != 7 {
+		t.Fatalf("expected a PartialSubscriptionError, got %v", err)
+	}
+	if subscriber == nil || payment != nil {
+		t.Errorf("expected the subscriber without payment, got %+v, %+v", subscriber, payment)
+	}
+
+	// Invalid payments fail before subscribing.
+	keys = nil
+	req.RegisteredBy = ""
+	if _, _, err := client.Subscriptions().SubscribeAndPay(ctx, req); err == nil || len(keys) != 0 {
+		t.Errorf("expected the request to fail without subscribing, got %v after %d requests", err, len(keys))
+	}
+}
+
+func TestSubscriptionStatus(t *testing.T) {
+	day := 24 * time.Hour
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	subscriber := &Subscriber{ID: 7}
+	bill := &Bill{Amount: 50000, Duration: 365 * day}
+	payment := func(from, to time.Duration) *Payment {
+		return &Payment{SubscriberID: 7, CreatedAt: at.Add(from), ValidTo: at.Add(to)}
+	}
+	voided := payment(-day, 10*day)
+	voided.VoidedAt = &at
+
+	tests := []struct {
+		name     string
+		sub      *Subscriber
+		payments []*Payment
+		state    SubscriptionState
+		days     int
+	}{
+		{"never subscribed", nil, nil, SubscriptionNeverSubscribed, 0},
+		{"never paid", subscriber, []*Payment{voided}, SubscriptionNeverSubscribed, 0},
+		{"active", subscriber, []*Payment{payment(-30*day, 2*day+time.Hour), voided}, SubscriptionActive, 3},
+		{"renewed", subscriber, []*Payment{payment(-30*day, day), payment(day, 20*day)}, SubscriptionActive, 20},
+		{"grace period", subscriber, []*Payment{payment(-30*day, -2*day)}, SubscriptionGracePeriod, 5},
+		{"expired", subscriber, []*Payment{payment(-30*day, -8*day)}, SubscriptionExpired, 0},
+	}
+	for _, test := range tests {
+		status := subscriptionStatus(test.sub, test.payments, bill, 7*day, at)
+		if status.State != test.state || status.DaysRemaining != test.days || status.RenewalAmount != 50000 {
+			t.Errorf("%s: got %s with %d days, expected %s with %d days", test.name, status.State,
+				status.DaysRemaining, test.state, test.days)
+		}
+		if status.NeedsRenewal() != (test.state != SubscriptionActive) {
+			t.Errorf("%s: unexpected NeedsRenewal %t", test.name, status.NeedsRenewal())
+		}
+	}
+
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/api/billing/get_bill":
+			return newJSONResponse(http.StatusOK, `{"Amount": 50000, "Duration": 31536000000000000}`), nil
+		case "/api/subscriptions/check_subscription/HOS-123/1":
+			return newJSONResponse(http.StatusOK, `{"id": 7, "patient_id": 1}`), nil
+		case "/api/payments/list/7":
+			data, _ := json.Marshal([]*Payment{{ID: 3, SubscriberID: 7, CreatedAt: time.Now().Add(-day),
+				ValidTo: time.Now().Add(10 * day)}})
+			return newJSONResponse(http.StatusOK, string(data)), nil
+		}
+		return newJSONResponse(http.StatusNotFound, `{"error": "not found"}`), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+	ctx := context.Background()
+
+	status, err := client.Subscriptions().SubscriptionStatus(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != SubscriptionActive || status.DaysRemaining != 10 || status.LatestPayment.ID != 3 ||
+		status.RenewalDuration != 365*day {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	status, err = client.Subscriptions().SubscriptionStatus(ctx, 2)
+	if err != nil || status.State != SubscriptionNeverSubscribed || status.Subscriber != nil {
+		t.Errorf("expected an unknown patient to be never subscribed, got %+v, %v", status, err)
+	}
+}
+
+func TestOperations(t *testing.T) {
+	polls := map[string]int{}
+	client, _ := newTestClient(func(req *http.Request) (*http.Response, error) {
+		if req.Body != nil {
+			io.Copy(io.Discard, req.Body)
+		}
+		accepted := func(body string) *http.Response {
+			resp := newJSONResponse(http.StatusAccepted, body)
+			resp.Header.Set("Retry-After", "0")
+			return resp
+		}
+
+		switch req.URL.Path {
+		case "/api/records":
+			resp := accepted("")
+			resp.Header.Set("Location", "/api/operations/sync-1")
+			return resp, nil
+		case "/api/subscriptions/7/export":
+			return accepted(`{"id": "export-1", "status": "pending", "status_url": "/api/operations/export-1"}`), nil
+		case "/api/subscriptions/7/erasure":
+			return accepted(`{"id": "erasure-1", "status": "pending", "status_url": "/api/operations/erasure-1"}`), nil
+		case "/api/subscriptions/8/export":
+			return newJSONResponse(http.StatusNotFound, `{"error": "subscriber not found"}`), nil
+		case "/api/subscriptions/9/export":
+			resp := accepted(`{"id": "export-9", "status": "pending"}`)
+			resp.Header.Set("Location", "https://evil.example.com/api/operations/export-9")
+			return resp, nil
+		}
+
+		if req.URL.Host != "testhost" {
+			t.Errorf("expected only the API host to be polled, got %s", req.URL)
+		}
+		id := strings.TrimPrefix(req.URL.Path, "/api/operations/")
+		polls[id]++
+		if polls[id] == 1 {
+			return accepted(fmt.Sprintf(`{"id": %q, "status": "running"}`, id)), nil
+		}
+
+		switch id {
+		case "sync-1":
+			return newJSONResponse(http.StatusOK, `{"id": "sync-1", "status": "succeeded", "result": {"id": 42}}`), nil
+		case "export-1":
+			return newJSONResponse(http.StatusOK, `{"id": "export-1", "status": "succeeded",
+				"result": {"url": "https://files.example.com/export-1.zip", "size": 1024}}`), nil
+		}
+		return newJSONResponse(http.StatusOK, fmt.Sprintf(`{"id": %q, "status": "failed", "error": "legal hold"}`, id)), nil
+	})
+	client.(*DefaultEcloudClient).jwtToken = "test-token"
+	ctx := context.Background()
+
+	// Records processed asynchronously are awaited.
+	result, err := client.Records().SyncMedicalRecordsV2(ctx, &PatientRecord{
+		VisitID: 1, SubscriberID: 7, Title: "Checkup", VisitTimestamp: time.Now(), LabReport: validPDFBytes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RecordID != 42 || result.Operation == nil || polls["sync-1"] != 2 {
+		t.Errorf("expected the record operation to be awaited, got %+v after %d polls", result, polls["sync-1"])
+	}
+
+	op, err := client.Subscriptions().RequestDataExport(ctx, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.Done() {
+		t.Error("expected the export to be pending")
+	}
+	if err := op.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var export DataExport
+	if err := op.Decode(&export); err != nil || export.URL != "https://files.example.com/export-1.zip" {
+		t.Errorf("unexpected export %+v, %v", export, err)
+	}
+
+	op, err = client.Subscriptions().RequestErasure(ctx, 7, "consent withdrawn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Wait(ctx); !errors.Is(err, ErrOperationFailed) || !strings.Contains(err.Error(), "legal hold") {
+		t.Errorf("expected the erasure to fail, got %v", err)
+	}
+
+	if _, err := client.Subscriptions().RequestDataExport(ctx, 8); !errors.Is(err, ErrSubscriberNotFound) {
+		t.Errorf("expected ErrSubscriberNotFound, got %v", err)
+	}
+
+	// The token isn't sent to a status URL on another host.
+	op, err = client.Subscriptions().RequestDataExport(ctx, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := op.Wait(ctx); !errors.Is(err, ErrHostNotAllowed) || polls["export-9"] != 0 {
+		t.Errorf("expected the foreign status URL to be rejected, got %v", err)
+	}
+}
+
+func TestRequestContentLength(t *testing.T) {
+	var lengths []int64
+	var encodings [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lengths = append(lengths, r.ContentLength)
+		encodings = append(encodings, r.TransferEncoding)
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte(`{"id": 3, "subscriber_id": 7, "amount": 5000}`))
+	}))
+	defer server.Close()
+
+	client, err := NewEcloudClient(&Config{ApiBaseUrl: server.URL, EclinicId: "id", Password: "pw",
+		HospitalNumber: "HOS-123", HospitalName: "Test", EclinicBaseUrl: "http://eclinic", Logger: &NoOpLogger{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.(*DefaultEcloudClient)
+	c.jwtToken, c.authenticated = "secret", true
+
+	if _, err := c.CreatePayment(context.Background(), 7, 5000, "finance"); err != nil {
+		t.Fatal(err)
+	}
+	if len(lengths) != 1 || lengths[0] <= 0 || len(encodings[0]) != 0 {
+		t.Fatalf("expected a Content-Length and no chunked encoding, got %v, %v", lengths, encodings)
+	}
+	if sent := c.BandwidthUsage().Sent; sent != lengths[0] {
+		t.Errorf("expected %d bytes to be counted as sent, got %d", lengths[0], sent)
+	}
+}
@@ -0,0 +1,345 @@
+package ecloudsdk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// ReportEncryptionScheme identifies the format of encrypted reports. It is
+// sent in the report_encryption field of uploads of encrypted reports.
+const ReportEncryptionScheme = "A256GCM-STREAM-v1"
+
+// DefaultReportKeyID is the key ID of Config.ReportEncryptionKey.
+const DefaultReportKeyID = "default"
+
+// KeyProvider supplies the keys of client-side report encryption, e.g from a
+// KMS. Keys are 32-byte AES-256 keys identified by an ID of at most 255 bytes,
+// which is stored with each report so keys can be rotated.
+type KeyProvider interface {
+	// CurrentKey returns the key new reports are encrypted with, and its ID.
+	CurrentKey(ctx context.Context) (keyID string, key []byte, err error)
+
+	// Key returns the key with the given ID, to decrypt reports encrypted
+	// before a rotation.
+	Key(ctx context.Context, keyID string) ([]byte, error)
+}
+
+// StaticKeyProvider is a KeyProvider with a single key.
+type StaticKeyProvider struct {
+	ID     string
+	Secret []byte // 32-byte AES-256 key.
+}
+
+func (p *StaticKeyProvider) CurrentKey(ctx context.Context) (string, []byte, error) {
+	return p.ID, p.Secret, nil
+}
+
+func (p *StaticKeyProvider) Key(ctx context.Context, keyID string) ([]byte, error) {
+	if keyID != p.ID {
+		return nil, fmt.Errorf("unknown report key %q", keyID)
+	}
+	return p.Secret, nil
+}
+
+// keyProvider returns the configured KeyProvider, or nil if report
+// encryption is off.
+func (c *DefaultEcloudClient) keyProvider() KeyProvider {
+	cfg := c.cfg()
+	if cfg.KeyProvider != nil {
+		return cfg.KeyProvider
+	}
+
+	if cfg.ReportEncryptionKey != nil {
+		return &StaticKeyProvider{ID: DefaultReportKeyID, Secret: cfg.ReportEncryptionKey}
+	}
+	return nil
+}
+
+// Encrypted reports are an envelope: a random data key wrapped with the
+// hospital's key, followed by the report encrypted with the data key in
+// segments, so reports are streamed rather than held in memory:
+//
+//	"ECE1" | key ID length (1 byte) | key ID | wrapped data key | nonce prefix (7 bytes) | segments...
+//
+// Each segment is up to encryptionSegmentSize bytes sealed with AES-GCM under
+// a nonce made of the prefix, the segment index and a flag marking the last
+// segment, so reordered, dropped or truncated segments fail to decrypt. The
+// report's field name is the additional data of every seal.
+var encryptedMagic = []byte("ECE1")
+
+const (
+	encryptionSegmentSize = 64 << 10
+	noncePrefixLen        = 7
+	dataKeyLen            = 32
+)
+
+const encryptedContentType = "application/octet-stream"
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidEncryptionKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// segmentNonce returns the nonce of a segment, see encryptedMagic.
+func segmentNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, noncePrefixLen+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixLen:], index)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// reportSealer encrypts a report. The data key and nonces are fixed per
+// sealer, so every upload attempt of a report sends the same bytes.
+type reportSealer struct {
+	header []byte
+	aead   cipher.AEAD
+	prefix []byte
+	aad    []byte
+}
+
+// newReportSealer creates a sealer of the report in field with a new data key.
+func (c *DefaultEcloudClient) newReportSealer(ctx context.Context, field string) (*reportSealer, error) {
+	keyID, key, err := c.keyProvider().CurrentKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get report key: %w", err)
+	}
+
+	if len(keyID) > math.MaxUint8 {
+		return nil, fmt.Errorf("report key id %q is longer than %d bytes", keyID, math.MaxUint8)
+	}
+
+	kek, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, dataKeyLen)
+	wrapNonce := make([]byte, kek.NonceSize())
+	prefix := make([]byte, noncePrefixLen)
+	for _, b := range [][]byte{dataKey, wrapNonce, prefix} {
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append(bytes.Clone(encryptedMagic), byte(len(keyID)))
+	header = append(header, keyID...)
+	header = append(header, wrapNonce...)
+	header = kek.Seal(header, wrapNonce, dataKey, []byte(field))
+	header = append(header, prefix...)
+	return &reportSealer{header: header, aead: aead, prefix: prefix, aad: []byte(field)}, nil
+}
+
+// sealedSize returns the size of a report of n bytes once encrypted.
+func (s *reportSealer) sealedSize(n int64) int64 {
+	segments := max((n+encryptionSegmentSize-1)/encryptionSegmentSize, 1)
+	return int64(len(s.header)) + n + segments*int64(s.aead.Overhead())
+}
+
+// seal returns a reader of r encrypted.
+func (s *reportSealer) seal(r io.Reader) io.Reader {
+	return &segmentReader{
+		src:     bufio.NewReader(r),
+		aead:    s.aead,
+		prefix:  s.prefix,
+		aad:     s.aad,
+		segment: make([]byte, encryptionSegmentSize),
+		pending: s.header,
+		sealing: true,
+	}
+}
+
+// segmentReader seals or opens the segments of a report as it is read.
+type segmentReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	aad     []byte
+	segment []byte // Input segment buffer.
+	sealing bool   // Encrypt rather than decrypt.
+
+	index   uint32
+	pending []byte // Output not read yet.
+	out     []byte
+	done    bool
+}
+
+func (r *segmentReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// next processes the next segment. A segment is the last one if it is short
+// or nothing follows it.
+func (r *segmentReader) next() error {
+	n, err := io.ReadFull(r.src, r.segment)
+	last := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		last = true
+	case err != nil:
+		return err
+	default:
+		if _, err := r.src.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if r.index == math.MaxUint32 && !last {
+		return fmt.Errorf("report too large to encrypt")
+	}
+
+	nonce := segmentNonce(r.prefix, r.index, last)
+	var out []byte
+	if r.sealing {
+		out = r.aead.Seal(r.out[:0], nonce, r.segment[:n], r.aad)
+	} else if out, err = r.aead.Open(r.out[:0], nonce, r.segment[:n], r.aad); err != nil {
+		return fmt.Errorf("%w: segment %d", ErrReportDecryption, r.index)
+	}
+
+	r.out, r.pending = out, out
+	r.index++
+	r.done = last
+	return nil
+}
+
+// isEncryptedReport reports whether a report starts like an encrypted report.
+func isEncryptedReport(r *bufio.Reader) bool {
+	magic, _ := r.Peek(len(encryptedMagic))
+	return bytes.Equal(magic, encryptedMagic)
+}
+
+// openReport returns a reader of the encrypted report r decrypted, checking
+// each segment as it is read.
+func (c *DefaultEcloudClient) openReport(ctx context.Context, r *bufio.Reader, field string) (io.Reader, error) {
+	provider := c.keyProvider()
+	if provider == nil {
+		return nil, fmt.Errorf("%w: no report key configured", ErrReportDecryption)
+	}
+
+	head := make([]byte, len(encryptedMagic)+1)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, fmt.Errorf("unable to read report header: %w", err)
+	}
+
+	keyID := make([]byte, head[len(encryptedMagic)])
+	if _, err := io.ReadFull(r, keyID); err != nil {
+		return nil, fmt.Errorf("unable to read report header: %w", err)
+	}
+
+	key, err := provider.Key(ctx, string(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get report key: %w", err)
+	}
+
+	kek, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped := make([]byte, kek.NonceSize()+dataKeyLen+kek.Overhead()+noncePrefixLen)
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return nil, fmt.Errorf("unable to read report header: %w", err)
+	}
+
+	nonce, wrapped, prefix := wrapped[:kek.NonceSize()], wrapped[kek.NonceSize():len(wrapped)-noncePrefixLen],
+		wrapped[len(wrapped)-noncePrefixLen:]
+	dataKey, err := kek.Open(nil, nonce, wrapped, []byte(field))
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrong key or corrupted header", ErrReportDecryption)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &segmentReader{
+		src:     r,
+		aead:    aead,
+		prefix:  prefix,
+		aad:     []byte(field),
+		segment: make([]byte, encryptionSegmentSize+aead.Overhead()),
+	}, nil
+}
+
+// encryptReports returns the reports encrypted with the current report key,
+// or as they are if report encryption is off. Reports held in memory are
+// encrypted once; streamed reports are encrypted as they are uploaded.
+func (c *DefaultEcloudClient) encryptReports(ctx context.Context, parts []reportPart) ([]reportPart, error) {
+	if c.keyProvider() == nil {
+		return parts, nil
+	}
+
+	encrypted := make([]reportPart, len(parts))
+	for i, part := range parts {
+		sealer, err := c.newReportSealer(ctx, part.field)
+		if err != nil {
+			return nil, err
+		}
+
+		open := part.open
+		encrypted[i] = reportPart{
+			field:       part.field,
+			filename:    part.filename + ".enc",
+			contentType: encryptedContentType,
+			size:        -1,
+			open: func() (io.Reader, error) {
+				r, err := open()
+				if err != nil {
+					return nil, err
+				}
+				return sealer.seal(r), nil
+			},
+		}
+
+		if part.sha256 != "" {
+			r, _ := open()
+			data, err := io.ReadAll(sealer.seal(r))
+			if err != nil {
+				return nil, fmt.Errorf("unable to encrypt %s: %w", part.field, err)
+			}
+			encrypted[i].open, encrypted[i].sha256 = bytesOpener(data), sha256Hex(data)
+			encrypted[i].size = int64(len(data))
+		} else if part.size >= 0 {
+			encrypted[i].size = sealer.sealedSize(part.size)
+		}
+	}
+	return encrypted, nil
+}
@@ -0,0 +1,76 @@
+package ecloudsdk
+
+import (
+	"context"
+	"fmt"
+)
+
+// SubscribeAndPayRequest subscribes a patient and records their first payment.
+type SubscribeAndPayRequest struct {
+	SubscribeRequest
+
+	// Amount paid for the subscription. RegisteredBy is recorded on both the
+	// subscription and the payment.
+	Amount float64
+}
+
+// PartialSubscriptionError is returned by SubscribeAndPay when the patient was
+// subscribed but the payment failed. Retry the payment with CreatePayment for
+// Subscriber.ID rather than subscribing again. It matches ErrPartialSubscription
+// with errors.Is.
+type PartialSubscriptionError struct {
+	Subscriber *Subscriber // The subscription that was created.
+	Err        error       // The error of CreatePayment.
+}
+
+func (e *PartialSubscriptionError) Error() string {
+	return fmt.Sprintf("%s: subscriber %d created but payment failed: %v", ErrPartialSubscription,
+		e.Subscriber.ID, e.Err)
+}
+
+func (e *PartialSubscriptionError) Is(target error) bool {
+	return target == ErrPartialSubscription
+}
+
+func (e *PartialSubscriptionError) Unwrap() error {
+	return e.Err
+}
+
+// SubscribeAndPay is the front-desk flow: it subscribes a patient, then
+// records their payment, and returns both. The payment is validated before
+// subscribing. If the payment fails after the patient was subscribed, it
+// returns the subscriber and a *PartialSubscriptionError.
+//
+// With a key set by WithIdempotencyKey, each step derives its own key from
+// it, so the whole flow can be retried with the same key after a crash.
+func (c *DefaultEcloudClient) SubscribeAndPay(ctx context.Context, req *SubscribeAndPayRequest) (*Subscriber, *Payment, error) {
+	if req == nil {
+		return nil, nil, fmt.Errorf("subscribe and pay request must not be nil")
+	}
+	if req.Amount < 0 {
+		return nil, nil, fmt.Errorf("amount to be paid must be greater then zero")
+	}
+	if err := c.checkAmount(req.Amount); err != nil {
+		return nil, nil, err
+	}
+	if req.RegisteredBy == "" {
+		return nil, nil, fmt.Errorf("eclinic user making the payment (registered_by) must not be empty")
+	}
+
+	subscribeCtx, payCtx := ctx, ctx
+	if key, ok := IdempotencyKeyFrom(ctx); ok {
+		subscribeCtx = WithIdempotencyKey(ctx, key+"-subscribe")
+		payCtx = WithIdempotencyKey(ctx, key+"-payment")
+	}
+
+	subscriber, err := c.Subscribe(subscribeCtx, &req.SubscribeRequest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payment, err := c.CreatePayment(payCtx, subscriber.ID, req.Amount, req.RegisteredBy)
+	if err != nil {
+		return subscriber, nil, &PartialSubscriptionError{Subscriber: subscriber, Err: err}
+	}
+	return subscriber, payment, nil
+}
@@ -0,0 +1,79 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Feature is an ecloud feature licensed per hospital.
+type Feature string
+
+const (
+	FeatureTeleconsult    Feature = "teleconsult"     // Video consultations with subscribers.
+	FeatureSMS            Feature = "sms"             // SMS notifications to subscribers.
+	FeatureEmail          Feature = "email"           // Email notifications to subscribers.
+	FeatureMedicalRecords Feature = "medical_records" // Medical records synchronization.
+	FeaturePatientPortal  Feature = "patient_portal"  // Subscriber access to the patient portal.
+)
+
+// Entitlement is a feature licensed to the hospital.
+type Entitlement struct {
+	Feature   Feature   `json:"feature"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"` // Zero if the license does not expire.
+}
+
+// Active reports whether the entitlement is in effect at the given time.
+func (e Entitlement) Active(at time.Time) bool {
+	return e.ExpiresAt.IsZero() || at.Before(e.ExpiresAt)
+}
+
+// Entitlements are the features licensed to a hospital.
+type Entitlements struct {
+	HospitalNumber HospitalNumber `json:"hospital_number"`
+	Features       []Entitlement  `json:"features"`
+}
+
+// HasFeature reports whether the hospital is currently licensed for feature.
+// The HMS should hide actions for unlicensed features, since the server
+// rejects them with 402 or 403.
+func (e *Entitlements) HasFeature(feature Feature) bool {
+	return e.HasFeatureAt(feature, time.Now())
+}
+
+// HasFeatureAt reports whether the hospital is licensed for feature at the given time.
+func (e *Entitlements) HasFeatureAt(feature Feature, at time.Time) bool {
+	if e == nil {
+		return false
+	}
+
+	for _, entitlement := range e.Features {
+		if entitlement.Feature == feature && entitlement.Active(at) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetEntitlements fetches the features licensed to the authenticated hospital.
+func (c *DefaultEcloudClient) GetEntitlements(ctx context.Context) (*Entitlements, error) {
+	url := c.cfg().ApiBaseUrl + "/api/entitlements"
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch entitlements: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	entitlements := &Entitlements{}
+	err = json.NewDecoder(resp.Body).Decode(entitlements)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return entitlements, nil
+}
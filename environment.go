@@ -0,0 +1,78 @@
+package ecloudsdk
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Environment selects a preset ecloud deployment.
+type Environment string
+
+const (
+	// EnvironmentProduction targets the live ecloud deployment.
+	EnvironmentProduction Environment = "production"
+
+	// EnvironmentSandbox targets a test deployment, whose base URL must be
+	// configured. Records are validated more strictly and uploaded with an
+	// "environment" field set to "sandbox", so they are recognizable if they
+	// reach another deployment.
+	EnvironmentSandbox Environment = "sandbox"
+)
+
+// ProductionBaseURL is the API base URL of the production environment.
+const ProductionBaseURL = "https://api.ecloud.com"
+
+// BaseURL returns the API base URL of the environment, empty for the sandbox,
+// which has no well-known base URL.
+func (e Environment) BaseURL() string {
+	if e == EnvironmentProduction {
+		return ProductionBaseURL
+	}
+	return ""
+}
+
+// Validate reports whether the environment is known. The empty environment is valid.
+func (e Environment) Validate() error {
+	switch e {
+	case "", EnvironmentProduction, EnvironmentSandbox:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown environment %q", ErrInvalidConfig, string(e))
+}
+
+// applyEnvironment defaults the base URL from Config.Environment and refuses
+// the production base URL in the sandbox, the usual cause of test records
+// landing in production.
+func (c *Config) applyEnvironment() error {
+	if err := c.Environment.Validate(); err != nil {
+		return err
+	}
+
+	if c.Environment == "" {
+		return nil
+	}
+
+	if c.ApiBaseUrl == "" {
+		c.ApiBaseUrl = c.Environment.BaseURL()
+	}
+
+	if c.Environment == EnvironmentSandbox && strings.TrimRight(c.ApiBaseUrl, "/") == ProductionBaseURL {
+		return fmt.Errorf("%w: %s environment configured with base URL %s",
+			ErrEnvironmentMismatch, c.Environment, c.ApiBaseUrl)
+	}
+	return nil
+}
+
+// validateSandboxRecord applies the stricter checks of the sandbox environment.
+func validateSandboxRecord(pr *PatientRecord) error {
+	if strings.TrimSpace(pr.Title) == "" {
+		return fmt.Errorf("patient record title is blank")
+	}
+
+	if pr.VisitTimestamp.After(time.Now()) {
+		return fmt.Errorf("patient record VisitTimestamp %s is in the future",
+			pr.VisitTimestamp.Format(time.RFC3339))
+	}
+	return nil
+}
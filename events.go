@@ -0,0 +1,378 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultEventBufferSize is the number of events buffered for each Events
+// subscriber when Config.EventBufferSize is zero.
+const DefaultEventBufferSize = 256
+
+// EventType identifies the kind of an Event.
+type EventType string
+
+const (
+	// A patient was subscribed with Subscribe. Event.Subscriber is set.
+	EventSubscriberCreated EventType = "subscriber.created"
+
+	// A payment was recorded with CreatePayment. Event.Payment is set.
+	EventPaymentRecorded EventType = "payment.recorded"
+
+	// A record was uploaded with SyncMedicalRecords, SyncMedicalRecordsBatch
+	// or SyncVisit (once the visit is committed). Event.Record is set.
+	EventRecordSynced EventType = "record.synced"
+)
+
+// Event is a notification published by the client on the channels
+// returned by Events. The model matching Type is set; it is shared with the
+// other subscribers and the caller of the SDK call, and must not be modified.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+
+	Subscriber *Subscriber `json:"subscriber,omitempty"`
+	Payment    *Payment    `json:"payment,omitempty"`
+
+	// The uploaded record with its ID, without the reports.
+	Record *PatientRecord `json:"record,omitempty"`
+}
+
+// OverflowPolicy decides what happens when a subscriber's event buffer is full.
+type OverflowPolicy int
+
+const (
+	// Publishers wait for the consumer to make room. The SDK call publishing
+	// the event blocks until then or until its context is done, in which
+	// case the event is dropped and logged. Nothing is lost while calls
+	// have no deadline, at the cost of slowing them down.
+	OverflowBlock OverflowPolicy = iota
+
+	// The oldest buffered event is discarded and logged to make room.
+	// Publishers never wait.
+	OverflowDropOldest
+
+	// Events that don't fit the buffer are appended to a temporary file in
+	// Config.EventSpillDir, which must be set, and delivered in order once the
+	// consumer catches up. Publishers never wait and events are only lost if
+	// the disk write fails. The file holds patient data, see EventSpillDir.
+	OverflowSpillToDisk
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowSpillToDisk:
+		return "spill-to-disk"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+}
+
+// Events subscribes to the events published by the client, e.g
+// EventSubscriberCreated. The channel is closed once ctx is done.
+//
+// Each call creates an independent subscription buffering up to
+// Config.EventBufferSize events. What happens when the consumer falls behind
+// is decided by Config.EventOverflow. Events published before the call or
+// after ctx is done are not delivered.
+func (c *DefaultEcloudClient) Events(ctx context.Context) <-chan Event {
+	config := c.cfg()
+	size := config.EventBufferSize
+	if size <= 0 {
+		size = DefaultEventBufferSize
+	}
+
+	sub := &eventSubscription{
+		size:     size,
+		policy:   config.EventOverflow,
+		spillDir: config.EventSpillDir,
+		logger:   c.logger,
+		out:      make(chan Event),
+		ready:    make(chan struct{}, 1),
+		space:    make(chan struct{}, 1),
+		done:     ctx.Done(),
+	}
+
+	c.events.add(sub)
+	go func() {
+		sub.deliver()
+		c.events.remove(sub)
+		sub.close()
+	}()
+	return sub.out
+}
+
+// publish sends the event to every subscriber. ctx bounds the wait of
+// subscribers using OverflowBlock.
+func (c *DefaultEcloudClient) publish(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	for _, sub := range c.events.subscribers() {
+		sub.publish(ctx, event)
+	}
+}
+
+// eventBus tracks the subscriptions created by Events.
+type eventBus struct {
+	mu   sync.Mutex
+	subs map[*eventSubscription]struct{}
+}
+
+func (b *eventBus) add(sub *eventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subs == nil {
+		b.subs = make(map[*eventSubscription]struct{})
+	}
+	b.subs[sub] = struct{}{}
+}
+
+func (b *eventBus) remove(sub *eventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, sub)
+}
+
+func (b *eventBus) subscribers() []*eventSubscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs := make([]*eventSubscription, 0, len(b.subs))
+	for sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// eventSubscription buffers the events of one Events call. Events are kept
+// in memory up to size, then handled according to policy. The deliver
+// goroutine moves them to out in publication order.
+type eventSubscription struct {
+	size     int
+	policy   OverflowPolicy
+	spillDir string
+	logger   Logger
+
+	out   chan Event
+	ready chan struct{} // Signalled when an event is queued.
+	space chan struct{} // Signalled when an event is taken from the queue.
+	done  <-chan struct{}
+
+	mu     sync.Mutex
+	queue  []Event
+	spill  *eventSpill // Events that overflowed the queue, newer than those in it.
+	closed bool
+}
+
+func (s *eventSubscription) publish(ctx context.Context, event Event) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+
+		queued, err := s.enqueue(event)
+		s.mu.Unlock()
+
+		if err != nil {
+			s.logger.Error("events: unable to spill %s event to disk, dropped: %v", event.Type, err)
+			return
+		}
+
+		if queued {
+			signal(s.ready)
+			return
+		}
+
+		// OverflowBlock with a full queue.
+		select {
+		case <-s.space:
+		case <-s.done:
+			return
+		case <-ctx.Done():
+			s.logger.Error("events: buffer full, dropped %s event: %v", event.Type, ctx.Err())
+			return
+		}
+	}
+}
+
+// enqueue adds the event to the queue or the spill file, reporting false
+// if the caller must wait for space. s.mu must be held.
+func (s *eventSubscription) enqueue(event Event) (bool, error) {
+	// Once spilling, newer events go to disk too, to keep the order.
+	if s.spill != nil && s.spill.len() > 0 {
+		return true, s.spill.push(event)
+	}
+
+	if len(s.queue) < s.size {
+		s.queue = append(s.queue, event)
+		return true, nil
+	}
+
+	switch s.policy {
+	case OverflowDropOldest:
+		s.logger.Error("events: buffer full, dropped oldest %s event", s.queue[0].Type)
+		s.queue = append(s.queue[1:], event)
+		return true, nil
+	case OverflowSpillToDisk:
+		if s.spill == nil {
+			spill, err := newEventSpill(s.spillDir)
+			if err != nil {
+				return false, err
+			}
+			s.spill = spill
+		}
+		return true, s.spill.push(event)
+	default:
+		return false, nil
+	}
+}
+
+// next takes the oldest buffered event.
+func (s *eventSubscription) next() (Event, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.queue) > 0 {
+		event := s.queue[0]
+		s.queue[0] = Event{}
+		s.queue = s.queue[1:]
+		signal(s.space)
+		return event, true
+	}
+
+	for s.spill != nil && s.spill.len() > 0 {
+		event, err := s.spill.pop()
+		if err != nil {
+			s.logger.Error("events: unable to read spilled event, dropped: %v", err)
+			continue
+		}
+		return event, true
+	}
+	return Event{}, false
+}
+
+func (s *eventSubscription) deliver() {
+	for {
+		event, ok := s.next()
+		if !ok {
+			select {
+			case <-s.ready:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+
+		select {
+		case s.out <- event:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *eventSubscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	s.queue = nil
+	if s.spill != nil {
+		s.spill.close()
+		s.spill = nil
+	}
+	close(s.out)
+}
+
+// signal wakes up a waiter of ch without blocking.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// eventSpill is a FIFO of JSON encoded events backed by a temporary file.
+// The file is truncated whenever it is drained and removed on close.
+type eventSpill struct {
+	file    *os.File
+	sizes   []int // Sizes of the events not read yet.
+	readAt  int64
+	writeAt int64
+}
+
+func newEventSpill(dir string) (*eventSpill, error) {
+	if dir == "" {
+		return nil, ErrEventSpillDirRequired
+	}
+
+	file, err := os.CreateTemp(dir, "ecloud-events-*.jsonl")
+	if err != nil {
+		return nil, err
+	}
+	return &eventSpill{file: file}, nil
+}
+
+func (s *eventSpill) len() int {
+	return len(s.sizes)
+}
+
+func (s *eventSpill) push(event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if _, err := s.file.WriteAt(data, s.writeAt); err != nil {
+		return err
+	}
+
+	s.writeAt += int64(len(data))
+	s.sizes = append(s.sizes, len(data))
+	return nil
+}
+
+func (s *eventSpill) pop() (Event, error) {
+	size := s.sizes[0]
+	s.sizes = s.sizes[1:]
+
+	data := make([]byte, size)
+	_, err := s.file.ReadAt(data, s.readAt)
+	s.readAt += int64(size)
+
+	if len(s.sizes) == 0 {
+		s.readAt, s.writeAt = 0, 0
+		if truncErr := s.file.Truncate(0); truncErr != nil && err == nil {
+			err = truncErr
+		}
+	}
+
+	if err != nil {
+		return Event{}, err
+	}
+
+	var event Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return Event{}, err
+	}
+	return event, nil
+}
+
+func (s *eventSpill) close() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
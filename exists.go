@@ -0,0 +1,62 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// SubscriberExists reports whether a subscriber exists, without fetching it.
+// Use it in batch jobs to skip work for unknown subscribers.
+func (c *DefaultEcloudClient) SubscriberExists(ctx context.Context, subscriberID uint) (bool, error) {
+	url := fmt.Sprintf("%s/api/subscriptions/%d", c.cfg().ApiBaseUrl, subscriberID)
+	exists, err := c.exists(ctx, url)
+	if err != nil {
+		return false, fmt.Errorf("unable to check subscriber: %w", err)
+	}
+	return exists, nil
+}
+
+// RecordExists reports whether a record was synced for an HMS visit of this
+// hospital, e.g to skip visits uploaded by a previous run. See ResolveVisit.
+func (c *DefaultEcloudClient) RecordExists(ctx context.Context, visitID uint) (bool, error) {
+	url := fmt.Sprintf("%s/api/records/visits/%s/%d", c.cfg().ApiBaseUrl, c.cfg().HospitalNumber, visitID)
+	exists, err := c.exists(ctx, url)
+	if err != nil {
+		return false, fmt.Errorf("unable to check record: %w", err)
+	}
+	return exists, nil
+}
+
+// exists checks a resource with a HEAD request, falling back to a GET on
+// deployments that don't support HEAD. An empty JSON list is a missing resource.
+func (c *DefaultEcloudClient) exists(ctx context.Context, url string) (bool, error) {
+	resp, err := c.performRequest(ctx, http.MethodHead, url, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented {
+		resp, err = c.performRequest(ctx, http.MethodGet, url, nil, nil)
+		if err != nil {
+			return false, err
+		}
+		defer resp.Body.Close()
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return false, err
+		}
+		body = bytes.TrimSpace(body)
+		return !bytes.Equal(body, []byte("[]")) && !bytes.Equal(body, []byte("null")), nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, c.decodeError(resp)
+}
@@ -0,0 +1,82 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ExtractionStatus is the state of a text extraction (OCR) job.
+type ExtractionStatus string
+
+const (
+	ExtractionPending    ExtractionStatus = "pending"
+	ExtractionProcessing ExtractionStatus = "processing"
+	ExtractionCompleted  ExtractionStatus = "completed"
+	ExtractionFailed     ExtractionStatus = "failed"
+)
+
+// Done reports whether the job has finished, successfully or not.
+func (s ExtractionStatus) Done() bool {
+	return s == ExtractionCompleted || s == ExtractionFailed
+}
+
+// ExtractedText is the text ecloud extracted from the reports of an uploaded record.
+// Text and Pages are only set once Status is ExtractionCompleted.
+type ExtractedText struct {
+	RecordID    uint             `json:"record_id"`
+	Status      ExtractionStatus `json:"status"`
+	Text        string           `json:"text"`                  // Full text, pages separated by form feeds.
+	Pages       []string         `json:"pages"`                 // Text of each page.
+	Language    string           `json:"language,omitempty"`    // Detected language e.g "en".
+	Error       string           `json:"error,omitempty"`       // Why the job failed.
+	RequestedAt time.Time        `json:"requested_at,omitzero"` // When extraction was requested.
+	CompletedAt time.Time        `json:"completed_at,omitzero"` // When the job finished.
+}
+
+// RequestTextExtraction asks ecloud to OCR the reports of an uploaded record.
+// Extraction runs asynchronously; poll GetExtractedText until the status is done.
+// Requesting extraction of a record that is already processed is a no-op.
+func (c *DefaultEcloudClient) RequestTextExtraction(ctx context.Context, recordID uint) (*ExtractedText, error) {
+	url := fmt.Sprintf("%s/api/records/%d/text", c.cfg().ApiBaseUrl, recordID)
+	resp, err := c.performRequest(ctx, http.MethodPost, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to request text extraction: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return nil, c.decodeResourceError(resp, ErrRecordNotFound)
+	}
+
+	extracted := &ExtractedText{}
+	err = json.NewDecoder(resp.Body).Decode(extracted)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return extracted, nil
+}
+
+// GetExtractedText returns the text extraction job of a record and,
+// once completed, the extracted text.
+func (c *DefaultEcloudClient) GetExtractedText(ctx context.Context, recordID uint) (*ExtractedText, error) {
+	url := fmt.Sprintf("%s/api/records/%d/text", c.cfg().ApiBaseUrl, recordID)
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch extracted text: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrRecordNotFound)
+	}
+
+	extracted := &ExtractedText{}
+	err = json.NewDecoder(resp.Body).Decode(extracted)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return extracted, nil
+}
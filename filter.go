@@ -0,0 +1,99 @@
+package ecloudsdk
+
+import (
+	neturl "net/url"
+	"strconv"
+	"time"
+)
+
+// SubscriberStatus is the lifecycle state of a subscription.
+type SubscriberStatus string
+
+const (
+	SubscriberPending SubscriberStatus = "pending" // Registered but not yet paid for.
+	SubscriberActive  SubscriberStatus = "active"  // Covered by a valid payment.
+	SubscriberExpired SubscriberStatus = "expired" // Coverage has lapsed.
+)
+
+// SubscriberFilter narrows down the subscribers returned by ListSubscribers and
+// WatchSubscribersMatching. Filters compose; a nil or empty filter matches all
+// subscribers of the hospital.
+//
+//	filter := ecloudsdk.NewSubscriberFilter().
+//		ByStatus(ecloudsdk.SubscriberActive).
+//		CreatedBetween(from, to).
+//		HasEmail(true)
+type SubscriberFilter struct {
+	statuses     []SubscriberStatus
+	createdFrom  time.Time
+	createdTo    time.Time
+	registeredBy string
+	hasEmail     *bool
+}
+
+// NewSubscriberFilter returns an empty filter.
+func NewSubscriberFilter() *SubscriberFilter {
+	return &SubscriberFilter{}
+}
+
+// ByStatus matches subscribers in any of the given statuses.
+func (f *SubscriberFilter) ByStatus(statuses ...SubscriberStatus) *SubscriberFilter {
+	f.statuses = append(f.statuses, statuses...)
+	return f
+}
+
+// CreatedBetween matches subscribers created in [from, to).
+// A zero from or to leaves that end of the range open.
+func (f *SubscriberFilter) CreatedBetween(from, to time.Time) *SubscriberFilter {
+	f.createdFrom = from
+	f.createdTo = to
+	return f
+}
+
+// RegisteredBy matches subscribers registered by the given user.
+func (f *SubscriberFilter) RegisteredBy(name string) *SubscriberFilter {
+	f.registeredBy = name
+	return f
+}
+
+// HasEmail matches subscribers with (true) or without (false) an email address.
+func (f *SubscriberFilter) HasEmail(hasEmail bool) *SubscriberFilter {
+	f.hasEmail = &hasEmail
+	return f
+}
+
+// Query encodes the filter as URL query parameters.
+func (f *SubscriberFilter) Query() neturl.Values {
+	query := neturl.Values{}
+	if f == nil {
+		return query
+	}
+
+	for _, status := range f.statuses {
+		query.Add("status", string(status))
+	}
+
+	if !f.createdFrom.IsZero() {
+		query.Set("created_from", f.createdFrom.Format(time.RFC3339))
+	}
+
+	if !f.createdTo.IsZero() {
+		query.Set("created_to", f.createdTo.Format(time.RFC3339))
+	}
+
+	if f.registeredBy != "" {
+		query.Set("registered_by", f.registeredBy)
+	}
+
+	if f.hasEmail != nil {
+		query.Set("has_email", strconv.FormatBool(*f.hasEmail))
+	}
+	return query
+}
+
+// subscribersURL builds the URL listing the hospital subscribers matching filter.
+func (c *DefaultEcloudClient) subscribersURL(filter *SubscriberFilter) string {
+	query := filter.Query()
+	query.Set("hospital_number", c.cfg().HospitalNumber.String())
+	return c.cfg().ApiBaseUrl + "/api/subscriptions?" + query.Encode()
+}
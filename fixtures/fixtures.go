@@ -0,0 +1,77 @@
+// Package fixtures builds valid subscribers, payments and records for the
+// tests of applications using the SDK, e.g with a mocked HTTPClient:
+//
+//	record := fixtures.NewTestPatientRecord(subscriber.ID)
+//	record.Title = "Malaria test"
+//	err := client.SyncMedicalRecords(ctx, record)
+//
+// Fixtures are new values on each call, so tests can modify them freely.
+package fixtures
+
+import (
+	"time"
+
+	ecloudsdk "github.com/abiiranathan/ecloud-sdk"
+)
+
+// HospitalNumber is the hospital of the fixtures.
+const HospitalNumber ecloudsdk.HospitalNumber = "HOS-123"
+
+// Date is the creation time of the fixtures, fixed so that tests are repeatable.
+var Date = time.Date(2024, time.January, 15, 9, 30, 0, 0, time.UTC)
+
+// minimalPDF is a one-page PDF with a valid cross-reference table.
+const minimalPDF = "%PDF-1.7\n" +
+	"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+	"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+	"3 0 obj << /Type /Page /MediaBox [0 0 612 792] >> endobj\n" +
+	"xref\n0 4\n0000000000 65535 f \n0000000009 00000 n \n0000000058 00000 n \n0000000115 00000 n \n" +
+	"trailer << /Size 4 /Root 1 0 R >>\n" +
+	"startxref\n172\n" +
+	"%%EOF"
+
+// MinimalPDF returns a one-page PDF that passes the SDK's report validation.
+func MinimalPDF() []byte {
+	return []byte(minimalPDF)
+}
+
+// NewTestSubscriber returns a subscriber of HospitalNumber, as returned by Subscribe.
+func NewTestSubscriber() *ecloudsdk.Subscriber {
+	return &ecloudsdk.Subscriber{
+		ID:             101,
+		EclinicID:      "EC000101",
+		PatientID:      1001,
+		PatientName:    "Jane Doe",
+		Email:          "jane.doe@example.com",
+		HospitalNumber: HospitalNumber,
+		HospitalName:   "Test Hospital",
+		RegisteredBy:   "reception",
+		CreatedAt:      Date,
+	}
+}
+
+// NewTestPayment returns a payment of the subscriber valid for a year, as
+// returned by CreatePayment.
+func NewTestPayment(subscriberID uint) *ecloudsdk.Payment {
+	return &ecloudsdk.Payment{
+		ID:           1,
+		SubscriberID: subscriberID,
+		Amount:       50000,
+		CreatedAt:    Date,
+		ValidTo:      Date.AddDate(1, 0, 0),
+		RegisteredBy: "finance",
+	}
+}
+
+// NewTestPatientRecord returns a record of the subscriber with a medical and
+// a lab report, ready for SyncMedicalRecords.
+func NewTestPatientRecord(subscriberID uint) *ecloudsdk.PatientRecord {
+	return &ecloudsdk.PatientRecord{
+		VisitID:        1,
+		SubscriberID:   subscriberID,
+		VisitTimestamp: Date,
+		Title:          "General checkup",
+		MedicalReport:  MinimalPDF(),
+		LabReport:      MinimalPDF(),
+	}
+}
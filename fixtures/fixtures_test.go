@@ -0,0 +1,40 @@
+package fixtures
+
+import (
+	"testing"
+
+	"github.com/abiiranathan/ecloud-sdk/pdf"
+)
+
+func TestMinimalPDF(t *testing.T) {
+	info, err := pdf.Validate(MinimalPDF(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Pages != 1 {
+		t.Errorf("expected 1 page, got %d", info.Pages)
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	subscriber := NewTestSubscriber()
+	if err := subscriber.HospitalNumber.Validate(); err != nil {
+		t.Errorf("invalid hospital number: %v", err)
+	}
+
+	payment := NewTestPayment(subscriber.ID)
+	if payment.SubscriberID != subscriber.ID || !payment.ValidTo.After(payment.CreatedAt) {
+		t.Errorf("unexpected payment %+v", payment)
+	}
+
+	record := NewTestPatientRecord(subscriber.ID)
+	if err := record.Validate(); err != nil {
+		t.Errorf("invalid record: %v", err)
+	}
+
+	// Fixtures don't share their reports.
+	record.LabReport[0] = 'x'
+	if NewTestPatientRecord(subscriber.ID).LabReport[0] != '%' || record.MedicalReport[0] != '%' {
+		t.Error("expected each fixture to have its own reports")
+	}
+}
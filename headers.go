@@ -0,0 +1,34 @@
+package ecloudsdk
+
+import (
+	"context"
+	"maps"
+	"net/http"
+)
+
+type headersKey struct{}
+
+// WithHeader returns a context that adds the header to every ecloud request
+// made with it, so values like tenant IDs or trace baggage set high in the
+// call stack reach outgoing requests without changing method signatures.
+// Headers set by the SDK itself (e.g Authorization, Content-Type) take precedence.
+func WithHeader(ctx context.Context, key, value string) context.Context {
+	headers := http.Header{}
+	if parent, ok := ctx.Value(headersKey{}).(http.Header); ok {
+		headers = parent.Clone()
+	}
+	headers.Set(key, value)
+	return context.WithValue(ctx, headersKey{}, headers)
+}
+
+// HeadersFrom returns a copy of the headers added to ctx with WithHeader.
+func HeadersFrom(ctx context.Context) http.Header {
+	headers, _ := ctx.Value(headersKey{}).(http.Header)
+	return headers.Clone()
+}
+
+// applyContextHeaders sets the headers added with WithHeader on req.
+func applyContextHeaders(ctx context.Context, req *http.Request) {
+	headers, _ := ctx.Value(headersKey{}).(http.Header)
+	maps.Copy(req.Header, headers.Clone())
+}
@@ -0,0 +1,60 @@
+package ecloudsdk
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// HospitalNumber is the globally unique identifier of a hospital, in the
+// panel format REGION-NUMBER e.g "HOS-123" or "KLA-4521".
+// The region is 2 to 5 uppercase letters and the number is 1 to 8 digits.
+type HospitalNumber string
+
+var hospitalNumberPattern = regexp.MustCompile(`^([A-Z]{2,5})-(\d{1,8})$`)
+
+// ParseHospitalNumber normalizes s (trimming spaces and upper-casing the region)
+// and validates it.
+func ParseHospitalNumber(s string) (HospitalNumber, error) {
+	hn := HospitalNumber(strings.ToUpper(strings.TrimSpace(s)))
+	if err := hn.Validate(); err != nil {
+		return "", err
+	}
+	return hn, nil
+}
+
+// MustParseHospitalNumber is like ParseHospitalNumber but panics if s is invalid.
+// It is intended for constants and tests.
+func MustParseHospitalNumber(s string) HospitalNumber {
+	hn, err := ParseHospitalNumber(s)
+	if err != nil {
+		panic(err)
+	}
+	return hn
+}
+
+// Validate reports whether the hospital number follows the panel format.
+func (hn HospitalNumber) Validate() error {
+	if hn == "" {
+		return ErrHospitalNumberRequired
+	}
+
+	if !hospitalNumberPattern.MatchString(string(hn)) {
+		return fmt.Errorf("%w: %q", ErrInvalidHospitalNumber, string(hn))
+	}
+	return nil
+}
+
+// Region returns the region prefix of the hospital number e.g "HOS" for "HOS-123".
+// It returns an empty string if the hospital number is invalid.
+func (hn HospitalNumber) Region() string {
+	match := hospitalNumberPattern.FindStringSubmatch(string(hn))
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+func (hn HospitalNumber) String() string {
+	return string(hn)
+}
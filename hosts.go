@@ -0,0 +1,45 @@
+package ecloudsdk
+
+import (
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strings"
+)
+
+// hostAllowed reports whether u is on one of the allowed hosts. Entries
+// without a port match any port of the host; nil allows every host.
+func hostAllowed(allowed []string, u *neturl.URL) bool {
+	if allowed == nil {
+		return true
+	}
+
+	for _, host := range allowed {
+		if _, _, err := net.SplitHostPort(host); err == nil {
+			if strings.EqualFold(host, u.Host) {
+				return true
+			}
+		} else if strings.EqualFold(strings.Trim(host, "[]"), u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHost fails with ErrHostNotAllowed if rawURL is not on one of the
+// allowed hosts.
+func checkHost(allowed []string, rawURL string) error {
+	if allowed == nil {
+		return nil
+	}
+
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: invalid URL: %w", ErrHostNotAllowed, err)
+	}
+
+	if u.Host == "" || !hostAllowed(allowed, u) {
+		return fmt.Errorf("%w: %q", ErrHostNotAllowed, u.Host)
+	}
+	return nil
+}
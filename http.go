@@ -2,29 +2,110 @@ package ecloudsdk
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"time"
+	"net/http/httptrace"
+	"sync/atomic"
 )
 
+// newHTTPClient builds the http.Client used when Config.HTTPClient is not provided.
+func newHTTPClient(config *Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig(config)
+	transport.HTTP2 = heartbeatConfig(config)
+
+	dialer := newDialer(config)
+	if config.Resolver != nil {
+		transport.DialContext = resolvingDialContext(config.Resolver, dialer)
+	} else {
+		transport.DialContext = dialer.DialContext
+	}
+
+	return &http.Client{
+		Timeout:       config.Timeout,
+		Transport:     transport,
+		CheckRedirect: checkRedirect(config),
+	}
+}
+
+// loginRequestKey marks the context of login requests.
+type loginRequestKey struct{}
+
+// performRequest sends a request with authentication, retries, bandwidth accounting
+// and tracing. Before each attempt the body is recreated or rewound, see bodyFactory.
+// Bodies that cannot be replayed are sent once.
 func (c *DefaultEcloudClient) performRequest(ctx context.Context, method, url string,
 	body io.Reader, headers map[string]string) (*http.Response, error) {
 	var lastErr error
 	var lastResp *http.Response
-	var maxRetries = c.retryPolicy.MaxRetries()
+	httpClient, retryPolicy := c.transport()
+	url = c.routeRead(method, url)
+	if err := checkHost(c.cfg().AllowedHosts, url); err != nil {
+		return nil, err
+	}
+	retryPolicy = c.retryPolicyFor(url, retryPolicy)
+	var maxRetries = retryPolicy.MaxRetries()
+
+	// Login requests are retried by Login itself.
+	isLogin, _ := ctx.Value(loginRequestKey{}).(bool)
+	if isLogin {
+		maxRetries = 0
+	}
+
+	decoders := c.contentDecoders()
+	span := spanFrom(ctx)
+
+	if err := c.checkBandwidth(ctx); err != nil {
+		return nil, err
+	}
+
+	newBody, replayable, err := bodyFactory(body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to rewind request body: %w", err)
+	}
+
+	// Set once a gzip response could not be decoded, see below.
+	identity := false
 
 	for attempt := 0; attempt <= maxRetries; attempt++ {
-		// Create new request for each attempt
-		req, err := http.NewRequestWithContext(ctx, method, url, body)
+		attemptBody, err := newBody()
+		if errors.Is(err, errBodyNotReplayable) && attempt > 0 {
+			break // Report the outcome of the previous attempt.
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Create new request for each attempt, from the body itself so that
+		// ContentLength and GetBody are set for in-memory bodies.
+		req, err := http.NewRequestWithContext(withAttempt(ctx, attempt), method, url, attemptBody)
 		if err != nil {
 			return nil, err
 		}
 
+		// Account for the bytes sent and received against the bandwidth budget.
+		// The body is wrapped after the request is built, keeping its length.
+		var sent atomic.Int64
+		count := func(n int64) {
+			c.bandwidth.addSent(n)
+			sent.Add(n)
+		}
+		countBody(req, count)
+
+		// Headers from the context come first so the SDK's own headers win.
+		applyContextHeaders(ctx, req)
+
 		// Add authentication header if available
-		if c.jwtToken != "" {
-			req.Header.Set("Authorization", "Bearer "+c.jwtToken)
+		token, authenticated := c.authState()
+		if authenticated && !isLogin {
+			token = c.refreshExpiringToken(ctx, token)
+		}
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
 		}
 
 		// Add custom headers first
@@ -34,6 +115,8 @@ func (c *DefaultEcloudClient) performRequest(ctx context.Context, method, url st
 			}
 		}
 
+		span.propagate(req)
+
 		// Set default headers if not provided
 		if req.Header.Get("Content-Type") == "" {
 			req.Header.Set("Content-Type", "application/json")
@@ -43,33 +126,130 @@ func (c *DefaultEcloudClient) performRequest(ctx context.Context, method, url st
 			req.Header.Set("Accept", "application/json")
 		}
 
+		// Compressed responses are decoded below, for any HTTPClient.
+		if identity {
+			req.Header.Set("Accept-Encoding", "identity")
+		} else if req.Header.Get("Accept-Encoding") == "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding(decoders))
+		}
+
+		c.dumpRequest(req, attemptBody)
+
 		// Execute request
-		resp, err := c.httpClient.Do(req)
+		traceCtx := req.Context()
+		if c.cfg().ClientTrace != nil {
+			traceCtx = httptrace.WithClientTrace(traceCtx, c.cfg().ClientTrace)
+		}
+
+		// Composed with the user trace above, so both receive the callbacks.
+		timer := newRequestTimer(req, attempt)
+		req = req.WithContext(httptrace.WithClientTrace(traceCtx, timer.trace()))
+
+		// An open circuit fails fast, without further retries.
+		var breakerDone func(*http.Response, error)
+		if breaker := c.cfg().CircuitBreaker; breaker != nil {
+			breakerDone, err = breaker.Allow(req)
+			if err != nil {
+				c.observeRequest(req, attempt, RequestTiming{}, 0, nil, err)
+				c.journalRequest(req, attempt, RequestTiming{}, nil, err)
+				if _, ok := body.(*retryableBody); ok {
+					if closer, ok := attemptBody.(io.Closer); ok {
+						closer.Close()
+					}
+				}
+				return nil, err
+			}
+		}
+
+		resp, err := httpClient.Do(req)
+		if breakerDone != nil {
+			breakerDone(resp, err)
+		}
+		span.recordAttempt(req, attempt, sent.Load(), resp)
+
+		// Bodies from a BodyFactory (e.g pipes) are released after each attempt.
+		if _, ok := body.(*retryableBody); ok {
+			if closer, ok := attemptBody.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+
+		timing := timer.finish()
+		c.checkSlowCall(req.URL.Path, timing)
+		if handler := c.cfg().TimingHandler; handler != nil {
+			safeCall(c.logger, "TimingHandler", func() { handler(timing) })
+		}
+		c.observeRequest(req, attempt, timing, sent.Load(), resp, err)
+		c.journalRequest(req, attempt, timing, resp, err)
+
 		if err != nil {
+			// A rejected redirect would be rejected again, and its 3xx response is closed.
+			if errors.Is(err, ErrRedirectRejected) {
+				return nil, err
+			}
+
 			lastErr = err
 			lastResp = resp
 
-			if !c.retryPolicy.ShouldRetry(attempt, err, resp) {
+			if !replayable || !retryPolicy.ShouldRetry(attempt, err, resp) {
 				break
 			}
 
 			c.logger.Debug("request failed, retrying: %v", err)
-			time.Sleep(c.retryPolicy.BackoffDuration(attempt))
+			if !backoff(ctx, retryPolicy, attempt, nil) {
+				break
+			}
 			continue
 		}
 
+		c.checkDeprecation(req, resp)
+
+		// Count the bytes on the wire, before decompression.
+		resp.Body = &countingReadCloser{
+			countingReader: countingReader{r: resp.Body, count: c.bandwidth.addReceived},
+			Closer:         resp.Body,
+		}
+		encoding := decodeBody(resp, decoders)
+
+		// Flaky proxies sometimes truncate gzip bodies. JSON responses are small,
+		// so they are decoded here and requested once more uncompressed on failure.
+		if encoding == "gzip" && req.Header.Get("Accept") == "application/json" {
+			if err := bufferBody(resp); err != nil {
+				if !replayable || identity {
+					return nil, fmt.Errorf("unable to decode gzip response: %w", err)
+				}
+
+				logWarn(c.logger, "undecodable gzip response to %s %s, retrying uncompressed: %v\n",
+					req.Method, req.URL.Path, err)
+				identity = true
+				attempt-- // Not a retry of a failed request.
+				continue
+			}
+		}
+		c.dumpResponse(req, resp)
+
 		// Handle authentication errors with token refresh
-		if resp.StatusCode == http.StatusUnauthorized && c.authenticated {
+		if resp.StatusCode == http.StatusUnauthorized && authenticated && !isLogin {
 			c.logger.Debug("received 401, attempting token refresh")
-			if refreshErr := c.Refresh(ctx); refreshErr != nil {
+			if refreshErr := c.refreshStaleToken(ctx, token); refreshErr != nil {
 				c.logger.Error("token refresh failed: %v", refreshErr)
 				return resp, nil // Return the 401 response
 			}
 
 			// Retry with new token if we should retry
-			if c.retryPolicy.ShouldRetry(attempt, nil, resp) {
+			if replayable && retryPolicy.ShouldRetry(attempt, nil, resp) && backoff(ctx, retryPolicy, attempt, nil) {
 				resp.Body.Close() // Close previous response body
-				time.Sleep(c.retryPolicy.BackoffDuration(attempt))
+				continue
+			}
+			return resp, nil
+		}
+
+		// Retry throttled and failed responses, honoring Retry-After.
+		if resp.StatusCode >= http.StatusTooManyRequests && replayable && attempt < maxRetries &&
+			retryPolicy.ShouldRetry(attempt, nil, resp) {
+			c.logger.Debug("received %d, retrying", resp.StatusCode)
+			if backoff(ctx, retryPolicy, attempt, resp) {
+				resp.Body.Close()
 				continue
 			}
 		}
@@ -85,26 +265,15 @@ func (c *DefaultEcloudClient) performRequest(ctx context.Context, method, url st
 	return nil, lastErr
 }
 
-// JSONRespError encodes the response body returned by the API when there is an error.
-type JSONRespError struct {
-	Error string `json:"error"`
-}
-
-func (c *DefaultEcloudClient) decodeError(resp *http.Response) error {
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("statusCode=%d: failed to read response body: %w", resp.StatusCode, err)
-	}
-
-	var jsonErr JSONRespError
-	if err := json.Unmarshal(body, &jsonErr); err == nil && jsonErr.Error != "" {
-		return fmt.Errorf("statusCode=%d remote error: %s", resp.StatusCode, jsonErr.Error)
-	}
-
-	// fallback: plain text or unknown structure
-	if len(body) == 0 {
-		return fmt.Errorf("statusCode=%d remote error: empty response body", resp.StatusCode)
-	}
-
-	return fmt.Errorf("statusCode=%d remote error: %s", resp.StatusCode, string(body))
+// Do sends a custom request to the ecloud API through the client's pipeline:
+// authentication, token refresh, retries, bandwidth accounting, tracing and
+// response decompression. path is relative to Config.ApiBaseUrl e.g "/api/custom".
+//
+// To keep retries safe, io.Seeker bodies (e.g *bytes.Reader, *os.File) are rewound
+// before each attempt and bodies created with NewRetryableBody are recreated.
+// Other bodies are sent once and the request is not retried.
+// The caller must close the response body.
+func (c *DefaultEcloudClient) Do(ctx context.Context, method, path string, body io.Reader,
+	headers map[string]string) (*http.Response, error) {
+	return c.performRequest(ctx, method, c.cfg().ApiBaseUrl+path, body, headers)
 }
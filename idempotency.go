@@ -0,0 +1,36 @@
+package ecloudsdk
+
+import (
+	"context"
+	"crypto/rand"
+)
+
+// IdempotencyKeyHeader is the header carrying the idempotency key of a request.
+// The server performs an operation once per key and replays the original
+// response for retries, so a retried POST cannot double-charge or double-subscribe.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey sets the idempotency key used by Subscribe, CreatePayment and
+// RefundPayment calls made with the returned context. Supply your own key (e.g derived from the
+// HMS receipt number) to make an operation idempotent across process restarts;
+// by default a random key is generated per call.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// IdempotencyKeyFrom returns the idempotency key set with WithIdempotencyKey.
+func IdempotencyKeyFrom(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKey{}).(string)
+	return key, ok && key != ""
+}
+
+// idempotencyKeyFor returns the caller's key or a new random key for one logical operation.
+// The key is sent with every retry attempt of the operation.
+func idempotencyKeyFor(ctx context.Context) string {
+	if key, ok := IdempotencyKeyFrom(ctx); ok {
+		return key
+	}
+	return rand.Text()
+}
@@ -0,0 +1,135 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// InboundUploadStatus is the review state of a document uploaded by a patient.
+type InboundUploadStatus string
+
+const (
+	InboundUploadPending  InboundUploadStatus = "pending"  // Awaiting review by the clinic.
+	InboundUploadAccepted InboundUploadStatus = "accepted" // Attached to a visit as a record.
+	InboundUploadRejected InboundUploadStatus = "rejected" // Declined by the clinic.
+)
+
+// InboundUpload is a prior record uploaded by a patient through the portal,
+// which the clinic reviews and accepts into a visit or rejects.
+type InboundUpload struct {
+	ID           uint                `json:"id"`
+	SubscriberID uint                `json:"subscriber_id"`
+	Title        string              `json:"title"`        // Description given by the patient.
+	Filename     string              `json:"filename"`     // Name of the uploaded file.
+	ContentType  string              `json:"content_type"` // MIME type e.g application/pdf.
+	Size         int64               `json:"size"`         // Size of the file in bytes.
+	Status       InboundUploadStatus `json:"status"`
+	UploadedAt   time.Time           `json:"uploaded_at"`
+
+	VisitID         uint       `json:"visit_id,omitempty"`         // Visit the upload was accepted into.
+	RecordID        uint       `json:"record_id,omitempty"`        // Record created on acceptance.
+	RejectionReason string     `json:"rejection_reason,omitempty"` // Reason given on rejection.
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// ListInboundPatientUploads returns the documents uploaded by the hospital's
+// patients that await review, oldest first.
+func (c *DefaultEcloudClient) ListInboundPatientUploads(ctx context.Context) ([]*InboundUpload, error) {
+	query := neturl.Values{}
+	query.Set("hospital_number", c.cfg().HospitalNumber.String())
+	query.Set("status", string(InboundUploadPending))
+
+	url := c.cfg().ApiBaseUrl + "/api/inbound-uploads?" + query.Encode()
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch inbound uploads: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	var uploads []*InboundUpload
+	err = json.NewDecoder(resp.Body).Decode(&uploads)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return uploads, nil
+}
+
+// DownloadInboundUpload streams the file of an inbound upload to w for
+// review and returns the number of bytes written.
+// Fails with ErrInboundUploadNotFound if there is no such upload.
+func (c *DefaultEcloudClient) DownloadInboundUpload(ctx context.Context, uploadID uint, w io.Writer) (int64, error) {
+	url := fmt.Sprintf("%s/api/inbound-uploads/%d/file", c.cfg().ApiBaseUrl, uploadID)
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return 0, fmt.Errorf("unable to download inbound upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, c.decodeResourceError(resp, ErrInboundUploadNotFound)
+	}
+
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return n, fmt.Errorf("unable to download inbound upload: %w", err)
+	}
+	return n, nil
+}
+
+// AcceptInboundUpload attaches an inbound upload to an HMS visit, creating a
+// record of the patient. Fails with ErrInboundUploadNotFound if there is no
+// such upload, and with ErrConflict if it was already reviewed.
+func (c *DefaultEcloudClient) AcceptInboundUpload(ctx context.Context, uploadID, visitID uint) (*InboundUpload, error) {
+	if visitID == 0 {
+		return nil, fmt.Errorf("visit ID must not be zero")
+	}
+	return c.reviewInboundUpload(ctx, uploadID, "accept", map[string]any{"visit_id": visitID})
+}
+
+// RejectInboundUpload declines an inbound upload; the reason is shown to the
+// patient. Fails with ErrInboundUploadNotFound if there is no such upload,
+// and with ErrConflict if it was already reviewed.
+func (c *DefaultEcloudClient) RejectInboundUpload(ctx context.Context, uploadID uint, reason string) (*InboundUpload, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, fmt.Errorf("rejection reason must not be empty")
+	}
+	return c.reviewInboundUpload(ctx, uploadID, "reject", map[string]any{"reason": reason})
+}
+
+func (c *DefaultEcloudClient) reviewInboundUpload(ctx context.Context, uploadID uint, action string,
+	body map[string]any) (*InboundUpload, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/inbound-uploads/%d/%s", c.cfg().ApiBaseUrl, uploadID, action)
+	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to %s inbound upload: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrInboundUploadNotFound)
+	}
+
+	upload := &InboundUpload{}
+	err = json.NewDecoder(resp.Body).Decode(upload)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return upload, nil
+}
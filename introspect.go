@@ -0,0 +1,54 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// TokenInfo is the server's view of the client's token.
+type TokenInfo struct {
+	Active    bool      `json:"active"`               // False if the token expired or was revoked.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`  // Zero if the server didn't report it.
+	EclinicID string    `json:"eclinic_id,omitempty"` // Account the token belongs to.
+}
+
+// ValidateToken asks the server whether the current token is still accepted,
+// without refreshing it. A token the server rejects is reported as inactive
+// rather than as an error; errors mean the token couldn't be checked.
+// Fails with ErrNotAuthenticated if the client has no token.
+//
+// Login calls it when resuming a session from Config.TokenStore, so a revoked
+// token is replaced before the first real operation instead of failing it with a 401.
+func (c *DefaultEcloudClient) ValidateToken(ctx context.Context) (*TokenInfo, error) {
+	if token, _ := c.authState(); token == "" {
+		return nil, ErrNotAuthenticated
+	}
+
+	// Like login, introspection must never trigger a token refresh.
+	ctx = context.WithValue(ctx, loginRequestKey{}, true)
+
+	url := c.cfg().ApiBaseUrl + "/api/auth/introspect"
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to validate token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return &TokenInfo{}, nil
+	default:
+		return nil, c.decodeError(resp)
+	}
+
+	info := &TokenInfo{}
+	err = json.NewDecoder(resp.Body).Decode(info)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return info, nil
+}
@@ -0,0 +1,284 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultJournalSegmentSize is the size at which journal segments are
+// sealed when Config.JournalSegmentSize is zero.
+const DefaultJournalSegmentSize = 1 << 20
+
+// Headers of journal segment uploads.
+const (
+	JournalSegmentHeader  = "X-Journal-Segment"  // Segment file name.
+	JournalSHA256Header   = "X-Content-SHA256"   // Hex SHA-256 of the uncompressed segment.
+	JournalChainHeader    = "X-Journal-Chain"    // Hex SHA-256 of the previous chain hash and the segment hash.
+	JournalPreviousHeader = "X-Journal-Previous" // Chain hash of the previous segment, empty for the first.
+)
+
+// JournalEntry is a line of the request journal, recorded for every HTTP
+// attempt when Config.JournalDir is set. Bodies and query strings are not
+// recorded.
+type JournalEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	StatusCode int       `json:"status_code,omitempty"` // Zero if no response was received.
+	Attempt    int       `json:"attempt,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	ErrorClass string    `json:"error_class,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"` // Server request ID (X-Request-Id).
+}
+
+// journal appends entries to segment files in a directory. Segments other
+// than the active one are sealed and wait in the directory for ShipJournal.
+type journal struct {
+	mu      sync.Mutex
+	dir     string
+	file    *os.File // Active segment, nil until the first entry.
+	size    int64
+	lastSeq int64
+
+	// Serializes ShipJournal calls.
+	shipMu sync.Mutex
+}
+
+// journalUploadKey marks the context of journal uploads, which are not journaled.
+type journalUploadKey struct{}
+
+// journalRequest appends an attempt to the journal, if Config.JournalDir is set.
+// Failures are logged and never fail the request.
+func (c *DefaultEcloudClient) journalRequest(req *http.Request, attempt int, timing RequestTiming,
+	resp *http.Response, err error) {
+	dir := c.cfg().JournalDir
+	if dir == "" || req.Context().Value(journalUploadKey{}) != nil {
+		return
+	}
+
+	entry := JournalEntry{
+		Time:       time.Now().UTC(),
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		Attempt:    attempt,
+		DurationMS: timing.Total.Milliseconds(),
+		ErrorClass: errorClass(req.Context(), resp, err),
+	}
+	if resp != nil {
+		entry.StatusCode = resp.StatusCode
+		entry.RequestID = resp.Header.Get("X-Request-Id")
+	}
+
+	if err := c.journal.append(dir, c.cfg().JournalSegmentSize, entry); err != nil {
+		c.logger.Error("unable to write request journal: %v\n", err)
+	}
+}
+
+func (j *journal) append(dir string, maxSize int64, entry JournalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if maxSize <= 0 {
+		maxSize = DefaultJournalSegmentSize
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// The directory may change with UpdateConfig.
+	if j.file != nil && (j.dir != dir || j.size+int64(len(line)) > maxSize) {
+		j.sealLocked()
+	}
+
+	if j.file == nil {
+		if err := j.openLocked(dir); err != nil {
+			return err
+		}
+	}
+
+	n, err := j.file.Write(line)
+	j.size += int64(n)
+	return err
+}
+
+// openLocked starts a new segment. Segments are named after an increasing
+// sequence so they sort in the order they were written.
+func (j *journal) openLocked(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	seq := max(time.Now().UnixNano(), j.lastSeq+1)
+	file, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("journal-%020d.jsonl", seq)),
+		os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	j.dir, j.file, j.size, j.lastSeq = dir, file, 0, seq
+	return nil
+}
+
+// sealLocked closes the active segment so it can be shipped.
+func (j *journal) sealLocked() {
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+}
+
+// sealed seals the active segment of dir and returns the segments waiting to be shipped, oldest first.
+func (j *journal) sealed(dir string) ([]string, error) {
+	j.mu.Lock()
+	if j.dir == dir {
+		j.sealLocked()
+	}
+	j.mu.Unlock()
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "journal-") && strings.HasSuffix(name, ".jsonl") {
+			segments = append(segments, name)
+		}
+	}
+	slices.Sort(segments)
+	return segments, nil
+}
+
+// ShipJournal uploads the sealed segments of the request journal to ecloud's
+// audit endpoint, oldest first, and deletes them once accepted. The active
+// segment is sealed first, so everything journaled before the call is shipped.
+//
+// Segments are gzip compressed and sent with their SHA-256 and a hash chain
+// linking each segment to the previous one, so ecloud can detect altered,
+// missing or reordered segments. The chain survives restarts in the
+// journal.chain file of Config.JournalDir.
+func (c *DefaultEcloudClient) ShipJournal(ctx context.Context) error {
+	dir := c.cfg().JournalDir
+	if dir == "" {
+		return fmt.Errorf("shipping the journal requires Config.JournalDir")
+	}
+
+	c.journal.shipMu.Lock()
+	defer c.journal.shipMu.Unlock()
+
+	segments, err := c.journal.sealed(dir)
+	if err != nil {
+		return fmt.Errorf("unable to list journal segments: %w", err)
+	}
+
+	chainPath := filepath.Join(dir, "journal.chain")
+	previous, err := os.ReadFile(chainPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("unable to read journal chain: %w", err)
+	}
+
+	ctx = context.WithValue(WithBackgroundPriority(ctx), journalUploadKey{}, true)
+	for _, segment := range segments {
+		chain, err := c.shipSegment(ctx, filepath.Join(dir, segment), string(bytes.TrimSpace(previous)))
+		if err != nil {
+			return fmt.Errorf("unable to ship journal segment %s: %w", segment, err)
+		}
+
+		// Persist the chain before deleting the segment: after a crash in
+		// between, the segment is shipped again and ecloud sees a duplicate
+		// SHA-256 rather than a broken chain.
+		if err := os.WriteFile(chainPath, []byte(chain), 0o600); err != nil {
+			return fmt.Errorf("unable to write journal chain: %w", err)
+		}
+		if err := os.Remove(filepath.Join(dir, segment)); err != nil {
+			return fmt.Errorf("unable to remove shipped journal segment: %w", err)
+		}
+		previous = []byte(chain)
+	}
+	return nil
+}
+
+// shipSegment uploads a segment and returns its chain hash.
+func (c *DefaultEcloudClient) shipSegment(ctx context.Context, path, previous string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	segmentHash := hex.EncodeToString(sum[:])
+	chainSum := sha256.Sum256([]byte(previous + segmentHash))
+	chain := hex.EncodeToString(chainSum[:])
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+
+	headers := map[string]string{
+		"Content-Type":        "application/x-ndjson",
+		"Content-Encoding":    "gzip",
+		JournalSegmentHeader:  filepath.Base(path),
+		JournalSHA256Header:   segmentHash,
+		JournalChainHeader:    chain,
+		JournalPreviousHeader: previous,
+		"X-Hospital-Number":   c.cfg().HospitalNumber.String(),
+	}
+
+	url := c.cfg().ApiBaseUrl + "/api/audit/journal"
+	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(compressed.Bytes()), headers)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return chain, nil
+	}
+	return "", c.decodeError(resp)
+}
+
+// RunJournalShipper calls ShipJournal every interval until ctx is done.
+// Failed shipments are logged and retried at the next tick.
+func (c *DefaultEcloudClient) RunJournalShipper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.ShipJournal(ctx); err != nil && ctx.Err() == nil {
+				c.logger.Error("%v\n", err)
+			}
+		}
+	}
+}
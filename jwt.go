@@ -0,0 +1,75 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// defaultTokenRefreshMargin is used when Config.TokenRefreshMargin is zero.
+const defaultTokenRefreshMargin = time.Minute
+
+// parseTokenExpiry reads the exp claim of a JWT without verifying its signature.
+// It reports false if the token is not a JWT or has no exp claim.
+func parseTokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var claims struct {
+		Exp json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == "" {
+		return time.Time{}, false
+	}
+
+	exp, err := claims.Exp.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
+
+// TokenExpiresAt returns the expiry time of the current token,
+// or the zero time if unknown (not authenticated or the token has no exp claim).
+func (c *DefaultEcloudClient) TokenExpiresAt() time.Time {
+	c.authMu.RLock()
+	defer c.authMu.RUnlock()
+	return c.tokenExpiresAt
+}
+
+// tokenRefreshMargin returns how long before expiry the token is refreshed,
+// or a negative duration if proactive refresh is disabled.
+func (c *DefaultEcloudClient) tokenRefreshMargin() time.Duration {
+	margin := c.cfg().TokenRefreshMargin
+	if margin == 0 {
+		return defaultTokenRefreshMargin
+	}
+	return margin
+}
+
+// refreshExpiringToken refreshes the token if it expires within the refresh margin,
+// saving the round trip of a request rejected with 401.
+// A failed refresh is logged and the request proceeds with the current token.
+func (c *DefaultEcloudClient) refreshExpiringToken(ctx context.Context, token string) string {
+	margin := c.tokenRefreshMargin()
+	expiresAt := c.TokenExpiresAt()
+	if margin < 0 || expiresAt.IsZero() || time.Until(expiresAt) > margin {
+		return token
+	}
+
+	c.logger.Debug("token expires at %s, refreshing\n", expiresAt.Format(time.RFC3339))
+	if err := c.refreshStaleToken(ctx, token); err != nil {
+		c.logger.Error("proactive token refresh failed: %v\n", err)
+		return token
+	}
+	return c.GetToken()
+}
@@ -0,0 +1,27 @@
+package ecloudsdk
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// newDialer returns the dialer of the internal transport.
+// It has the same timeouts as the dialer of http.DefaultTransport,
+// with Config.TCPKeepAlive applied if enabled.
+func newDialer(config *Config) *net.Dialer {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if config.TCPKeepAlive.Enable {
+		dialer.KeepAliveConfig = config.TCPKeepAlive
+	}
+	return dialer
+}
+
+// heartbeatConfig returns the HTTP/2 settings sending PING frames on
+// connections idle for Config.HeartbeatInterval, or nil if disabled.
+func heartbeatConfig(config *Config) *http.HTTP2Config {
+	if config.HeartbeatInterval <= 0 {
+		return nil
+	}
+	return &http.HTTP2Config{SendPingTimeout: config.HeartbeatInterval}
+}
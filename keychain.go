@@ -0,0 +1,80 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// DefaultKeychainService is the service name KeychainTokenStore files tokens under.
+const DefaultKeychainService = "ecloud-sdk"
+
+// keychain is a platform credential store holding one secret per service and account.
+type keychain interface {
+	// get returns the secret, or nil if there is none.
+	get(ctx context.Context, service, account string) ([]byte, error)
+	set(ctx context.Context, service, account string, secret []byte) error
+
+	// delete removes the secret. Deleting a missing secret is not an error.
+	delete(ctx context.Context, service, account string) error
+}
+
+// KeychainTokenStore is a TokenStore backed by the operating system's credential
+// store, so tokens are encrypted at rest and never written to disk in plain text:
+//
+//   - macOS: the login Keychain, through the security command.
+//   - Windows: Credential Manager. Tokens are limited to 2560 bytes.
+//   - Linux: the Secret Service (GNOME Keyring, KWallet), through the secret-tool
+//     command of libsecret.
+//
+// On other platforms every call fails with ErrKeychainUnsupported.
+type KeychainTokenStore struct {
+	service  string
+	keychain keychain
+}
+
+// NewKeychainTokenStore creates a KeychainTokenStore filing tokens under service,
+// or DefaultKeychainService if service is empty. Each token store key is stored
+// as a separate account of the service.
+func NewKeychainTokenStore(service string) *KeychainTokenStore {
+	if service == "" {
+		service = DefaultKeychainService
+	}
+	return &KeychainTokenStore{service: service, keychain: osKeychain{}}
+}
+
+func (s *KeychainTokenStore) Get(ctx context.Context, key string) (*StoredToken, error) {
+	secret, err := s.keychain.get(ctx, s.service, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token from keychain: %w", err)
+	}
+
+	if secret == nil {
+		return nil, nil
+	}
+
+	token := &StoredToken{}
+	if err := json.Unmarshal(secret, token); err != nil {
+		return nil, fmt.Errorf("unable to decode keychain token: %w", err)
+	}
+	return token, nil
+}
+
+func (s *KeychainTokenStore) Set(ctx context.Context, key string, token *StoredToken) error {
+	secret, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	if err := s.keychain.set(ctx, s.service, key, secret); err != nil {
+		return fmt.Errorf("unable to write token to keychain: %w", err)
+	}
+	return nil
+}
+
+func (s *KeychainTokenStore) Delete(ctx context.Context, key string) error {
+	if err := s.keychain.delete(ctx, s.service, key); err != nil {
+		return fmt.Errorf("unable to delete token from keychain: %w", err)
+	}
+	return nil
+}
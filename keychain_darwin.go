@@ -0,0 +1,60 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// securityItemNotFound is the exit code of the security command for a missing item.
+const securityItemNotFound = 44
+
+// osKeychain stores secrets in the macOS login Keychain with the security command.
+type osKeychain struct{}
+
+func (osKeychain) get(ctx context.Context, service, account string) ([]byte, error) {
+	out, code, err := runKeychainCommand(ctx, nil, "/usr/bin/security",
+		"find-generic-password", "-s", service, "-a", account, "-w")
+	if code == securityItemNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(out, []byte("\n")), nil
+}
+
+func (osKeychain) set(ctx context.Context, service, account string, secret []byte) error {
+	if err := checkSecurityArg(service); err != nil {
+		return err
+	}
+	if err := checkSecurityArg(account); err != nil {
+		return err
+	}
+
+	// Interactive mode reads the command from stdin, keeping the secret out of
+	// the process arguments. -X takes the secret hex encoded.
+	command := fmt.Sprintf("add-generic-password -U -s %q -a %q -X %s\n",
+		service, account, hex.EncodeToString(secret))
+	_, _, err := runKeychainCommand(ctx, []byte(command), "/usr/bin/security", "-i")
+	return err
+}
+
+func (osKeychain) delete(ctx context.Context, service, account string) error {
+	_, code, err := runKeychainCommand(ctx, nil, "/usr/bin/security",
+		"delete-generic-password", "-s", service, "-a", account)
+	if code == securityItemNotFound {
+		return nil
+	}
+	return err
+}
+
+// checkSecurityArg rejects values that cannot be quoted for security -i.
+func checkSecurityArg(value string) error {
+	if strings.ContainsAny(value, "\"\\\n\r") {
+		return fmt.Errorf("keychain service and account must not contain quotes, backslashes or newlines: %q", value)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+//go:build darwin || linux
+
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runKeychainCommand runs a credential helper, passing secrets on stdin rather
+// than as arguments so they never show up in the process list.
+// It returns the exit code of a command that ran but failed.
+func runKeychainCommand(ctx context.Context, stdin []byte, name string, args ...string) ([]byte, int, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout.Bytes(), exitErr.ExitCode(), fmt.Errorf("%s: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, -1, fmt.Errorf("%w: %s is not installed", ErrKeychainUnsupported, name)
+	}
+
+	if err != nil {
+		return nil, -1, fmt.Errorf("%s: %w", name, err)
+	}
+	return stdout.Bytes(), 0, nil
+}
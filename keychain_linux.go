@@ -0,0 +1,37 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+)
+
+// osKeychain stores secrets in the Secret Service (GNOME Keyring, KWallet)
+// with the secret-tool command of libsecret.
+type osKeychain struct{}
+
+func (osKeychain) get(ctx context.Context, service, account string) ([]byte, error) {
+	out, code, err := runKeychainCommand(ctx, nil, "secret-tool", "lookup", "service", service, "account", account)
+
+	// secret-tool exits with 1 and no output when there is no matching item.
+	if code == 1 && len(out) == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(out, []byte("\n")), nil
+}
+
+func (osKeychain) set(ctx context.Context, service, account string, secret []byte) error {
+	_, _, err := runKeychainCommand(ctx, secret, "secret-tool", "store", "--label", service+" token",
+		"service", service, "account", account)
+	return err
+}
+
+func (osKeychain) delete(ctx context.Context, service, account string) error {
+	out, code, err := runKeychainCommand(ctx, nil, "secret-tool", "clear", "service", service, "account", account)
+	if code == 1 && len(out) == 0 {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,20 @@
+//go:build !darwin && !linux && !windows
+
+package ecloudsdk
+
+import "context"
+
+// osKeychain reports ErrKeychainUnsupported on platforms without a supported credential store.
+type osKeychain struct{}
+
+func (osKeychain) get(ctx context.Context, service, account string) ([]byte, error) {
+	return nil, ErrKeychainUnsupported
+}
+
+func (osKeychain) set(ctx context.Context, service, account string, secret []byte) error {
+	return ErrKeychainUnsupported
+}
+
+func (osKeychain) delete(ctx context.Context, service, account string) error {
+	return ErrKeychainUnsupported
+}
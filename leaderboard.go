@@ -0,0 +1,80 @@
+package ecloudsdk
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"time"
+)
+
+// UploadCount is the number of records a clinician uploaded in a month.
+type UploadCount struct {
+	Clinician string    `json:"registered_by"` // User who uploaded the records.
+	Month     time.Time `json:"month"`         // Start of the month (UTC).
+	Records   int       `json:"records"`       // Records uploaded.
+}
+
+// UploadLeaderboard is the number of records uploaded per clinician per
+// month, used by hospital management to monitor adoption of the ecloud workflow.
+type UploadLeaderboard struct {
+	Period  ReportPeriod  `json:"-"`       // Period requested by the client.
+	Entries []UploadCount `json:"entries"` // Ordered by month, then by records, most first.
+}
+
+// Totals returns the records uploaded by each clinician over the whole
+// period, most first.
+func (l *UploadLeaderboard) Totals() []UploadCount {
+	totals := make(map[string]int)
+	for _, entry := range l.Entries {
+		totals[entry.Clinician] += entry.Records
+	}
+
+	counts := make([]UploadCount, 0, len(totals))
+	for clinician, records := range totals {
+		counts = append(counts, UploadCount{Clinician: clinician, Records: records})
+	}
+
+	slices.SortFunc(counts, func(a, b UploadCount) int {
+		return cmp.Or(cmp.Compare(b.Records, a.Records), cmp.Compare(a.Clinician, b.Clinician))
+	})
+	return counts
+}
+
+// GetUploadLeaderboard returns the number of records uploaded by each
+// clinician of the hospital per month of the period.
+func (c *DefaultEcloudClient) GetUploadLeaderboard(ctx context.Context, period ReportPeriod) (*UploadLeaderboard, error) {
+	if err := period.Validate(); err != nil {
+		return nil, err
+	}
+
+	query := neturl.Values{}
+	query.Set("hospital_number", c.cfg().HospitalNumber.String())
+	query.Set("from", period.From.Format(time.RFC3339))
+	query.Set("to", period.To.Format(time.RFC3339))
+	query.Set("group_by", "registered_by,month")
+
+	url := c.cfg().ApiBaseUrl + "/api/records/stats/uploads?" + query.Encode()
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get upload leaderboard: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	leaderboard := &UploadLeaderboard{Period: period}
+	if err := json.NewDecoder(resp.Body).Decode(leaderboard); err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+
+	slices.SortStableFunc(leaderboard.Entries, func(a, b UploadCount) int {
+		return cmp.Or(a.Month.Compare(b.Month), cmp.Compare(b.Records, a.Records))
+	})
+	return leaderboard, nil
+}
@@ -0,0 +1,69 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RecordLink maps an ecloud record to the HMS visit it was synced from.
+type RecordLink struct {
+	RecordID       uint           `json:"record_id"`       // ecloud record ID.
+	VisitID        uint           `json:"visit_id"`        // HMS visit ID, see PatientRecord.VisitID.
+	PatientID      uint           `json:"patient_id"`      // Patient ID in Eclinic HMS.
+	SubscriberID   uint           `json:"subscriber_id"`   // ecloud subscriber ID.
+	HospitalNumber HospitalNumber `json:"hospital_number"` // Hospital that synced the record.
+	Title          string         `json:"title"`
+	VisitTimestamp time.Time      `json:"visit_timestamp"`
+	UploadedAt     time.Time      `json:"uploaded_at"`
+}
+
+// ResolveVisit returns the ecloud records synced for an HMS visit of this hospital.
+// A visit synced with SyncVisit may have several records.
+// Fails with ErrRecordNotFound if nothing was synced for the visit.
+func (c *DefaultEcloudClient) ResolveVisit(ctx context.Context, visitID uint) ([]*RecordLink, error) {
+	url := fmt.Sprintf("%s/api/records/visits/%s/%d", c.cfg().ApiBaseUrl, c.cfg().HospitalNumber, visitID)
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve visit: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrRecordNotFound)
+	}
+
+	var links []*RecordLink
+	err = json.NewDecoder(resp.Body).Decode(&links)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+
+	if len(links) == 0 {
+		return nil, fmt.Errorf("visit %d: %w", visitID, ErrRecordNotFound)
+	}
+	return links, nil
+}
+
+// ResolveRecord returns the HMS visit an ecloud record was synced from.
+func (c *DefaultEcloudClient) ResolveRecord(ctx context.Context, recordID uint) (*RecordLink, error) {
+	url := fmt.Sprintf("%s/api/records/%d/link", c.cfg().ApiBaseUrl, recordID)
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve record: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrRecordNotFound)
+	}
+
+	link := &RecordLink{}
+	err = json.NewDecoder(resp.Body).Decode(link)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return link, nil
+}
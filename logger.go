@@ -1,10 +1,71 @@
 package ecloudsdk
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log/slog"
+	"strings"
 )
 
+// WarnLogger is implemented by loggers with a warning level. The SDK logs
+// warnings (slow calls, deprecated endpoints, server warnings, ...) with Warn
+// when the Logger implements it and with Info otherwise.
+type WarnLogger interface {
+	Warn(msg string, args ...any)
+}
+
+// StructuredLogger is implemented by loggers accepting key/value pairs,
+// with the signature of slog.Logger.Log. The SDK logs its structured messages
+// with Log when the Logger implements it; other loggers receive them
+// formatted as "msg key=value ...".
+type StructuredLogger interface {
+	Log(ctx context.Context, level slog.Level, msg string, args ...any)
+}
+
+// logWarn logs a printf-style warning at the best level logger supports.
+func logWarn(logger Logger, msg string, args ...any) {
+	if warner, ok := logger.(WarnLogger); ok {
+		warner.Warn(msg, args...)
+		return
+	}
+	logger.Info("warning: "+msg, args...)
+}
+
+// logStructured logs msg with key/value pairs at level.
+func logStructured(ctx context.Context, logger Logger, level slog.Level, msg string, args ...any) {
+	if structured, ok := logger.(StructuredLogger); ok {
+		structured.Log(ctx, level, msg, args...)
+		return
+	}
+
+	line := formatKeyValues(msg, args) + "\n"
+	switch {
+	case level >= slog.LevelError:
+		logger.Error("%s", line)
+	case level >= slog.LevelWarn:
+		logWarn(logger, "%s", line)
+	case level >= slog.LevelInfo:
+		logger.Info("%s", line)
+	default:
+		logger.Debug("%s", line)
+	}
+}
+
+// formatKeyValues formats msg and the key/value pairs as "msg key=value ...".
+func formatKeyValues(msg string, args []any) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fmt.Fprintf(&b, " %v", args[i])
+			break
+		}
+		fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+	}
+	return b.String()
+}
+
 // NoOpLogger is a default logger that does nothing
 type NoOpLogger struct{}
 
@@ -28,6 +89,54 @@ func (l *StdLogger) Info(msg string, args ...any) {
 	fmt.Fprintf(l.out, "[INFO]: "+msg, args...)
 }
 
+func (l *StdLogger) Warn(msg string, args ...any) {
+	fmt.Fprintf(l.out, "[WARN]: "+msg, args...)
+}
+
 func (l *StdLogger) Error(msg string, args ...any) {
 	fmt.Fprintf(l.out, "[ERROR]: "+msg, args...)
 }
+
+// SlogLogger adapts a *slog.Logger to the Logger interface. Printf-style
+// messages are formatted before logging and structured messages keep their
+// key/value pairs as slog attributes.
+type SlogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a Logger writing to logger, or to slog.Default() if nil.
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SlogLogger{logger: logger}
+}
+
+func (l *SlogLogger) Debug(msg string, args ...any) {
+	l.logf(slog.LevelDebug, msg, args)
+}
+
+func (l *SlogLogger) Info(msg string, args ...any) {
+	l.logf(slog.LevelInfo, msg, args)
+}
+
+func (l *SlogLogger) Warn(msg string, args ...any) {
+	l.logf(slog.LevelWarn, msg, args)
+}
+
+func (l *SlogLogger) Error(msg string, args ...any) {
+	l.logf(slog.LevelError, msg, args)
+}
+
+// Log implements StructuredLogger.
+func (l *SlogLogger) Log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	l.logger.Log(ctx, level, msg, args...)
+}
+
+func (l *SlogLogger) logf(level slog.Level, msg string, args []any) {
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	l.logger.Log(ctx, level, strings.TrimSuffix(fmt.Sprintf(msg, args...), "\n"))
+}
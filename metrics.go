@@ -0,0 +1,94 @@
+package ecloudsdk
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Metrics receives an observation for every HTTP attempt made by the client,
+// to dashboard SDK health. Set it with Config.Metrics. Implementations must be
+// safe for concurrent use and should not block. See the prometheus sub-package.
+type Metrics interface {
+	ObserveRequest(request RequestMetric)
+}
+
+// Error classes of RequestMetric.
+const (
+	ErrorClassNone        = ""
+	ErrorClassNetwork     = "network"      // The request failed without a response.
+	ErrorClassTimeout     = "timeout"      // The request or its context timed out.
+	ErrorClassCanceled    = "canceled"     // The caller canceled the request.
+	ErrorClassCircuitOpen = "circuit_open" // Rejected by Config.CircuitBreaker.
+	ErrorClassRateLimited = "rate_limited" // 429 response.
+	ErrorClassClient      = "client"       // Other 4xx response.
+	ErrorClassServer      = "server"       // 5xx response.
+)
+
+// RequestMetric describes one HTTP attempt.
+type RequestMetric struct {
+	Method string
+
+	// URL path with numeric IDs replaced by "{id}" e.g "/api/subscriptions/{id}",
+	// so it can be used as a low-cardinality label.
+	Endpoint string
+
+	StatusCode int           // Zero if no response was received.
+	Attempt    int           // Zero for the first attempt, retries are 1 or more.
+	Duration   time.Duration // Until the response headers were read.
+	ErrorClass string        // One of the ErrorClass constants.
+	BytesSent  int64         // Request body bytes sent e.g record uploads.
+}
+
+// Retry reports whether the attempt was a retry.
+func (m RequestMetric) Retry() bool {
+	return m.Attempt > 0
+}
+
+// observeRequest reports an attempt to Config.Metrics, if set.
+func (c *DefaultEcloudClient) observeRequest(req *http.Request, attempt int, timing RequestTiming,
+	sent int64, resp *http.Response, err error) {
+	metrics := c.cfg().Metrics
+	if metrics == nil {
+		return
+	}
+
+	request := RequestMetric{
+		Method:     req.Method,
+		Endpoint:   endpointPattern(req.URL.Path),
+		Attempt:    attempt,
+		Duration:   timing.Total,
+		ErrorClass: errorClass(req.Context(), resp, err),
+		BytesSent:  sent,
+	}
+	if resp != nil {
+		request.StatusCode = resp.StatusCode
+	}
+	safeCall(c.logger, "Metrics", func() { metrics.ObserveRequest(request) })
+}
+
+// errorClass classifies the outcome of an attempt.
+func errorClass(ctx context.Context, resp *http.Response, err error) string {
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return ErrorClassCircuitOpen
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case errors.Is(err, context.Canceled) || (err != nil && ctx.Err() != nil):
+		return ErrorClassCanceled
+	case err != nil:
+		var timeout interface{ Timeout() bool }
+		if errors.As(err, &timeout) && timeout.Timeout() {
+			return ErrorClassTimeout
+		}
+		return ErrorClassNetwork
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return ErrorClassRateLimited
+	case resp.StatusCode >= 500:
+		return ErrorClassServer
+	case resp.StatusCode >= 400:
+		return ErrorClassClient
+	}
+	return ErrorClassNone
+}
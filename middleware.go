@@ -0,0 +1,51 @@
+package ecloudsdk
+
+import (
+	"context"
+	"net/http"
+)
+
+// HTTPClientFunc adapts a function to the HTTPClient interface.
+type HTTPClientFunc func(req *http.Request) (*http.Response, error)
+
+// Do calls f(req).
+func (f HTTPClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps the HTTPClient that sends requests, to inspect or modify
+// requests and responses, e.g for audit logging, metrics or extra headers.
+// It is called once per attempt, after the SDK has set its headers, so retries
+// are seen individually (see RequestAttempt). A middleware may return without
+// calling next, e.g to serve a response from a cache.
+//
+//	audit := func(next ecloudsdk.HTTPClient) ecloudsdk.HTTPClient {
+//		return ecloudsdk.HTTPClientFunc(func(req *http.Request) (*http.Response, error) {
+//			resp, err := next.Do(req)
+//			log.Printf("%s %s attempt=%d", req.Method, req.URL.Path, ecloudsdk.RequestAttempt(req))
+//			return resp, err
+//		})
+//	}
+type Middleware func(next HTTPClient) HTTPClient
+
+// chainMiddleware wraps client with middleware, the first being the outermost.
+func chainMiddleware(client HTTPClient, middleware []Middleware) HTTPClient {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		client = middleware[i](client)
+	}
+	return client
+}
+
+// attemptKey holds the attempt number in the context of each request.
+type attemptKey struct{}
+
+// RequestAttempt returns the attempt number of a request sent by the client,
+// 0 for the first attempt and 1 or more for retries.
+func RequestAttempt(req *http.Request) int {
+	attempt, _ := req.Context().Value(attemptKey{}).(int)
+	return attempt
+}
+
+func withAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
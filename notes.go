@@ -0,0 +1,142 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// SubscriberNote is a free-text note kept on a subscriber, e.g "prefers SMS in Luganda".
+// Notes are stored in ecloud, so every branch of the hospital sees them.
+type SubscriberNote struct {
+	ID           uint      `json:"id"`
+	SubscriberID uint      `json:"subscriber_id"`
+	Text         string    `json:"text"`
+	CreatedBy    string    `json:"created_by"` // User who added the note.
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// SubscriberFlag is a named boolean marker on a subscriber, e.g "vip".
+// UpdatedBy and UpdatedAt record who last set or cleared it.
+type SubscriberFlag struct {
+	Name      string    `json:"name"`
+	Value     bool      `json:"value"`
+	UpdatedBy string    `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AddSubscriberNote adds a note to a subscriber on behalf of createdBy.
+func (c *DefaultEcloudClient) AddSubscriberNote(ctx context.Context, subscriberID uint, text, createdBy string) (*SubscriberNote, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, fmt.Errorf("note text must not be empty")
+	}
+	if createdBy == "" {
+		return nil, fmt.Errorf("note author must not be empty")
+	}
+
+	data, err := json.Marshal(map[string]string{"text": text, "created_by": createdBy})
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/subscriptions/%d/notes", c.cfg().ApiBaseUrl, subscriberID)
+	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to add subscriber note: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
+	}
+
+	note := &SubscriberNote{}
+	err = json.NewDecoder(resp.Body).Decode(note)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return note, nil
+}
+
+// ListSubscriberNotes returns the notes of a subscriber, oldest first.
+func (c *DefaultEcloudClient) ListSubscriberNotes(ctx context.Context, subscriberID uint) ([]*SubscriberNote, error) {
+	url := fmt.Sprintf("%s/api/subscriptions/%d/notes", c.cfg().ApiBaseUrl, subscriberID)
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch subscriber notes: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
+	}
+
+	var notes []*SubscriberNote
+	err = json.NewDecoder(resp.Body).Decode(&notes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return notes, nil
+}
+
+// SetSubscriberFlag sets or clears a flag on a subscriber on behalf of updatedBy.
+func (c *DefaultEcloudClient) SetSubscriberFlag(ctx context.Context, subscriberID uint, name string, value bool,
+	updatedBy string) (*SubscriberFlag, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("flag name must not be empty")
+	}
+	if updatedBy == "" {
+		return nil, fmt.Errorf("flag author must not be empty")
+	}
+
+	data, err := json.Marshal(map[string]any{"value": value, "updated_by": updatedBy})
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/subscriptions/%d/flags/%s", c.cfg().ApiBaseUrl, subscriberID, neturl.PathEscape(name))
+	resp, err := c.performRequest(ctx, http.MethodPut, url, bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to set subscriber flag: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
+	}
+
+	flag := &SubscriberFlag{}
+	err = json.NewDecoder(resp.Body).Decode(flag)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return flag, nil
+}
+
+// GetSubscriberFlags returns the flags of a subscriber, including cleared ones.
+func (c *DefaultEcloudClient) GetSubscriberFlags(ctx context.Context, subscriberID uint) ([]*SubscriberFlag, error) {
+	url := fmt.Sprintf("%s/api/subscriptions/%d/flags", c.cfg().ApiBaseUrl, subscriberID)
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch subscriber flags: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
+	}
+
+	var flags []*SubscriberFlag
+	err = json.NewDecoder(resp.Body).Decode(&flags)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return flags, nil
+}
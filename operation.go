@@ -0,0 +1,209 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// DefaultOperationPollInterval is the interval between polls of Operation.Wait
+// when the server doesn't send a Retry-After header.
+const DefaultOperationPollInterval = 2 * time.Second
+
+// maxOperationPollInterval caps the Retry-After of operation polls.
+const maxOperationPollInterval = time.Minute
+
+// OperationStatus is the state of an asynchronous operation.
+type OperationStatus string
+
+const (
+	OperationPending   OperationStatus = "pending"
+	OperationRunning   OperationStatus = "running"
+	OperationSucceeded OperationStatus = "succeeded"
+	OperationFailed    OperationStatus = "failed"
+)
+
+// Done reports whether the operation has finished, successfully or not.
+func (s OperationStatus) Done() bool {
+	return s == OperationSucceeded || s == OperationFailed
+}
+
+// Operation is work that ecloud accepted (202 Accepted) but completes later,
+// e.g processing an uploaded record or exporting a subscriber's data. Call
+// Wait to await its completion, or Poll to check on it, e.g from a UI timer.
+// An Operation must not be polled concurrently.
+type Operation struct {
+	ID        string          `json:"id"`
+	Status    OperationStatus `json:"status"`
+	StatusURL string          `json:"status_url"`          // Polled for the status, from the Location header if not in the body.
+	Error     string          `json:"error,omitempty"`     // Why the operation failed.
+	Result    json.RawMessage `json:"result,omitempty"`    // Set once succeeded, see Decode.
+	CreatedAt time.Time       `json:"created_at,omitzero"` // When the operation was accepted.
+	UpdatedAt time.Time       `json:"updated_at,omitzero"` // Last change of the status.
+
+	client    *DefaultEcloudClient
+	pollAfter time.Duration // Delay before the next poll, see pollDelay.
+}
+
+// Done reports whether the operation has finished, successfully or not.
+func (o *Operation) Done() bool {
+	return o.Status.Done()
+}
+
+// Err returns an error wrapping ErrOperationFailed if the operation failed.
+func (o *Operation) Err() error {
+	if o.Status != OperationFailed {
+		return nil
+	}
+	return fmt.Errorf("%w: operation %s: %s", ErrOperationFailed, o.ID, o.Error)
+}
+
+// Decode decodes the result of a succeeded operation into v.
+func (o *Operation) Decode(v any) error {
+	if o.Status != OperationSucceeded {
+		return fmt.Errorf("operation %s is %s", o.ID, o.Status)
+	}
+	if len(o.Result) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(o.Result, v); err != nil {
+		return fmt.Errorf("unable to decode json: %w", err)
+	}
+	return nil
+}
+
+// Poll fetches the status of the operation, updating it. A status URL on
+// another host than Config.ApiBaseUrl fails with ErrHostNotAllowed.
+func (o *Operation) Poll(ctx context.Context) error {
+	c := o.client
+	url, err := o.statusURL()
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return fmt.Errorf("unable to poll operation %s: %w", o.ID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return c.decodeError(resp)
+	}
+
+	polled := &Operation{}
+	err = json.NewDecoder(resp.Body).Decode(polled)
+	if err != nil {
+		return fmt.Errorf("unable to decode json: %w", err)
+	}
+
+	// The status URL may be omitted once known.
+	if polled.StatusURL == "" {
+		polled.StatusURL = o.StatusURL
+	}
+	polled.client = c
+	polled.pollAfter = pollDelay(resp)
+	*o = *polled
+	return nil
+}
+
+// statusURL resolves the status URL against Config.ApiBaseUrl. The server
+// names it, so an absolute URL on another host is rejected rather than sent
+// the client's credentials.
+func (o *Operation) statusURL() (string, error) {
+	base := o.client.cfg().ApiBaseUrl
+	if !strings.Contains(o.StatusURL, "://") {
+		return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(o.StatusURL, "/"), nil
+	}
+
+	u, err := neturl.Parse(o.StatusURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid status URL of operation %s: %w", o.ID, err)
+	}
+
+	api, err := neturl.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid ApiBaseUrl: %w", err)
+	}
+
+	if !strings.EqualFold(u.Host, api.Host) || !strings.EqualFold(u.Scheme, api.Scheme) {
+		return "", fmt.Errorf("%w: status URL of operation %s is on another host %q", ErrHostNotAllowed, o.ID, u.Host)
+	}
+	return u.String(), nil
+}
+
+// Wait polls the operation until it is done or ctx is done, at the interval
+// asked by the server with Retry-After, else DefaultOperationPollInterval.
+// It returns the error of a failed operation, see Err.
+func (o *Operation) Wait(ctx context.Context) error {
+	for !o.Done() {
+		timer := time.NewTimer(o.pollAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if err := o.Poll(ctx); err != nil {
+			return err
+		}
+	}
+	return o.Err()
+}
+
+// newOperation returns the operation accepted by resp. A status URL is only
+// required while the operation isn't done.
+func (c *DefaultEcloudClient) newOperation(resp *http.Response) (*Operation, error) {
+	op := &Operation{Status: OperationPending}
+	if err := json.NewDecoder(resp.Body).Decode(op); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+
+	if op.StatusURL == "" {
+		op.StatusURL = resp.Header.Get("Location")
+	}
+	if op.StatusURL == "" && !op.Done() {
+		return nil, fmt.Errorf("202 Accepted response without a status URL")
+	}
+
+	op.client = c
+	op.pollAfter = pollDelay(resp)
+	return op, nil
+}
+
+// pollDelay returns the delay before polling an operation again: the
+// Retry-After of resp, capped, else DefaultOperationPollInterval.
+func pollDelay(resp *http.Response) time.Duration {
+	if delay, ok := retryAfter(resp, time.Now()); ok {
+		return min(delay, maxOperationPollInterval)
+	}
+	return DefaultOperationPollInterval
+}
+
+// startOperation sends a request starting an operation. The server replies
+// 202 Accepted, or 200 OK with the operation if it completed at once.
+func (c *DefaultEcloudClient) startOperation(ctx context.Context, url string, body any, notFound error) (*Operation, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return nil, c.decodeResourceError(resp, notFound)
+	}
+	return c.newOperation(resp)
+}
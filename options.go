@@ -0,0 +1,114 @@
+package ecloudsdk
+
+import (
+	"slices"
+	"time"
+)
+
+// Option configures a client created with NewClient.
+type Option func(*Config)
+
+// NewClient creates a client from functional options, as an alternative to
+// NewEcloudClient. Options are applied in order to a private Config, so the
+// defaults filled in during validation never leak back to the caller.
+//
+//	client, err := ecloudsdk.NewClient(
+//		ecloudsdk.WithBaseURL("https://api.ecloud.com"),
+//		ecloudsdk.WithCredentials("ABCD1234", "secret"),
+//		ecloudsdk.WithHospital("HOS-123", "Mulago Hospital"),
+//		ecloudsdk.WithEclinicBaseURL("https://eclinic.example.com"),
+//		ecloudsdk.WithTimeout(10*time.Second),
+//	)
+func NewClient(opts ...Option) (EcloudClient, error) {
+	config := &Config{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return NewEcloudClient(config)
+}
+
+// WithConfig starts from a copy of config. Options applied after it override its fields.
+func WithConfig(config Config) Option {
+	return func(c *Config) {
+		*c = config
+	}
+}
+
+// WithBaseURL sets the base URL of the ecloud server.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Config) {
+		c.ApiBaseUrl = baseURL
+	}
+}
+
+// WithEnvironment selects a preset deployment. See Config.Environment.
+func WithEnvironment(env Environment) Option {
+	return func(c *Config) {
+		c.Environment = env
+	}
+}
+
+// WithCredentials sets the eclinic ID and password used to log in.
+func WithCredentials(eclinicID, password string) Option {
+	return func(c *Config) {
+		c.EclinicId = eclinicID
+		c.Password = password
+	}
+}
+
+// WithHospital sets the hospital number and name.
+func WithHospital(number HospitalNumber, name string) Option {
+	return func(c *Config) {
+		c.HospitalNumber = number
+		c.HospitalName = name
+	}
+}
+
+// WithEclinicBaseURL sets the eclinic hostname used during PDF generation.
+func WithEclinicBaseURL(baseURL string) Option {
+	return func(c *Config) {
+		c.EclinicBaseUrl = baseURL
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for all requests.
+func WithHTTPClient(client HTTPClient) Option {
+	return func(c *Config) {
+		c.HTTPClient = client
+	}
+}
+
+// WithMiddleware appends middleware wrapping the HTTP client.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(c *Config) {
+		c.Middleware = append(slices.Clip(c.Middleware), middleware...)
+	}
+}
+
+// WithLogger sets the logger.
+func WithLogger(logger Logger) Option {
+	return func(c *Config) {
+		c.Logger = logger
+	}
+}
+
+// WithRetryPolicy sets the retry policy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Config) {
+		c.RetryPolicy = policy
+	}
+}
+
+// WithCircuitBreaker sets the circuit breaker.
+func WithCircuitBreaker(breaker CircuitBreaker) Option {
+	return func(c *Config) {
+		c.CircuitBreaker = breaker
+	}
+}
+
+// WithTimeout sets the timeout of the internal HTTP client.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.Timeout = timeout
+	}
+}
@@ -0,0 +1,163 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+)
+
+// DefaultPerPage is the page size used by the paginated list methods when
+// ListOptions.PerPage is zero.
+const DefaultPerPage = 100
+
+// ListOptions controls the page returned by the paginated list methods.
+// Prefer Cursor over Page for large lists: cursors stay stable while
+// subscribers are being added.
+type ListOptions struct {
+	Page    int    // 1-based page number. Ignored when Cursor is set.
+	PerPage int    // Page size. Defaults to DefaultPerPage.
+	Cursor  string // Opaque cursor from a previous page's NextCursor.
+	Sort    string // Sort field, prefixed with "-" for descending e.g "-created_at".
+}
+
+// apply encodes the options into query.
+func (o *ListOptions) apply(query neturl.Values) {
+	perPage := DefaultPerPage
+	if o != nil && o.PerPage > 0 {
+		perPage = o.PerPage
+	}
+	query.Set("per_page", strconv.Itoa(perPage))
+
+	if o == nil {
+		return
+	}
+
+	if o.Cursor != "" {
+		query.Set("cursor", o.Cursor)
+	} else if o.Page > 0 {
+		query.Set("page", strconv.Itoa(o.Page))
+	}
+
+	if o.Sort != "" {
+		query.Set("sort", o.Sort)
+	}
+}
+
+// SubscriberPage is a page of subscribers.
+type SubscriberPage struct {
+	Subscribers []*Subscriber `json:"data"`
+	NextCursor  string        `json:"next_cursor"` // Empty on the last page.
+	Total       int           `json:"total"`       // Number of subscribers across all pages.
+}
+
+// HasMore reports whether there are more pages after this one.
+func (p *SubscriberPage) HasMore() bool {
+	return p.NextCursor != ""
+}
+
+// ListSubscribersPage returns a page of the hospital subscribers matching filter.
+// A nil filter matches all subscribers and nil opts returns the first page.
+func (c *DefaultEcloudClient) ListSubscribersPage(ctx context.Context, filter *SubscriberFilter,
+	opts *ListOptions) (*SubscriberPage, error) {
+	query := filter.Query()
+	query.Set("hospital_number", c.cfg().HospitalNumber.String())
+	opts.apply(query)
+
+	url := c.cfg().ApiBaseUrl + "/api/subscriptions?" + query.Encode()
+	return c.fetchSubscriberPage(ctx, url)
+}
+
+// GetPendingSubscribersPage returns a page of the hospital's pending subscribers.
+func (c *DefaultEcloudClient) GetPendingSubscribersPage(ctx context.Context, opts *ListOptions) (*SubscriberPage, error) {
+	query := neturl.Values{}
+	opts.apply(query)
+
+	url := fmt.Sprintf("%s/api/subscriptions/pending/%s?%s", c.cfg().ApiBaseUrl,
+		c.cfg().HospitalNumber, query.Encode())
+	return c.fetchSubscriberPage(ctx, url)
+}
+
+func (c *DefaultEcloudClient) fetchSubscriberPage(ctx context.Context, url string) (*SubscriberPage, error) {
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch subscribers: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	page := &SubscriberPage{}
+	err = json.NewDecoder(resp.Body).Decode(page)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return page, nil
+}
+
+// AllSubscribers iterates over the hospital subscribers matching filter,
+// fetching pages of opts.PerPage on demand. Iteration stops at the first error,
+// which is yielded with a nil subscriber.
+//
+//	for subscriber, err := range client.AllSubscribers(ctx, nil, nil) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func (c *DefaultEcloudClient) AllSubscribers(ctx context.Context, filter *SubscriberFilter,
+	opts *ListOptions) iter.Seq2[*Subscriber, error] {
+	return paginate(opts, func(opts *ListOptions) ([]*Subscriber, string, error) {
+		page, err := c.ListSubscribersPage(ctx, filter, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return page.Subscribers, page.NextCursor, nil
+	})
+}
+
+// AllPendingSubscribers iterates over the hospital's pending subscribers. See AllSubscribers.
+func (c *DefaultEcloudClient) AllPendingSubscribers(ctx context.Context, opts *ListOptions) iter.Seq2[*Subscriber, error] {
+	return paginate(opts, func(opts *ListOptions) ([]*Subscriber, string, error) {
+		page, err := c.GetPendingSubscribersPage(ctx, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		return page.Subscribers, page.NextCursor, nil
+	})
+}
+
+// paginate yields the items of every page returned by fetch, following the next cursor.
+func paginate[T any](opts *ListOptions, fetch func(opts *ListOptions) (items []T, nextCursor string, err error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		next := ListOptions{}
+		if opts != nil {
+			next = *opts
+		}
+
+		for {
+			items, nextCursor, err := fetch(&next)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			if nextCursor == "" || len(items) == 0 {
+				return
+			}
+			next.Cursor = nextCursor
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+)
+
+// PaymentCheckpoint is a position in the hospital's payment feed, for incremental
+// ingestion with PaymentsSince. The zero checkpoint starts from the first payment.
+// Persist it atomically with the ingested payments, e.g in the same transaction.
+type PaymentCheckpoint uint64
+
+// paymentFeed is the response of the payment feed endpoint.
+type paymentFeed struct {
+	Payments []*Payment `json:"data"`
+
+	// Highest sequence below which every payment is committed. Payments
+	// committed out of order are only served once the watermark passes them.
+	Watermark uint64 `json:"watermark"`
+}
+
+// PaymentsSince returns the payments recorded after checkpoint, in feed order,
+// and the checkpoint to pass to the next call. Payments are ordered by the
+// sequence the server assigns on commit (Payment.Sequence), not by CreatedAt,
+// and only payments below the server's commit watermark are returned, so no
+// payment is skipped or returned twice across calls, even when payments are
+// backdated or arrive out of order. An empty result returns checkpoint unchanged.
+//
+// At most DefaultPerPage payments are returned per call; call again until the
+// result is empty to catch up.
+func (c *DefaultEcloudClient) PaymentsSince(ctx context.Context, checkpoint PaymentCheckpoint) ([]*Payment, PaymentCheckpoint, error) {
+	query := neturl.Values{}
+	query.Set("hospital_number", c.cfg().HospitalNumber.String())
+	query.Set("after", strconv.FormatUint(uint64(checkpoint), 10))
+	query.Set("limit", strconv.Itoa(DefaultPerPage))
+
+	url := c.cfg().ApiBaseUrl + "/api/payments/feed?" + query.Encode()
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, checkpoint, fmt.Errorf("unable to fetch payment feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, checkpoint, c.decodeError(resp)
+	}
+
+	var feed paymentFeed
+	err = json.NewDecoder(resp.Body).Decode(&feed)
+	if err != nil {
+		return nil, checkpoint, fmt.Errorf("unable to decode json: %w", err)
+	}
+
+	// Enforce the feed contract client-side: strictly increasing sequences after
+	// the checkpoint and not beyond the watermark. Anything else would cause
+	// duplicates or gaps downstream.
+	next := checkpoint
+	payments := make([]*Payment, 0, len(feed.Payments))
+	for _, payment := range feed.Payments {
+		if payment.Sequence <= uint64(next) {
+			return nil, checkpoint, fmt.Errorf("payment feed out of order: sequence %d after %d", payment.Sequence, next)
+		}
+		if payment.Sequence > feed.Watermark {
+			break // Not yet stable; served again by a later call.
+		}
+		payments = append(payments, payment)
+		next = PaymentCheckpoint(payment.Sequence)
+	}
+	return payments, next, nil
+}
@@ -0,0 +1,128 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	neturl "net/url"
+	"time"
+)
+
+// PaymentListOptions filters and pages the payments returned by ListPayments
+// and GetSubscriberPaymentsPage.
+type PaymentListOptions struct {
+	ListOptions
+
+	From         time.Time // Earliest payment time, inclusive. Optional.
+	To           time.Time // Latest payment time, exclusive. Optional.
+	RegisteredBy string    // Only payments taken by this user. Optional.
+}
+
+// Validate reports whether the date range is valid.
+func (o *PaymentListOptions) Validate() error {
+	if o != nil && !o.From.IsZero() && !o.To.IsZero() && !o.From.Before(o.To) {
+		return fmt.Errorf("payment list From must be before To")
+	}
+	return nil
+}
+
+// query encodes the options as URL query parameters.
+func (o *PaymentListOptions) query() neturl.Values {
+	query := neturl.Values{}
+	if o == nil {
+		o = &PaymentListOptions{}
+	}
+
+	o.ListOptions.apply(query)
+	if !o.From.IsZero() {
+		query.Set("from", o.From.Format(time.RFC3339))
+	}
+	if !o.To.IsZero() {
+		query.Set("to", o.To.Format(time.RFC3339))
+	}
+	if o.RegisteredBy != "" {
+		query.Set("registered_by", o.RegisteredBy)
+	}
+	return query
+}
+
+// PaymentPage is a page of payments.
+type PaymentPage struct {
+	Payments    []*Payment `json:"data"`
+	NextCursor  string     `json:"next_cursor"`  // Empty on the last page.
+	Total       int        `json:"total"`        // Number of payments across all pages.
+	TotalAmount float64    `json:"total_amount"` // Sum of the amounts across all pages.
+}
+
+// HasMore reports whether there are more pages after this one.
+func (p *PaymentPage) HasMore() bool {
+	return p.NextCursor != ""
+}
+
+// ListPayments returns a page of the payments taken by the hospital, e.g to
+// reconcile a day's collections:
+//
+//	page, err := client.ListPayments(ctx, &ecloudsdk.PaymentListOptions{From: day, To: day.AddDate(0, 0, 1)})
+func (c *DefaultEcloudClient) ListPayments(ctx context.Context, opts *PaymentListOptions) (*PaymentPage, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	query := opts.query()
+	query.Set("hospital_number", c.cfg().HospitalNumber.String())
+
+	url := c.cfg().ApiBaseUrl + "/api/payments?" + query.Encode()
+	return c.fetchPaymentPage(ctx, url, nil)
+}
+
+// GetSubscriberPaymentsPage returns a page of the payments of a subscriber.
+func (c *DefaultEcloudClient) GetSubscriberPaymentsPage(ctx context.Context, subscriberID uint,
+	opts *PaymentListOptions) (*PaymentPage, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/api/payments/list/%d?%s", c.cfg().ApiBaseUrl, subscriberID, opts.query().Encode())
+	return c.fetchPaymentPage(ctx, url, ErrSubscriberNotFound)
+}
+
+// AllPayments iterates over the payments taken by the hospital, fetching pages
+// on demand. Iteration stops at the first error, which is yielded with a nil payment.
+func (c *DefaultEcloudClient) AllPayments(ctx context.Context, opts *PaymentListOptions) iter.Seq2[*Payment, error] {
+	filter := PaymentListOptions{}
+	if opts != nil {
+		filter = *opts
+	}
+
+	return paginate(&filter.ListOptions, func(page *ListOptions) ([]*Payment, string, error) {
+		next := filter
+		next.ListOptions = *page
+
+		payments, err := c.ListPayments(ctx, &next)
+		if err != nil {
+			return nil, "", err
+		}
+		return payments.Payments, payments.NextCursor, nil
+	})
+}
+
+func (c *DefaultEcloudClient) fetchPaymentPage(ctx context.Context, url string, notFound error) (*PaymentPage, error) {
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch payments: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, notFound)
+	}
+
+	page := &PaymentPage{}
+	err = json.NewDecoder(resp.Body).Decode(page)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return page, nil
+}
@@ -0,0 +1,549 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// PDF values are parsed to these types, int64, float64, bool, []any,
+// []byte (strings, undecoded) or nil.
+type (
+	dict    map[name]any
+	name    string
+	keyword string // A bare keyword e.g "obj" or "stream".
+)
+
+// ref is an indirect reference e.g "12 0 R".
+type ref struct {
+	num, gen int
+}
+
+// maxDepth limits the nesting of values and of references resolved.
+const maxDepth = 32
+
+// maxDecoded limits the size of a decompressed stream.
+const maxDecoded = 32 << 20
+
+var errUnexpectedEOF = errors.New("unexpected end of data")
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func isRegular(c byte) bool {
+	return !isSpace(c) && !isDelimiter(c)
+}
+
+// parser reads PDF values from data.
+type parser struct {
+	data []byte
+	pos  int
+}
+
+// skipSpace skips white space and comments.
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case isSpace(c):
+			p.pos++
+		case c == '%':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// keyword reads a run of regular characters, e.g a number or a keyword.
+func (p *parser) keyword() string {
+	start := p.pos
+	for p.pos < len(p.data) && isRegular(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+func (p *parser) int() (int64, error) {
+	p.skipSpace()
+	return strconv.ParseInt(p.keyword(), 10, 64)
+}
+
+func (p *parser) hasPrefix(prefix string) bool {
+	return bytes.HasPrefix(p.data[p.pos:], []byte(prefix))
+}
+
+// value reads the next value.
+func (p *parser) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("values nested too deep at offset %d", p.pos)
+	}
+
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, errUnexpectedEOF
+	}
+
+	switch c := p.data[p.pos]; c {
+	case '/':
+		p.pos++
+		return name(p.keyword()), nil
+	case '[':
+		p.pos++
+		var array []any
+		for {
+			p.skipSpace()
+			if p.hasPrefix("]") {
+				p.pos++
+				return array, nil
+			}
+
+			v, err := p.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, v)
+		}
+	case '<':
+		if p.hasPrefix("<<") {
+			return p.dict(depth)
+		}
+
+		end := bytes.IndexByte(p.data[p.pos:], '>')
+		if end < 0 {
+			return nil, errUnexpectedEOF
+		}
+		s := p.data[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+		return s, nil
+	case '(':
+		return p.literalString()
+	case ')', '>', ']', '{', '}':
+		return nil, fmt.Errorf("unexpected %q at offset %d", c, p.pos)
+	}
+
+	start := p.pos
+	token := p.keyword()
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	if n, err := strconv.ParseInt(token, 10, 64); err == nil {
+		// An integer may start a reference "num gen R".
+		end := p.pos
+		if gen, err := p.int(); err == nil && gen >= 0 && n >= 0 {
+			p.skipSpace()
+			if p.keyword() == "R" {
+				return ref{int(n), int(gen)}, nil
+			}
+		}
+		p.pos = end
+		return n, nil
+	}
+
+	if f, err := strconv.ParseFloat(token, 64); err == nil {
+		return f, nil
+	}
+
+	if token == "" {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.data[start], start)
+	}
+	return keyword(token), nil
+}
+
+func (p *parser) dict(depth int) (dict, error) {
+	p.pos += len("<<")
+	d := make(dict)
+	for {
+		p.skipSpace()
+		if p.hasPrefix(">>") {
+			p.pos += len(">>")
+			return d, nil
+		}
+
+		key, err := p.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		k, ok := key.(name)
+		if !ok {
+			return nil, fmt.Errorf("dictionary key is not a name at offset %d", p.pos)
+		}
+
+		if d[k], err = p.value(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// literalString reads a (string), which may contain balanced parentheses and
+// escapes. The string is returned undecoded.
+func (p *parser) literalString() ([]byte, error) {
+	start := p.pos + 1
+	open := 0
+	for ; p.pos < len(p.data); p.pos++ {
+		switch p.data[p.pos] {
+		case '\\':
+			p.pos++
+		case '(':
+			open++
+		case ')':
+			if open--; open == 0 {
+				p.pos++
+				return p.data[start : p.pos-1], nil
+			}
+		}
+	}
+	return nil, errUnexpectedEOF
+}
+
+// object is an indirect object.
+type object struct {
+	value  any
+	stream []byte // Raw data of a stream object, nil otherwise.
+}
+
+// objectPattern matches the header of an indirect object e.g "12 0 obj".
+var objectPattern = regexp.MustCompile(`(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+obj\b`)
+
+// document looks up the objects of a PDF document.
+type document struct {
+	data []byte
+
+	xref    map[int]int64 // Object offsets from the cross-reference tables.
+	scanned map[int]int   // Object offsets found by scanning, built on demand.
+	packed  map[int]any   // Objects of object streams, built on demand.
+	loading map[int]bool  // Objects being resolved, to break reference cycles.
+}
+
+func newDocument(data []byte) *document {
+	return &document{data: data, xref: make(map[int]int64), loading: make(map[int]bool)}
+}
+
+// parseObject parses the indirect object at offset. If num isn't negative,
+// the object must have that number.
+func (d *document) parseObject(offset int, num int) (*object, error) {
+	if offset < 0 || offset >= len(d.data) {
+		return nil, fmt.Errorf("object offset %d out of range", offset)
+	}
+
+	p := &parser{data: d.data, pos: offset}
+	n, err := p.int()
+	if err != nil || (num >= 0 && int(n) != num) {
+		return nil, fmt.Errorf("no object %d at offset %d", num, offset)
+	}
+
+	if _, err := p.int(); err != nil {
+		return nil, fmt.Errorf("no object %d at offset %d", num, offset)
+	}
+
+	p.skipSpace()
+	if p.keyword() != "obj" {
+		return nil, fmt.Errorf("no object %d at offset %d", num, offset)
+	}
+
+	value, err := p.value(0)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &object{value: value}
+	p.skipSpace()
+	if streamDict, ok := value.(dict); ok && p.hasPrefix("stream") {
+		p.pos += len("stream")
+		obj.stream = d.streamData(p.pos, streamDict)
+	}
+	return obj, nil
+}
+
+// streamData returns the data of the stream starting after the stream
+// keyword at start. A wrong /Length is recovered from by looking for
+// endstream, as viewers do.
+func (d *document) streamData(start int, streamDict dict) []byte {
+	if bytes.HasPrefix(d.data[start:], []byte("\r\n")) {
+		start += 2
+	} else if bytes.HasPrefix(d.data[start:], []byte("\n")) {
+		start++
+	}
+
+	if length, ok := d.resolve(streamDict["Length"]).(int64); ok && length >= 0 && int64(start)+length <= int64(len(d.data)) {
+		end := &parser{data: d.data, pos: start + int(length)}
+		end.skipSpace()
+		if end.keyword() == "endstream" {
+			return d.data[start : start+int(length)]
+		}
+	}
+
+	end := bytes.Index(d.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil
+	}
+	return bytes.TrimRight(d.data[start:start+end], "\r\n")
+}
+
+// resolve returns v with references replaced by the objects they point to.
+// A missing object resolves to nil.
+func (d *document) resolve(v any) any {
+	for depth := 0; depth < maxDepth; depth++ {
+		r, ok := v.(ref)
+		if !ok {
+			return v
+		}
+		v = d.lookup(r.num)
+	}
+	return nil
+}
+
+// lookup returns the value of object num: at its cross-reference offset,
+// else found by scanning the document, else in an object stream.
+func (d *document) lookup(num int) any {
+	if d.loading[num] {
+		return nil
+	}
+	d.loading[num] = true
+	defer delete(d.loading, num)
+
+	if offset, ok := d.xref[num]; ok {
+		if obj, err := d.parseObject(int(offset), num); err == nil {
+			return obj.value
+		}
+	}
+
+	if d.scanned == nil {
+		d.scan()
+	}
+
+	if offset, ok := d.scanned[num]; ok {
+		if obj, err := d.parseObject(offset, num); err == nil {
+			return obj.value
+		}
+	}
+
+	if d.packed == nil {
+		d.unpack()
+	}
+	return d.packed[num]
+}
+
+// scan indexes the objects of the document by their headers. The last
+// definition of an object wins, as in incremental updates.
+func (d *document) scan() {
+	d.scanned = make(map[int]int)
+	for _, match := range objectPattern.FindAllSubmatchIndex(d.data, -1) {
+		num, err := strconv.Atoi(string(d.data[match[2]:match[3]]))
+		if err == nil {
+			d.scanned[num] = match[0]
+		}
+	}
+}
+
+// unpack indexes the objects held in the object streams of the document.
+func (d *document) unpack() {
+	d.packed = make(map[int]any)
+	for _, offset := range d.scanned {
+		obj, err := d.parseObject(offset, -1)
+		if err != nil || obj.stream == nil {
+			continue
+		}
+
+		streamDict := obj.value.(dict)
+		if streamDict["Type"] != name("ObjStm") {
+			continue
+		}
+
+		data, err := decode(obj.stream, streamDict)
+		if err != nil {
+			continue
+		}
+
+		count, _ := streamDict["N"].(int64)
+		first, _ := streamDict["First"].(int64)
+		if first < 0 || first > int64(len(data)) {
+			continue
+		}
+
+		p := &parser{data: data}
+		for range count {
+			num, err := p.int()
+			if err != nil {
+				break
+			}
+
+			rel, err := p.int()
+			if err != nil || rel < 0 || first+rel >= int64(len(data)) {
+				break
+			}
+
+			value, err := (&parser{data: data, pos: int(first + rel)}).value(0)
+			if err != nil {
+				continue
+			}
+			if _, ok := d.packed[int(num)]; !ok {
+				d.packed[int(num)] = value
+			}
+		}
+	}
+}
+
+// decode returns the decompressed data of a stream. Only FlateDecode, the
+// filter of object and cross-reference streams, is supported.
+func decode(data []byte, streamDict dict) ([]byte, error) {
+	filter := streamDict["Filter"]
+	if filters, ok := filter.([]any); ok && len(filters) == 1 {
+		filter = filters[0]
+	}
+
+	switch filter {
+	case nil:
+		return data, nil
+	case name("FlateDecode"):
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		decoded, err := io.ReadAll(io.LimitReader(r, maxDecoded+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(decoded) > maxDecoded {
+			return nil, fmt.Errorf("stream larger than %d bytes", maxDecoded)
+		}
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("unsupported filter %v", filter)
+}
+
+// readXref parses the cross-reference table or stream at offset, adding its
+// offsets to those of newer sections, and returns its trailer.
+func (d *document) readXref(offset int64) (dict, bool, error) {
+	if offset < 0 || offset >= int64(len(d.data)) {
+		return nil, false, fmt.Errorf("%w: offset %d out of range", ErrBadXref, offset)
+	}
+
+	p := &parser{data: d.data, pos: int(offset)}
+	p.skipSpace()
+	if !p.hasPrefix("xref") {
+		trailer, err := d.readXrefStream(p.pos)
+		return trailer, true, err
+	}
+	p.pos += len("xref")
+
+	for {
+		p.skipSpace()
+		if p.hasPrefix("trailer") {
+			p.pos += len("trailer")
+			break
+		}
+
+		start, err := p.int()
+		if err != nil || start < 0 {
+			return nil, false, fmt.Errorf("%w: invalid subsection at offset %d", ErrBadXref, p.pos)
+		}
+
+		count, err := p.int()
+		// Entries take 20 bytes.
+		if err != nil || count < 0 || count > int64(len(d.data)-p.pos)/20+1 {
+			return nil, false, fmt.Errorf("%w: invalid subsection at offset %d", ErrBadXref, p.pos)
+		}
+
+		for i := range count {
+			entryOffset, err1 := p.int()
+			_, err2 := p.int()
+			p.skipSpace()
+			kind := p.keyword()
+			if err1 != nil || err2 != nil || (kind != "n" && kind != "f") {
+				return nil, false, fmt.Errorf("%w: invalid entry at offset %d", ErrBadXref, p.pos)
+			}
+
+			num := int(start + i)
+			if _, ok := d.xref[num]; !ok && kind == "n" {
+				d.xref[num] = entryOffset
+			}
+		}
+	}
+
+	value, err := p.value(0)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %w", ErrBadTrailer, err)
+	}
+
+	trailer, ok := value.(dict)
+	if !ok {
+		return nil, false, fmt.Errorf("%w: not a dictionary", ErrBadTrailer)
+	}
+	return trailer, false, nil
+}
+
+// readXrefStream parses the cross-reference stream at offset and returns its
+// dictionary, which is the trailer. The stream's entries aren't indexed;
+// objects are found by scanning instead.
+func (d *document) readXrefStream(offset int) (dict, error) {
+	obj, err := d.parseObject(offset, -1)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadXref, err)
+	}
+
+	streamDict, _ := obj.value.(dict)
+	if obj.stream == nil || streamDict["Type"] != name("XRef") {
+		return nil, fmt.Errorf("%w: no cross-reference at offset %d", ErrBadXref, offset)
+	}
+
+	// Check the stream holds as many entries as it declares: /Size objects
+	// or the counts of /Index, of the widths in /W, each row prefixed by a
+	// byte with PNG predictors.
+	widths, _ := streamDict["W"].([]any)
+	rowLen := 0
+	for _, w := range widths {
+		n, ok := w.(int64)
+		if !ok || n < 0 {
+			return nil, fmt.Errorf("%w: invalid /W", ErrBadXref)
+		}
+		rowLen += int(n)
+	}
+	if len(widths) != 3 || rowLen == 0 {
+		return nil, fmt.Errorf("%w: invalid /W", ErrBadXref)
+	}
+
+	params, _ := streamDict["DecodeParms"].(dict)
+	if predictor, _ := params["Predictor"].(int64); predictor >= 10 {
+		rowLen++
+	}
+
+	entries, _ := streamDict["Size"].(int64)
+	if index, ok := streamDict["Index"].([]any); ok {
+		entries = 0
+		for i := 1; i < len(index); i += 2 {
+			n, _ := index[i].(int64)
+			entries += n
+		}
+	}
+
+	data, err := decode(obj.stream, streamDict)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadXref, err)
+	}
+
+	if int64(len(data)) < entries*int64(rowLen) {
+		return nil, fmt.Errorf("%w: stream holds %d bytes, %d entries need %d", ErrBadXref,
+			len(data), entries, entries*int64(rowLen))
+	}
+	return streamDict, nil
+}
@@ -0,0 +1,226 @@
+// Package pdf validates PDF documents before they are uploaded. It checks the
+// structure a viewer needs to open a document: the header, the
+// cross-reference tables or streams, the trailer and the page tree. Documents
+// are not rendered, and the content of encrypted documents is not checked.
+//
+//	info, err := pdf.Validate(report, &pdf.Options{MaxSize: 20 << 20})
+//	if err != nil {
+//		return fmt.Errorf("invalid lab report: %w", err)
+//	}
+//	log.Printf("PDF %s, %d pages", info.Version, info.Pages)
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var (
+	ErrNotPDF      = errors.New("pdf: missing %PDF header")
+	ErrTooLarge    = errors.New("pdf: document too large")
+	ErrNoEOF       = errors.New("pdf: missing %%EOF marker")
+	ErrNoStartxref = errors.New("pdf: missing startxref")
+	ErrBadXref     = errors.New("pdf: malformed cross-reference")
+	ErrBadTrailer  = errors.New("pdf: malformed trailer")
+	ErrNoPages     = errors.New("pdf: document has no pages")
+)
+
+// TailLen is the number of bytes at the end of a document searched for the
+// %%EOF marker, as viewers do.
+const TailLen = 1024
+
+// Options configures Validate.
+type Options struct {
+	// Maximum size of the document in bytes. Zero means no limit.
+	MaxSize int64
+}
+
+// Info describes a valid document.
+type Info struct {
+	Version    string // PDF version e.g "1.7", from the header or the catalog if later.
+	Pages      int    // Number of pages, or 0 if the page tree is encrypted.
+	Size       int64  // Size of the document in bytes.
+	Encrypted  bool   // The document is encrypted, e.g password protected.
+	Linearized bool   // The document is optimized for incremental loading ("fast web view").
+	XrefStream bool   // The cross-reference is a stream (PDF 1.5+) rather than a table.
+
+	// The startxref offset was wrong and the cross-reference was found by
+	// scanning the document, as viewers do to open damaged files.
+	Repaired bool
+}
+
+var (
+	headerPattern = regexp.MustCompile(`^%PDF-([12]\.\d)`)
+	eofMarker     = []byte("%%EOF")
+)
+
+// Header checks the %PDF header at the start of data and returns the version
+// it declares. Only the first 8 bytes are needed, e.g to sniff a stream.
+func Header(data []byte) (string, error) {
+	match := headerPattern.FindSubmatch(data[:min(len(data), 8)])
+	if match == nil {
+		return "", ErrNotPDF
+	}
+	return string(match[1]), nil
+}
+
+// HasEOF reports whether the last TailLen bytes of a document contain the
+// %%EOF marker.
+func HasEOF(tail []byte) bool {
+	return bytes.Contains(tail[max(0, len(tail)-TailLen):], eofMarker)
+}
+
+// Validate checks the structure of the document in data and describes it.
+// opts may be nil.
+func Validate(data []byte, opts *Options) (*Info, error) {
+	info := &Info{Size: int64(len(data))}
+	if opts != nil && opts.MaxSize > 0 && info.Size > opts.MaxSize {
+		return nil, fmt.Errorf("%w: %d bytes, maximum is %d", ErrTooLarge, info.Size, opts.MaxSize)
+	}
+
+	version, err := Header(data)
+	if err != nil {
+		return nil, err
+	}
+	info.Version = version
+
+	tailStart := max(0, len(data)-TailLen)
+	eof := bytes.LastIndex(data[tailStart:], eofMarker)
+	if eof < 0 {
+		return nil, ErrNoEOF
+	}
+	eof += tailStart
+
+	startxref := lastKeyword(data[:eof], "startxref")
+	if startxref < 0 {
+		return nil, ErrNoStartxref
+	}
+
+	p := &parser{data: data[:eof], pos: startxref + len("startxref")}
+	p.skipSpace()
+	offset, err := strconv.ParseInt(p.keyword(), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid offset", ErrNoStartxref)
+	}
+
+	d := newDocument(data)
+	trailer, err := d.readTrailers(offset, startxref, info)
+	if err != nil {
+		return nil, err
+	}
+
+	info.Encrypted = trailer["Encrypt"] != nil
+	linearizedPages := d.linearized()
+	info.Linearized = linearizedPages >= 0
+
+	root, ok := trailer["Root"].(ref)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing /Root", ErrBadTrailer)
+	}
+
+	catalog, ok := d.resolve(root).(dict)
+	if !ok {
+		// Object streams of encrypted documents can't be read without the key.
+		if info.Encrypted {
+			info.Pages = max(linearizedPages, 0)
+			return info, nil
+		}
+		return nil, fmt.Errorf("%w: catalog %d %d R not found", ErrBadTrailer, root.num, root.gen)
+	}
+
+	if version, ok := catalog["Version"].(name); ok && string(version) > info.Version {
+		info.Version = string(version)
+	}
+
+	pages, _ := d.resolve(catalog["Pages"]).(dict)
+	count, _ := d.resolve(pages["Count"]).(int64)
+	if count < 1 {
+		return nil, ErrNoPages
+	}
+	info.Pages = int(count)
+	return info, nil
+}
+
+// readTrailers reads the cross-reference section at offset and those of the
+// previous revisions of the document, and returns the latest trailer.
+// startxref is the position of the startxref keyword, for repairs.
+func (d *document) readTrailers(offset int64, startxref int, info *Info) (dict, error) {
+	trailer, isStream, err := d.readXref(offset)
+	if err != nil {
+		// Fall back to the last cross-reference table.
+		repaired := lastKeyword(d.data[:startxref], "xref")
+		if repaired < 0 {
+			return nil, err
+		}
+
+		if trailer, isStream, err = d.readXref(int64(repaired)); err != nil {
+			return nil, err
+		}
+		info.Repaired = true
+	}
+	info.XrefStream = isStream
+
+	seen := map[int64]bool{offset: true}
+	prev := trailer
+	for {
+		offset, ok := prev["Prev"].(int64)
+		if !ok || seen[offset] {
+			break
+		}
+		seen[offset] = true
+
+		if prev, _, err = d.readXref(offset); err != nil {
+			// The offsets of damaged documents are all wrong; objects are
+			// found by scanning instead.
+			if info.Repaired {
+				break
+			}
+			return nil, fmt.Errorf("previous revision: %w", err)
+		}
+	}
+	return trailer, nil
+}
+
+// linearized returns the page count declared by the linearization
+// dictionary, which must be the first object of the document, or -1 if the
+// document isn't linearized.
+func (d *document) linearized() int {
+	match := objectPattern.FindSubmatchIndex(d.data[:min(len(d.data), TailLen)])
+	if match == nil {
+		return -1
+	}
+
+	obj, err := d.parseObject(match[0], -1)
+	if err != nil {
+		return -1
+	}
+
+	params, _ := obj.value.(dict)
+	if _, ok := params["Linearized"]; !ok {
+		return -1
+	}
+
+	pages, _ := params["N"].(int64)
+	return int(pages)
+}
+
+// lastKeyword returns the position of the last occurrence of keyword in data
+// as a whole token, or -1.
+func lastKeyword(data []byte, keyword string) int {
+	end := len(data)
+	for {
+		i := bytes.LastIndex(data[:end], []byte(keyword))
+		if i < 0 {
+			return -1
+		}
+
+		after := i + len(keyword)
+		if (i == 0 || !isRegular(data[i-1])) && (after == len(data) || !isRegular(data[after])) {
+			return i
+		}
+		end = i
+	}
+}
@@ -0,0 +1,202 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// builder writes PDF documents with correct cross-reference offsets.
+type builder struct {
+	buf     bytes.Buffer
+	pending []int // Objects written since the last cross-reference section.
+	offsets map[int]int
+}
+
+func newBuilder(version string) *builder {
+	b := &builder{offsets: make(map[int]int)}
+	b.buf.WriteString("%PDF-" + version + "\n%\xe2\xe3\xcf\xd3\n")
+	return b
+}
+
+func (b *builder) object(num int, body string) {
+	b.offsets[num] = b.buf.Len()
+	b.pending = append(b.pending, num)
+	fmt.Fprintf(&b.buf, "%d 0 obj\n%s\nendobj\n", num, body)
+}
+
+func (b *builder) stream(num int, dict string, data []byte) {
+	b.object(num, fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data))
+}
+
+// xref writes a cross-reference table of the objects written since the last
+// one and returns its offset.
+func (b *builder) xref(trailer string) int {
+	offset := b.buf.Len()
+	b.buf.WriteString("xref\n0 1\n0000000000 65535 f \n")
+	for _, num := range b.pending {
+		fmt.Fprintf(&b.buf, "%d 1\n%010d 00000 n \n", num, b.offsets[num])
+	}
+	b.pending = nil
+	fmt.Fprintf(&b.buf, "trailer\n%s\nstartxref\n%d\n%%%%EOF\n", trailer, offset)
+	return offset
+}
+
+func (b *builder) bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// simplePDF returns a document with the given number of pages.
+func simplePDF(pages int) []byte {
+	b := newBuilder("1.7")
+	b.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	b.object(2, fmt.Sprintf("<< /Type /Pages /Kids [3 0 R] /Count %d >>", pages))
+	b.object(3, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>")
+	b.stream(4, "", []byte("BT /F1 12 Tf (Hello \\) world) Tj ET"))
+	b.xref("<< /Size 5 /Root 1 0 R >>")
+	return b.bytes()
+}
+
+func TestValidate(t *testing.T) {
+	info, err := Validate(simplePDF(3), nil)
+	if err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if info.Version != "1.7" || info.Pages != 3 || info.Encrypted || info.Linearized || info.Repaired {
+		t.Errorf("unexpected info: %+v", info)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	valid := simplePDF(1)
+
+	tests := []struct {
+		name string
+		data []byte
+		opts *Options
+		want error
+	}{
+		{"empty", nil, nil, ErrNotPDF},
+		{"not a PDF", []byte("<html></html>"), nil, ErrNotPDF},
+		{"too large", valid, &Options{MaxSize: int64(len(valid) - 1)}, ErrTooLarge},
+		{"truncated", valid[:len(valid)/2], nil, ErrNoEOF},
+		{"no startxref", bytes.Replace(valid, []byte("startxref"), []byte("startxxxx"), 1), nil, ErrNoStartxref},
+		{"no pages", simplePDF(0), nil, ErrNoPages},
+		{"no root", bytes.Replace(valid, []byte("/Root 1 0 R"), []byte("/Info 1 0 R"), 1), nil, ErrBadTrailer},
+		{"bad xref", bytes.Replace(valid, []byte("0 1\n0000000000"), []byte("0 1\n000000000x"), 1), nil, ErrBadXref},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Validate(tt.data, tt.opts)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected error %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if _, err := Validate(valid, &Options{MaxSize: int64(len(valid))}); err != nil {
+		t.Errorf("expected a document of MaxSize to be valid, got %v", err)
+	}
+}
+
+func TestValidateRepaired(t *testing.T) {
+	// Bytes inserted after the header shift every offset.
+	data := simplePDF(2)
+	data = bytes.Replace(data, []byte("%PDF-1.7\n"), []byte("%PDF-1.7\n% "+strings.Repeat("x", 100)+"\n"), 1)
+
+	info, err := Validate(data, nil)
+	if err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if !info.Repaired || info.Pages != 2 {
+		t.Errorf("unexpected info: %+v", info)
+	}
+}
+
+func TestValidateLinearizedUpdate(t *testing.T) {
+	b := newBuilder("1.4")
+	b.object(1, "<< /Linearized 1 /L 1000 /N 2 /T 900 >>")
+	b.object(2, "<< /Type /Catalog /Pages 3 0 R >>")
+	b.object(3, "<< /Type /Pages /Kids [4 0 R 5 0 R] /Count 2 >>")
+	b.object(4, "<< /Type /Page /Parent 3 0 R >>")
+	b.object(5, "<< /Type /Page /Parent 3 0 R >>")
+	first := b.xref("<< /Size 6 /Root 2 0 R >>")
+
+	// An incremental update encrypting the document and declaring PDF 1.6.
+	b.object(2, "<< /Type /Catalog /Pages 3 0 R /Version /1.6 >>")
+	b.object(6, "<< /Filter /Standard /V 2 /R 3 >>")
+	b.xref(fmt.Sprintf("<< /Size 7 /Root 2 0 R /Encrypt 6 0 R /Prev %d >>", first))
+
+	info, err := Validate(b.bytes(), nil)
+	if err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if !info.Linearized || !info.Encrypted || info.Pages != 2 || info.Version != "1.6" {
+		t.Errorf("unexpected info: %+v", info)
+	}
+
+	broken := bytes.Replace(b.bytes(), fmt.Appendf(nil, "/Prev %d", first), []byte("/Prev 5"), 1)
+	if _, err := Validate(broken, nil); !errors.Is(err, ErrBadXref) {
+		t.Errorf("expected error %v for a broken /Prev, got %v", ErrBadXref, err)
+	}
+}
+
+func TestValidateXrefStream(t *testing.T) {
+	b := newBuilder("1.5")
+
+	// The catalog and page tree are compressed in an object stream.
+	catalog := "<< /Type /Catalog /Pages 3 0 R /Version /2.0 >>"
+	objects := catalog + " << /Type /Pages /Kids [4 0 R] /Count 1 >>"
+	header := fmt.Sprintf("2 0 3 %d ", len(catalog)+1)
+	b.stream(1, fmt.Sprintf("/Type /ObjStm /N 2 /First %d /Filter /FlateDecode", len(header)),
+		deflate([]byte(header+objects)))
+	b.object(4, "<< /Type /Page /Parent 3 0 R >>")
+
+	// Entries of 1+2+1 bytes for objects 0 to 5.
+	var entries []byte
+	entries = append(entries, 0, 0, 0, 0xff)
+	entries = append(entries, 1, byte(b.offsets[1]>>8), byte(b.offsets[1]), 0)
+	entries = append(entries, 2, 0, 1, 0, 2, 0, 1, 1)
+	entries = append(entries, 1, byte(b.offsets[4]>>8), byte(b.offsets[4]), 0)
+	offset := b.buf.Len()
+	entries = append(entries, 1, byte(offset>>8), byte(offset), 0)
+	b.stream(5, "/Type /XRef /Size 6 /W [1 2 1] /Root 2 0 R /Filter /FlateDecode", deflate(entries))
+	fmt.Fprintf(&b.buf, "startxref\n%d\n%%%%EOF\n", offset)
+
+	info, err := Validate(b.bytes(), nil)
+	if err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if !info.XrefStream || info.Pages != 1 || info.Version != "2.0" {
+		t.Errorf("unexpected info: %+v", info)
+	}
+
+	short := bytes.Replace(b.bytes(), []byte("/Size 6"), []byte("/Size 9"), 1)
+	if _, err := Validate(short, nil); !errors.Is(err, ErrBadXref) {
+		t.Errorf("expected error %v for a short xref stream, got %v", ErrBadXref, err)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	if version, err := Header([]byte("%PDF-2.0\n")); err != nil || version != "2.0" {
+		t.Errorf("Header() = %q, %v", version, err)
+	}
+	if _, err := Header([]byte("%PDF")); err != ErrNotPDF {
+		t.Errorf("expected error %v, got %v", ErrNotPDF, err)
+	}
+	if !HasEOF([]byte("trailer\n%%EOF\r\n")) || HasEOF([]byte("trailer\n")) {
+		t.Error("HasEOF() mismatch")
+	}
+}
@@ -0,0 +1,134 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+)
+
+// PDFAConverter converts reports to PDF/A before upload, for hospitals whose
+// archival policy requires it. Set it with Config.PDFAConverter; when nil,
+// reports are uploaded as they are.
+type PDFAConverter interface {
+	// ConvertToPDFA returns the PDF/A version of pdf.
+	ConvertToPDFA(ctx context.Context, pdf []byte) ([]byte, error)
+}
+
+// PDFAConverterFunc adapts a function to the PDFAConverter interface.
+type PDFAConverterFunc func(ctx context.Context, pdf []byte) ([]byte, error)
+
+// ConvertToPDFA calls f(ctx, pdf).
+func (f PDFAConverterFunc) ConvertToPDFA(ctx context.Context, pdf []byte) ([]byte, error) {
+	return f(ctx, pdf)
+}
+
+// pdfaIdentification matches the PDF/A part declared in the XMP metadata, as an
+// attribute (pdfaid:part="2") or an element (<pdfaid:part>2</pdfaid:part>).
+var pdfaIdentification = regexp.MustCompile(`pdfaid:part(?:\s*=\s*["']|>)\s*[1-4]`)
+
+// IsPDFA reports whether pdf declares PDF/A conformance in its XMP metadata.
+// It doesn't validate the document against the standard.
+func IsPDFA(pdf []byte) bool {
+	return isValidPDF(pdf) && pdfaIdentification.Match(pdf)
+}
+
+// GhostscriptConverter converts reports to PDF/A-2b with Ghostscript.
+type GhostscriptConverter struct {
+	// Path of the gs executable. Defaults to "gs" looked up in PATH.
+	Path string
+
+	// Extra arguments passed before the input file, e.g a PDFA_def.ps
+	// with the ICC profile of the hospital's documents. Optional.
+	Args []string
+}
+
+// ConvertToPDFA implements PDFAConverter.
+func (g *GhostscriptConverter) ConvertToPDFA(ctx context.Context, pdf []byte) ([]byte, error) {
+	path := g.Path
+	if path == "" {
+		path = "gs"
+	}
+
+	dir, err := os.MkdirTemp("", "ecloud-pdfa-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input, output := filepath.Join(dir, "input.pdf"), filepath.Join(dir, "output.pdf")
+	if err := os.WriteFile(input, pdf, 0o600); err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"-dPDFA=2", "-dBATCH", "-dNOPAUSE", "-dQUIET",
+		"-sDEVICE=pdfwrite", "-sColorConversionStrategy=RGB",
+		"-dPDFACompatibilityPolicy=1", "-sOutputFile=" + output,
+	}
+	args = append(args, g.Args...)
+	args = append(args, input)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ghostscript: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return os.ReadFile(output)
+}
+
+// convertToPDFA returns a copy of the record with its reports converted with
+// Config.PDFAConverter, or the record itself if there is nothing to convert.
+// Streamed reports are read into memory for the conversion.
+func (c *DefaultEcloudClient) convertToPDFA(ctx context.Context, record *PatientRecord) (*PatientRecord, error) {
+	converter := c.cfg().PDFAConverter
+	if converter == nil {
+		return record, nil
+	}
+
+	converted := *record
+	reports := []struct {
+		name   string
+		data   *[]byte
+		reader *io.Reader
+	}{
+		{"medical report", &converted.MedicalReport, &converted.MedicalReportReader},
+		{"lab report", &converted.LabReport, &converted.LabReportReader},
+	}
+
+	for _, report := range reports {
+		if *report.data == nil && *report.reader != nil {
+			data, err := io.ReadAll(*report.reader)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read %s: %w", report.name, err)
+			}
+			*report.data, *report.reader = data, nil
+		}
+
+		// Invalid PDFs are left to the upload checks.
+		if *report.data == nil || !isValidPDF(*report.data) || IsPDFA(*report.data) {
+			continue
+		}
+
+		var data []byte
+		var err error
+		panicErr := safeCall(c.logger, "PDFAConverter", func() {
+			data, err = converter.ConvertToPDFA(ctx, *report.data)
+		})
+		if panicErr != nil {
+			err = panicErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to convert %s to PDF/A: %w", report.name, err)
+		}
+
+		c.logger.Debug("converted %s of visit %d to PDF/A\n", report.name, record.VisitID)
+		*report.data = data
+	}
+	return &converted, nil
+}
@@ -0,0 +1,48 @@
+package ecloudsdk
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DataExport is the result of the operation of RequestDataExport.
+type DataExport struct {
+	URL       string    `json:"url"`        // Download URL of the archive.
+	Size      int64     `json:"size"`       // Size of the archive in bytes.
+	ExpiresAt time.Time `json:"expires_at"` // When the URL stops working.
+}
+
+// RequestDataExport asks ecloud to archive the records and payments of a
+// subscriber, e.g to answer a patient's access request. Wait for the
+// operation, then Decode its result into a DataExport.
+// Fails with ErrSubscriberNotFound if there is no such subscriber.
+func (c *DefaultEcloudClient) RequestDataExport(ctx context.Context, subscriberID uint) (*Operation, error) {
+	url := fmt.Sprintf("%s/api/subscriptions/%d/export", c.cfg().ApiBaseUrl, subscriberID)
+	op, err := c.startOperation(ctx, url, struct{}{}, ErrSubscriberNotFound)
+	if err != nil {
+		return nil, fmt.Errorf("unable to request data export: %w", err)
+	}
+	return op, nil
+}
+
+// RequestErasure asks ecloud to erase a subscriber and their records, e.g
+// when a patient withdraws consent. Erasure can't be undone; the reason is
+// kept in ecloud's audit log. Wait for the operation to know when the data
+// is gone. Fails with ErrSubscriberNotFound if there is no such subscriber.
+func (c *DefaultEcloudClient) RequestErasure(ctx context.Context, subscriberID uint, reason string) (*Operation, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, fmt.Errorf("erasure reason must not be empty")
+	}
+
+	url := fmt.Sprintf("%s/api/subscriptions/%d/erasure", c.cfg().ApiBaseUrl, subscriberID)
+	op, err := c.startOperation(ctx, url, map[string]string{"reason": reason}, ErrSubscriberNotFound)
+	if err != nil {
+		return nil, fmt.Errorf("unable to request erasure: %w", err)
+	}
+
+	c.cache.invalidate(subscriberID)
+	return op, nil
+}
@@ -0,0 +1,90 @@
+package ecloudsdk
+
+import (
+	"context"
+	"io"
+)
+
+type progressKey struct{}
+
+// Progress is the state of an upload or download, see WithProgress.
+type Progress struct {
+	// "SyncMedicalRecords" for record uploads, including those of SyncVisit
+	// and SyncMedicalRecordsBatch, "UploadLargeReport" or "DownloadReport".
+	Operation string
+
+	Bytes int64 // Report bytes transferred so far.
+	Total int64 // Report bytes to transfer, or -1 if unknown.
+
+	// Metadata of the record, without its reports. Only ID is set for downloads.
+	Record *PatientRecord
+}
+
+// Fraction returns the fraction of the transfer done, from 0 to 1,
+// or -1 if the total is unknown.
+func (p Progress) Fraction() float64 {
+	if p.Total < 0 {
+		return -1
+	}
+
+	if p.Total == 0 || p.Bytes >= p.Total {
+		return 1
+	}
+	return float64(p.Bytes) / float64(p.Total)
+}
+
+// ProgressFunc receives the progress of transfers, see WithProgress.
+type ProgressFunc func(progress Progress)
+
+// WithProgress returns a context that reports the progress of the report
+// uploads and downloads made with it to fn: SyncMedicalRecords, SyncVisit,
+// SyncMedicalRecordsBatch, UploadLargeReport and DownloadReport.
+//
+// fn is called from the goroutine doing the transfer each time data moves, so
+// it must be fast, e.g post to the UI thread. Concurrent transfers call it
+// concurrently. A retried upload starts again from zero bytes.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// progressTracker reports the progress of a transfer. A nil tracker reports nothing.
+type progressTracker struct {
+	logger   Logger
+	fn       ProgressFunc
+	progress Progress
+}
+
+// newProgress returns the tracker of a transfer, or nil if ctx has no ProgressFunc.
+func (c *DefaultEcloudClient) newProgress(ctx context.Context, operation string, record *PatientRecord,
+	total int64) *progressTracker {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	if fn == nil {
+		return nil
+	}
+	return &progressTracker{logger: c.logger, fn: fn,
+		progress: Progress{Operation: operation, Total: total, Record: record}}
+}
+
+// set reports that bytes were transferred in total.
+func (t *progressTracker) set(bytes int64) {
+	if t == nil {
+		return
+	}
+
+	t.progress.Bytes = bytes
+	safeCall(t.logger, "ProgressFunc", func() { t.fn(t.progress) })
+}
+
+func (t *progressTracker) add(n int64) {
+	if t != nil {
+		t.set(t.progress.Bytes + n)
+	}
+}
+
+// reader returns r, reporting the bytes read from it.
+func (t *progressTracker) reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &countingReader{r: r, count: t.add}
+}
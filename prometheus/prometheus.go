@@ -0,0 +1,258 @@
+// Package prometheus exports the metrics of ecloud clients in the Prometheus
+// text exposition format, without depending on the Prometheus client library.
+//
+//	collector := prometheus.NewCollector()
+//	config.Metrics = collector
+//	http.Handle("/metrics", collector)
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	ecloudsdk "github.com/abiiranathan/ecloud-sdk"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the request duration histogram.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// ContentType of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Collector implements ecloudsdk.Metrics and serves the collected metrics:
+//
+//   - ecloud_requests_total{method, endpoint, code}: HTTP attempts, code is
+//     empty when no response was received.
+//   - ecloud_request_duration_seconds{method, endpoint}: histogram of attempt latencies.
+//   - ecloud_retries_total{method, endpoint}: attempts that were retries.
+//   - ecloud_request_errors_total{class}: failed attempts by error class.
+//   - ecloud_upload_bytes_total{method, endpoint}: request body bytes sent.
+//
+// A Collector may be shared by several clients.
+type Collector struct {
+	buckets []float64
+
+	mu          sync.Mutex
+	requests    map[requestKey]uint64
+	durations   map[endpointKey]*histogram
+	retries     map[endpointKey]uint64
+	errors      map[string]uint64
+	uploadBytes map[endpointKey]uint64
+}
+
+type endpointKey struct {
+	method, endpoint string
+}
+
+type requestKey struct {
+	endpointKey
+	code int
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative.
+	count  uint64
+	sum    float64
+}
+
+// NewCollector returns a Collector using DefaultBuckets.
+func NewCollector() *Collector {
+	return NewCollectorWithBuckets(DefaultBuckets)
+}
+
+// NewCollectorWithBuckets returns a Collector with the given histogram bucket
+// upper bounds, in seconds.
+func NewCollectorWithBuckets(buckets []float64) *Collector {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+
+	return &Collector{
+		buckets:     buckets,
+		requests:    make(map[requestKey]uint64),
+		durations:   make(map[endpointKey]*histogram),
+		retries:     make(map[endpointKey]uint64),
+		errors:      make(map[string]uint64),
+		uploadBytes: make(map[endpointKey]uint64),
+	}
+}
+
+// ObserveRequest implements ecloudsdk.Metrics.
+func (c *Collector) ObserveRequest(request ecloudsdk.RequestMetric) {
+	key := endpointKey{method: request.Method, endpoint: request.Endpoint}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests[requestKey{endpointKey: key, code: request.StatusCode}]++
+
+	if request.Duration > 0 {
+		h := c.durations[key]
+		if h == nil {
+			h = &histogram{counts: make([]uint64, len(c.buckets))}
+			c.durations[key] = h
+		}
+
+		seconds := request.Duration.Seconds()
+		if i, _ := slices.BinarySearch(c.buckets, seconds); i < len(c.buckets) {
+			h.counts[i]++
+		}
+		h.count++
+		h.sum += seconds
+	}
+
+	if request.Retry() {
+		c.retries[key]++
+	}
+
+	if request.ErrorClass != ecloudsdk.ErrorClassNone {
+		c.errors[request.ErrorClass]++
+	}
+
+	if request.BytesSent > 0 {
+		c.uploadBytes[key] += uint64(request.BytesSent)
+	}
+}
+
+// ServeHTTP serves the metrics for scraping.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	c.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the text exposition format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := &countingWriter{w: bufio.NewWriter(w)}
+
+	out.header("ecloud_requests_total", "counter", "HTTP attempts made by the ecloud client.")
+	for _, key := range sortedKeys(c.requests, compareRequestKeys) {
+		code := ""
+		if key.code != 0 {
+			code = strconv.Itoa(key.code)
+		}
+		out.sample("ecloud_requests_total", key.labels("code", code), float64(c.requests[key]))
+	}
+
+	out.header("ecloud_request_duration_seconds", "histogram", "Latency of HTTP attempts until the response headers.")
+	for _, key := range sortedKeys(c.durations, compareEndpointKeys) {
+		h := c.durations[key]
+
+		var cumulative uint64
+		for i, bound := range c.buckets {
+			cumulative += h.counts[i]
+			out.sample("ecloud_request_duration_seconds_bucket", key.labels("le", formatFloat(bound)), float64(cumulative))
+		}
+		out.sample("ecloud_request_duration_seconds_bucket", key.labels("le", "+Inf"), float64(h.count))
+		out.sample("ecloud_request_duration_seconds_sum", key.labels(), h.sum)
+		out.sample("ecloud_request_duration_seconds_count", key.labels(), float64(h.count))
+	}
+
+	out.header("ecloud_retries_total", "counter", "HTTP attempts that were retries.")
+	for _, key := range sortedKeys(c.retries, compareEndpointKeys) {
+		out.sample("ecloud_retries_total", key.labels(), float64(c.retries[key]))
+	}
+
+	out.header("ecloud_request_errors_total", "counter", "Failed HTTP attempts by error class.")
+	for _, class := range sortedKeys(c.errors, strings.Compare) {
+		out.sample("ecloud_request_errors_total", formatLabels("class", class), float64(c.errors[class]))
+	}
+
+	out.header("ecloud_upload_bytes_total", "counter", "Request body bytes sent to ecloud.")
+	for _, key := range sortedKeys(c.uploadBytes, compareEndpointKeys) {
+		out.sample("ecloud_upload_bytes_total", key.labels(), float64(c.uploadBytes[key]))
+	}
+
+	if out.err == nil {
+		out.err = out.w.Flush()
+	}
+	return out.n, out.err
+}
+
+func (k endpointKey) labels(extra ...string) string {
+	return formatLabels(append([]string{"method", k.method, "endpoint", k.endpoint}, extra...)...)
+}
+
+func compareEndpointKeys(a, b endpointKey) int {
+	if c := strings.Compare(a.endpoint, b.endpoint); c != 0 {
+		return c
+	}
+	return strings.Compare(a.method, b.method)
+}
+
+func compareRequestKeys(a, b requestKey) int {
+	if c := compareEndpointKeys(a.endpointKey, b.endpointKey); c != 0 {
+		return c
+	}
+	return a.code - b.code
+}
+
+func sortedKeys[K comparable, V any](m map[K]V, compare func(a, b K) int) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, compare)
+	return keys
+}
+
+// formatLabels formats name-value pairs as {name="value",...}.
+func formatLabels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// countingWriter writes lines, keeping the first error and the bytes written.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) printf(format string, args ...any) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *countingWriter) header(name, kind, help string) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (w *countingWriter) sample(name, labels string, value float64) {
+	w.printf("%s%s %s\n", name, labels, formatFloat(value))
+}
@@ -0,0 +1,53 @@
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ecloudsdk "github.com/abiiranathan/ecloud-sdk"
+)
+
+func TestCollector(t *testing.T) {
+	collector := NewCollectorWithBuckets([]float64{1, 0.1})
+	collector.ObserveRequest(ecloudsdk.RequestMetric{
+		Method: "POST", Endpoint: "/api/records", StatusCode: 503,
+		Duration: 50 * time.Millisecond, ErrorClass: ecloudsdk.ErrorClassServer, BytesSent: 1024,
+	})
+	collector.ObserveRequest(ecloudsdk.RequestMetric{
+		Method: "POST", Endpoint: "/api/records", StatusCode: 200, Attempt: 1,
+		Duration: 500 * time.Millisecond, BytesSent: 1024,
+	})
+	collector.ObserveRequest(ecloudsdk.RequestMetric{
+		Method: "GET", Endpoint: `/api/"odd"`, ErrorClass: ecloudsdk.ErrorClassNetwork,
+	})
+
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Header().Get("Content-Type") != ContentType {
+		t.Errorf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE ecloud_requests_total counter\n",
+		`ecloud_requests_total{method="GET",endpoint="/api/\"odd\"",code=""} 1` + "\n",
+		`ecloud_requests_total{method="POST",endpoint="/api/records",code="200"} 1` + "\n",
+		`ecloud_requests_total{method="POST",endpoint="/api/records",code="503"} 1` + "\n",
+		`ecloud_request_duration_seconds_bucket{method="POST",endpoint="/api/records",le="0.1"} 1` + "\n",
+		`ecloud_request_duration_seconds_bucket{method="POST",endpoint="/api/records",le="1"} 2` + "\n",
+		`ecloud_request_duration_seconds_bucket{method="POST",endpoint="/api/records",le="+Inf"} 2` + "\n",
+		`ecloud_request_duration_seconds_sum{method="POST",endpoint="/api/records"} 0.55` + "\n",
+		`ecloud_retries_total{method="POST",endpoint="/api/records"} 1` + "\n",
+		`ecloud_request_errors_total{class="network"} 1` + "\n",
+		`ecloud_request_errors_total{class="server"} 1` + "\n",
+		`ecloud_upload_bytes_total{method="POST",endpoint="/api/records"} 2048` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in:\n%s", want, body)
+		}
+	}
+}
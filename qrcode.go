@@ -0,0 +1,74 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxQRCodeSize bounds the QR code image read into memory.
+const maxQRCodeSize = 1 << 20
+
+// GetSubscriberQRCode returns a PNG QR code for the subscriber's card.
+// The code encodes a verification token that ResolveQRCode exchanges
+// for the subscription, so triage can scan the printed card.
+func (c *DefaultEcloudClient) GetSubscriberQRCode(ctx context.Context, subscriberID uint) ([]byte, error) {
+	url := fmt.Sprintf("%s/api/subscriptions/%d/qrcode", c.cfg().ApiBaseUrl, subscriberID)
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, map[string]string{"Accept": "image/png"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch QR code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
+	}
+
+	image, err := io.ReadAll(io.LimitReader(resp.Body, maxQRCodeSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read QR code: %w", err)
+	}
+
+	if len(image) > maxQRCodeSize {
+		return nil, fmt.Errorf("QR code exceeds maximum size of %d bytes", maxQRCodeSize)
+	}
+	return image, nil
+}
+
+// ResolveQRCode returns the subscription of the patient whose card encodes token.
+func (c *DefaultEcloudClient) ResolveQRCode(ctx context.Context, token string) (*Subscriber, error) {
+	// Scanners commonly append a newline.
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, fmt.Errorf("QR code token must not be empty")
+	}
+
+	data, err := json.Marshal(map[string]string{"token": token})
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	url := c.cfg().ApiBaseUrl + "/api/subscriptions/qrcode/resolve"
+	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve QR code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
+	}
+
+	subscriber := &Subscriber{}
+	err = json.NewDecoder(resp.Body).Decode(subscriber)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode subscriber json: %w", err)
+	}
+
+	c.reportWarnings("ResolveQRCode", subscriber.Warnings)
+	return subscriber, nil
+}
@@ -0,0 +1,793 @@
+package ecloudsdk
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of UploadQueueConfig.
+const (
+	DefaultQueuePollInterval = 30 * time.Second
+	DefaultQueueBaseDelay    = 30 * time.Second
+	DefaultQueueMaxDelay     = 30 * time.Minute
+)
+
+// QueuedRecord is a record waiting in an UploadQueue.
+type QueuedRecord struct {
+	ID         string         `json:"id"`
+	Record     *PatientRecord `json:"record"` // The reports and attachments are held in memory unless spilled.
+	EnqueuedAt time.Time      `json:"enqueued_at"`
+
+	// The reports and attachments kept on disk, see UploadQueueConfig.SpillDir.
+	Spilled *SpilledFiles `json:"spilled,omitempty"`
+
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"last_attempt,omitzero"` // Zero until the first failed attempt.
+	LastError   string    `json:"last_error,omitempty"`
+	NextAttempt time.Time `json:"next_attempt,omitzero"`
+
+	// The upload was rejected by ecloud (e.g a validation error), so the
+	// record is only retried by Flush. Fix the cause or Remove it.
+	Failed bool `json:"failed,omitempty"`
+
+	// Version of the format the record is persisted in. Records are always
+	// marshaled in the current format, and older records are migrated to it
+	// when unmarshaled, see QueueStore.
+	Version int `json:"version"`
+
+	migratedFrom int // Version the record was unmarshaled from, if older.
+}
+
+// queueMigrations[i] migrates the JSON fields of a queued record from
+// version i+1 to version i+2. Records written before versioning are version 1.
+// When the format of QueuedRecord or PatientRecord changes incompatibly,
+// append a migration so that records queued by older SDKs still upload.
+var queueMigrations = []func(fields map[string]json.RawMessage) error{
+	// Version 2 added Spilled. Version 1 records hold their files in Record.
+	func(fields map[string]json.RawMessage) error { return nil },
+}
+
+// queueVersion returns the current version of the format of queued records.
+func queueVersion() int {
+	return len(queueMigrations) + 1
+}
+
+// MarshalJSON encodes the record in the current format.
+func (r QueuedRecord) MarshalJSON() ([]byte, error) {
+	type plain QueuedRecord
+	p := plain(r)
+	p.Version = queueVersion()
+	return json.Marshal(p)
+}
+
+// UnmarshalJSON decodes a record, migrating it from the format of an older
+// SDK. Records written by a newer SDK fail with ErrQueueVersionUnsupported.
+func (r *QueuedRecord) UnmarshalJSON(data []byte) error {
+	type plain QueuedRecord
+
+	var header struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+
+	version, current := 1, queueVersion()
+	if header.Version != nil {
+		version = *header.Version
+	}
+
+	if version > current {
+		return fmt.Errorf("%w: version %d, supported up to %d", ErrQueueVersionUnsupported, version, current)
+	}
+	if version < 1 {
+		return fmt.Errorf("invalid queued record version %d", version)
+	}
+
+	if version < current {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+
+		for v := version; v < current; v++ {
+			if err := queueMigrations[v-1](fields); err != nil {
+				return fmt.Errorf("unable to migrate queued record from version %d: %w", v, err)
+			}
+		}
+
+		var err error
+		if data, err = json.Marshal(fields); err != nil {
+			return err
+		}
+	}
+
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+
+	r.Version, r.migratedFrom = current, 0
+	if version < current {
+		r.migratedFrom = version
+	}
+	return nil
+}
+
+// QueueStore persists the records of an UploadQueue across restarts.
+//
+// Stores that persist records as JSON get the format migrations of
+// QueuedRecord.UnmarshalJSON, so records queued before an SDK upgrade are
+// still uploaded. They should keep records they can't decode because a newer
+// SDK wrote them, rather than delete them.
+type QueueStore interface {
+	// Put stores item, replacing the item with the same ID.
+	Put(ctx context.Context, item *QueuedRecord) error
+
+	// List returns the stored items, oldest first.
+	List(ctx context.Context) ([]*QueuedRecord, error)
+
+	// Delete removes the item with the given ID. Deleting a missing item is not an error.
+	Delete(ctx context.Context, id string) error
+}
+
+// MemoryQueueStore is a QueueStore that keeps records in memory.
+// Queued records are lost when the process exits.
+type MemoryQueueStore struct {
+	mu    sync.Mutex
+	items map[string]QueuedRecord
+}
+
+// NewMemoryQueueStore creates an empty MemoryQueueStore.
+func NewMemoryQueueStore() *MemoryQueueStore {
+	return &MemoryQueueStore{items: make(map[string]QueuedRecord)}
+}
+
+func (s *MemoryQueueStore) Put(ctx context.Context, item *QueuedRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[item.ID] = *item
+	return nil
+}
+
+func (s *MemoryQueueStore) List(ctx context.Context) ([]*QueuedRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := make([]*QueuedRecord, 0, len(s.items))
+	for _, item := range s.items {
+		items = append(items, &item)
+	}
+	sortQueuedRecords(items)
+	return items, nil
+}
+
+func (s *MemoryQueueStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, id)
+	return nil
+}
+
+// FileQueueStore is a QueueStore that keeps each record in a compressed JSON
+// file of a directory readable only by the current user, with the reports
+// that an UploadQueue didn't spill.
+//
+// Records in an older format, or uncompressed, are rewritten in the current
+// one by the UploadQueue before its first upload, List itself doesn't rewrite
+// them; records written by a newer SDK are left in place and skipped. Records failing their integrity check (see ErrQueueCorrupted) are
+// renamed with a ".corrupt" suffix for inspection and skipped.
+//
+// The SDK has no dependencies outside the standard library, so the default
+// store is a plain directory rather than an embedded database such as bbolt or
+// SQLite. Each record is written atomically (temporary file, fsync, rename),
+// so a crash never leaves a partial record, but records are not written
+// together in transactions. Implement QueueStore to use a database instead.
+//
+// Queued records and spilled reports hold patient data and are not encrypted
+// by the SDK: keep the directory on an encrypted volume, e.g BitLocker,
+// FileVault or LUKS.
+type FileQueueStore struct {
+	// Compression of the files written, gzip by default. Set it to nil to
+	// write uncompressed JSON.
+	Compression *QueueCompression
+
+	dir string
+}
+
+// NewFileQueueStore creates a FileQueueStore backed by dir.
+// The directory is created on the first Put.
+func NewFileQueueStore(dir string) *FileQueueStore {
+	return &FileQueueStore{dir: dir, Compression: GzipQueueCompression(gzip.DefaultCompression)}
+}
+
+func (s *FileQueueStore) Put(ctx context.Context, item *QueuedRecord) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("unable to create queue directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".queued-*")
+	if err != nil {
+		return fmt.Errorf("unable to write queued record: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, _, err := writeQueueFile(tmp, bytes.NewReader(data), s.Compression, -1); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write queued record: %w", err)
+	}
+
+	// The record must survive a power cut once Enqueue has returned.
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write queued record: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write queued record: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path(item.ID)); err != nil {
+		return fmt.Errorf("unable to write queued record: %w", err)
+	}
+	return nil
+}
+
+func (s *FileQueueStore) List(ctx context.Context) ([]*QueuedRecord, error) {
+	items, _, err := s.list()
+	return items, err
+}
+
+// list returns the stored items, and those of them whose file is in an older
+// format or uncompressed. It only writes to set corrupted files aside.
+func (s *FileQueueStore) list() (items, outdated []*QueuedRecord, err error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read queue directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		data, compressed, err := s.read(id)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // Deleted since ReadDir.
+		}
+		if errors.Is(err, ErrQueueCorrupted) {
+			os.Rename(s.path(id), s.path(id)+".corrupt")
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read queued record %s: %w", id, err)
+		}
+
+		item := &QueuedRecord{}
+		err = json.Unmarshal(data, item)
+		if errors.Is(err, ErrQueueVersionUnsupported) {
+			continue // Kept for the SDK that wrote it, e.g after a downgrade.
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to decode queued record %s: %w", id, err)
+		}
+
+		if item.migratedFrom != 0 || (!compressed && s.Compression != nil) {
+			outdated = append(outdated, item)
+		}
+		items = append(items, item)
+	}
+	sortQueuedRecords(items)
+	return items, outdated, nil
+}
+
+// migrate rewrites the records in an older format, or uncompressed, in the
+// current one. It must not run concurrently with Delete, which the rewrite
+// could undo, so the UploadQueue calls it while processing.
+func (s *FileQueueStore) migrate(ctx context.Context) error {
+	_, outdated, err := s.list()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range outdated {
+		if err := s.Put(ctx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FileQueueStore) Delete(ctx context.Context, id string) error {
+	err := os.Remove(s.path(id))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("unable to delete queued record: %w", err)
+	}
+	return nil
+}
+
+// read returns the JSON of a record, and whether its file is compressed.
+func (s *FileQueueStore) read(id string) ([]byte, bool, error) {
+	file, err := os.Open(s.path(id))
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	r, compressed, err := decodeQueueFile(bufio.NewReader(file), s.Compression)
+	if err != nil {
+		return nil, false, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	return data, compressed, err
+}
+
+func (s *FileQueueStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func sortQueuedRecords(items []*QueuedRecord) {
+	slices.SortFunc(items, func(a, b *QueuedRecord) int {
+		if c := a.EnqueuedAt.Compare(b.EnqueuedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
+
+// UploadQueueConfig configures an UploadQueue.
+type UploadQueueConfig struct {
+	// Where queued records are persisted. Defaults to a FileQueueStore in Dir.
+	Store QueueStore
+
+	// Directory of the default FileQueueStore. Required if Store is nil.
+	Dir string
+
+	// How often records due for a retry are uploaded. Defaults to DefaultQueuePollInterval.
+	PollInterval time.Duration
+
+	// Bounds of the exponential backoff between the attempts of a record.
+	// Default to DefaultQueueBaseDelay and DefaultQueueMaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// Directory where the reports and attachments of queued records are kept,
+	// so that they aren't held in memory, e.g on terminals with little RAM.
+	// Files shared by several records are stored once, and removed once the
+	// last record using them is uploaded. Defaults to the "spill"
+	// subdirectory of Dir; without Dir, records are held by the Store. It
+	// must not be Dir itself.
+	SpillDir string
+
+	// Maximum total size of the files in SpillDir, in bytes. Queuing a record
+	// that would exceed it fails with ErrSpillFull. Zero means no limit.
+	MaxSpillSize int64
+
+	// Compression of the spilled files and of the records of the default
+	// FileQueueStore, e.g GzipQueueCompression(gzip.BestSpeed) on slow
+	// terminals. Defaults to gzip at its default level.
+	Compression *QueueCompression
+
+	// Logger for queue progress. Defaults to the NoOpLogger.
+	Logger Logger
+}
+
+// QueueStatus summarizes the records waiting in an UploadQueue.
+type QueueStatus struct {
+	Pending     int       // Records waiting for connectivity.
+	Failed      int       // Records rejected by ecloud, see QueuedRecord.Failed.
+	Oldest      time.Time // When the oldest record was queued. Zero if the queue is empty.
+	NextAttempt time.Time // Earliest scheduled retry of a pending record.
+	LastError   string    // Error of the most recent failed attempt.
+}
+
+// UploadQueue uploads records through a RecordsService, queuing them in a
+// persistent store while ecloud can't be reached. Queued records are retried
+// with exponential backoff by Run, and all at once as soon as an upload
+// succeeds again.
+type UploadQueue struct {
+	records   RecordsService
+	store     QueueStore
+	interval  time.Duration
+	backoff   *BackoffPolicy
+	logger    Logger
+	now       func() time.Time
+	reconnect chan struct{}
+	spill     *spillStore // Nil if records are held by the store.
+
+	// Serializes uploads of queued records, so none is uploaded twice.
+	processMu sync.Mutex
+	migrated  bool // Whether the FileQueueStore was migrated, guarded by processMu.
+}
+
+// NewUploadQueue creates an UploadQueue uploading records through the given RecordsService.
+func NewUploadQueue(records RecordsService, config UploadQueueConfig) (*UploadQueue, error) {
+	compression := config.Compression
+	if compression == nil {
+		compression = GzipQueueCompression(gzip.DefaultCompression)
+	}
+
+	store := config.Store
+	if store == nil {
+		if config.Dir == "" {
+			return nil, ErrQueueStoreRequired
+		}
+		fileStore := NewFileQueueStore(config.Dir)
+		fileStore.Compression = compression
+		store = fileStore
+	}
+
+	q := &UploadQueue{
+		records:   records,
+		store:     store,
+		interval:  config.PollInterval,
+		backoff:   NewBackoffPolicy(0, config.BaseDelay, config.MaxDelay),
+		logger:    config.Logger,
+		now:       time.Now,
+		reconnect: make(chan struct{}, 1),
+	}
+
+	spillDir := config.SpillDir
+	if spillDir == "" && config.Dir != "" {
+		spillDir = filepath.Join(config.Dir, "spill")
+	}
+	if spillDir != "" && config.Dir != "" && sameDir(spillDir, config.Dir) {
+		return nil, fmt.Errorf("upload queue SpillDir must not be its Dir %q", config.Dir)
+	}
+	if spillDir != "" {
+		q.spill = newSpillStore(spillDir, config.MaxSpillSize, store, compression)
+	}
+
+	if q.interval <= 0 {
+		q.interval = DefaultQueuePollInterval
+	}
+
+	if q.backoff.BaseDelay <= 0 {
+		q.backoff.BaseDelay = DefaultQueueBaseDelay
+	}
+
+	if q.backoff.MaxDelay <= 0 {
+		q.backoff.MaxDelay = DefaultQueueMaxDelay
+	}
+
+	if q.logger == nil {
+		q.logger = &NoOpLogger{}
+	} else {
+		q.logger = safeLogger{q.logger}
+	}
+	return q, nil
+}
+
+// sameDir reports whether a and b are the same directory, compared by their
+// absolute paths.
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
+
+// Sync uploads record now, or queues it if ecloud can't be reached (network
+// errors, timeouts, 5xx and 429 responses, open circuit). It reports whether
+// the record was queued. Other errors, like validation errors, are returned
+// and the record is not queued.
+func (q *UploadQueue) Sync(ctx context.Context, record *PatientRecord) (queued bool, err error) {
+	item, err := newQueuedRecord(ctx, record, q.now(), q.spill)
+	if err != nil {
+		return false, err
+	}
+
+	err = q.upload(ctx, item)
+	if err == nil {
+		q.spill.release(item.Spilled)
+		signal(q.reconnect) // Connectivity is back, retry the queue.
+		return false, nil
+	}
+
+	if ctx.Err() != nil || !isTransientUploadError(err) {
+		q.spill.release(item.Spilled)
+		return false, err
+	}
+
+	q.logger.Info("ecloud unreachable, queuing record of visit %d: %v\n", record.VisitID, err)
+	q.failed(item, err)
+	if err := q.store.Put(ctx, item); err != nil {
+		q.spill.release(item.Spilled)
+		return false, fmt.Errorf("unable to queue record: %w", err)
+	}
+	return true, nil
+}
+
+// Enqueue queues record for upload by Run or Flush, without trying to upload it first.
+func (q *UploadQueue) Enqueue(ctx context.Context, record *PatientRecord) (*QueuedRecord, error) {
+	item, err := newQueuedRecord(ctx, record, q.now(), q.spill)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.store.Put(ctx, item); err != nil {
+		q.spill.release(item.Spilled)
+		return nil, fmt.Errorf("unable to queue record: %w", err)
+	}
+	return item, nil
+}
+
+// newQueuedRecord validates record and copies it with its reports, so the
+// queued record can be persisted and uploaded more than once. The reports
+// are moved to spill if set, otherwise they are held in memory.
+func newQueuedRecord(ctx context.Context, record *PatientRecord, now time.Time, spill *spillStore) (*QueuedRecord, error) {
+	if err := record.Validate(); err != nil {
+		return nil, fmt.Errorf("validation error: %w", err)
+	}
+
+	copied := *record
+	copied.files = nil
+	copied.Attachments = slices.Clone(record.Attachments)
+
+	item := &QueuedRecord{ID: rand.Text(), Record: &copied, EnqueuedAt: now}
+	if spill != nil {
+		if err := spill.spill(ctx, item); err != nil {
+			return nil, err
+		}
+		return item, nil
+	}
+
+	reports := []struct {
+		name   string
+		data   *[]byte
+		reader *io.Reader
+	}{
+		{"medical report", &copied.MedicalReport, &copied.MedicalReportReader},
+		{"lab report", &copied.LabReport, &copied.LabReportReader},
+	}
+
+	for _, report := range reports {
+		if *report.data == nil && *report.reader != nil {
+			data, err := io.ReadAll(*report.reader)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read %s: %w", report.name, err)
+			}
+			*report.data = data
+		}
+		*report.reader = nil
+	}
+
+	for i := range copied.Attachments {
+		a := &copied.Attachments[i]
+		if a.Data == nil {
+			data, err := io.ReadAll(a.Reader)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read attachment %q: %w", a.Name, err)
+			}
+			a.Data = data
+		}
+		a.Reader = nil
+	}
+	return item, nil
+}
+
+// upload uploads the record of item, reading its spilled files from disk.
+func (q *UploadQueue) upload(ctx context.Context, item *QueuedRecord) error {
+	record, closeFiles, err := q.spill.open(item)
+	if err != nil {
+		return err
+	}
+	defer closeFiles()
+
+	return q.records.SyncMedicalRecords(ctx, record)
+}
+
+// Run uploads queued records until ctx is cancelled: records due for a retry
+// every PollInterval, and every pending record once an upload through Sync
+// succeeds.
+func (q *UploadQueue) Run(ctx context.Context) error {
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	all := false
+	for {
+		var err error
+		safeCall(q.logger, "UploadQueue", func() { _, err = q.process(ctx, all, false) })
+		if err != nil && ctx.Err() == nil {
+			q.logger.Error("upload queue: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			all = false
+		case <-q.reconnect:
+			all = true
+		}
+	}
+}
+
+// Flush tries to upload every queued record now, failed ones included,
+// ignoring the backoff. It stops at the first upload failing because
+// ecloud can't be reached and returns the number of records uploaded.
+func (q *UploadQueue) Flush(ctx context.Context) (int, error) {
+	return q.process(ctx, true, true)
+}
+
+// process uploads the queued records that are due, or all pending ones, and
+// failed ones if retryFailed is set.
+func (q *UploadQueue) process(ctx context.Context, all, retryFailed bool) (int, error) {
+	q.processMu.Lock()
+	defer q.processMu.Unlock()
+
+	// Uploaded records release their spilled files.
+	if err := q.spill.init(ctx); err != nil {
+		return 0, err
+	}
+
+	// Migrated while no record is uploaded and deleted, which the rewrite
+	// would bring back.
+	if store, ok := q.store.(*FileQueueStore); ok && !q.migrated {
+		if err := store.migrate(ctx); err != nil {
+			return 0, err
+		}
+		q.migrated = true
+	}
+
+	items, err := q.store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx = WithBackgroundPriority(ctx)
+	uploaded := 0
+	for _, item := range items {
+		if item.Failed && !retryFailed {
+			continue
+		}
+		if !all && q.now().Before(item.NextAttempt) {
+			continue
+		}
+
+		err := q.upload(ctx, item)
+		if ctx.Err() != nil {
+			return uploaded, ctx.Err()
+		}
+
+		if err == nil {
+			uploaded++
+			q.logger.Debug("uploaded queued record of visit %d\n", item.Record.VisitID)
+			if err := q.store.Delete(ctx, item.ID); err != nil {
+				return uploaded, err
+			}
+			q.spill.release(item.Spilled)
+			continue
+		}
+
+		q.failed(item, err)
+		if err := q.store.Put(ctx, item); err != nil {
+			return uploaded, err
+		}
+
+		// Still offline, the other records would fail the same way.
+		if !item.Failed {
+			return uploaded, fmt.Errorf("unable to upload queued record of visit %d: %w", item.Record.VisitID, err)
+		}
+		q.logger.Error("queued record of visit %d rejected: %v\n", item.Record.VisitID, err)
+	}
+	return uploaded, nil
+}
+
+// failed records a failed attempt of item and schedules the next one.
+func (q *UploadQueue) failed(item *QueuedRecord, err error) {
+	item.Attempts++
+	item.LastAttempt = q.now()
+	item.LastError = err.Error()
+	item.Failed = !isTransientUploadError(err)
+	item.NextAttempt = q.now().Add(q.backoff.BackoffDuration(item.Attempts - 1))
+}
+
+// Status summarizes the queued records.
+func (q *UploadQueue) Status(ctx context.Context) (QueueStatus, error) {
+	items, err := q.store.List(ctx)
+	if err != nil {
+		return QueueStatus{}, err
+	}
+
+	var status QueueStatus
+	var lastAttempt time.Time
+	for _, item := range items {
+		if status.Oldest.IsZero() || item.EnqueuedAt.Before(status.Oldest) {
+			status.Oldest = item.EnqueuedAt
+		}
+
+		if item.Failed {
+			status.Failed++
+		} else {
+			status.Pending++
+			if status.NextAttempt.IsZero() || item.NextAttempt.Before(status.NextAttempt) {
+				status.NextAttempt = item.NextAttempt
+			}
+		}
+
+		if item.LastError != "" && item.LastAttempt.After(lastAttempt) {
+			status.LastError = item.LastError
+			lastAttempt = item.LastAttempt
+		}
+	}
+	return status, nil
+}
+
+// Remove discards a queued record, e.g one that failed.
+func (q *UploadQueue) Remove(ctx context.Context, id string) error {
+	q.processMu.Lock()
+	defer q.processMu.Unlock()
+
+	if q.spill == nil {
+		return q.store.Delete(ctx, id)
+	}
+	if err := q.spill.init(ctx); err != nil {
+		return err
+	}
+
+	items, err := q.store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if item.ID == id {
+			if err := q.store.Delete(ctx, id); err != nil {
+				return err
+			}
+			q.spill.release(item.Spilled)
+			break
+		}
+	}
+	return nil
+}
+
+// isTransientUploadError reports whether an upload failed because ecloud
+// couldn't be reached or was temporarily unavailable, so retrying later may succeed.
+func isTransientUploadError(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrBandwidthBudgetExceeded) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		// 401: the session expired and couldn't be refreshed yet.
+		return apiErr.StatusCode >= http.StatusInternalServerError ||
+			apiErr.StatusCode == http.StatusTooManyRequests ||
+			apiErr.StatusCode == http.StatusRequestTimeout ||
+			apiErr.StatusCode == http.StatusUnauthorized
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
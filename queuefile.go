@@ -0,0 +1,300 @@
+package ecloudsdk
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// queueFileMagic starts the header of the compressed files of an upload
+// queue: "ecloud-queue/1 <encoding> <size> <sha256>\n", followed by the
+// compressed content. The size and SHA-256 are those of the uncompressed
+// content and are checked as it is read back. Files without a header were
+// written uncompressed, e.g by an older SDK.
+const queueFileMagic = "ecloud-queue/1 "
+
+// QueueCompression compresses the records and spilled files that an
+// UploadQueue writes to disk. Use GzipQueueCompression, or plug in another
+// encoding, e.g zstd from a third-party package.
+type QueueCompression struct {
+	// Name of the encoding, stored in each file e.g "zstd". Files are read
+	// back with the compression of the same name, or gzip.
+	Encoding string
+
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+// GzipQueueCompression returns gzip compression at level, from
+// gzip.HuffmanOnly to gzip.BestCompression. gzip files are always readable,
+// whatever the compression configured.
+func GzipQueueCompression(level int) *QueueCompression {
+	return &QueueCompression{
+		Encoding:  "gzip",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, level) },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	}
+}
+
+// decoder returns the reader of files compressed with encoding.
+func (c *QueueCompression) decoder(encoding string) (func(io.Reader) (io.ReadCloser, error), error) {
+	if c != nil && c.Encoding == encoding {
+		return c.NewReader, nil
+	}
+	if encoding == "gzip" {
+		return GzipQueueCompression(gzip.DefaultCompression).NewReader, nil
+	}
+	return nil, fmt.Errorf("queue file compressed with unsupported encoding %q", encoding)
+}
+
+// queueFileHeader is the header of a compressed queue file.
+type queueFileHeader struct {
+	encoding string
+	size     int64
+	sha256   string
+}
+
+// String formats the header with a fixed width, so that it can be written
+// before the content and rewritten once the size and SHA-256 are known.
+func (h queueFileHeader) String() string {
+	return fmt.Sprintf("%s%s %016d %064s\n", queueFileMagic, h.encoding, h.size, h.sha256)
+}
+
+// readQueueFileHeader reads the header of a queue file, if it has one.
+func readQueueFileHeader(r *bufio.Reader) (*queueFileHeader, error) {
+	if prefix, _ := r.Peek(len(queueFileMagic)); string(prefix) != queueFileMagic {
+		return nil, nil
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("%w: truncated header", ErrQueueCorrupted)
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(line, queueFileMagic))
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("%w: invalid header", ErrQueueCorrupted)
+	}
+
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("%w: invalid header", ErrQueueCorrupted)
+	}
+	return &queueFileHeader{encoding: fields[0], size: size, sha256: fields[2]}, nil
+}
+
+// writeQueueFile writes the content of r to file, compressed with c unless it
+// is nil, and returns the size and hex SHA-256 of the content. Writes beyond
+// limit bytes fail with ErrSpillFull, unless limit is negative.
+func writeQueueFile(file *os.File, r io.Reader, c *QueueCompression, limit int64) (int64, string, error) {
+	var w io.Writer = file
+	if limit >= 0 {
+		w = &limitWriter{w: file, n: limit}
+	}
+
+	sum := sha256.New()
+	if c == nil {
+		n, err := io.Copy(io.MultiWriter(w, sum), r)
+		return n, hex.EncodeToString(sum.Sum(nil)), err
+	}
+
+	header := queueFileHeader{encoding: c.Encoding}
+	if _, err := io.WriteString(w, header.String()); err != nil {
+		return 0, "", err
+	}
+
+	zw, err := c.NewWriter(w)
+	if err != nil {
+		return 0, "", fmt.Errorf("unable to compress queue file: %w", err)
+	}
+
+	n, err := io.Copy(io.MultiWriter(zw, sum), r)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	header.size, header.sha256 = n, hex.EncodeToString(sum.Sum(nil))
+	if _, err := file.WriteAt([]byte(header.String()), 0); err != nil {
+		return 0, "", err
+	}
+	return n, header.sha256, nil
+}
+
+// limitWriter fails with ErrSpillFull once more than n bytes are written.
+type limitWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, ErrSpillFull
+	}
+
+	n, err := l.w.Write(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// decodeQueueFile returns the content of a queue file read from r, decompressed
+// and checked against its header as it is read, and whether the file was
+// compressed. Uncompressed files are returned as they are.
+func decodeQueueFile(r *bufio.Reader, c *QueueCompression) (io.ReadCloser, bool, error) {
+	header, err := readQueueFileHeader(r)
+	if err != nil {
+		return nil, false, err
+	}
+	if header == nil {
+		return io.NopCloser(r), false, nil
+	}
+
+	decoder, err := c.decoder(header.encoding)
+	if err != nil {
+		return nil, false, err
+	}
+
+	zr, err := decoder(r)
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %w", ErrQueueCorrupted, err)
+	}
+	return &verifyingReader{r: zr, header: header, sum: sha256.New()}, true, nil
+}
+
+// verifyingReader fails with ErrQueueCorrupted if the content read doesn't
+// match the size and SHA-256 of its header.
+type verifyingReader struct {
+	r      io.ReadCloser
+	header *queueFileHeader
+	sum    hash.Hash
+	n      int64
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.sum.Write(p[:n])
+	v.n += int64(n)
+
+	switch {
+	case err == io.EOF:
+		if v.n != v.header.size || hex.EncodeToString(v.sum.Sum(nil)) != v.header.sha256 {
+			return n, fmt.Errorf("%w: content doesn't match its checksum", ErrQueueCorrupted)
+		}
+	case err != nil:
+		return n, fmt.Errorf("%w: %w", ErrQueueCorrupted, err)
+	case v.n > v.header.size:
+		return n, fmt.Errorf("%w: content longer than its header", ErrQueueCorrupted)
+	}
+	return n, err
+}
+
+func (v *verifyingReader) Close() error {
+	return v.r.Close()
+}
+
+// spilledFile reads a compressed spilled file. It implements io.Seeker, so
+// that uploads can be retried, by decompressing the file again from the start.
+type spilledFile struct {
+	file        *os.File
+	compression *QueueCompression
+	size        int64 // Of the uncompressed content.
+
+	r    io.ReadCloser // Decompressed content, read up to read.
+	read int64
+	pos  int64
+}
+
+// openSpilledFile opens a spilled file, compressed or not.
+func openSpilledFile(path string, c *QueueCompression) (io.ReadSeekCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := readQueueFileHeader(bufio.NewReader(file))
+	if err == nil && header != nil {
+		_, err = c.decoder(header.encoding)
+	}
+	if err == nil && header == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if header == nil {
+		return file, nil
+	}
+	return &spilledFile{file: file, compression: c, size: header.size}, nil
+}
+
+func (f *spilledFile) Read(p []byte) (int, error) {
+	if f.r == nil || f.read > f.pos {
+		if err := f.rewind(); err != nil {
+			return 0, err
+		}
+	}
+
+	if f.read < f.pos {
+		n, err := io.CopyN(io.Discard, f.r, f.pos-f.read)
+		f.read += n
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.r.Read(p)
+	f.read += int64(n)
+	f.pos = f.read
+	return n, err
+}
+
+// rewind decompresses the file again from the start.
+func (f *spilledFile) rewind() error {
+	if f.r != nil {
+		f.r.Close()
+	}
+
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	r, _, err := decodeQueueFile(bufio.NewReader(f.file), f.compression)
+	if err != nil {
+		return err
+	}
+	f.r, f.read = r, 0
+	return nil
+}
+
+func (f *spilledFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.size
+	}
+
+	if offset < 0 {
+		return 0, fmt.Errorf("seek to negative offset %d", offset)
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *spilledFile) Close() error {
+	if f.r != nil {
+		f.r.Close()
+	}
+	return f.file.Close()
+}
@@ -0,0 +1,67 @@
+package ecloudsdk
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+)
+
+// PanicError reports a panic recovered from a user-provided callback or a background worker.
+// The SDK recovers these panics so a faulty callback cannot crash the HMS or stop
+// long-running subsystems like the SyncManager and WatchSubscribers.
+type PanicError struct {
+	Source string // The callback or worker that panicked e.g "WarningHandler".
+	Value  any    // The value passed to panic.
+	Stack  []byte // Stack trace of the panicking goroutine.
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s: %v", e.Source, e.Value)
+}
+
+// safeCall runs fn, recovering from any panic.
+// A recovered panic is logged to logger and returned as a *PanicError.
+func safeCall(logger Logger, source string, fn func()) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			panicErr := &PanicError{Source: source, Value: value, Stack: debug.Stack()}
+			logger.Error("recovered %v\n%s", panicErr, panicErr.Stack)
+			err = panicErr
+		}
+	}()
+
+	fn()
+	return nil
+}
+
+// safeLogger wraps a user-provided Logger and discards panics from it,
+// since there is nowhere left to report them.
+type safeLogger struct {
+	logger Logger
+}
+
+func (l safeLogger) Debug(msg string, args ...any) {
+	defer func() { recover() }()
+	l.logger.Debug(msg, args...)
+}
+
+func (l safeLogger) Info(msg string, args ...any) {
+	defer func() { recover() }()
+	l.logger.Info(msg, args...)
+}
+
+func (l safeLogger) Error(msg string, args ...any) {
+	defer func() { recover() }()
+	l.logger.Error(msg, args...)
+}
+
+func (l safeLogger) Warn(msg string, args ...any) {
+	defer func() { recover() }()
+	logWarn(l.logger, msg, args...)
+}
+
+func (l safeLogger) Log(ctx context.Context, level slog.Level, msg string, args ...any) {
+	defer func() { recover() }()
+	logStructured(ctx, l.logger, level, msg, args...)
+}
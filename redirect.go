@@ -0,0 +1,87 @@
+package ecloudsdk
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxRedirects is the number of redirects followed when
+// RedirectPolicy.MaxRedirects is zero.
+const DefaultMaxRedirects = 5
+
+// RedirectPolicy controls how the SDK follows 3xx responses. The zero value
+// follows up to DefaultMaxRedirects redirects on the same host.
+//
+// A rejected redirect fails the request with ErrRedirectRejected and is not retried.
+type RedirectPolicy struct {
+	// Maximum number of redirects followed. Defaults to DefaultMaxRedirects;
+	// negative disables redirects.
+	MaxRedirects int
+
+	// Follow redirects to other hosts. Credentials (Authorization, Cookie
+	// and X-Api-Key headers) are never sent to another host.
+	AllowCrossHost bool
+}
+
+// redirectCredentialHeaders are removed when a redirect changes host.
+var redirectCredentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key"}
+
+// CheckRedirect applies the policy to a redirect. It is an http.Client
+// CheckRedirect function: the SDK's internal client uses Config.RedirectPolicy,
+// and clients provided with Config.HTTPClient can use it too:
+//
+//	httpClient := &http.Client{CheckRedirect: (&ecloudsdk.RedirectPolicy{}).CheckRedirect}
+//
+// Redirects from HTTPS to HTTP are always rejected.
+func (p *RedirectPolicy) CheckRedirect(req *http.Request, via []*http.Request) error {
+	maxRedirects := p.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = DefaultMaxRedirects
+	}
+
+	from := via[len(via)-1].URL
+	if len(via) > maxRedirects {
+		return fmt.Errorf("%w: %s %s: stopped after %d redirects", ErrRedirectRejected,
+			req.Method, from.Redacted(), max(maxRedirects, 0))
+	}
+
+	if from.Scheme == "https" && req.URL.Scheme != "https" {
+		return fmt.Errorf("%w: %s to %s downgrades to %s", ErrRedirectRejected, from.Redacted(),
+			req.URL.Redacted(), req.URL.Scheme)
+	}
+
+	if strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+		return nil
+	}
+
+	if !p.AllowCrossHost {
+		return fmt.Errorf("%w: %s to another host %s", ErrRedirectRejected, from.Redacted(), req.URL.Host)
+	}
+
+	for _, header := range redirectCredentialHeaders {
+		req.Header.Del(header)
+	}
+	return nil
+}
+
+// checkRedirect returns the CheckRedirect function of the internal client,
+// which also rejects redirects to hosts outside Config.AllowedHosts.
+func checkRedirect(config *Config) func(req *http.Request, via []*http.Request) error {
+	policy := redirectPolicy(config)
+	return func(req *http.Request, via []*http.Request) error {
+		if !hostAllowed(config.AllowedHosts, req.URL) {
+			return fmt.Errorf("%w: %s to %w %q", ErrRedirectRejected, via[len(via)-1].URL.Redacted(),
+				ErrHostNotAllowed, req.URL.Host)
+		}
+		return policy.CheckRedirect(req, via)
+	}
+}
+
+// redirectPolicy returns the redirect policy of the config.
+func redirectPolicy(config *Config) *RedirectPolicy {
+	if config.RedirectPolicy != nil {
+		return config.RedirectPolicy
+	}
+	return &RedirectPolicy{}
+}
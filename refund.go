@@ -0,0 +1,102 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Refund is money returned on a payment, e.g after a clerk entered the wrong amount.
+type Refund struct {
+	ID        uint      `json:"id"`
+	PaymentID uint      `json:"payment_id"`
+	Amount    float64   `json:"amount"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+
+	// The payment after the refund, with RefundedAmount and ValidTo updated.
+	Payment *Payment `json:"payment,omitempty"`
+}
+
+// RefundPayment refunds part or all of a payment. The server rejects refunds
+// exceeding the amount not yet refunded with a 422 (see ErrUnprocessable).
+// Retries carry the same idempotency key, see WithIdempotencyKey.
+func (c *DefaultEcloudClient) RefundPayment(ctx context.Context, paymentID uint, amount float64, reason string) (*Refund, error) {
+	if paymentID == 0 {
+		return nil, fmt.Errorf("payment id must not be zero")
+	}
+	if amount <= 0 || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return nil, fmt.Errorf("refund amount must be greater than zero")
+	}
+	if err := c.checkAmount(amount); err != nil {
+		return nil, err
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, fmt.Errorf("refund reason must not be empty")
+	}
+
+	data, err := json.Marshal(map[string]any{"amount": amount, "reason": reason})
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/payments/%d/refund", c.cfg().ApiBaseUrl, paymentID)
+
+	key := idempotencyKeyFor(ctx)
+	headers := map[string]string{IdempotencyKeyHeader: key}
+
+	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), headers)
+	if err != nil {
+		return nil, fmt.Errorf("unable to refund payment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrPaymentNotFound)
+	}
+
+	refund := &Refund{}
+	err = json.NewDecoder(resp.Body).Decode(refund)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+
+	c.cache.invalidate(0)
+	return refund, nil
+}
+
+// VoidPayment cancels a payment entered in error and returns the voided payment.
+// Voided payments no longer extend the subscription. Payments that were
+// already refunded cannot be voided (see ErrConflict).
+func (c *DefaultEcloudClient) VoidPayment(ctx context.Context, paymentID uint) (*Payment, error) {
+	if paymentID == 0 {
+		return nil, fmt.Errorf("payment id must not be zero")
+	}
+
+	url := fmt.Sprintf("%s/api/payments/%d/void", c.cfg().ApiBaseUrl, paymentID)
+	resp, err := c.performRequest(ctx, http.MethodPost, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to void payment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrPaymentNotFound)
+	}
+
+	payment := &Payment{}
+	err = json.NewDecoder(resp.Body).Decode(payment)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+
+	c.cache.invalidate(payment.SubscriberID)
+	c.reportWarnings("VoidPayment", payment.Warnings)
+	return payment, nil
+}
@@ -0,0 +1,53 @@
+package ecloudsdk
+
+import (
+	"context"
+	"fmt"
+)
+
+// UpdateConfig applies update to a copy of the current config, validates it and
+// atomically swaps it in, so long-running daemons can pick up rotated passwords,
+// new base URLs or transport settings without recreating the client.
+// Requests already in flight finish with the previous settings.
+//
+// The HTTP transport is rebuilt from the new config, and if the client was
+// authenticated and the base URL or credentials changed, it logs in again.
+// A failed re-authentication is returned but the new config stays in effect,
+// since the old credentials are usually no longer valid after a rotation.
+//
+// The logger cannot be changed after the client is created.
+func (c *DefaultEcloudClient) UpdateConfig(ctx context.Context, update func(*Config)) error {
+	c.mu.Lock()
+
+	previous := c.config
+	next := *previous
+	update(&next)
+
+	if err := next.Validate(); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+
+	c.config = &next
+	c.httpClient, c.retryPolicy = newTransport(&next)
+	c.mu.Unlock()
+
+	c.bandwidth.setBudget(next.DailyBandwidthBudget)
+	c.cache.reset()
+
+	// The residency must be verified again against the new deployment or region.
+	if next.ApiBaseUrl != previous.ApiBaseUrl || next.ResidencyRegion != previous.ResidencyRegion {
+		c.residency.reset()
+	}
+
+	credentialsChanged := next.ApiBaseUrl != previous.ApiBaseUrl ||
+		next.EclinicId != previous.EclinicId ||
+		next.Password != previous.Password
+
+	if credentialsChanged && c.IsAuthenticated() {
+		if _, err := c.authenticate(ctx); err != nil {
+			return fmt.Errorf("config updated but re-authentication failed: %w", err)
+		}
+	}
+	return nil
+}
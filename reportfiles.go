@@ -0,0 +1,164 @@
+package ecloudsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// attachmentExtensions maps extensions missing from the system MIME
+// database to content types.
+var attachmentExtensions = map[string]string{
+	".dcm":   DICOMContentType,
+	".dicom": DICOMContentType,
+}
+
+// detectContentType returns the MIME type of a file from its extension, else
+// from its first bytes.
+func detectContentType(file *os.File) (string, error) {
+	ext := strings.ToLower(filepath.Ext(file.Name()))
+	if contentType, ok := attachmentExtensions[ext]; ok {
+		return contentType, nil
+	}
+
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err == nil {
+			return mediaType, nil
+		}
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return sniffContentType(head[:n]), nil
+}
+
+// openFile opens a file to upload with the record. It is closed by Close.
+func (pr *PatientRecord) openFile(path string) (*os.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err == nil && info.IsDir() {
+		err = fmt.Errorf("%s is a directory", path)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	pr.files = append(pr.files, file)
+	return file, nil
+}
+
+// AttachMedicalReportFile sets the medical report to the PDF at path, which is
+// streamed from disk when the record is uploaded. Call Close once the record
+// is uploaded.
+func (pr *PatientRecord) AttachMedicalReportFile(path string) error {
+	file, err := pr.openFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to open medical report: %w", err)
+	}
+	pr.MedicalReport, pr.MedicalReportReader = nil, file
+	return nil
+}
+
+// AttachLabReportFile sets the lab report to the PDF at path, which is
+// streamed from disk when the record is uploaded. Call Close once the record
+// is uploaded.
+func (pr *PatientRecord) AttachLabReportFile(path string) error {
+	file, err := pr.openFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to open lab report: %w", err)
+	}
+	pr.LabReport, pr.LabReportReader = nil, file
+	return nil
+}
+
+// AttachFile adds the file at path to the attachments of the record, named
+// after the file. Its content type is detected from the extension, else from
+// its content. The file is streamed from disk when the record is uploaded.
+// Call Close once the record is uploaded.
+func (pr *PatientRecord) AttachFile(path string) error {
+	file, err := pr.openFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to open attachment: %w", err)
+	}
+
+	contentType, err := detectContentType(file)
+	if err != nil {
+		return fmt.Errorf("unable to read attachment %s: %w", path, err)
+	}
+
+	pr.Attachments = append(pr.Attachments, Attachment{Name: filepath.Base(path), ContentType: contentType,
+		Reader: file})
+	return nil
+}
+
+// Close closes the files opened by AttachMedicalReportFile, AttachLabReportFile
+// and AttachFile.
+func (pr *PatientRecord) Close() error {
+	var errs []error
+	for _, file := range pr.files {
+		errs = append(errs, file.Close())
+	}
+	pr.files = nil
+	return errors.Join(errs...)
+}
+
+// ReportFiles are the paths of the files of a record, see SyncMedicalRecordsFromFiles.
+type ReportFiles struct {
+	MedicalReport string   // PDF medical report. Optional.
+	LabReport     string   // PDF lab report. Optional.
+	Attachments   []string // Other files e.g scans, see AttachFile. Optional.
+}
+
+// SyncMedicalRecordsFromFiles uploads the record with its reports and
+// attachments streamed from disk, so they are never held in memory.
+// The reports and attachments already set on the record are replaced.
+// Use UploadLargeReport for files that may not upload in one request.
+func (c *DefaultEcloudClient) SyncMedicalRecordsFromFiles(ctx context.Context, patientRecord *PatientRecord,
+	files ReportFiles) error {
+	if patientRecord == nil {
+		return fmt.Errorf("validation error: patient record is nil")
+	}
+
+	record := *patientRecord
+	record.MedicalReport, record.MedicalReportReader = nil, nil
+	record.LabReport, record.LabReportReader = nil, nil
+	record.Attachments, record.files = nil, nil
+	defer record.Close()
+
+	if files.MedicalReport != "" {
+		if err := record.AttachMedicalReportFile(files.MedicalReport); err != nil {
+			return err
+		}
+	}
+
+	if files.LabReport != "" {
+		if err := record.AttachLabReportFile(files.LabReport); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range files.Attachments {
+		if err := record.AttachFile(path); err != nil {
+			return err
+		}
+	}
+	return c.SyncMedicalRecords(ctx, &record)
+}
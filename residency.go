@@ -0,0 +1,93 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Capabilities describes what the target ecloud deployment supports.
+type Capabilities struct {
+	// Data residency regions the deployment can store data in e.g ["UG", "KE"].
+	ResidencyRegions []string `json:"residency_regions"`
+
+	// Whether reports can be uploaded in chunks, see UploadLargeReport.
+	ChunkedUploads bool `json:"chunked_uploads"`
+
+	// Largest chunk accepted by the deployment in bytes, zero if unlimited.
+	MaxChunkSize int64 `json:"max_chunk_size,omitempty"`
+}
+
+// SupportsResidency reports whether the deployment can store data in region.
+func (caps *Capabilities) SupportsResidency(region string) bool {
+	return slices.ContainsFunc(caps.ResidencyRegions, func(r string) bool {
+		return strings.EqualFold(r, region)
+	})
+}
+
+// GetCapabilities fetches the capabilities of the ecloud deployment.
+func (c *DefaultEcloudClient) GetCapabilities(ctx context.Context) (*Capabilities, error) {
+	url := c.cfg().ApiBaseUrl + "/api/capabilities"
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch capabilities: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	caps := &Capabilities{}
+	err = json.NewDecoder(resp.Body).Decode(caps)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return caps, nil
+}
+
+// residencyCheck remembers a successful residency check so the capabilities
+// are only fetched once per client.
+type residencyCheck struct {
+	mu      sync.Mutex
+	checked bool
+}
+
+func (r *residencyCheck) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checked = false
+}
+
+// checkResidency fails fast with ErrResidencyUnsupported if the deployment
+// cannot honor Config.ResidencyRegion. Failed checks are retried on the next call.
+func (c *DefaultEcloudClient) checkResidency(ctx context.Context) error {
+	region := c.cfg().ResidencyRegion
+	if region == "" {
+		return nil
+	}
+
+	c.residency.mu.Lock()
+	defer c.residency.mu.Unlock()
+
+	if c.residency.checked {
+		return nil
+	}
+
+	caps, err := c.GetCapabilities(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to verify data residency: %w", err)
+	}
+
+	if !caps.SupportsResidency(region) {
+		return fmt.Errorf("%w: region %q (supported: %s)", ErrResidencyUnsupported,
+			region, strings.Join(caps.ResidencyRegions, ", "))
+	}
+
+	c.residency.checked = true
+	return nil
+}
@@ -0,0 +1,259 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+)
+
+// Resolver resolves host names for the SDK's internal transport.
+// *net.Resolver satisfies this interface.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+}
+
+// DefaultDoHURL is Cloudflare's DNS-over-HTTPS JSON endpoint.
+// It is addressed by IP so that it works when the local DNS is down.
+const DefaultDoHURL = "https://1.1.1.1/dns-query"
+
+// DoHResolver resolves names with a DNS-over-HTTPS server using the JSON API
+// (application/dns-json) supported by Cloudflare and Google.
+type DoHResolver struct {
+	URL    string       // DoH endpoint. Defaults to DefaultDoHURL.
+	Client *http.Client // HTTP client used for queries. Defaults to a client with a 5 second timeout.
+}
+
+// dohResponse is the JSON answer of a DoH query.
+type dohResponse struct {
+	Status int `json:"Status"`
+	Answer []struct {
+		Type int    `json:"type"`
+		Data string `json:"data"`
+	} `json:"Answer"`
+}
+
+// DNS record types queried by DoHResolver.
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+)
+
+// LookupHost returns the IPv4 and IPv6 addresses of host.
+func (r *DoHResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	var addrs []string
+	var lastErr error
+	for _, recordType := range []int{dnsTypeA, dnsTypeAAAA} {
+		found, err := r.query(ctx, host, recordType)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		addrs = append(addrs, found...)
+	}
+
+	if len(addrs) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no addresses found")
+		}
+		return nil, &net.DNSError{Err: lastErr.Error(), Name: host, Server: r.url()}
+	}
+	return addrs, nil
+}
+
+func (r *DoHResolver) url() string {
+	if r.URL == "" {
+		return DefaultDoHURL
+	}
+	return r.URL
+}
+
+// dohURLs returns the endpoints of the DoH resolvers of resolver, including
+// those wrapped by FallbackResolver and CachingResolver.
+func dohURLs(resolver Resolver) []string {
+	switch r := resolver.(type) {
+	case *DoHResolver:
+		return []string{r.url()}
+	case fallbackResolver:
+		var urls []string
+		for _, resolver := range r {
+			urls = append(urls, dohURLs(resolver)...)
+		}
+		return urls
+	case *cachingResolver:
+		return dohURLs(r.resolver)
+	}
+	return nil
+}
+
+func (r *DoHResolver) query(ctx context.Context, host string, recordType int) ([]string, error) {
+	query := neturl.Values{}
+	query.Set("name", host)
+	query.Set("type", fmt.Sprint(recordType))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url()+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-json")
+
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server returned status %d", resp.StatusCode)
+	}
+
+	var answer dohResponse
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+
+	// Status is the DNS RCODE; 0 is NOERROR.
+	if answer.Status != 0 {
+		return nil, fmt.Errorf("DNS query failed with rcode %d", answer.Status)
+	}
+
+	var addrs []string
+	for _, record := range answer.Answer {
+		// Answers may include CNAME records in addition to the addresses.
+		if record.Type == recordType && net.ParseIP(record.Data) != nil {
+			addrs = append(addrs, record.Data)
+		}
+	}
+	return addrs, nil
+}
+
+// FallbackResolver tries each resolver in order and returns the first successful answer.
+// For example, the system resolver with DoH as fallback:
+//
+//	FallbackResolver(net.DefaultResolver, &DoHResolver{})
+func FallbackResolver(resolvers ...Resolver) Resolver {
+	return fallbackResolver(resolvers)
+}
+
+type fallbackResolver []Resolver
+
+func (resolvers fallbackResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	var errs []error
+	for _, resolver := range resolvers {
+		addrs, err := resolver.LookupHost(ctx, host)
+		if err == nil && len(addrs) > 0 {
+			return addrs, nil
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, &net.DNSError{Err: "no addresses found", Name: host, IsNotFound: true}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// CachingResolver caches successful lookups of resolver for ttl.
+// When a lookup fails, the last known addresses are returned even if expired,
+// so a flaky DNS server does not interrupt a working upstream link.
+// Failures are never cached.
+func CachingResolver(resolver Resolver, ttl time.Duration) Resolver {
+	return &cachingResolver{
+		resolver: resolver,
+		ttl:      ttl,
+		entries:  make(map[string]dnsCacheEntry),
+		now:      time.Now,
+	}
+}
+
+type dnsCacheEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+type cachingResolver struct {
+	resolver Resolver
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+	now     func() time.Time
+}
+
+func (r *cachingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	entry, cached := r.entries[host]
+	r.mu.Unlock()
+
+	if cached && r.now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := r.resolver.LookupHost(ctx, host)
+	if err != nil {
+		if cached {
+			return entry.addrs, nil
+		}
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.entries[host] = dnsCacheEntry{addrs: addrs, expires: r.now().Add(r.ttl)}
+	r.mu.Unlock()
+	return addrs, nil
+}
+
+// resolvingDialContext returns a DialContext that resolves host names with resolver
+// and tries each address in turn.
+func resolvingDialContext(resolver Resolver, dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		addrs, err := resolver.LookupHost(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for _, ip := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		if lastErr == nil {
+			lastErr = &net.DNSError{Err: "no addresses found", Name: host, IsNotFound: true}
+		}
+		return nil, lastErr
+	}
+}
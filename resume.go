@@ -0,0 +1,266 @@
+package ecloudsdk
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/abiiranathan/ecloud-sdk/pdf"
+)
+
+// partialDownload is the state of an interrupted download, kept next to the
+// partial file so the download resumes only if the report is unchanged.
+type partialDownload struct {
+	ETag   string `json:"etag"`             // Validator of the report, sent in If-Range.
+	SHA256 string `json:"sha256,omitempty"` // Hex SHA-256 of the complete report, if known.
+}
+
+// DownloadReportToFile downloads a report of a synced record to path and
+// returns its size. The report is written to path+".part" and renamed to path
+// once complete and verified, so path never holds a partial report.
+//
+// A download failing midway keeps the partial file, and calling
+// DownloadReportToFile again resumes it with a Range request, provided the
+// server sent an ETag and the report hasn't changed since; otherwise it
+// restarts. If the server sends the SHA-256 of the report in
+// ReportSHA256Header, the complete report is checked against it and a
+// mismatch fails with ErrChecksumMismatch and discards the partial file.
+// Encrypted reports are decrypted once complete, see DownloadReport.
+//
+// Reports are requested uncompressed, so that ranges apply to the report
+// itself. Cancelling ctx stops the download with the context error and keeps
+// the partial file to resume.
+func (c *DefaultEcloudClient) DownloadReportToFile(ctx context.Context, recordID uint, kind ReportKind, path string) (int64, error) {
+	if kind != ReportMedical && kind != ReportLab {
+		return 0, fmt.Errorf("invalid report kind %q", kind)
+	}
+
+	partPath, statePath := path+".part", path+".part.json"
+	state, offset := loadPartialDownload(partPath, statePath)
+
+	headers := map[string]string{"Accept": pdfContentType, "Accept-Encoding": "identity"}
+	if offset > 0 {
+		headers["Range"] = fmt.Sprintf("bytes=%d-", offset)
+		headers["If-Range"] = state.ETag
+	}
+
+	url := fmt.Sprintf("%s/api/records/%d/reports/%s", c.cfg().ApiBaseUrl, recordID, kind)
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, headers)
+	if err != nil {
+		return 0, fmt.Errorf("unable to download %s report: %w", kind, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		if start, ok := contentRangeStart(resp.Header.Get("Content-Range")); !ok || start != offset {
+			return 0, fmt.Errorf("unable to download %s report: unexpected Content-Range %q", kind,
+				resp.Header.Get("Content-Range"))
+		}
+		if state.SHA256 == "" {
+			state.SHA256 = resp.Header.Get(ReportSHA256Header)
+		}
+	case http.StatusOK:
+		// The server ignored the range, or the report changed: restart.
+		offset = 0
+		state = &partialDownload{ETag: resp.Header.Get("ETag"), SHA256: resp.Header.Get(ReportSHA256Header)}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The previous attempt failed after the last byte was written.
+		if offset == 0 {
+			return 0, c.decodeResourceError(resp, ErrRecordNotFound)
+		}
+		if resp.Header.Get("Content-Range") != fmt.Sprintf("bytes */%d", offset) {
+			os.Remove(partPath)
+			os.Remove(statePath)
+			return 0, fmt.Errorf("unable to download %s report: partial download discarded, call again to restart", kind)
+		}
+		return c.completeDownload(ctx, kind, partPath, statePath, path, state)
+	default:
+		return 0, c.decodeResourceError(resp, ErrRecordNotFound)
+	}
+
+	if err := savePartialDownload(statePath, state); err != nil {
+		return 0, fmt.Errorf("unable to save %s report download: %w", kind, err)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(partPath, flags, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("unable to save %s report download: %w", kind, err)
+	}
+
+	progress := c.newProgress(ctx, "DownloadReport", &PatientRecord{ID: recordID}, resp.ContentLength)
+	// The checksum covers the whole report, it is verified once complete.
+	_, err = io.Copy(file, progress.reader(newDownloadBody(ctx, resp, "")))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to download %s report, call again to resume: %w", kind, err)
+	}
+	return c.completeDownload(ctx, kind, partPath, statePath, path, state)
+}
+
+// completeDownload verifies a downloaded report, decrypting it if needed,
+// and moves it to path.
+func (c *DefaultEcloudClient) completeDownload(ctx context.Context, kind ReportKind, partPath, statePath, path string,
+	state *partialDownload) (int64, error) {
+	discard := func() {
+		os.Remove(partPath)
+		os.Remove(statePath)
+	}
+
+	if state.SHA256 != "" {
+		sum, err := fileSHA256(partPath)
+		if err != nil {
+			return 0, fmt.Errorf("unable to verify %s report: %w", kind, err)
+		}
+
+		if !strings.EqualFold(sum, state.SHA256) {
+			discard()
+			return 0, fmt.Errorf("%w: %s report downloaded with SHA-256 %s, expected %s", ErrChecksumMismatch,
+				kind, sum, state.SHA256)
+		}
+	}
+
+	part, err := os.Open(partPath)
+	if err != nil {
+		return 0, fmt.Errorf("unable to verify %s report: %w", kind, err)
+	}
+	defer part.Close()
+
+	body := bufio.NewReader(part)
+	if !isEncryptedReport(body) {
+		header, _ := body.Peek(8)
+		if _, err := pdf.Header(header); err != nil {
+			discard()
+			return 0, fmt.Errorf("downloaded %s report is not a PDF", kind)
+		}
+
+		info, err := part.Stat()
+		if err != nil {
+			return 0, err
+		}
+
+		part.Close()
+		if err := os.Rename(partPath, path); err != nil {
+			return 0, fmt.Errorf("unable to save %s report: %w", kind, err)
+		}
+		os.Remove(statePath)
+		return info.Size(), nil
+	}
+
+	n, err := c.decryptDownload(ctx, kind, body, path)
+	if errors.Is(err, ErrReportDecryption) {
+		discard()
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	part.Close()
+	discard()
+	return n, nil
+}
+
+// decryptDownload decrypts a downloaded report to path, through a temporary
+// file so path never holds a partial report.
+func (c *DefaultEcloudClient) decryptDownload(ctx context.Context, kind ReportKind, body *bufio.Reader,
+	path string) (int64, error) {
+	field := labReportFieldName
+	if kind == ReportMedical {
+		field = medicalReportFieldName
+	}
+
+	report, err := c.openReport(ctx, body, field)
+	if err != nil {
+		return 0, fmt.Errorf("unable to decrypt %s report: %w", kind, err)
+	}
+
+	tmpPath := path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("unable to save %s report: %w", kind, err)
+	}
+	defer os.Remove(tmpPath)
+
+	n, err := io.Copy(tmp, report)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unable to decrypt %s report: %w", kind, err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, fmt.Errorf("unable to save %s report: %w", kind, err)
+	}
+	return n, nil
+}
+
+// loadPartialDownload returns the state of an interrupted download and the
+// size of its partial file, or a zero offset if it can't be resumed.
+func loadPartialDownload(partPath, statePath string) (*partialDownload, int64) {
+	state := &partialDownload{}
+	data, err := os.ReadFile(statePath)
+	if err != nil || json.Unmarshal(data, state) != nil || state.ETag == "" {
+		return &partialDownload{}, 0
+	}
+
+	info, err := os.Stat(partPath)
+	if err != nil {
+		return &partialDownload{}, 0
+	}
+	return state, info.Size()
+}
+
+func savePartialDownload(statePath string, state *partialDownload) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %w", err)
+	}
+	return os.WriteFile(statePath, data, 0o600)
+}
+
+// contentRangeStart returns the first byte of a Content-Range header
+// e.g "bytes 100-199/200".
+func contentRangeStart(header string) (int64, bool) {
+	rest, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, false
+	}
+
+	start, _, ok := strings.Cut(rest, "-")
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(start, 10, 64)
+	return n, err == nil
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
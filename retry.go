@@ -0,0 +1,166 @@
+package ecloudsdk
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defaults of the BackoffPolicy built from Config when RetryPolicy is nil.
+const (
+	DefaultMaxRetries     = 3
+	DefaultRetryBaseDelay = 500 * time.Millisecond
+	DefaultRetryMaxDelay  = 30 * time.Second
+)
+
+// RetryAfterPolicy is a RetryPolicy that derives the backoff from the response,
+// e.g honoring its Retry-After header. performRequest prefers BackoffFor over
+// BackoffDuration for policies implementing it.
+type RetryAfterPolicy interface {
+	RetryPolicy
+	BackoffFor(attempt int, resp *http.Response) time.Duration
+}
+
+// BackoffPolicy retries network errors, 429 and 5xx responses with exponential
+// backoff and full jitter, capped at MaxDelay. The Retry-After header of 429 and
+// 503 responses is honored, up to MaxDelay. It is the default retry policy.
+type BackoffPolicy struct {
+	Retries   int           // Maximum retries after the first attempt.
+	BaseDelay time.Duration // Backoff cap of the first retry, doubled for every further retry.
+	MaxDelay  time.Duration // Upper bound of every backoff, including Retry-After.
+
+	// Returns a random duration in [0, n). Defaults to math/rand.
+	random func(n time.Duration) time.Duration
+}
+
+// NewBackoffPolicy returns a BackoffPolicy with the given limits.
+func NewBackoffPolicy(retries int, baseDelay, maxDelay time.Duration) *BackoffPolicy {
+	return &BackoffPolicy{Retries: retries, BaseDelay: baseDelay, MaxDelay: maxDelay}
+}
+
+// defaultRetryPolicy builds the BackoffPolicy from the retry settings of config.
+func defaultRetryPolicy(config *Config) *BackoffPolicy {
+	retries := config.MaxRetries
+	if retries == 0 {
+		retries = DefaultMaxRetries
+	}
+
+	baseDelay := config.RetryBaseDelay
+	if baseDelay <= 0 {
+		baseDelay = DefaultRetryBaseDelay
+	}
+
+	maxDelay := config.RetryMaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultRetryMaxDelay
+	}
+	return NewBackoffPolicy(max(retries, 0), baseDelay, maxDelay)
+}
+
+func (p *BackoffPolicy) ShouldRetry(attempt int, err error, resp *http.Response) bool {
+	if attempt >= p.Retries {
+		return false
+	}
+
+	if err != nil {
+		// The caller gave up; retrying cannot succeed.
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return resp != nil && retryableStatus(resp.StatusCode)
+}
+
+// BackoffDuration returns a random backoff between zero and
+// min(MaxDelay, BaseDelay * 2^attempt) ("full jitter").
+func (p *BackoffPolicy) BackoffDuration(attempt int) time.Duration {
+	ceiling := p.MaxDelay
+	if attempt < 32 {
+		if delay := p.BaseDelay << attempt; delay > 0 && delay < ceiling {
+			ceiling = delay
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+
+	random := p.random
+	if random == nil {
+		random = rand.N[time.Duration]
+	}
+	return random(ceiling)
+}
+
+// BackoffFor honors the Retry-After header of resp, capped at MaxDelay,
+// falling back to BackoffDuration.
+func (p *BackoffPolicy) BackoffFor(attempt int, resp *http.Response) time.Duration {
+	if delay, ok := retryAfter(resp, time.Now()); ok {
+		return min(delay, p.MaxDelay)
+	}
+	return p.BackoffDuration(attempt)
+}
+
+func (p *BackoffPolicy) MaxRetries() int {
+	return p.Retries
+}
+
+// retryableStatus reports whether a response with the status code is worth retrying.
+// 401 is retried after the token is refreshed.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header of resp, in seconds or as an HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// backoff waits before the next attempt under policy. It returns false without
+// waiting out the backoff if ctx is done or its deadline would pass first, as
+// the next attempt could not complete anyway.
+func backoff(ctx context.Context, policy RetryPolicy, attempt int, resp *http.Response) bool {
+	delay := policy.BackoffDuration(attempt)
+	if p, ok := policy.(RetryAfterPolicy); ok && resp != nil {
+		delay = p.BackoffFor(attempt, resp)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return false
+	}
+
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
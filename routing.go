@@ -0,0 +1,48 @@
+package ecloudsdk
+
+import (
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+// routeRead returns the URL a request is sent to: reads (GET and HEAD) whose
+// path matches Config.ReadRoutes go to Config.ReadBaseUrl, everything else to
+// the primary ApiBaseUrl.
+func (c *DefaultEcloudClient) routeRead(method, rawURL string) string {
+	config := c.cfg()
+	if config.ReadBaseUrl == "" || (method != http.MethodGet && method != http.MethodHead) {
+		return rawURL
+	}
+
+	// Only URLs of the primary are routed, not absolute URLs from the server.
+	primary := strings.TrimRight(config.ApiBaseUrl, "/")
+	rest, ok := strings.CutPrefix(rawURL, primary)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/") && !strings.HasPrefix(rest, "?")) {
+		return rawURL
+	}
+
+	u, err := neturl.Parse(rawURL)
+	if err != nil || !readRouted(config.ReadRoutes, u.Path) {
+		return rawURL
+	}
+	return strings.TrimRight(config.ReadBaseUrl, "/") + rest
+}
+
+// readRouted reports whether reads of path go to the read endpoint.
+// The longest matching prefix of routes wins; nil routes every read.
+func readRouted(routes map[string]bool, path string) bool {
+	if routes == nil {
+		return true
+	}
+
+	routed := false
+	longest := -1
+	for prefix, value := range routes {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			routed = value
+			longest = len(prefix)
+		}
+	}
+	return routed
+}
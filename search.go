@@ -0,0 +1,112 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecordQuery selects synced records by subscriber, text, visit date and tags.
+// Text is matched against titles and the extracted text of the reports
+// (see RequestTextExtraction). At least one criterion is required.
+type RecordQuery struct {
+	SubscriberID uint      // Restrict to one subscriber. Zero searches the whole hospital.
+	Text         string    // Free text e.g "CT report".
+	From         time.Time // Earliest visit time, inclusive. Optional.
+	To           time.Time // Latest visit time, inclusive. Optional.
+	Tags         []string  // Records must carry all the tags. Optional.
+}
+
+// Validate reports whether the query has a criterion and a valid date range.
+func (q *RecordQuery) Validate() error {
+	if q.SubscriberID == 0 && strings.TrimSpace(q.Text) == "" && q.From.IsZero() && q.To.IsZero() && len(q.Tags) == 0 {
+		return fmt.Errorf("record query must have at least one criterion")
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && q.From.After(q.To) {
+		return fmt.Errorf("record query From is after To")
+	}
+	return nil
+}
+
+// values encodes the query as URL query parameters.
+func (q *RecordQuery) values() neturl.Values {
+	query := neturl.Values{}
+	if q.SubscriberID != 0 {
+		query.Set("subscriber_id", strconv.FormatUint(uint64(q.SubscriberID), 10))
+	}
+	if text := strings.TrimSpace(q.Text); text != "" {
+		query.Set("q", text)
+	}
+	if !q.From.IsZero() {
+		query.Set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		query.Set("to", q.To.Format(time.RFC3339))
+	}
+	for _, tag := range q.Tags {
+		query.Add("tag", tag)
+	}
+	return query
+}
+
+// Highlight is a fragment of a record field that matched the search text.
+type Highlight struct {
+	Field   string   `json:"field"`   // Matched field e.g "title" or "text".
+	Snippet string   `json:"snippet"` // Fragment of the field around the matches.
+	Matches [][2]int `json:"matches"` // Byte offsets [start, end) of the matches in Snippet.
+}
+
+// RecordHit is a record matching a search, with the fragments that matched.
+type RecordHit struct {
+	Record     PatientRecord `json:"record"`
+	Score      float64       `json:"score"` // Relevance, higher is better.
+	Highlights []Highlight   `json:"highlights"`
+}
+
+// RecordSearchResult is a page of search results.
+type RecordSearchResult struct {
+	Hits       []*RecordHit `json:"data"`
+	NextCursor string       `json:"next_cursor"` // Empty on the last page.
+	Total      int          `json:"total"`       // Number of hits across all pages.
+}
+
+// HasMore reports whether there are more pages after this one.
+func (r *RecordSearchResult) HasMore() bool {
+	return r.NextCursor != ""
+}
+
+// SearchRecords searches the hospital's synced records with the server-side index.
+// Results are ordered by relevance unless opts.Sort is set e.g "-visit_timestamp".
+// Pass the NextCursor of a result in opts.Cursor to fetch the next page.
+func (c *DefaultEcloudClient) SearchRecords(ctx context.Context, query RecordQuery, opts *ListOptions) (*RecordSearchResult, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	values := query.values()
+	values.Set("hospital_number", c.cfg().HospitalNumber.String())
+	opts.apply(values)
+
+	url := c.cfg().ApiBaseUrl + "/api/records/search?" + values.Encode()
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to search records: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	result := &RecordSearchResult{}
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return result, nil
+}
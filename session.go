@@ -0,0 +1,69 @@
+package ecloudsdk
+
+import (
+	"context"
+	"time"
+)
+
+// Session is a consistent snapshot of the client's authentication state.
+// Unlike separate GetToken, GetUser and IsAuthenticated calls, its fields
+// cannot change between reads when a refresh happens concurrently.
+type Session struct {
+	Token         string    // JWT sent with requests. Empty before login.
+	User          User      // Logged in user. Zero before login.
+	Authenticated bool      // Whether the client has logged in with a token.
+	ExpiresAt     time.Time // Token expiry from its exp claim, zero if unknown.
+}
+
+// Expired reports whether the token is expired at the given time.
+// Tokens of unknown expiry are never considered expired.
+func (s Session) Expired(at time.Time) bool {
+	return !s.ExpiresAt.IsZero() && !at.Before(s.ExpiresAt)
+}
+
+// SessionProvider handles authentication, exposing the auth state as a Session snapshot.
+type SessionProvider interface {
+	Login(ctx context.Context) (*LoginResponse, error)
+	Refresh(ctx context.Context) error
+	Session() Session
+}
+
+// EcloudClientV2 is EcloudClient without the individual auth getters, which
+// encourage stale reads of mutable state. Read the auth state with Session instead.
+type EcloudClientV2 interface {
+	SessionProvider
+	BillingService
+	SubscriptionService
+	PaymentService
+	RecordsService
+	ClientCore
+
+	// Per-service views of the client. They share its config, transport and session.
+	Billing() BillingService
+	Subscriptions() SubscriptionService
+	Payments() PaymentService
+	Records() RecordsService
+}
+
+// NewEcloudClientV2 creates a client exposing the EcloudClientV2 interface.
+// The config is validated as in NewEcloudClient.
+func NewEcloudClientV2(config *Config) (EcloudClientV2, error) {
+	client, err := NewEcloudClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return client.(*DefaultEcloudClient), nil
+}
+
+// Session returns a snapshot of the authentication state.
+func (c *DefaultEcloudClient) Session() Session {
+	c.authMu.RLock()
+	defer c.authMu.RUnlock()
+
+	return Session{
+		Token:         c.jwtToken,
+		User:          c.user,
+		Authenticated: c.authenticated && c.jwtToken != "",
+		ExpiresAt:     c.tokenExpiresAt,
+	}
+}
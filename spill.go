@@ -0,0 +1,367 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SpilledFiles references the reports and attachments of a queued record
+// kept in the spill directory of its UploadQueue, by the hex SHA-256 of
+// their content. Spilled files are nil in QueuedRecord.Record.
+type SpilledFiles struct {
+	MedicalReport string   `json:"medical_report,omitempty"`
+	LabReport     string   `json:"lab_report,omitempty"`
+	Attachments   []string `json:"attachments,omitempty"` // By index in Record.Attachments, "" if held in memory.
+}
+
+// hashes returns the files referenced, once per reference.
+func (f *SpilledFiles) hashes() []string {
+	if f == nil {
+		return nil
+	}
+
+	var hashes []string
+	for _, hash := range append([]string{f.MedicalReport, f.LabReport}, f.Attachments...) {
+		if hash != "" {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+// spillStore keeps the reports and attachments of queued records on disk, so
+// that they aren't held in memory. Files are named by the SHA-256 of their
+// content, so identical files (e.g the same scan attached to several visits)
+// are stored once, and reference counted: a file is removed once the last
+// queued record using it is uploaded or removed.
+//
+// The reference counts are rebuilt from the QueueStore on first use, and
+// spilled files left behind by a crash are removed then. Other files in the
+// directory are ignored.
+type spillStore struct {
+	dir         string
+	maxSize     int64 // Maximum total size of the files, zero for no limit.
+	store       QueueStore
+	compression *QueueCompression // Of the files written, nil to write them uncompressed.
+
+	mu     sync.Mutex
+	loaded bool
+	refs   map[string]int
+	sizes  map[string]int64
+	size   int64
+}
+
+func newSpillStore(dir string, maxSize int64, store QueueStore, compression *QueueCompression) *spillStore {
+	return &spillStore{dir: dir, maxSize: maxSize, store: store, compression: compression}
+}
+
+// init rebuilds the reference counts from the queued records, once, and
+// removes the files no record references.
+func (s *spillStore) init(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(ctx)
+}
+
+// load implements init. s.mu must be held.
+func (s *spillStore) load(ctx context.Context) error {
+	if s.loaded {
+		return nil
+	}
+
+	items, err := s.store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	refs := make(map[string]int)
+	for _, item := range items {
+		for _, hash := range item.Spilled.hashes() {
+			refs[hash]++
+		}
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("unable to read spill directory: %w", err)
+	}
+
+	sizes := make(map[string]int64)
+	var size int64
+	for _, entry := range entries {
+		// Other files, e.g of a directory shared with the application, are
+		// left alone.
+		name := entry.Name()
+		if !isSpillFileName(name) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if refs[name] == 0 || err != nil {
+			os.Remove(filepath.Join(s.dir, name))
+			continue
+		}
+		sizes[name] = info.Size()
+		size += info.Size()
+	}
+
+	// Files referenced but missing fail the upload of their record.
+	for hash := range refs {
+		if _, ok := sizes[hash]; !ok {
+			delete(refs, hash)
+		}
+	}
+
+	s.refs, s.sizes, s.size, s.loaded = refs, sizes, size, true
+	return nil
+}
+
+// isSpillFileName reports whether name is a spilled file, named by its hex
+// SHA-256, or a temporary file left by add.
+func isSpillFileName(name string) bool {
+	if strings.HasPrefix(name, ".spill-") {
+		return true
+	}
+
+	_, err := hex.DecodeString(name)
+	return len(name) == 2*sha256.Size && err == nil && strings.ToLower(name) == name
+}
+
+// add stores the content of r and returns its hash, taking a reference on it.
+// It fails with ErrSpillFull if the file would exceed the maximum size.
+func (s *spillStore) add(ctx context.Context, r io.Reader) (string, error) {
+	if err := s.init(ctx); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return "", fmt.Errorf("unable to create spill directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".spill-*")
+	if err != nil {
+		return "", fmt.Errorf("unable to spill file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// Stop writing once the file can't fit. The cap is checked again once
+	// the file is complete, as other files may have been spilled meanwhile.
+	available := int64(-1)
+	if s.maxSize > 0 {
+		available = max(s.maxSize-s.spilledSize(), 0)
+	}
+
+	_, name, err := writeQueueFile(tmp, r, s.compression, available)
+	if errors.Is(err, ErrSpillFull) {
+		tmp.Close()
+		return "", fmt.Errorf("%w: limit of %d bytes reached", ErrSpillFull, s.maxSize)
+	}
+
+	var size int64
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		var info os.FileInfo
+		if info, err = tmp.Stat(); err == nil {
+			size = info.Size()
+		}
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("unable to spill file: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.refs[name] == 0 && s.maxSize > 0 && s.size+size > s.maxSize {
+		return "", fmt.Errorf("%w: %d of %d bytes used", ErrSpillFull, s.size, s.maxSize)
+	}
+
+	// Replacing a referenced file with the same content restores it if it
+	// was removed behind our back, e.g by another queue on the directory.
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		return "", fmt.Errorf("unable to spill file: %w", err)
+	}
+	if s.refs[name] == 0 {
+		s.sizes[name] = size
+		s.size += size
+	}
+	s.refs[name]++
+	return name, nil
+}
+
+func (s *spillStore) spilledSize() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// release drops the references of files, removing those no longer used.
+func (s *spillStore) release(files *SpilledFiles) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, hash := range files.hashes() {
+		if s.refs[hash] == 0 {
+			continue // Missing since load.
+		}
+
+		s.refs[hash]--
+		if s.refs[hash] == 0 {
+			delete(s.refs, hash)
+			os.Remove(filepath.Join(s.dir, hash))
+			s.size -= s.sizes[hash]
+			delete(s.sizes, hash)
+		}
+	}
+}
+
+// spill moves the reports and attachments of the record of item to disk,
+// reading streamed ones without holding them in memory.
+func (s *spillStore) spill(ctx context.Context, item *QueuedRecord) error {
+	record := item.Record
+	spilled := &SpilledFiles{}
+
+	reports := []struct {
+		name   string
+		data   *[]byte
+		reader *io.Reader
+		hash   *string
+	}{
+		{"medical report", &record.MedicalReport, &record.MedicalReportReader, &spilled.MedicalReport},
+		{"lab report", &record.LabReport, &record.LabReportReader, &spilled.LabReport},
+	}
+
+	add := func(name string, data []byte, reader io.Reader) (string, error) {
+		if data != nil {
+			reader = bytes.NewReader(data)
+		}
+
+		hash, err := s.add(ctx, reader)
+		if err != nil {
+			s.release(spilled)
+			return "", fmt.Errorf("unable to queue %s: %w", name, err)
+		}
+		return hash, nil
+	}
+
+	for _, report := range reports {
+		if *report.data == nil && *report.reader == nil {
+			continue
+		}
+
+		hash, err := add(report.name, *report.data, *report.reader)
+		if err != nil {
+			return err
+		}
+		*report.hash = hash
+		*report.data, *report.reader = nil, nil
+	}
+
+	if len(record.Attachments) > 0 {
+		spilled.Attachments = make([]string, len(record.Attachments))
+	}
+	for i := range record.Attachments {
+		a := &record.Attachments[i]
+		hash, err := add(fmt.Sprintf("attachment %q", a.Name), a.Data, a.Reader)
+		if err != nil {
+			return err
+		}
+		spilled.Attachments[i] = hash
+		a.Data, a.Reader = nil, nil
+	}
+
+	item.Spilled = spilled
+	return nil
+}
+
+// open returns the record of item for upload, reading its spilled files from
+// disk, and a function closing them.
+func (s *spillStore) open(item *QueuedRecord) (*PatientRecord, func(), error) {
+	if item.Spilled == nil {
+		return item.Record, func() {}, nil
+	}
+	if s == nil {
+		return nil, nil, fmt.Errorf("queued record %s has spilled files but the queue has no spill directory", item.ID)
+	}
+
+	record := *item.Record
+	record.Attachments = append([]Attachment(nil), item.Record.Attachments...)
+
+	var files []io.Closer
+	closeFiles := func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}
+
+	openFile := func(hash string) (io.ReadSeekCloser, error) {
+		if strings.ContainsAny(hash, `/\.`) {
+			return nil, fmt.Errorf("invalid spilled file %q", hash)
+		}
+
+		file, err := openSpilledFile(filepath.Join(s.dir, hash), s.compression)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Not retried: the upload would fail the same way.
+			closeFiles()
+			return nil, fmt.Errorf("spilled file %s of queued record %s is missing", hash, item.ID)
+		}
+		if err != nil {
+			closeFiles()
+			return nil, fmt.Errorf("unable to open spilled file of queued record %s: %w", item.ID, err)
+		}
+		files = append(files, file)
+		return file, nil
+	}
+
+	if hash := item.Spilled.MedicalReport; hash != "" {
+		file, err := openFile(hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		record.MedicalReportReader = file
+	}
+
+	if hash := item.Spilled.LabReport; hash != "" {
+		file, err := openFile(hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		record.LabReportReader = file
+	}
+
+	for i, hash := range item.Spilled.Attachments {
+		if hash == "" || i >= len(record.Attachments) {
+			continue
+		}
+
+		file, err := openFile(hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		record.Attachments[i].Reader = file
+	}
+	return &record, closeFiles, nil
+}
@@ -0,0 +1,126 @@
+package ecloudsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// SubscriptionState summarizes whether a patient's records are accessible.
+type SubscriptionState string
+
+const (
+	SubscriptionActive          SubscriptionState = "active"           // Covered by a payment.
+	SubscriptionGracePeriod     SubscriptionState = "grace_period"     // Expired within Config.SubscriptionGracePeriod.
+	SubscriptionExpired         SubscriptionState = "expired"          // Coverage ended, must be renewed.
+	SubscriptionNeverSubscribed SubscriptionState = "never_subscribed" // No subscription, or never paid.
+)
+
+// SubscriptionStatus is the subscription of a patient as shown at the front
+// desk, see DefaultEcloudClient.SubscriptionStatus.
+type SubscriptionStatus struct {
+	State SubscriptionState
+
+	// The patient's subscription, nil if the patient was never subscribed.
+	Subscriber *Subscriber
+
+	// The payment with the latest ValidTo, nil if there is none. Voided
+	// payments are ignored.
+	LatestPayment *Payment
+
+	// End of the current coverage, or of the last one if it expired.
+	// Back-to-back payments are merged, see IsCoverageActive.
+	ValidTo time.Time
+
+	// End of the grace period, zero unless the state is SubscriptionGracePeriod.
+	GraceEndsAt time.Time
+
+	// Whole days, rounded up, until the coverage ends when active or until
+	// the grace period ends in it; zero otherwise.
+	DaysRemaining int
+
+	// The hospital's current bill for a renewal.
+	RenewalAmount   float64
+	RenewalDuration time.Duration
+}
+
+// NeedsRenewal reports whether the patient must pay before their records can be accessed.
+func (s *SubscriptionStatus) NeedsRenewal() bool {
+	return s.State != SubscriptionActive
+}
+
+// SubscriptionStatus combines the patient's subscription, their payments and
+// the hospital's bill into the state of the subscription and the days
+// remaining. A patient without a subscription is SubscriptionNeverSubscribed,
+// not an error.
+func (c *DefaultEcloudClient) SubscriptionStatus(ctx context.Context, patientID uint) (*SubscriptionStatus, error) {
+	bill, err := c.GetBill(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriber, err := c.GetPatientSubscription(ctx, patientID)
+	if errors.Is(err, ErrSubscriberNotFound) {
+		return subscriptionStatus(nil, nil, bill, c.cfg().SubscriptionGracePeriod, time.Now()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	payments, err := c.GetSubscriberPayments(ctx, subscriber.ID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch payments: %w", err)
+	}
+	return subscriptionStatus(subscriber, payments, bill, c.cfg().SubscriptionGracePeriod, time.Now()), nil
+}
+
+// subscriptionStatus computes the status of a subscription at the given time.
+func subscriptionStatus(subscriber *Subscriber, payments []*Payment, bill *Bill, grace time.Duration,
+	at time.Time) *SubscriptionStatus {
+	status := &SubscriptionStatus{
+		State:           SubscriptionNeverSubscribed,
+		Subscriber:      subscriber,
+		RenewalAmount:   bill.Amount,
+		RenewalDuration: bill.Duration,
+	}
+
+	payments = slices.DeleteFunc(slices.Clone(payments), func(p *Payment) bool {
+		return p == nil || p.VoidedAt != nil
+	})
+	for _, payment := range payments {
+		if status.LatestPayment == nil || payment.ValidTo.After(status.LatestPayment.ValidTo) {
+			status.LatestPayment = payment
+		}
+	}
+
+	if subscriber == nil || status.LatestPayment == nil {
+		return status
+	}
+
+	active, window := IsCoverageActive(subscriber, payments, at)
+	status.ValidTo = window.To
+
+	switch {
+	case active:
+		status.State = SubscriptionActive
+		status.DaysRemaining = daysUntil(at, window.To)
+	case window.IsZero():
+		// Only paid for the future.
+		status.State, status.ValidTo = SubscriptionExpired, time.Time{}
+	case at.Before(window.To.Add(grace)):
+		status.State = SubscriptionGracePeriod
+		status.GraceEndsAt = window.To.Add(grace)
+		status.DaysRemaining = daysUntil(at, status.GraceEndsAt)
+	default:
+		status.State = SubscriptionExpired
+	}
+	return status
+}
+
+// daysUntil returns the whole days from at to end, rounded up.
+func daysUntil(at, end time.Time) int {
+	return int(math.Ceil(end.Sub(at).Hours() / 24))
+}
@@ -0,0 +1,110 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+)
+
+// UpdateSubscriberRequest corrects the details of a subscriber.
+// Nil fields are left unchanged.
+type UpdateSubscriberRequest struct {
+	PatientName *string `json:"patient_name,omitempty"`
+	Email       *string `json:"email,omitempty"` // An empty string removes the email.
+	UpdatedBy   string  `json:"updated_by"`      // The person making the correction.
+}
+
+// Validate reports whether the request changes something and the new values are valid.
+func (r *UpdateSubscriberRequest) Validate() error {
+	if r.PatientName == nil && r.Email == nil {
+		return fmt.Errorf("update subscriber request has no changes")
+	}
+	if r.PatientName != nil && strings.TrimSpace(*r.PatientName) == "" {
+		return fmt.Errorf("patient name must not be empty")
+	}
+	if r.Email != nil && *r.Email != "" {
+		if _, err := mail.ParseAddress(*r.Email); err != nil {
+			return fmt.Errorf("invalid email %q: %w", *r.Email, err)
+		}
+	}
+	if r.UpdatedBy == "" {
+		return fmt.Errorf("update subscriber request missing UpdatedBy")
+	}
+	return nil
+}
+
+// CancellationReason explains why a subscription was cancelled.
+type CancellationReason string
+
+const (
+	CancellationOptOut    CancellationReason = "opt_out"   // The patient no longer wants the service.
+	CancellationMistake   CancellationReason = "mistake"   // Registered in error at the front desk.
+	CancellationDuplicate CancellationReason = "duplicate" // The patient is already subscribed.
+	CancellationDeceased  CancellationReason = "deceased"  // The patient has died.
+	CancellationOther     CancellationReason = "other"     // Any other reason.
+)
+
+// UpdateSubscriber corrects the patient name or email of a subscriber and
+// returns the subscriber as stored by the server.
+func (c *DefaultEcloudClient) UpdateSubscriber(ctx context.Context, subscriberID uint, req UpdateSubscriberRequest) (*Subscriber, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/subscriptions/%d", c.cfg().ApiBaseUrl, subscriberID)
+	resp, err := c.performRequest(ctx, http.MethodPatch, url, bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to update subscriber: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
+	}
+
+	subscriber := &Subscriber{}
+	err = json.NewDecoder(resp.Body).Decode(subscriber)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+
+	c.cache.invalidate(subscriberID)
+	c.reportWarnings("UpdateSubscriber", subscriber.Warnings)
+	return subscriber, nil
+}
+
+// CancelSubscription cancels a subscription, e.g after a patient opts out or
+// a front-desk mistake. Records already synced are kept by ecloud.
+func (c *DefaultEcloudClient) CancelSubscription(ctx context.Context, subscriberID uint, reason CancellationReason) error {
+	if reason == "" {
+		return fmt.Errorf("cancellation reason must not be empty")
+	}
+
+	data, err := json.Marshal(map[string]CancellationReason{"reason": reason})
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/subscriptions/%d/cancel", c.cfg().ApiBaseUrl, subscriberID)
+	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), nil)
+	if err != nil {
+		return fmt.Errorf("unable to cancel subscription: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return c.decodeResourceError(resp, ErrSubscriberNotFound)
+	}
+
+	c.cache.invalidate(subscriberID)
+	return nil
+}
@@ -0,0 +1,273 @@
+package ecloudsdk
+
+import (
+	"context"
+	"time"
+)
+
+// RecordSource discovers patient records that are ready to be uploaded.
+// HMS vendors implement it on top of their own storage, for example
+// with a SQL query over completed visits.
+type RecordSource interface {
+	// Pending returns up to limit records that have not yet been acknowledged.
+	Pending(ctx context.Context, limit int) ([]*PatientRecord, error)
+
+	// Ack marks a record as uploaded so that it is not returned by Pending again.
+	Ack(ctx context.Context, record *PatientRecord) error
+}
+
+// RecordStream is optionally implemented by a RecordSource that can push
+// new records as they appear (e.g. a change-data-capture stream).
+// The SyncManager prefers the stream over polling when it is available.
+// The channel must be closed when the stream ends.
+type RecordStream interface {
+	Records(ctx context.Context) (<-chan *PatientRecord, error)
+}
+
+// SyncManagerConfig configures a SyncManager.
+type SyncManagerConfig struct {
+	// Source of the records to upload. Required.
+	Source RecordSource
+
+	// How often the source is polled. Defaults to one minute.
+	PollInterval time.Duration
+
+	// Maximum number of records fetched per poll. Defaults to 50.
+	BatchSize int
+
+	// Logger for sync progress. Defaults to the NoOpLogger.
+	Logger Logger
+
+	// Checks the subscriber's coverage before each upload, typically the
+	// EcloudClient. Records of subscribers without coverage are parked until
+	// a payment is recorded, see SyncManager.AwaitingPayment. Optional.
+	Coverage CoverageChecker
+
+	// How often the coverage of subscribers with parked records is checked
+	// again. Defaults to DefaultCoverageRecheckInterval.
+	CoverageRecheckInterval time.Duration
+}
+
+// SyncManager uploads records discovered by a RecordSource,
+// decoupling record discovery from the upload itself.
+type SyncManager struct {
+	records      RecordsService
+	source       RecordSource
+	pollInterval time.Duration
+	batchSize    int
+	logger       Logger
+	stats        *syncStats
+
+	coverage        CoverageChecker
+	recheckInterval time.Duration
+	awaiting        awaitingPayment
+}
+
+// NewSyncManager creates a SyncManager that uploads records through the given RecordsService.
+func NewSyncManager(records RecordsService, config SyncManagerConfig) (*SyncManager, error) {
+	if config.Source == nil {
+		return nil, ErrRecordSourceRequired
+	}
+
+	m := &SyncManager{
+		records:      records,
+		source:       config.Source,
+		pollInterval: config.PollInterval,
+		batchSize:    config.BatchSize,
+		logger:       config.Logger,
+		stats:        newSyncStats(),
+
+		coverage:        config.Coverage,
+		recheckInterval: config.CoverageRecheckInterval,
+	}
+
+	if m.pollInterval <= 0 {
+		m.pollInterval = time.Minute
+	}
+
+	if m.batchSize <= 0 {
+		m.batchSize = 50
+	}
+
+	if m.recheckInterval <= 0 {
+		m.recheckInterval = DefaultCoverageRecheckInterval
+	}
+
+	if m.logger == nil {
+		m.logger = &NoOpLogger{}
+	} else {
+		m.logger = safeLogger{m.logger}
+	}
+	return m, nil
+}
+
+// Run uploads records until ctx is cancelled.
+// If the source implements RecordStream, records are consumed from the stream
+// and those that fail to upload are retried every PollInterval, otherwise the
+// source is polled every PollInterval.
+//
+// With a CoverageChecker that is also an EventSource, such as the EcloudClient,
+// the records of a subscriber awaiting payment are uploaded as soon as the
+// client records a payment for them.
+func (m *SyncManager) Run(ctx context.Context) error {
+	payments := m.paymentEvents(ctx)
+	if stream, ok := m.source.(RecordStream); ok {
+		return m.runStream(ctx, stream, payments)
+	}
+
+	ticker := time.NewTicker(m.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// A panicking RecordSource is logged and the batch retried on the next poll.
+		var err error
+		safeCall(m.logger, "SyncManager", func() { _, err = m.SyncOnce(ctx) })
+		if err != nil && ctx.Err() == nil {
+			m.logger.Error("sync failed: %v\n", err)
+		}
+
+		if !m.wait(ctx, ticker.C, payments) {
+			return ctx.Err()
+		}
+	}
+}
+
+// wait resumes the records of paying subscribers until the next poll.
+// It returns false once ctx is done.
+func (m *SyncManager) wait(ctx context.Context, tick <-chan time.Time, payments <-chan Event) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-tick:
+			return true
+		case event, ok := <-payments:
+			if !ok {
+				payments = nil
+				continue
+			}
+			m.resumePaid(ctx, event)
+		}
+	}
+}
+
+// SyncOnce fetches one batch of pending records and uploads them.
+// It returns the number of records uploaded successfully.
+// A record that fails to upload is not acknowledged and will be retried on the next poll.
+func (m *SyncManager) SyncOnce(ctx context.Context) (int, error) {
+	ctx = WithBackgroundPriority(ctx)
+	if m.coverage != nil {
+		m.resumeCovered(ctx)
+	}
+
+	records, err := m.source.Pending(ctx, m.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	uploaded := 0
+	for _, record := range records {
+		if ctx.Err() != nil {
+			return uploaded, ctx.Err()
+		}
+
+		if m.upload(ctx, record) {
+			uploaded++
+		}
+	}
+	return uploaded, nil
+}
+
+func (m *SyncManager) runStream(ctx context.Context, stream RecordStream, payments <-chan Event) error {
+	ctx = WithBackgroundPriority(ctx)
+
+	records, err := stream.Records(ctx)
+	if err != nil {
+		return err
+	}
+
+	recheck := time.NewTicker(m.recheckInterval)
+	defer recheck.Stop()
+
+	// Records that failed to upload from the stream are retried, by visit ID.
+	// The source isn't polled, as it also returns the records emitted on the
+	// stream but not read yet, which would then be uploaded twice.
+	failed := make(map[uint]*PatientRecord)
+	retry := time.NewTicker(m.pollInterval)
+	defer retry.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-retry.C:
+			for visitID, record := range failed {
+				if ctx.Err() != nil {
+					break
+				}
+				if m.upload(ctx, record) || m.isAwaiting(record) {
+					delete(failed, visitID)
+				}
+			}
+		case <-recheck.C:
+			if m.coverage != nil {
+				m.resumeCovered(ctx)
+			}
+		case event, ok := <-payments:
+			if !ok {
+				payments = nil
+				continue
+			}
+			m.resumePaid(ctx, event)
+		case record, ok := <-records:
+			if !ok {
+				return nil
+			}
+			if m.upload(ctx, record) || m.isAwaiting(record) {
+				delete(failed, record.VisitID)
+			} else {
+				failed[record.VisitID] = record
+			}
+		}
+	}
+}
+
+// upload syncs a single record and acknowledges it on success.
+// The outcome is recorded in the sync report.
+func (m *SyncManager) upload(ctx context.Context, record *PatientRecord) bool {
+	var uploaded bool
+	if err := safeCall(m.logger, "SyncManager", func() { uploaded = m.uploadRecord(ctx, record) }); err != nil {
+		m.stats.addFailure(FailurePanic)
+	}
+	return uploaded
+}
+
+func (m *SyncManager) uploadRecord(ctx context.Context, record *PatientRecord) bool {
+	if m.awaitPayment(ctx, record) {
+		return false
+	}
+
+	start := time.Now()
+	if err := m.records.SyncMedicalRecords(ctx, record); err != nil {
+		// The coverage lapsed since it was checked.
+		if m.coverage != nil && isPaymentRequired(err) {
+			m.park(record)
+			return false
+		}
+
+		m.logger.Error("unable to sync record for visit %d: %v\n", record.VisitID, err)
+		m.stats.addFailure(failureReason(err))
+		return false
+	}
+	latency := time.Since(start)
+
+	if err := m.source.Ack(ctx, record); err != nil {
+		m.logger.Error("unable to acknowledge record for visit %d: %v\n", record.VisitID, err)
+		m.stats.addFailure(FailureAck)
+		return false
+	}
+
+	m.stats.addUpload(recordSize(record), latency)
+	m.logger.Debug("synced record for visit %d\n", record.VisitID)
+	return true
+}
@@ -0,0 +1,175 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SyncFailureReason classifies why the SyncManager failed to upload a record.
+type SyncFailureReason string
+
+const (
+	FailureInvalidRecord SyncFailureReason = "invalid_record" // Attachment failed PDF or content type checks.
+	FailureResidency     SyncFailureReason = "residency"      // Residency region not supported.
+	FailureBandwidth     SyncFailureReason = "bandwidth"      // Daily bandwidth budget exceeded.
+	FailureCancelled     SyncFailureReason = "cancelled"      // Upload cancelled, aborted or timed out.
+	FailureAck           SyncFailureReason = "ack"            // Uploaded but not acknowledged by the RecordSource.
+	FailurePanic         SyncFailureReason = "panic"          // A callback or the RecordSource panicked.
+	FailureOther         SyncFailureReason = "other"          // Network, server or validation errors.
+)
+
+// failureReason classifies an upload error.
+func failureReason(err error) SyncFailureReason {
+	var panicErr *PanicError
+	switch {
+	case errors.As(err, &panicErr):
+		return FailurePanic
+	case errors.Is(err, ErrInvalidMedicalReportPDF), errors.Is(err, ErrInvalidLabReportPDF),
+		errors.Is(err, ErrContentTypeMismatch):
+		return FailureInvalidRecord
+	case errors.Is(err, ErrResidencyUnsupported):
+		return FailureResidency
+	case errors.Is(err, ErrBandwidthBudgetExceeded):
+		return FailureBandwidth
+	case errors.Is(err, ErrUploadAborted), errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return FailureCancelled
+	}
+	return FailureOther
+}
+
+// SyncDayReport aggregates the uploads of a single day.
+type SyncDayReport struct {
+	Day              time.Time                 `json:"day"`                // Start of the day (local time).
+	Uploaded         int                       `json:"uploaded"`           // Records uploaded and acknowledged.
+	Failed           int                       `json:"failed"`             // Failed upload attempts.
+	Bytes            int64                     `json:"bytes"`              // Attachment bytes of uploaded records.
+	FailuresByReason map[SyncFailureReason]int `json:"failures_by_reason"` // Failed attempts per reason.
+	AverageLatency   time.Duration             `json:"average_latency"`    // Mean upload time in nanoseconds.
+
+	totalLatency time.Duration
+}
+
+// SyncReport is the upload summary returned by SyncManager.SyncReport,
+// suitable for an end-of-day email to the records officer.
+type SyncReport struct {
+	Days []SyncDayReport `json:"days"` // Oldest day first.
+}
+
+var syncReportHeader = []string{"day", "uploaded", "failed", "bytes", "average_latency_ms",
+	"failures_" + string(FailureInvalidRecord), "failures_" + string(FailureResidency),
+	"failures_" + string(FailureBandwidth), "failures_" + string(FailureCancelled),
+	"failures_" + string(FailureAck), "failures_" + string(FailurePanic), "failures_" + string(FailureOther),
+}
+
+// WriteCSV writes the report as CSV with a header row and one row per day.
+func (r *SyncReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(syncReportHeader); err != nil {
+		return err
+	}
+
+	for _, day := range r.Days {
+		row := []string{
+			day.Day.Format(time.DateOnly),
+			strconv.Itoa(day.Uploaded),
+			strconv.Itoa(day.Failed),
+			strconv.FormatInt(day.Bytes, 10),
+			strconv.FormatInt(day.AverageLatency.Milliseconds(), 10),
+		}
+
+		for _, reason := range []SyncFailureReason{FailureInvalidRecord, FailureResidency, FailureBandwidth,
+			FailureCancelled, FailureAck, FailurePanic, FailureOther} {
+			row = append(row, strconv.Itoa(day.FailuresByReason[reason]))
+		}
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// syncReportRetention is the number of days kept by the SyncManager.
+const syncReportRetention = 31
+
+// syncStats collects the per-day upload aggregates of a SyncManager.
+type syncStats struct {
+	mu   sync.Mutex
+	days map[time.Time]*SyncDayReport
+	now  func() time.Time
+}
+
+func newSyncStats() *syncStats {
+	return &syncStats{days: make(map[time.Time]*SyncDayReport), now: time.Now}
+}
+
+// today returns the aggregate of the current day, dropping expired days. Caller must hold mu.
+func (s *syncStats) today() *SyncDayReport {
+	now := s.now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	report, ok := s.days[day]
+	if !ok {
+		report = &SyncDayReport{Day: day, FailuresByReason: make(map[SyncFailureReason]int)}
+		s.days[day] = report
+
+		oldest := day.AddDate(0, 0, -syncReportRetention+1)
+		maps.DeleteFunc(s.days, func(d time.Time, _ *SyncDayReport) bool {
+			return d.Before(oldest)
+		})
+	}
+	return report
+}
+
+func (s *syncStats) addUpload(bytes int64, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := s.today()
+	report.Uploaded++
+	report.Bytes += bytes
+	report.totalLatency += latency
+	report.AverageLatency = report.totalLatency / time.Duration(report.Uploaded)
+}
+
+func (s *syncStats) addFailure(reason SyncFailureReason) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := s.today()
+	report.Failed++
+	report.FailuresByReason[reason]++
+}
+
+func (s *syncStats) report() *SyncReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &SyncReport{Days: make([]SyncDayReport, 0, len(s.days))}
+	for _, day := range s.days {
+		copied := *day
+		copied.FailuresByReason = maps.Clone(day.FailuresByReason)
+		report.Days = append(report.Days, copied)
+	}
+
+	slices.SortFunc(report.Days, func(a, b SyncDayReport) int {
+		return a.Day.Compare(b.Day)
+	})
+	return report
+}
+
+// SyncReport returns the per-day upload aggregates of the last 31 days, oldest first.
+// Days without any upload attempt are omitted.
+func (m *SyncManager) SyncReport() *SyncReport {
+	return m.stats.report()
+}
@@ -0,0 +1,391 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRecordsService records uploads and fails for the configured visit IDs.
+// Methods other than SyncMedicalRecords are not implemented.
+type fakeRecordsService struct {
+	RecordsService
+
+	mu       sync.Mutex
+	uploaded []uint
+	failFor  map[uint]bool
+}
+
+func (f *fakeRecordsService) SyncMedicalRecords(ctx context.Context, record *PatientRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failFor[record.VisitID] {
+		return errors.New("upload failed")
+	}
+	f.uploaded = append(f.uploaded, record.VisitID)
+	return nil
+}
+
+// memoryRecordSource is an in-memory RecordSource.
+type memoryRecordSource struct {
+	mu      sync.Mutex
+	pending []*PatientRecord
+}
+
+func (s *memoryRecordSource) Pending(ctx context.Context, limit int) ([]*PatientRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.pending[:min(limit, len(s.pending))]), nil
+}
+
+func (s *memoryRecordSource) Ack(ctx context.Context, record *PatientRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, r := range s.pending {
+		if r == record {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func TestSyncManagerSyncOnce(t *testing.T) {
+	source := &memoryRecordSource{pending: []*PatientRecord{{VisitID: 1}, {VisitID: 2}, {VisitID: 3}}}
+	records := &fakeRecordsService{failFor: map[uint]bool{2: true}}
+
+	manager, err := NewSyncManager(records, SyncManagerConfig{Source: source})
+	if err != nil {
+		t.Fatalf("NewSyncManager() failed: %v", err)
+	}
+
+	uploaded, err := manager.SyncOnce(context.Background())
+	if err != nil {
+		t.Fatalf("SyncOnce() failed: %v", err)
+	}
+	if uploaded != 2 {
+		t.Errorf("expected 2 uploaded records, got %d", uploaded)
+	}
+
+	// The failed record must stay pending for the next poll.
+	if len(source.pending) != 1 || source.pending[0].VisitID != 2 {
+		t.Errorf("expected visit 2 to remain pending, got %+v", source.pending)
+	}
+}
+
+func TestSyncReport(t *testing.T) {
+	source := &memoryRecordSource{pending: []*PatientRecord{
+		{VisitID: 1, LabReport: []byte("1234")},
+		{VisitID: 2},
+		{VisitID: 3, LabReport: []byte("123456")},
+	}}
+	records := &fakeRecordsService{failFor: map[uint]bool{2: true}}
+
+	manager, err := NewSyncManager(records, SyncManagerConfig{Source: source})
+	if err != nil {
+		t.Fatalf("NewSyncManager() failed: %v", err)
+	}
+
+	today := time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC)
+	manager.stats.now = func() time.Time { return today }
+
+	if _, err := manager.SyncOnce(context.Background()); err != nil {
+		t.Fatalf("SyncOnce() failed: %v", err)
+	}
+
+	report := manager.SyncReport()
+	if len(report.Days) != 1 {
+		t.Fatalf("expected 1 day, got %d", len(report.Days))
+	}
+
+	day := report.Days[0]
+	if day.Uploaded != 2 || day.Failed != 1 || day.Bytes != 10 {
+		t.Errorf("unexpected aggregates: %+v", day)
+	}
+	if day.FailuresByReason[FailureOther] != 1 {
+		t.Errorf("expected 1 failure with reason %q, got %v", FailureOther, day.FailuresByReason)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV() failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "2025-03-14,2,1,10,") {
+		t.Errorf("unexpected CSV:\n%s", buf.String())
+	}
+
+	if _, err := json.Marshal(report); err != nil {
+		t.Errorf("unable to marshal report: %v", err)
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		err    error
+		reason SyncFailureReason
+	}{
+		{fmt.Errorf("upload: %w", ErrContentTypeMismatch), FailureInvalidRecord},
+		{&UploadAbortedError{UploadID: "u1", Cause: context.Canceled}, FailureCancelled},
+		{ErrBandwidthBudgetExceeded, FailureBandwidth},
+		{&PanicError{Source: "TitleNormalizer"}, FailurePanic},
+		{errors.New("statusCode=500 remote error: boom"), FailureOther},
+	}
+
+	for _, tt := range tests {
+		if got := failureReason(tt.err); got != tt.reason {
+			t.Errorf("failureReason(%v) = %q, want %q", tt.err, got, tt.reason)
+		}
+	}
+}
+
+// fakeCoverage covers the subscribers in covered and publishes events.
+type fakeCoverage struct {
+	mu      sync.Mutex
+	covered map[uint]bool
+	checks  int
+	events  chan Event
+}
+
+func (f *fakeCoverage) CheckCoverage(ctx context.Context, subscriberID uint, at time.Time) (*CoverageStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.checks++
+	return &CoverageStatus{Active: f.covered[subscriberID]}, nil
+}
+
+func (f *fakeCoverage) Events(ctx context.Context) <-chan Event {
+	return f.events
+}
+
+func (f *fakeCoverage) cover(subscriberID uint) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.covered[subscriberID] = true
+}
+
+func TestSyncManagerAwaitingPayment(t *testing.T) {
+	source := &memoryRecordSource{pending: []*PatientRecord{
+		{VisitID: 1, SubscriberID: 10},
+		{VisitID: 2, SubscriberID: 20},
+		{VisitID: 3, SubscriberID: 20},
+	}}
+	records := &fakeRecordsService{}
+	coverage := &fakeCoverage{covered: map[uint]bool{10: true}, events: make(chan Event)}
+
+	manager, err := NewSyncManager(records, SyncManagerConfig{
+		Source:       source,
+		PollInterval: time.Hour,
+		Coverage:     coverage,
+	})
+	if err != nil {
+		t.Fatalf("NewSyncManager() failed: %v", err)
+	}
+
+	uploaded, err := manager.SyncOnce(context.Background())
+	if err != nil {
+		t.Fatalf("SyncOnce() failed: %v", err)
+	}
+	if uploaded != 1 || !slices.Equal(records.uploaded, []uint{1}) {
+		t.Fatalf("expected only visit 1 uploaded, got %v", records.uploaded)
+	}
+
+	// The second record of subscriber 20 is parked without another check.
+	if coverage.checks != 2 {
+		t.Errorf("expected 2 coverage checks, got %d", coverage.checks)
+	}
+
+	var visits []uint
+	for _, record := range manager.AwaitingPayment() {
+		visits = append(visits, record.VisitID)
+	}
+	if !slices.Equal(visits, []uint{2, 3}) {
+		t.Errorf("expected visits 2 and 3 awaiting payment, got %v", visits)
+	}
+
+	// Polling again keeps them parked.
+	if _, err := manager.SyncOnce(context.Background()); err != nil {
+		t.Fatalf("SyncOnce() failed: %v", err)
+	}
+	if len(records.uploaded) != 1 || len(manager.AwaitingPayment()) != 2 {
+		t.Fatalf("expected parked records to stay parked, uploaded %v", records.uploaded)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- manager.Run(ctx) }()
+
+	coverage.cover(20)
+	coverage.events <- Event{Type: EventPaymentRecorded, Payment: &Payment{SubscriberID: 20}}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(manager.AwaitingPayment()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	records.mu.Lock()
+	defer records.mu.Unlock()
+	slices.Sort(records.uploaded)
+	if !slices.Equal(records.uploaded, []uint{1, 2, 3}) {
+		t.Errorf("expected parked records uploaded after payment, got %v", records.uploaded)
+	}
+	if len(source.pending) != 0 {
+		t.Errorf("expected all records acknowledged, %d pending", len(source.pending))
+	}
+}
+
+func TestSyncManagerPaymentRequired(t *testing.T) {
+	source := &memoryRecordSource{pending: []*PatientRecord{{VisitID: 1, SubscriberID: 10}}}
+	records := &paymentRequiredRecords{}
+	coverage := &fakeCoverage{covered: map[uint]bool{10: true}}
+
+	manager, err := NewSyncManager(records, SyncManagerConfig{Source: source, Coverage: coverage})
+	if err != nil {
+		t.Fatalf("NewSyncManager() failed: %v", err)
+	}
+
+	if _, err := manager.SyncOnce(context.Background()); err != nil {
+		t.Fatalf("SyncOnce() failed: %v", err)
+	}
+	if len(manager.AwaitingPayment()) != 1 {
+		t.Errorf("expected the record rejected with 402 to await payment")
+	}
+	if report := manager.SyncReport(); len(report.Days) != 0 {
+		t.Errorf("expected parked record not counted as failed, got %+v", report.Days)
+	}
+}
+
+// paymentRequiredRecords rejects uploads with 402 Payment Required.
+type paymentRequiredRecords struct {
+	RecordsService
+}
+
+func (paymentRequiredRecords) SyncMedicalRecords(ctx context.Context, record *PatientRecord) error {
+	return &APIError{StatusCode: 402, Message: "subscription expired"}
+}
+
+// streamRecordSource is a memoryRecordSource that also streams its records.
+type streamRecordSource struct {
+	memoryRecordSource
+	stream chan *PatientRecord
+}
+
+func (s *streamRecordSource) Records(ctx context.Context) (<-chan *PatientRecord, error) {
+	return s.stream, nil
+}
+
+// flakyRecordsService fails the first upload of each visit.
+type flakyRecordsService struct {
+	fakeRecordsService
+	attempts map[uint]int
+}
+
+func (f *flakyRecordsService) SyncMedicalRecords(ctx context.Context, record *PatientRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.attempts[record.VisitID]++
+	if f.attempts[record.VisitID] == 1 {
+		return errors.New("upload failed")
+	}
+	f.uploaded = append(f.uploaded, record.VisitID)
+	return nil
+}
+
+func TestSyncManagerStreamNoDuplicates(t *testing.T) {
+	// The record is pending at the source before the stream emits it.
+	record := &PatientRecord{VisitID: 2}
+	source := &streamRecordSource{
+		memoryRecordSource: memoryRecordSource{pending: []*PatientRecord{record}},
+		stream:             make(chan *PatientRecord, 1),
+	}
+	records := &fakeRecordsService{}
+
+	manager, err := NewSyncManager(records, SyncManagerConfig{Source: source, PollInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewSyncManager() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- manager.Run(ctx) }()
+
+	time.Sleep(20 * time.Millisecond)
+	source.stream <- record
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		source.mu.Lock()
+		pending := len(source.pending)
+		source.mu.Unlock()
+		if pending == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+
+	records.mu.Lock()
+	defer records.mu.Unlock()
+	if !slices.Equal(records.uploaded, []uint{2}) {
+		t.Errorf("expected visit 2 uploaded once, got %v", records.uploaded)
+	}
+}
+
+func TestSyncManagerStreamRetry(t *testing.T) {
+	record := &PatientRecord{VisitID: 1}
+	source := &streamRecordSource{
+		memoryRecordSource: memoryRecordSource{pending: []*PatientRecord{record}},
+		stream:             make(chan *PatientRecord, 1),
+	}
+	records := &flakyRecordsService{attempts: map[uint]int{}}
+
+	manager, err := NewSyncManager(records, SyncManagerConfig{Source: source, PollInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewSyncManager() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- manager.Run(ctx) }()
+
+	source.stream <- record
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		source.mu.Lock()
+		pending := len(source.pending)
+		source.mu.Unlock()
+		if pending == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	records.mu.Lock()
+	defer records.mu.Unlock()
+	if !slices.Equal(records.uploaded, []uint{1}) || records.attempts[1] != 2 {
+		t.Errorf("expected visit 1 uploaded on the second attempt, got %v after %d attempts",
+			records.uploaded, records.attempts[1])
+	}
+	if len(source.pending) != 0 {
+		t.Errorf("expected the retried record acknowledged, %d pending", len(source.pending))
+	}
+}
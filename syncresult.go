@@ -0,0 +1,47 @@
+package ecloudsdk
+
+import (
+	"context"
+	"time"
+)
+
+// SyncResult is what ecloud stored for an uploaded record, so local
+// databases can link their records to ecloud's.
+type SyncResult struct {
+	RecordID uint `json:"id"` // ID of the record on ecloud.
+
+	// URLs of the stored files, keyed by multipart field e.g "lab_report"
+	// or "attachment_0".
+	Files map[string]string `json:"files,omitempty"`
+
+	// SHA-256 of the stored files, keyed by multipart field.
+	Checksums map[string]string `json:"checksums,omitempty"`
+
+	// The record was already stored, e.g by an upload retried after a lost
+	// response, and RecordID is the existing record.
+	Duplicate bool `json:"duplicate"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Server warnings about the record, also passed to Config.WarningHandler.
+	Warnings []Warning `json:"warnings,omitempty"`
+
+	// The completed operation if ecloud processed the record asynchronously
+	// (202 Accepted), nil otherwise.
+	Operation *Operation `json:"-"`
+}
+
+// SyncMedicalRecordsV2 is SyncMedicalRecords returning what ecloud stored.
+func (c *DefaultEcloudClient) SyncMedicalRecordsV2(ctx context.Context, patientRecord *PatientRecord) (result *SyncResult, err error) {
+	ctx, span := c.startSpan(ctx, "SyncMedicalRecords")
+	defer func() { span.end(err) }()
+
+	record, result, err := c.syncRecord(ctx, patientRecord, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c.publish(ctx, Event{Type: EventRecordSynced, Record: record})
+	return result, nil
+}
@@ -0,0 +1,58 @@
+package ecloudsdk
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// throttledReader limits the rate at which r is read to rate bytes per second.
+type throttledReader struct {
+	ctx   context.Context
+	r     io.Reader
+	rate  int64
+	burst int
+
+	start time.Time
+	read  int64
+	now   func() time.Time
+}
+
+// newThrottledReader returns r limited to rate bytes per second.
+// A rate of zero or less returns r unchanged.
+func newThrottledReader(ctx context.Context, r io.Reader, rate int64) io.Reader {
+	if rate <= 0 {
+		return r
+	}
+
+	// Read in slices of about 100ms worth of data to keep the rate smooth.
+	burst := int(max(rate/10, 512))
+	return &throttledReader{ctx: ctx, r: r, rate: rate, burst: burst, now: time.Now}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = t.now()
+	}
+
+	if len(p) > t.burst {
+		p = p[:t.burst]
+	}
+
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+
+	// Sleep until the bytes read so far fit within the rate.
+	due := t.start.Add(time.Duration(float64(t.read) / float64(t.rate) * float64(time.Second)))
+	if wait := due.Sub(t.now()); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,119 @@
+package ecloudsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Bounds of the thumbnail size accepted by GetRecordThumbnail.
+const (
+	MinThumbnailSize = 32
+	MaxThumbnailSize = 1024
+)
+
+// GetRecordThumbnail streams a server-rendered PNG preview of an uploaded record,
+// at most size pixels wide and high. The caller must close the returned reader,
+// which may be done before reading it to the end.
+//
+// Compressed responses are decompressed as they are read. If the server sends
+// the SHA-256 of the thumbnail in ReportSHA256Header, reading it to the end
+// fails with ErrChecksumMismatch on a mismatch, as does Close once every byte
+// was read. Once ctx is done, reads fail with the context error.
+//
+// If Config.ThumbnailCacheDir is set, thumbnails are cached on disk and served
+// from the cache on later calls. A thumbnail is only cached once it was read
+// completely and verified.
+func (c *DefaultEcloudClient) GetRecordThumbnail(ctx context.Context, recordID uint, size int) (io.ReadCloser, error) {
+	if size < MinThumbnailSize || size > MaxThumbnailSize {
+		return nil, fmt.Errorf("thumbnail size must be between %d and %d pixels, got %d",
+			MinThumbnailSize, MaxThumbnailSize, size)
+	}
+
+	cacheDir := c.cfg().ThumbnailCacheDir
+	cachePath := ""
+	if cacheDir != "" {
+		cachePath = filepath.Join(cacheDir, fmt.Sprintf("record-%d-%d.png", recordID, size))
+
+		file, err := os.Open(cachePath)
+		if err == nil {
+			return file, nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			c.logger.Error("unable to read cached thumbnail: %v\n", err)
+		}
+	}
+
+	url := fmt.Sprintf("%s/api/records/%d/thumbnail?size=%d", c.cfg().ApiBaseUrl, recordID, size)
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, map[string]string{"Accept": "image/png"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch thumbnail: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, c.decodeResourceError(resp, ErrRecordNotFound)
+	}
+
+	body := newDownloadBody(ctx, resp, resp.Header.Get(ReportSHA256Header))
+	if cachePath == "" {
+		return body, nil
+	}
+
+	if err := os.MkdirAll(cacheDir, 0o700); err != nil {
+		c.logger.Error("unable to create thumbnail cache: %v\n", err)
+		return body, nil
+	}
+
+	tmp, err := os.CreateTemp(cacheDir, ".thumbnail-*")
+	if err != nil {
+		c.logger.Error("unable to create cached thumbnail: %v\n", err)
+		return body, nil
+	}
+	return &thumbnailCacheWriter{body: body, tmp: tmp, path: cachePath, logger: c.logger}, nil
+}
+
+// thumbnailCacheWriter copies the thumbnail to a temporary file while it is
+// read and moves it into the cache on Close if it was read to the end.
+type thumbnailCacheWriter struct {
+	body     io.ReadCloser
+	tmp      *os.File
+	path     string
+	logger   Logger
+	complete bool
+	failed   bool
+}
+
+func (w *thumbnailCacheWriter) Read(p []byte) (int, error) {
+	n, err := w.body.Read(p)
+	if n > 0 && !w.failed {
+		if _, werr := w.tmp.Write(p[:n]); werr != nil {
+			w.logger.Error("unable to write cached thumbnail: %v\n", werr)
+			w.failed = true
+		}
+	}
+
+	if err == io.EOF {
+		w.complete = true
+	}
+	return n, err
+}
+
+func (w *thumbnailCacheWriter) Close() error {
+	err := w.body.Close()
+
+	closeErr := w.tmp.Close()
+	if err == nil && w.complete && !w.failed && closeErr == nil {
+		if renameErr := os.Rename(w.tmp.Name(), w.path); renameErr == nil {
+			return err
+		}
+	}
+
+	os.Remove(w.tmp.Name())
+	return err
+}
@@ -0,0 +1,102 @@
+package ecloudsdk
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+)
+
+// RequestTiming is the timing breakdown of a single HTTP attempt, collected with httptrace.
+// Phases that did not happen (e.g DNS and TLS on a reused connection) are zero.
+type RequestTiming struct {
+	Method     string
+	URL        string
+	Attempt    int           // Zero for the first attempt.
+	DNS        time.Duration // DNS lookup.
+	Connect    time.Duration // TCP connect.
+	TLS        time.Duration // TLS handshake.
+	TTFB       time.Duration // From start of the request to the first response byte.
+	Total      time.Duration // From start of the request until the response headers are read.
+	ReusedConn bool          // Whether a pooled connection was reused.
+}
+
+// requestTimer collects a RequestTiming from httptrace callbacks.
+type requestTimer struct {
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	timing       RequestTiming
+}
+
+func newRequestTimer(req *http.Request, attempt int) *requestTimer {
+	return &requestTimer{
+		start: time.Now(),
+		timing: RequestTiming{
+			Method:  req.Method,
+			URL:     req.URL.Redacted(),
+			Attempt: attempt,
+		},
+	}
+}
+
+func (t *requestTimer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.timing.DNS = time.Since(t.dnsStart) },
+		ConnectStart: func(network, addr string) {
+			t.connectStart = time.Now()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.timing.Connect = time.Since(t.connectStart)
+		},
+		TLSHandshakeStart: func() { t.tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.timing.TLS = time.Since(t.tlsStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) { t.timing.ReusedConn = info.Reused },
+		GotFirstResponseByte: func() {
+			t.timing.TTFB = time.Since(t.start)
+		},
+	}
+}
+
+// finish records the total duration and returns the collected timing.
+func (t *requestTimer) finish() RequestTiming {
+	t.timing.Total = time.Since(t.start)
+	return t.timing
+}
+
+// slowCallThreshold returns the threshold for the endpoint at path.
+// The longest matching prefix in Config.SlowCallThresholds wins,
+// falling back to Config.SlowCallThreshold.
+func (c *DefaultEcloudClient) slowCallThreshold(path string) time.Duration {
+	threshold := c.cfg().SlowCallThreshold
+
+	longest := -1
+	for prefix, value := range c.cfg().SlowCallThresholds {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			threshold = value
+			longest = len(prefix)
+		}
+	}
+	return threshold
+}
+
+// checkSlowCall logs a warning with the timing breakdown if the call exceeded its threshold.
+func (c *DefaultEcloudClient) checkSlowCall(path string, timing RequestTiming) {
+	threshold := c.slowCallThreshold(path)
+	if threshold <= 0 || timing.Total < threshold {
+		return
+	}
+
+	logStructured(context.Background(), c.logger, slog.LevelWarn, "slow call",
+		"method", timing.Method, "url", timing.URL, "attempt", timing.Attempt,
+		"total", timing.Total, "threshold", threshold, "dns", timing.DNS,
+		"connect", timing.Connect, "tls", timing.TLS, "ttfb", timing.TTFB,
+		"reused_conn", timing.ReusedConn)
+}
@@ -0,0 +1,70 @@
+package ecloudsdk
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TitleNormalizer rewrites the title of a record before it is validated and uploaded,
+// so the portal shows consistent document names.
+type TitleNormalizer interface {
+	NormalizeTitle(record *PatientRecord) (string, error)
+}
+
+// Placeholders supported by TemplateTitleNormalizer.Template.
+const (
+	TitlePlaceholderVisitType = "{visit_type}"
+	TitlePlaceholderDate      = "{date}"
+	TitlePlaceholderVisitID   = "{visit_id}"
+)
+
+// TemplateTitleNormalizer maps free-form titles to canonical visit types
+// and renders them with a template.
+//
+// For example with Aliases {"opd": "Outpatient", "opd visit": "Outpatient"}
+// and Template "{visit_type} - {date}", a record titled " OPD  visit" becomes
+// "Outpatient - 2025-03-14".
+type TemplateTitleNormalizer struct {
+	// Maps lowercase titles to the canonical visit type.
+	// Titles without an alias are used as the visit type after whitespace cleanup.
+	Aliases map[string]string
+
+	// Template for the final title. Defaults to "{visit_type}".
+	Template string
+
+	// Go time layout used for {date}. Defaults to "2006-01-02".
+	DateLayout string
+}
+
+// NormalizeTitle implements TitleNormalizer.
+func (n *TemplateTitleNormalizer) NormalizeTitle(record *PatientRecord) (string, error) {
+	// Collapse runs of whitespace.
+	title := strings.Join(strings.Fields(record.Title), " ")
+
+	visitType := title
+	if canonical, ok := n.Aliases[strings.ToLower(title)]; ok {
+		visitType = canonical
+	}
+
+	template := n.Template
+	if template == "" {
+		template = TitlePlaceholderVisitType
+	}
+
+	dateLayout := n.DateLayout
+	if dateLayout == "" {
+		dateLayout = "2006-01-02"
+	}
+
+	var date string
+	if !record.VisitTimestamp.IsZero() {
+		date = record.VisitTimestamp.Format(dateLayout)
+	}
+
+	replacer := strings.NewReplacer(
+		TitlePlaceholderVisitType, visitType,
+		TitlePlaceholderDate, date,
+		TitlePlaceholderVisitID, fmt.Sprintf("%d", record.VisitID),
+	)
+	return strings.TrimSpace(replacer.Replace(template)), nil
+}
@@ -0,0 +1,71 @@
+package ecloudsdk
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+// StrictCipherSuites is the restricted TLS 1.2 cipher list used when Config.StrictTLS is set.
+// Only ECDHE key exchange with AEAD ciphers is allowed.
+// TLS 1.3 cipher suites are not configurable in Go and are always secure.
+var StrictCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// TLSParameters describes the TLS connection negotiated with the ecloud server.
+type TLSParameters struct {
+	Version     string // e.g "TLS 1.3"
+	CipherSuite string // e.g "TLS_AES_128_GCM_SHA256"
+	ServerName  string // SNI server name.
+	Protocol    string // Negotiated ALPN protocol e.g "h2".
+}
+
+// tlsConfig builds the TLS configuration of the internal transport.
+// It returns nil when no TLS setting is configured, keeping Go's defaults.
+func tlsConfig(config *Config) *tls.Config {
+	if !config.StrictTLS && config.MinTLSVersion == 0 && len(config.CipherSuites) == 0 {
+		return nil
+	}
+
+	tlsConf := &tls.Config{
+		MinVersion:   config.MinTLSVersion,
+		CipherSuites: config.CipherSuites,
+	}
+
+	if config.StrictTLS {
+		tlsConf.MinVersion = max(tlsConf.MinVersion, tls.VersionTLS12)
+		if len(tlsConf.CipherSuites) == 0 {
+			tlsConf.CipherSuites = StrictCipherSuites
+		}
+	}
+	return tlsConf
+}
+
+// NegotiatedTLS connects to the ecloud server and reports the negotiated TLS parameters.
+// It is meant for verifying the security baseline of a deployment.
+// An error is returned if the connection does not use TLS.
+func (c *DefaultEcloudClient) NegotiatedTLS(ctx context.Context) (*TLSParameters, error) {
+	resp, err := c.performRequest(ctx, http.MethodHead, c.cfg().ApiBaseUrl, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to ecloud: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.TLS == nil {
+		return nil, fmt.Errorf("connection to %s does not use TLS", c.cfg().ApiBaseUrl)
+	}
+
+	return &TLSParameters{
+		Version:     tls.VersionName(resp.TLS.Version),
+		CipherSuite: tls.CipherSuiteName(resp.TLS.CipherSuite),
+		ServerName:  resp.TLS.ServerName,
+		Protocol:    resp.TLS.NegotiatedProtocol,
+	}, nil
+}
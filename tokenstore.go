@@ -0,0 +1,262 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// StoredToken is an authenticated session persisted by a TokenStore.
+type StoredToken struct {
+	Token     string    `json:"token"`
+	User      User      `json:"user"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"` // Zero if the token has no exp claim.
+}
+
+// TokenStore persists sessions so a restarted application can resume its
+// JWT session instead of logging in again.
+// Keys identify the deployment and account the token belongs to.
+type TokenStore interface {
+	// Get returns the token stored under key, or nil if there is none.
+	Get(ctx context.Context, key string) (*StoredToken, error)
+
+	// Set stores token under key, replacing any previous token.
+	Set(ctx context.Context, key string, token *StoredToken) error
+
+	// Delete removes the token stored under key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// MemoryTokenStore is a TokenStore that keeps tokens in memory,
+// sharing a session between clients of the same process.
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]StoredToken
+}
+
+// NewMemoryTokenStore creates an empty MemoryTokenStore.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: make(map[string]StoredToken)}
+}
+
+func (s *MemoryTokenStore) Get(ctx context.Context, key string) (*StoredToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[key]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func (s *MemoryTokenStore) Set(ctx context.Context, key string, token *StoredToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[key] = *token
+	return nil
+}
+
+func (s *MemoryTokenStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, key)
+	return nil
+}
+
+// FileTokenStore is a TokenStore that keeps tokens in a JSON file readable
+// only by the current user. Tokens are stored in plain text.
+type FileTokenStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileTokenStore creates a FileTokenStore backed by the file at path.
+// The file and its directory are created on the first Set.
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{path: path}
+}
+
+func (s *FileTokenStore) Get(ctx context.Context, key string) (*StoredToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	token, ok := tokens[key]
+	if !ok {
+		return nil, nil
+	}
+	return &token, nil
+}
+
+func (s *FileTokenStore) Set(ctx context.Context, key string, token *StoredToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	tokens[key] = *token
+	return s.write(tokens)
+}
+
+func (s *FileTokenStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := tokens[key]; !ok {
+		return nil
+	}
+
+	delete(tokens, key)
+	return s.write(tokens)
+}
+
+// read loads the tokens file. A missing file is an empty store.
+func (s *FileTokenStore) read() (map[string]StoredToken, error) {
+	tokens := make(map[string]StoredToken)
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return tokens, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token store: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("unable to decode token store: %w", err)
+	}
+	return tokens, nil
+}
+
+// write replaces the tokens file atomically.
+func (s *FileTokenStore) write(tokens map[string]StoredToken) error {
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("unable to create token store directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tokens-*")
+	if err != nil {
+		return fmt.Errorf("unable to write token store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("unable to write token store: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write token store: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("unable to write token store: %w", err)
+	}
+	return nil
+}
+
+// tokenStoreKey identifies the deployment and account of the current config,
+// so that tokens are never reused across environments or accounts.
+func (c *DefaultEcloudClient) tokenStoreKey() string {
+	config := c.cfg()
+	return config.ApiBaseUrl + "|" + config.EclinicId
+}
+
+// restoreToken resumes the session saved in Config.TokenStore, if any.
+// Expired tokens and store errors are ignored so that the caller logs in instead.
+func (c *DefaultEcloudClient) restoreToken(ctx context.Context) (*LoginResponse, bool) {
+	store := c.cfg().TokenStore
+	if store == nil {
+		return nil, false
+	}
+
+	stored, err := store.Get(ctx, c.tokenStoreKey())
+	if err != nil {
+		c.logger.Error("unable to read stored token: %v\n", err)
+		return nil, false
+	}
+
+	if stored == nil || stored.Token == "" {
+		return nil, false
+	}
+
+	if !stored.ExpiresAt.IsZero() && time.Until(stored.ExpiresAt) <= max(c.tokenRefreshMargin(), 0) {
+		return nil, false
+	}
+
+	c.authMu.Lock()
+	c.jwtToken = stored.Token
+	c.tokenExpiresAt = stored.ExpiresAt
+	c.user = stored.User
+	c.authenticated = true
+	c.authMu.Unlock()
+
+	// A revoked token would fail the first real operation, check it up front.
+	// The session is kept if the server can't tell, e.g while offline.
+	info, err := c.ValidateToken(ctx)
+	if err != nil {
+		c.logger.Debug("unable to validate stored session: %v\n", err)
+	} else if !info.Active {
+		c.authMu.Lock()
+		c.jwtToken, c.tokenExpiresAt, c.user, c.authenticated = "", time.Time{}, User{}, false
+		c.authMu.Unlock()
+
+		c.deleteToken(ctx)
+		c.logger.Info("stored session for user %s is no longer valid\n", stored.User.EclinicID)
+		return nil, false
+	}
+
+	c.logger.Info("resumed stored session for user: %s\n", stored.User.EclinicID)
+	return &LoginResponse{Token: stored.Token, User: stored.User}, true
+}
+
+// saveToken persists a new session to Config.TokenStore. Failures are only logged.
+func (c *DefaultEcloudClient) saveToken(ctx context.Context, loginResp *LoginResponse, expiresAt time.Time) {
+	store := c.cfg().TokenStore
+	if store == nil {
+		return
+	}
+
+	stored := &StoredToken{Token: loginResp.Token, User: loginResp.User, ExpiresAt: expiresAt}
+	if err := store.Set(ctx, c.tokenStoreKey(), stored); err != nil {
+		c.logger.Error("unable to store token: %v\n", err)
+	}
+}
+
+// deleteToken removes the stored session after its credentials were rejected.
+func (c *DefaultEcloudClient) deleteToken(ctx context.Context) {
+	store := c.cfg().TokenStore
+	if store == nil {
+		return
+	}
+
+	if err := store.Delete(ctx, c.tokenStoreKey()); err != nil {
+		c.logger.Error("unable to delete stored token: %v\n", err)
+	}
+}
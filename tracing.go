@@ -0,0 +1,118 @@
+package ecloudsdk
+
+import (
+	"context"
+	"net/http"
+)
+
+// TracerProvider starts the spans of SDK operations (Login, Subscribe,
+// SyncMedicalRecords, ...). Set it with Config.TracerProvider.
+//
+// The interface mirrors OpenTelemetry's so the SDK stays free of
+// dependencies; an adapter over an otel trace.Tracer takes a few lines,
+// see the README.
+type TracerProvider interface {
+	// Start starts a span named after the operation, as a child of the span in ctx.
+	Start(ctx context.Context, operation string) (context.Context, Span)
+}
+
+// Span is an operation span started by a TracerProvider.
+type Span interface {
+	SetAttributes(attributes ...Attribute)
+	RecordError(err error)
+	End()
+
+	// TraceParent returns the W3C traceparent header value identifying the
+	// span, sent with the operation's requests. Empty disables propagation.
+	TraceParent() string
+}
+
+// Attribute is a key-value pair attached to a span.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Span attributes set by the SDK.
+const (
+	AttributeHTTPMethod       = "http.request.method"
+	AttributeHTTPStatusCode   = "http.response.status_code"
+	AttributeRequestBodySize  = "http.request.body.size"
+	AttributeResponseBodySize = "http.response.body.size"
+	AttributeRetryCount       = "ecloud.retry_count"
+)
+
+// spanKey holds the operation span in the context of its requests.
+type spanKey struct{}
+
+// operationSpan wraps the span of an operation. A nil *operationSpan is a no-op,
+// used when Config.TracerProvider is nil.
+type operationSpan struct {
+	span Span
+}
+
+// startSpan starts the span of an SDK operation. End it with end.
+func (c *DefaultEcloudClient) startSpan(ctx context.Context, operation string) (context.Context, *operationSpan) {
+	provider := c.cfg().TracerProvider
+	if provider == nil {
+		return ctx, nil
+	}
+
+	ctx, span := provider.Start(ctx, operation)
+	op := &operationSpan{span: span}
+	return context.WithValue(ctx, spanKey{}, op), op
+}
+
+// spanFrom returns the operation span of ctx, or nil.
+func spanFrom(ctx context.Context) *operationSpan {
+	op, _ := ctx.Value(spanKey{}).(*operationSpan)
+	return op
+}
+
+// end records err, if any, and ends the span.
+func (s *operationSpan) end(err error) {
+	if s == nil {
+		return
+	}
+
+	if err != nil {
+		s.span.RecordError(err)
+	}
+	s.span.End()
+}
+
+// propagate sets the traceparent header of req.
+func (s *operationSpan) propagate(req *http.Request) {
+	if s == nil {
+		return
+	}
+
+	if traceParent := s.span.TraceParent(); traceParent != "" {
+		req.Header.Set("traceparent", traceParent)
+	}
+}
+
+// recordAttempt sets the attributes of an HTTP attempt that sent the given
+// number of body bytes. Later attempts overwrite the attributes of earlier ones.
+func (s *operationSpan) recordAttempt(req *http.Request, attempt int, sent int64, resp *http.Response) {
+	if s == nil {
+		return
+	}
+
+	attributes := []Attribute{
+		{Key: AttributeHTTPMethod, Value: req.Method},
+		{Key: AttributeRetryCount, Value: attempt},
+	}
+
+	if sent > 0 {
+		attributes = append(attributes, Attribute{Key: AttributeRequestBodySize, Value: sent})
+	}
+
+	if resp != nil {
+		attributes = append(attributes, Attribute{Key: AttributeHTTPStatusCode, Value: resp.StatusCode})
+		if resp.ContentLength >= 0 {
+			attributes = append(attributes, Attribute{Key: AttributeResponseBodySize, Value: resp.ContentLength})
+		}
+	}
+	s.span.SetAttributes(attributes...)
+}
@@ -0,0 +1,145 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// transactionHeader carries the visit transaction ID on record uploads.
+const transactionHeader = "X-Ecloud-Transaction"
+
+// visitTransaction is the server transaction that groups the records of a visit.
+type visitTransaction struct {
+	ID             string         `json:"id"`
+	VisitID        uint           `json:"visit_id"`
+	SubscriberID   uint           `json:"subscriber_id"`
+	HospitalNumber HospitalNumber `json:"hospital_number"`
+}
+
+// SyncVisit uploads all records of a single visit atomically.
+// The records are uploaded under a server transaction and only published
+// on the portal once every upload has succeeded, so a visit is never left half-published.
+// If any upload fails, the transaction is aborted and nothing is published.
+// If ctx is cancelled mid-upload, the returned *UploadAbortedError carries the transaction ID.
+//
+// All records must belong to the same visit and subscriber.
+func (c *DefaultEcloudClient) SyncVisit(ctx context.Context, records []*PatientRecord) (err error) {
+	ctx, span := c.startSpan(ctx, "SyncVisit")
+	defer func() { span.end(err) }()
+
+	if len(records) == 0 {
+		return fmt.Errorf("no records to submit for the visit")
+	}
+
+	for _, record := range records {
+		if err := record.Validate(); err != nil {
+			return fmt.Errorf("validation error: %w", err)
+		}
+
+		if record.VisitID != records[0].VisitID || record.SubscriberID != records[0].SubscriberID {
+			return fmt.Errorf("all records of a visit must have the same VisitID and SubscriberID")
+		}
+	}
+
+	if err := c.checkResidency(ctx); err != nil {
+		return err
+	}
+
+	tx, err := c.beginVisitTransaction(ctx, records[0].VisitID, records[0].SubscriberID)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{transactionHeader: tx.ID}
+	synced := make([]*PatientRecord, 0, len(records))
+	for _, record := range records {
+		record, _, err := c.syncRecord(ctx, record, headers)
+		if err != nil {
+			c.abortVisitTransaction(ctx, tx)
+			if ctx.Err() != nil {
+				return &UploadAbortedError{UploadID: tx.ID, Cause: ctx.Err()}
+			}
+			return fmt.Errorf("visit %d not published: %w", tx.VisitID, err)
+		}
+		synced = append(synced, record)
+	}
+
+	url := fmt.Sprintf("%s/api/records/transactions/%s/commit", c.cfg().ApiBaseUrl, tx.ID)
+	resp, err := c.performRequest(ctx, http.MethodPost, url, nil, nil)
+	if err != nil {
+		c.abortVisitTransaction(ctx, tx)
+		if ctx.Err() != nil {
+			return &UploadAbortedError{UploadID: tx.ID, Cause: ctx.Err()}
+		}
+		return fmt.Errorf("unable to commit visit %d: %w", tx.VisitID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := c.decodeError(resp)
+		c.abortVisitTransaction(ctx, tx)
+		return fmt.Errorf("unable to commit visit %d: %w", tx.VisitID, err)
+	}
+
+	// The records are only visible once the visit is committed.
+	for _, record := range synced {
+		c.publish(ctx, Event{Type: EventRecordSynced, Record: record})
+	}
+	return nil
+}
+
+func (c *DefaultEcloudClient) beginVisitTransaction(ctx context.Context, visitID, subscriberID uint) (*visitTransaction, error) {
+	tx := &visitTransaction{
+		VisitID:        visitID,
+		SubscriberID:   subscriberID,
+		HospitalNumber: c.cfg().HospitalNumber,
+	}
+
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	url := c.cfg().ApiBaseUrl + "/api/records/transactions"
+	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to begin visit transaction: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(tx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+
+	if tx.ID == "" {
+		return nil, fmt.Errorf("server returned an empty visit transaction id")
+	}
+	return tx, nil
+}
+
+// abortVisitTransaction discards the uploads of a failed visit transaction.
+// It runs even if ctx was cancelled, since the cancellation may be the reason for the abort.
+// Failures are only logged; the server expires abandoned transactions.
+func (c *DefaultEcloudClient) abortVisitTransaction(ctx context.Context, tx *visitTransaction) {
+	ctx = context.WithoutCancel(ctx)
+
+	url := fmt.Sprintf("%s/api/records/transactions/%s", c.cfg().ApiBaseUrl, tx.ID)
+	resp, err := c.performRequest(ctx, http.MethodDelete, url, nil, nil)
+	if err != nil {
+		c.logger.Error("unable to abort transaction for visit %d: %v\n", tx.VisitID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		c.logger.Error("unable to abort transaction for visit %d: %v\n", tx.VisitID, c.decodeError(resp))
+	}
+}
@@ -1,8 +1,13 @@
 package ecloudsdk
 
 import (
+	"crypto/ed25519"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http/httptrace"
+	"os"
 	"time"
 )
 
@@ -12,13 +17,52 @@ var (
 	ErrInvalidConfig           = errors.New("invalid configuration")
 	ErrHospitalNameRequired    = errors.New("hospital name is required")
 	ErrHospitalNumberRequired  = errors.New("hospital number is required")
+	ErrInvalidHospitalNumber   = errors.New("invalid hospital number")
 	ErrApiBaseURLRequired      = errors.New("ecloud ApiBaseURL is required")
 	ErrEclinicIDRequired       = errors.New("ecloud ElinicID  is required")
 	ErrEclinicBaseURL          = errors.New("EclinicBaseURL is required")
 	ErrEcloudPasswordRequired  = errors.New("ecloud password is required")
 	ErrEmptyToken              = errors.New("empty token received")
-	ErrInvalidMedicalReportPDF = errors.New("invalid PDF for laboratory report")
-	ErrInvalidLabReportPDF     = errors.New("invalid PDF for medical report")
+	ErrInvalidCredentials      = errors.New("invalid ecloud credentials")
+	ErrAuthUnavailable         = errors.New("ecloud authentication temporarily unavailable")
+	ErrInvalidMedicalReportPDF = errors.New("invalid PDF for medical report")
+	ErrInvalidLabReportPDF     = errors.New("invalid PDF for laboratory report")
+	ErrContentTypeMismatch     = errors.New("attachment content type mismatch")
+	ErrResidencyUnsupported    = errors.New("data residency region not supported by the ecloud deployment")
+	ErrUploadAborted           = errors.New("upload aborted")
+	ErrEnvironmentMismatch     = errors.New("base URL belongs to another environment")
+	ErrNotFound                = errors.New("resource not found")
+	ErrForbidden               = errors.New("forbidden")
+	ErrConflict                = errors.New("conflict")
+	ErrUnprocessable           = errors.New("unprocessable request")
+	ErrRateLimited             = errors.New("rate limited")
+	ErrServerError             = errors.New("ecloud server error")
+	ErrSubscriberNotFound      = errors.New("subscriber not found")
+	ErrRecordNotFound          = errors.New("record not found")
+	ErrPaymentNotFound         = errors.New("payment not found")
+	ErrKeychainUnsupported     = errors.New("os keychain is not supported on this platform")
+	ErrCircuitOpen             = errors.New("circuit breaker open")
+	ErrAlreadySubscribed       = errors.New("patient is already subscribed")
+	ErrReportPublicKeyRequired = errors.New("ecloud report public key is required to verify signed reports")
+	ErrInvalidReportSignature  = errors.New("report signature verification failed")
+	ErrInvalidReportPeriod     = errors.New("report period must have From before To")
+	ErrRecordSourceRequired    = errors.New("sync manager requires a record source")
+	ErrBandwidthBudgetExceeded = errors.New("daily bandwidth budget exceeded")
+	ErrInvalidAmount           = errors.New("invalid amount")
+	ErrQueueStoreRequired      = errors.New("upload queue requires a store or a directory")
+	ErrChecksumMismatch        = errors.New("report checksum mismatch")
+	ErrInvalidEncryptionKey    = errors.New("report encryption key must be 32 bytes")
+	ErrReportDecryption        = errors.New("unable to decrypt report")
+	ErrRedirectRejected        = errors.New("redirect rejected")
+	ErrInboundUploadNotFound   = errors.New("inbound upload not found")
+	ErrInvalidAttachment       = errors.New("invalid attachment")
+	ErrQueueVersionUnsupported = errors.New("queued record written by a newer SDK")
+	ErrHostNotAllowed          = errors.New("host not allowed")
+	ErrPartialSubscription     = errors.New("patient subscribed without payment")
+	ErrOperationFailed         = errors.New("operation failed")
+	ErrSpillFull               = errors.New("upload queue spill directory is full")
+	ErrQueueCorrupted          = errors.New("queued record corrupted")
+	ErrEventSpillDirRequired   = errors.New("EventSpillDir is required to spill events to disk")
 )
 
 // LoginRequest is used to send login credentials.
@@ -46,18 +90,39 @@ type LoginResponse struct {
 type Bill struct {
 	Amount   float64       // Subscription amount.
 	Duration time.Duration // Duration of the subscription before expiry.
+
+	// Non-fatal warnings attached by the server.
+	Warnings []Warning `json:"warnings,omitempty"`
 }
 
 type Subscriber struct {
-	ID             uint      `json:"id"`              // Primary Key for the subscription.
-	EclinicID      string    `json:"eclinic_id"`      // Unique subcription ID
-	PatientID      uint      `json:"patient_id"`      // Patient ID in Eclinic HMS
-	PatientName    string    `json:"patient_name"`    // Name of the patient.
-	Email          string    `json:"email"`           // Optional email.
-	HospitalNumber string    `json:"hospital_number"` // Globally unique Hospital Number.
-	HospitalName   string    `json:"hospital_name"`   // Hospital name.
-	RegisteredBy   string    `json:"registered_by"`   // The person who subscribed the patient.
-	CreatedAt      time.Time `json:"created_at"`      // Populated by the remote server.
+	ID             uint           `json:"id"`              // Primary Key for the subscription.
+	EclinicID      string         `json:"eclinic_id"`      // Unique subcription ID
+	PatientID      uint           `json:"patient_id"`      // Patient ID in Eclinic HMS
+	PatientName    string         `json:"patient_name"`    // Name of the patient.
+	Email          string         `json:"email"`           // Optional email.
+	HospitalNumber HospitalNumber `json:"hospital_number"` // Globally unique Hospital Number.
+	HospitalName   string         `json:"hospital_name"`   // Hospital name.
+	RegisteredBy   string         `json:"registered_by"`   // The person who subscribed the patient.
+	CreatedAt      time.Time      `json:"created_at"`      // Populated by the remote server.
+
+	// Region where the subscriber's data is stored. See Config.ResidencyRegion.
+	ResidencyRegion string `json:"residency_region,omitempty"`
+
+	// Non-fatal warnings attached by the server e.g "subscriber near expiry".
+	Warnings []Warning `json:"warnings,omitempty"`
+
+	// Idempotency key sent by Subscribe. Reuse it with WithIdempotencyKey
+	// to retry the operation safely.
+	IdempotencyKey string `json:"-"`
+}
+
+// CommunicationPreferences records whether a subscriber has opted in to
+// notifications on each channel.
+type CommunicationPreferences struct {
+	SMS       bool      `json:"sms"`                 // Patient accepts SMS notifications.
+	Email     bool      `json:"email"`               // Patient accepts email notifications.
+	UpdatedAt time.Time `json:"updated_at,omitzero"` // Populated by the remote server.
 }
 
 // Payment represents a payment for a patient's subscription.
@@ -77,24 +142,98 @@ type Payment struct {
 	RegisteredBy string `json:"registered_by,omitempty"`
 
 	// Whether the records associated with this payment have been uploaded to the cloud.
-	// This helps to dedupe records preventing multiple uploads.
+	// This helps to dedupe records preventing multiple uploads. See MarkRecordsUploaded.
 	RecordsUploaded bool `json:"records_uploaded,omitempty"`
 
 	// The last time the records were uploaded.
 	LastUploaded *time.Time `json:"last_uploaded,omitempty"`
+
+	// Total amount refunded on the payment. See RefundPayment.
+	RefundedAmount float64 `json:"refunded_amount,omitempty"`
+
+	// When the payment was voided, nil if it is in effect. See VoidPayment.
+	VoidedAt *time.Time `json:"voided_at,omitempty"`
+
+	// Position of the payment in the hospital's payment feed. See PaymentsSince.
+	Sequence uint64 `json:"sequence,omitempty"`
+
+	// Non-fatal warnings attached by the server.
+	Warnings []Warning `json:"warnings,omitempty"`
+
+	// Idempotency key sent by CreatePayment. Reuse it with WithIdempotencyKey
+	// to retry the operation safely.
+	IdempotencyKey string `json:"-"`
+}
+
+// ReportPeriod is the time range covered by an exported report.
+type ReportPeriod struct {
+	From time.Time `json:"from"` // Start of the period (inclusive).
+	To   time.Time `json:"to"`   // End of the period (exclusive).
+}
+
+func (p ReportPeriod) Validate() error {
+	if p.From.IsZero() || p.To.IsZero() || !p.From.Before(p.To) {
+		return ErrInvalidReportPeriod
+	}
+	return nil
+}
+
+// SignedPaymentReport is a server-generated payment report with a detached
+// ed25519 signature. The signature covers the hospital, period, key and
+// generation time along with the report, see SignedData, so a report signed
+// for another hospital or period can't be passed off as this one.
+type SignedPaymentReport struct {
+	HospitalNumber HospitalNumber `json:"hospital_number"` // Hospital the report was generated for.
+	Period         ReportPeriod   `json:"period"`          // Period covered by the report.
+	Report         []byte         `json:"report"`          // Raw report document as produced by the server.
+	ContentType    string         `json:"content_type"`    // MIME type of the report e.g text/csv.
+	Signature      []byte         `json:"signature"`       // Detached ed25519 signature of SignedData.
+	KeyID          string         `json:"key_id"`          // Identifier of the key used to sign the report.
+	GeneratedAt    time.Time      `json:"generated_at"`    // When the server generated the report.
+}
+
+// SignedData returns the canonical envelope covered by the signature:
+//
+//	ecloud-signed-report/1
+//	hospital_number "HOS-123"
+//	period 2025-01-01T00:00:00Z 2025-02-01T00:00:00Z
+//	generated_at 2025-02-01T06:00:00Z
+//	key_id "2025-01"
+//
+// followed by an empty line and the report. Times are in UTC, formatted
+// with time.RFC3339Nano, and strings are quoted as with strconv.Quote.
+func (r *SignedPaymentReport) SignedData() []byte {
+	data := fmt.Appendf(nil, "ecloud-signed-report/1\nhospital_number %q\nperiod %s %s\ngenerated_at %s\nkey_id %q\n\n",
+		r.HospitalNumber.String(), formatSignedTime(r.Period.From), formatSignedTime(r.Period.To),
+		formatSignedTime(r.GeneratedAt), r.KeyID)
+	return append(data, r.Report...)
+}
+
+func formatSignedTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// Verify reports whether the signature is valid for the report and its
+// envelope under the given public key. It doesn't check what the envelope
+// holds, compare HospitalNumber, Period and KeyID with the expected values.
+func (r *SignedPaymentReport) Verify(publicKey ed25519.PublicKey) bool {
+	if len(publicKey) != ed25519.PublicKeySize || len(r.Signature) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(publicKey, r.SignedData(), r.Signature)
 }
 
 // PatientRecord represents a patient's medical record.
-// When syncing medical records, either MedicalReport or LabReport or both
-// must be provided.
+// When syncing medical records, at least one of MedicalReport, LabReport
+// and Attachments must be provided.
 type PatientRecord struct {
-	ID             uint      `json:"id,omitempty"`
-	HospitalNumber string    `json:"hospital_number,omitempty"`
-	VisitID        uint      `json:"visit_id,omitempty"`
-	SubscriberID   uint      `json:"subscriber_id,omitempty"`
-	VisitTimestamp time.Time `json:"visit_timestamp,omitzero"`
-	CreatedAt      time.Time `json:"created_at,omitzero"`
-	Title          string    `json:"title,omitempty"`
+	ID             uint           `json:"id,omitempty"`
+	HospitalNumber HospitalNumber `json:"hospital_number,omitempty"`
+	VisitID        uint           `json:"visit_id,omitempty"`
+	SubscriberID   uint           `json:"subscriber_id,omitempty"`
+	VisitTimestamp time.Time      `json:"visit_timestamp,omitzero"`
+	CreatedAt      time.Time      `json:"created_at,omitzero"`
+	Title          string         `json:"title,omitempty"`
 
 	// Only present when decoding from JSON.
 	// Uploaded separately as files.
@@ -103,6 +242,18 @@ type PatientRecord struct {
 	// Only present when decoding from JSON.
 	// Uploaded separately as files.
 	LabReport []byte `json:"lab_report,omitempty"`
+
+	// Streamed alternatives to MedicalReport and LabReport, for reports too large
+	// to hold in memory. Used only when the corresponding []byte field is nil.
+	// A reader can be uploaded only once.
+	MedicalReportReader io.Reader `json:"-"`
+	LabReportReader     io.Reader `json:"-"`
+
+	// Other files of the visit, e.g JPEG or PNG scans and DICOM studies
+	// from lab devices, uploaded after the reports.
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	files []*os.File // Opened by the Attach*File methods, see Close.
 }
 
 func (pr *PatientRecord) Validate() error {
@@ -122,8 +273,15 @@ func (pr *PatientRecord) Validate() error {
 	if pr.VisitTimestamp.IsZero() {
 		return fmt.Errorf("patient record missing valid VisitTimestamp")
 	}
-	if pr.MedicalReport == nil && pr.LabReport == nil {
-		return fmt.Errorf("no medical report or laboratory report to upload")
+	if pr.MedicalReport == nil && pr.LabReport == nil && pr.MedicalReportReader == nil && pr.LabReportReader == nil &&
+		len(pr.Attachments) == 0 {
+		return fmt.Errorf("no medical report, laboratory report or attachment to upload")
+	}
+
+	for i := range pr.Attachments {
+		if err := pr.Attachments[i].validate(); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -138,17 +296,50 @@ type SubscribeRequest struct {
 
 // Configuration for the client
 type Config struct {
+	// Preset deployment. In production, ApiBaseUrl defaults to
+	// ProductionBaseURL; the sandbox requires ApiBaseUrl and rejects
+	// ProductionBaseURL. Sandbox uploads are validated more strictly and
+	// marked with an "environment" field.
+	Environment Environment
+
 	// BASE URI for the cloud server.
 	ApiBaseUrl string
 
+	// Base URL of ecloud's read-optimized endpoint. Reads (GET requests)
+	// matching ReadRoutes are sent there and writes always go to ApiBaseUrl.
+	// The read endpoint may lag behind the primary. Empty disables routing.
+	ReadBaseUrl string
+
+	// Which reads go to ReadBaseUrl, keyed by URL path prefix e.g
+	// {"/api/subscriptions": true, "/api/subscriptions/check_subscription": false}.
+	// The longest matching prefix wins and unmatched reads go to ApiBaseUrl.
+	// Nil routes every read.
+	ReadRoutes map[string]bool
+
+	// Hosts the SDK may contact e.g {"ecloud.example.com"}, compared case
+	// insensitively. An entry with a port, e.g "ecloud.example.com:8443",
+	// only matches that port. Requests and redirects to other hosts fail with
+	// ErrHostNotAllowed, as does a base URL outside the list. The endpoint of
+	// a DoHResolver in Resolver must be listed too, e.g "1.1.1.1" for
+	// DefaultDoHURL. Nil allows any host.
+	AllowedHosts []string
+
 	// Unique 8 character ID generated by the server.
 	EclinicId string
 
 	// Login Password.
 	Password string
 
-	// Unique ID of the hospital.
-	HospitalNumber string
+	// Persists the session so restarts resume it instead of logging in again.
+	// See MemoryTokenStore and FileTokenStore. Optional.
+	TokenStore TokenStore
+
+	// How long before the token's exp claim it is refreshed, instead of
+	// waiting for a 401. Defaults to one minute; negative disables proactive refresh.
+	TokenRefreshMargin time.Duration
+
+	// Unique ID of the hospital, e.g "HOS-123". See HospitalNumber.
+	HospitalNumber HospitalNumber
 
 	// Name of the hospital.
 	HospitalName string
@@ -156,21 +347,225 @@ type Config struct {
 	// Eclinic hostname. Used during PDF generation whith chrome.
 	EclinicBaseUrl string
 
+	// Directory where GetRecordThumbnail caches thumbnails. Empty disables caching.
+	ThumbnailCacheDir string
+
 	// Control whether the medical report is always uploaded together with the lab report.
 	// By default, it is false. The lab report is always uploaded.
 	UploadMedicalReport bool
 
+	// Ecloud's published ed25519 public key, used to verify signed reports
+	// such as ExportSignedPaymentReport. Optional unless signed reports are used.
+	ReportPublicKey ed25519.PublicKey
+
+	// Identifier of ReportPublicKey, e.g "2025-01". Signed reports naming
+	// another key are rejected. Required with ReportPublicKey.
+	ReportKeyID string
+
+	// Data residency region (e.g "UG") sent when creating subscriptions and records.
+	// The deployment's capabilities are checked before the first such call and
+	// the call fails with ErrResidencyUnsupported if the region cannot be honored.
+	// Empty means no residency requirement.
+	ResidencyRegion string
+
+	// Look up the patient's subscription before Subscribe and fail with an
+	// *AlreadySubscribedError if there is one. A 409 response from the server
+	// is reported the same way even when this is false.
+	CheckDuplicateSubscriptions bool
+
+	// Time after a subscriber's coverage ends during which SubscriptionStatus
+	// reports SubscriptionGracePeriod instead of SubscriptionExpired, e.g to
+	// let patients renew on their next visit. Zero disables the grace period.
+	SubscriptionGracePeriod time.Duration
+
+	// Program-specific rules applied to every record before upload.
+	// Can also be fetched from the server with LoadValidationRules.
+	ValidationRules *ValidationRules
+
+	// Maximum size of a report in bytes, checked before upload. The smaller of
+	// this and ValidationRules.MaxReportSize applies. Zero means no limit.
+	MaxReportSize int64
+
+	// 32-byte AES-256 key reports are encrypted with before upload and
+	// decrypted with after download, so ecloud only stores ciphertext.
+	// Reports can't be recovered without it: keep it outside ecloud.
+	// Optional; see KeyProvider to rotate keys.
+	ReportEncryptionKey []byte
+
+	// Supplies report encryption keys instead of ReportEncryptionKey,
+	// e.g from a KMS. Optional.
+	KeyProvider KeyProvider
+
+	// Converts reports that don't declare PDF/A conformance before upload,
+	// e.g &GhostscriptConverter{}. Nil uploads reports as they are.
+	PDFAConverter PDFAConverter
+
+	// Rewrites record titles before validation. Optional.
+	// See TemplateTitleNormalizer.
+	TitleNormalizer TitleNormalizer
+
+	// Reject payment and refund amounts with more than two decimal places or
+	// that a float64 can't represent exactly, with ErrInvalidAmount, instead
+	// of sending them as they are. See ValidateAmount.
+	StrictAmounts bool
+
+	// Called for every non-fatal warning returned by the server, with the
+	// name of the SDK operation that received it. Optional.
+	WarningHandler func(operation string, warning Warning)
+
+	// Maximum bytes (request and response bodies) exchanged with ecloud per day.
+	// Once exceeded, background traffic is paused until the next day and
+	// foreground calls log a warning. Zero means unlimited.
+	DailyBandwidthBudget int64
+
+	// Maximum upload speed of each record upload, in bytes per second, so large
+	// uploads don't starve the clinic's shared link. Concurrent uploads are
+	// limited separately. Zero means unlimited.
+	UploadRateLimit int64
+
+	// Minimum TLS version of the internal transport e.g tls.VersionTLS12.
+	// Ignored when HTTPClient is provided.
+	MinTLSVersion uint16
+
+	// TLS 1.0-1.2 cipher suites allowed by the internal transport.
+	// Ignored when HTTPClient is provided.
+	CipherSuites []uint16
+
+	// Enforce TLS 1.2+ and StrictCipherSuites (unless CipherSuites is set)
+	// on the internal transport. Ignored when HTTPClient is provided.
+	StrictTLS bool
+
+	// Redirects followed by the internal transport. Defaults to up to
+	// DefaultMaxRedirects redirects on the same host. Ignored when HTTPClient
+	// is provided; see RedirectPolicy.CheckRedirect.
+	RedirectPolicy *RedirectPolicy
+
+	// Calls taking longer than this log a warning with a timing breakdown
+	// (DNS, connect, TLS, time to first byte). Zero disables the check.
+	SlowCallThreshold time.Duration
+
+	// Per-endpoint overrides of SlowCallThreshold, keyed by URL path prefix
+	// e.g "/api/records". The longest matching prefix wins.
+	SlowCallThresholds map[string]time.Duration
+
+	// httptrace callbacks attached to every request, for debugging latency.
+	// Traces attached to the context passed to SDK methods are also honored.
+	ClientTrace *httptrace.ClientTrace
+
+	// Receives the timing breakdown of every HTTP attempt. Optional.
+	TimingHandler func(timing RequestTiming)
+
+	// Resolves host names for the internal transport, e.g
+	// CachingResolver(FallbackResolver(net.DefaultResolver, &DoHResolver{}), time.Hour).
+	// Defaults to the system resolver. Ignored when HTTPClient is provided.
+	Resolver Resolver
+
+	// TCP keep-alive probes of the internal transport. Short idle times keep
+	// CGNAT mappings alive during long uploads and downloads, e.g
+	// net.KeepAliveConfig{Enable: true, Idle: 15 * time.Second, Interval: 15 * time.Second}.
+	// Defaults to Go's 30 second keep-alive. Ignored when HTTPClient is provided.
+	TCPKeepAlive net.KeepAliveConfig
+
+	// Application-level heartbeat: HTTP/2 PING frames are sent on connections
+	// that received nothing for this long, and dead connections are closed.
+	// HTTP/1.1 connections rely on TCPKeepAlive. Zero disables the heartbeat.
+	// Ignored when HTTPClient is provided.
+	HeartbeatInterval time.Duration
+
+	// Decoders for response encodings other than gzip, keyed by Content-Encoding
+	// e.g "zstd". gzip responses are always decoded. Optional.
+	ContentDecoders map[string]ContentDecoder
+
+	// Starts a span for each SDK operation, with the HTTP status, retry count
+	// and payload sizes as attributes, and propagates it to ecloud with the
+	// traceparent header. Optional.
+	TracerProvider TracerProvider
+
+	// Receives the outcome of every HTTP attempt, for request counts,
+	// latencies, retries, error classes and upload bytes. Optional.
+	Metrics Metrics
+
+	// Directory of the request journal: every HTTP attempt is recorded
+	// (method, path, status, timing, request ID; no bodies) in segment files
+	// shipped to ecloud by ShipJournal. Empty disables the journal.
+	JournalDir string
+
+	// Size at which journal segments are sealed. Defaults to DefaultJournalSegmentSize.
+	JournalSegmentSize int64
+
+	// Log every request and response at debug level, for support tickets.
+	// Authorization headers, passwords, tokens, patient names and emails are
+	// redacted and only JSON bodies are included. See RedactJSON.
+	Debug bool
+
 	HTTPClient  HTTPClient
+	Middleware  []Middleware // Wraps HTTPClient, the first being the outermost.
 	Logger      Logger
 	RetryPolicy RetryPolicy
 	Timeout     time.Duration
+
+	// Settings of the default BackoffPolicy, used when RetryPolicy is nil.
+	// MaxRetries defaults to DefaultMaxRetries; negative disables retries.
+	// RetryBaseDelay and RetryMaxDelay default to DefaultRetryBaseDelay and DefaultRetryMaxDelay.
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+
+	// Per-endpoint overrides of RetryPolicy, keyed by URL path prefix
+	// e.g "/api/records" for uploads. The longest matching prefix wins.
+	RetryPolicies map[string]RetryPolicy
+
+	// How long GetBill, GetSubscriber and GetPendingSubscribers results are
+	// served from memory. Writes made through the client invalidate the
+	// entries they affect. Zero disables caching. See WarmUp.
+	CacheTTL time.Duration
+
+	// Rejects requests to a failing server with ErrCircuitOpen instead of
+	// retrying them, e.g NewCircuitBreakerPolicy(5, 30*time.Second).
+	// Nil disables circuit breaking.
+	CircuitBreaker CircuitBreaker
+
+	// Number of events buffered in memory for each Events subscriber.
+	// Defaults to DefaultEventBufferSize.
+	EventBufferSize int
+
+	// What to do when an Events subscriber's buffer is full. Defaults to OverflowBlock.
+	EventOverflow OverflowPolicy
+
+	// Directory of the spill files of OverflowSpillToDisk, required with it.
+	// Spilled events hold patient data such as names and emails, unencrypted:
+	// keep the directory on an encrypted volume, e.g BitLocker, FileVault or
+	// LUKS, rather than in the shared system temporary directory.
+	EventSpillDir string
 }
 
 func (c *Config) Validate() error {
+	if err := c.applyEnvironment(); err != nil {
+		return err
+	}
+
 	if c.ApiBaseUrl == "" {
 		return ErrApiBaseURLRequired
 	}
 
+	if err := checkHost(c.AllowedHosts, c.ApiBaseUrl); err != nil {
+		return fmt.Errorf("ApiBaseUrl: %w", err)
+	}
+
+	if c.ReadBaseUrl != "" {
+		if err := checkHost(c.AllowedHosts, c.ReadBaseUrl); err != nil {
+			return fmt.Errorf("ReadBaseUrl: %w", err)
+		}
+	}
+
+	if c.HTTPClient == nil {
+		for _, url := range dohURLs(c.Resolver) {
+			if err := checkHost(c.AllowedHosts, url); err != nil {
+				return fmt.Errorf("Resolver: %w", err)
+			}
+		}
+	}
+
 	if c.EclinicId == "" {
 		return ErrEclinicIDRequired
 	}
@@ -179,8 +574,8 @@ func (c *Config) Validate() error {
 		return ErrEcloudPasswordRequired
 	}
 
-	if c.HospitalNumber == "" {
-		return ErrHospitalNumberRequired
+	if err := c.HospitalNumber.Validate(); err != nil {
+		return err
 	}
 
 	if c.HospitalName == "" {
@@ -191,13 +586,18 @@ func (c *Config) Validate() error {
 		return ErrEclinicBaseURL
 	}
 
+	if n := len(c.ReportEncryptionKey); n != 0 && n != 32 {
+		return ErrInvalidEncryptionKey
+	}
+
+	if c.EventOverflow == OverflowSpillToDisk && c.EventSpillDir == "" {
+		return ErrEventSpillDirRequired
+	}
+
 	// Set default timeout if not provided
 	if c.Timeout == 0 {
 		c.Timeout = 30 * time.Second
 	}
 
-	if c.RetryPolicy == nil {
-		c.RetryPolicy = &DefaultRetryPolicy{3}
-	}
 	return nil
 }
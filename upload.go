@@ -0,0 +1,360 @@
+package ecloudsdk
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+
+	"github.com/abiiranathan/ecloud-sdk/pdf"
+)
+
+// reportPart is a report attachment of a record upload.
+type reportPart struct {
+	field       string
+	filename    string
+	contentType string                    // Defaults to application/pdf.
+	open        func() (io.Reader, error) // Returns the report for each upload attempt.
+	size        int64                     // Size of the report, or -1 if unknown.
+	sha256      string                    // Hex SHA-256 of a report held in memory, empty for streams.
+}
+
+// bytesOpener returns an opener of a report held in memory.
+func bytesOpener(data []byte) func() (io.Reader, error) {
+	return func() (io.Reader, error) { return bytes.NewReader(data), nil }
+}
+
+// reportParts validates the reports and attachments of the record and returns
+// them in upload order.
+// Reports given as []byte are fully validated here. Reports given as io.Reader
+// are validated as far as their first bytes allow; the rest of the checks run
+// while they are streamed and abort the upload on failure.
+func (c *DefaultEcloudClient) reportParts(patientRecord *PatientRecord) ([]reportPart, error) {
+	var parts []reportPart
+
+	maxSize := c.maxReportSize()
+
+	// Check if facility turned off medical report uploads.
+	if c.cfg().UploadMedicalReport {
+		switch {
+		case patientRecord.MedicalReport != nil:
+			if err := checkContentType(medicalReportFieldName, pdfContentType, patientRecord.MedicalReport); err != nil {
+				return nil, err
+			}
+
+			if err := validatePDF(patientRecord.MedicalReport, ErrInvalidMedicalReportPDF, maxSize); err != nil {
+				return nil, err
+			}
+
+			parts = append(parts, reportPart{field: medicalReportFieldName, filename: medicalReportFileName,
+				open: bytesOpener(patientRecord.MedicalReport), size: int64(len(patientRecord.MedicalReport)),
+				sha256: sha256Hex(patientRecord.MedicalReport)})
+		case patientRecord.MedicalReportReader != nil:
+			size := readerSize(patientRecord.MedicalReportReader)
+			open, err := streamOpener(medicalReportFieldName, patientRecord.MedicalReportReader,
+				pdfStream(medicalReportFieldName, ErrInvalidMedicalReportPDF, maxSize))
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, reportPart{field: medicalReportFieldName, filename: medicalReportFileName,
+				open: open, size: size})
+		}
+	}
+
+	switch {
+	case patientRecord.LabReport != nil:
+		if err := checkContentType(labReportFieldName, pdfContentType, patientRecord.LabReport); err != nil {
+			return nil, err
+		}
+
+		if err := validatePDF(patientRecord.LabReport, ErrInvalidLabReportPDF, maxSize); err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, reportPart{field: labReportFieldName, filename: labReportFileName,
+			open: bytesOpener(patientRecord.LabReport), size: int64(len(patientRecord.LabReport)),
+			sha256: sha256Hex(patientRecord.LabReport)})
+	case patientRecord.LabReportReader != nil:
+		size := readerSize(patientRecord.LabReportReader)
+		open, err := streamOpener(labReportFieldName, patientRecord.LabReportReader,
+			pdfStream(labReportFieldName, ErrInvalidLabReportPDF, maxSize))
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, reportPart{field: labReportFieldName, filename: labReportFileName, open: open, size: size})
+	}
+
+	attachments, err := attachmentParts(patientRecord, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	return append(parts, attachments...), nil
+}
+
+// streamValidator checks the start of a streamed file and returns a reader
+// that checks the rest as it is read, returning failed checks as read errors.
+type streamValidator func(r io.Reader) (io.Reader, error)
+
+// streamOpener validates the start of a streamed file and returns its opener.
+// Readers implementing io.Seeker are rewound and validated again for each
+// upload attempt; other readers can be uploaded only once.
+func streamOpener(field string, r io.Reader, validate streamValidator) (func() (io.Reader, error), error) {
+	seeker, _ := r.(io.Seeker)
+
+	var offset int64
+	if seeker != nil {
+		var err error
+		if offset, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", field, err)
+		}
+	}
+
+	first, err := validate(r)
+	if err != nil {
+		return nil, err
+	}
+
+	opened := false
+	return func() (io.Reader, error) {
+		if !opened {
+			opened = true
+			return first, nil
+		}
+
+		if seeker == nil {
+			return nil, errBodyNotReplayable
+		}
+
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("unable to rewind %s: %w", field, err)
+		}
+		return validate(r)
+	}, nil
+}
+
+// multipartBody streams a record upload through a pipe instead of buffering
+// the reports in memory. A new pipe is opened for each attempt.
+type multipartBody struct {
+	parts    []reportPart
+	fields   [][2]string // Name/value pairs, written in order after the reports.
+	boundary string
+
+	streamErr chan error        // Result of the writer of the latest attempt.
+	failed    error             // First failed check of a streamed report.
+	checksums map[string]string // Hex SHA-256 of the reports by field, set once they are written.
+	progress  *progressTracker  // Reports the report bytes written. Optional.
+}
+
+func newMultipartBody(parts []reportPart, fields [][2]string) *multipartBody {
+	// The boundary must be the same for every attempt, as the
+	// Content-Type header is only set once.
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	return &multipartBody{parts: parts, fields: fields, boundary: boundary}
+}
+
+func (b *multipartBody) contentType() string {
+	writer := multipart.NewWriter(io.Discard)
+	_ = writer.SetBoundary(b.boundary)
+	return writer.FormDataContentType()
+}
+
+// open starts writing the body of an attempt. It is a BodyFactory.
+func (b *multipartBody) open() (io.Reader, error) {
+	// A report that failed validation fails every attempt the same way.
+	if err := b.wait(); err != nil {
+		return nil, err
+	}
+
+	// Every attempt uploads the reports from the start.
+	if b.progress != nil {
+		b.progress.progress.Bytes = 0
+	}
+
+	readers := make([]io.Reader, len(b.parts))
+	for i, part := range b.parts {
+		r, err := part.open()
+		if err != nil {
+			return nil, err
+		}
+		readers[i] = b.progress.reader(r)
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	writer := multipart.NewWriter(pipeWriter)
+	_ = writer.SetBoundary(b.boundary)
+
+	streamErr := make(chan error, 1)
+	b.streamErr = streamErr
+	go func() {
+		checksums, err := writeMultipart(writer, b.parts, readers, b.fields)
+		if err == nil {
+			b.checksums = checksums
+		}
+		pipeWriter.CloseWithError(err)
+		streamErr <- err
+	}()
+	return pipeReader, nil
+}
+
+// wait waits for the writer of the latest attempt and returns the first failed
+// check of a streamed report (e.g an invalid PDF). Writes interrupted because the
+// request ended early are not failures.
+func (b *multipartBody) wait() error {
+	if b.streamErr != nil {
+		err := <-b.streamErr
+		b.streamErr = nil
+
+		if err != nil && !errors.Is(err, io.ErrClosedPipe) && b.failed == nil {
+			b.failed = err
+		}
+	}
+	return b.failed
+}
+
+// writeMultipart writes the reports and form fields of an upload.
+// fields holds name/value pairs, written in order after the reports and their
+// checksums, which are returned by field.
+func writeMultipart(writer *multipart.Writer, parts []reportPart, readers []io.Reader,
+	fields [][2]string) (map[string]string, error) {
+	checksums := make(map[string]string, len(parts))
+	for i, part := range parts {
+		w, err := createFormFile(writer, part.field, part.filename, cmp.Or(part.contentType, pdfContentType))
+		if err != nil {
+			return nil, fmt.Errorf("error creating form file: %w", err)
+		}
+
+		hash := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(w, hash), readers[i]); err != nil {
+			return nil, fmt.Errorf("error writing form file: %w", err)
+		}
+		checksums[part.field] = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	// The checksums of streamed reports are only known once they are written.
+	for _, part := range parts {
+		if err := writer.WriteField(part.field+checksumFieldSuffix, checksums[part.field]); err != nil {
+			return nil, fmt.Errorf("error writing form field: %w", err)
+		}
+	}
+
+	for _, field := range fields {
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			return nil, fmt.Errorf("error writing form field: %w", err)
+		}
+	}
+
+	// Close the multipart writer to flush.
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("error closing multipart writer: %w", err)
+	}
+	return checksums, nil
+}
+
+// maxReportSize returns the maximum size of a report, or 0 if unlimited:
+// the smaller of Config.MaxReportSize and ValidationRules.MaxReportSize.
+func (c *DefaultEcloudClient) maxReportSize() int64 {
+	maxSize := c.cfg().MaxReportSize
+	if rules := c.cfg().ValidationRules; rules != nil && rules.MaxReportSize > 0 {
+		if maxSize <= 0 || int64(rules.MaxReportSize) < maxSize {
+			maxSize = int64(rules.MaxReportSize)
+		}
+	}
+	return max(maxSize, 0)
+}
+
+// validatePDF validates a report held in memory. The reason it is invalid
+// is wrapped in invalid.
+func validatePDF(data []byte, invalid error, maxSize int64) error {
+	if _, err := pdf.Validate(data, &pdf.Options{MaxSize: maxSize}); err != nil {
+		return fmt.Errorf("%w: %w", invalid, err)
+	}
+	return nil
+}
+
+// isValidPDF reports whether data is a valid PDF document.
+func isValidPDF(data []byte) bool {
+	_, err := pdf.Validate(data, nil)
+	return err == nil
+}
+
+// sniffLen is the number of bytes used to detect the content type.
+const sniffLen = 512
+
+// pdfStream returns a streamValidator of PDF reports, see streamPDF.
+func pdfStream(field string, invalid error, maxSize int64) streamValidator {
+	return func(r io.Reader) (io.Reader, error) {
+		return streamPDF(field, r, invalid, maxSize)
+	}
+}
+
+// streamPDF checks the content type and PDF header of a streamed report
+// and returns a reader that validates the rest of the PDF as it is read.
+func streamPDF(field string, r io.Reader, invalid error, maxSize int64) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("unable to read %s: %w", field, err)
+	}
+
+	if err := checkContentType(field, pdfContentType, head); err != nil {
+		return nil, err
+	}
+
+	if _, err := pdf.Header(head); err != nil {
+		return nil, fmt.Errorf("%w: %w", invalid, err)
+	}
+	return &pdfStreamValidator{r: br, field: field, invalid: invalid, maxSize: maxSize}, nil
+}
+
+// pdfStreamValidator applies the end-of-file checks of pdf.Validate to a streamed
+// PDF and enforces the maximum report size. The cross-reference and page tree
+// can't be checked without holding the report in memory. A failed check is
+// returned as the read error.
+type pdfStreamValidator struct {
+	r       io.Reader
+	field   string
+	invalid error
+	maxSize int64
+
+	size         int64
+	tail         []byte // Last bytes read, for the %%EOF marker.
+	sawStartxref bool
+}
+
+// pdfTailLen matches the window searched for %%EOF by pdf.Validate.
+const pdfTailLen = pdf.TailLen
+
+var startxref = []byte("startxref")
+
+func (v *pdfStreamValidator) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+
+	v.size += int64(n)
+	if v.maxSize > 0 && v.size > v.maxSize {
+		return n, fmt.Errorf("%s exceeds maximum size of %d bytes", v.field, v.maxSize)
+	}
+
+	// Keep enough of the previous tail to find markers split across reads.
+	v.tail = append(v.tail, p[:n]...)
+	if !v.sawStartxref && bytes.Contains(v.tail, startxref) {
+		v.sawStartxref = true
+	}
+
+	if len(v.tail) > pdfTailLen {
+		v.tail = append(v.tail[:0], v.tail[len(v.tail)-pdfTailLen:]...)
+	}
+
+	if err == io.EOF && !v.sawStartxref {
+		return n, fmt.Errorf("%w: %w", v.invalid, pdf.ErrNoStartxref)
+	}
+
+	if err == io.EOF && !pdf.HasEOF(v.tail) {
+		return n, fmt.Errorf("%w: %w", v.invalid, pdf.ErrNoEOF)
+	}
+	return n, err
+}
@@ -0,0 +1,110 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Field names understood by ValidationRules.RequiredFields.
+const (
+	FieldHospitalNumber = "hospital_number"
+	FieldMedicalReport  = "medical_report"
+	FieldLabReport      = "lab_report"
+)
+
+// ValidationRules are program-specific rules applied to a PatientRecord
+// on top of the basic checks performed by PatientRecord.Validate.
+// E.g an HIV clinic may require a lab report on every visit while
+// a maternity program only accepts a fixed set of titles.
+type ValidationRules struct {
+	// Fields that must be present. See the Field* constants.
+	RequiredFields []string `json:"required_fields,omitempty"`
+
+	// Maximum size in bytes of each report. Zero means no limit.
+	MaxReportSize int `json:"max_report_size,omitempty"`
+
+	// If not empty, the record title must be one of these (case-insensitive).
+	AllowedTitles []string `json:"allowed_titles,omitempty"`
+}
+
+// Validate checks the patient record against the rules.
+// A nil *ValidationRules accepts every record.
+func (r *ValidationRules) Validate(pr *PatientRecord) error {
+	if r == nil {
+		return nil
+	}
+
+	for _, field := range r.RequiredFields {
+		var missing bool
+		switch field {
+		case FieldHospitalNumber:
+			missing = pr.HospitalNumber == ""
+		case FieldMedicalReport:
+			missing = len(pr.MedicalReport) == 0 && pr.MedicalReportReader == nil
+		case FieldLabReport:
+			missing = len(pr.LabReport) == 0 && pr.LabReportReader == nil
+		default:
+			return fmt.Errorf("unknown required field in validation rules: %q", field)
+		}
+
+		if missing {
+			return fmt.Errorf("patient record missing required field %s", field)
+		}
+	}
+
+	// The size of streamed reports is checked during upload.
+	if r.MaxReportSize > 0 {
+		if len(pr.MedicalReport) > r.MaxReportSize {
+			return fmt.Errorf("medical report exceeds maximum size of %d bytes", r.MaxReportSize)
+		}
+		if len(pr.LabReport) > r.MaxReportSize {
+			return fmt.Errorf("lab report exceeds maximum size of %d bytes", r.MaxReportSize)
+		}
+	}
+
+	if len(r.AllowedTitles) > 0 {
+		allowed := slices.ContainsFunc(r.AllowedTitles, func(title string) bool {
+			return strings.EqualFold(title, pr.Title)
+		})
+
+		if !allowed {
+			return fmt.Errorf("patient record title %q is not allowed", pr.Title)
+		}
+	}
+	return nil
+}
+
+// LoadValidationRules fetches the hospital's validation rules from the server
+// capabilities endpoint and applies them to subsequent SyncMedicalRecords calls,
+// replacing Config.ValidationRules.
+func (c *DefaultEcloudClient) LoadValidationRules(ctx context.Context) (*ValidationRules, error) {
+	url := fmt.Sprintf("%s/api/capabilities/validation_rules/%s", c.cfg().ApiBaseUrl, c.cfg().HospitalNumber)
+
+	resp, err := c.performRequest(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch validation rules: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeError(resp)
+	}
+
+	rules := &ValidationRules{}
+	err = json.NewDecoder(resp.Body).Decode(rules)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	config := *c.config
+	config.ValidationRules = rules
+	c.config = &config
+	return rules, nil
+}
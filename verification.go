@@ -0,0 +1,87 @@
+package ecloudsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// VerificationChannel is the contact channel being verified.
+type VerificationChannel string
+
+const (
+	VerificationEmail VerificationChannel = "email"
+	VerificationSMS   VerificationChannel = "sms"
+)
+
+// Validate reports whether the channel is supported.
+func (ch VerificationChannel) Validate() error {
+	switch ch {
+	case VerificationEmail, VerificationSMS:
+		return nil
+	}
+	return fmt.Errorf("unsupported verification channel: %q", string(ch))
+}
+
+// Verification is the state of a contact verification.
+type Verification struct {
+	SubscriberID uint                `json:"subscriber_id"`
+	Channel      VerificationChannel `json:"channel"`
+	Verified     bool                `json:"verified"`             // Whether the contact has been confirmed.
+	SentAt       time.Time           `json:"sent_at,omitzero"`     // When the last code was sent.
+	ExpiresAt    time.Time           `json:"expires_at,omitzero"`  // When the last code expires.
+	VerifiedAt   time.Time           `json:"verified_at,omitzero"` // When the contact was confirmed.
+}
+
+// SendVerification sends a verification code to the subscriber's email or phone.
+// The portal invitation is only sent to verified contacts.
+func (c *DefaultEcloudClient) SendVerification(ctx context.Context, subscriberID uint, channel VerificationChannel) (*Verification, error) {
+	if err := channel.Validate(); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(map[string]VerificationChannel{"channel": channel})
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/subscriptions/%d/verification", c.cfg().ApiBaseUrl, subscriberID)
+	return c.postVerification(ctx, url, data)
+}
+
+// ConfirmVerification confirms a contact with the code the subscriber received.
+func (c *DefaultEcloudClient) ConfirmVerification(ctx context.Context, subscriberID uint, code string) (*Verification, error) {
+	if code == "" {
+		return nil, fmt.Errorf("verification code must not be empty")
+	}
+
+	data, err := json.Marshal(map[string]string{"code": code})
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal error: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/subscriptions/%d/verification/confirm", c.cfg().ApiBaseUrl, subscriberID)
+	return c.postVerification(ctx, url, data)
+}
+
+func (c *DefaultEcloudClient) postVerification(ctx context.Context, url string, data []byte) (*Verification, error) {
+	resp, err := c.performRequest(ctx, http.MethodPost, url, bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, fmt.Errorf("verification request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.decodeResourceError(resp, ErrSubscriberNotFound)
+	}
+
+	verification := &Verification{}
+	err = json.NewDecoder(resp.Body).Decode(verification)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode json: %w", err)
+	}
+	return verification, nil
+}
@@ -0,0 +1,48 @@
+package ecloudsdk
+
+import (
+	"encoding/json"
+)
+
+// Warning is a non-fatal message attached by the server to a successful response,
+// e.g "subscriber near expiry".
+type Warning struct {
+	Code    string `json:"code,omitempty"` // Machine readable warning code. May be empty.
+	Message string `json:"message"`        // Human readable message, suitable for display.
+}
+
+func (w Warning) String() string {
+	if w.Code == "" {
+		return w.Message
+	}
+	return w.Code + ": " + w.Message
+}
+
+// UnmarshalJSON accepts both the structured form and a plain string message.
+func (w *Warning) UnmarshalJSON(data []byte) error {
+	var message string
+	if err := json.Unmarshal(data, &message); err == nil {
+		*w = Warning{Message: message}
+		return nil
+	}
+
+	type warning Warning
+	return json.Unmarshal(data, (*warning)(w))
+}
+
+// warningsEnvelope decodes the warnings from responses that carry no other data.
+type warningsEnvelope struct {
+	Warnings []Warning `json:"warnings"`
+}
+
+// reportWarnings logs server warnings for the given operation and
+// passes them to Config.WarningHandler if set.
+func (c *DefaultEcloudClient) reportWarnings(operation string, warnings []Warning) {
+	for _, warning := range warnings {
+		logWarn(c.logger, "%s: server warning: %s\n", operation, warning)
+
+		if handler := c.cfg().WarningHandler; handler != nil {
+			safeCall(c.logger, "WarningHandler", func() { handler(operation, warning) })
+		}
+	}
+}
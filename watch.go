@@ -0,0 +1,191 @@
+package ecloudsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SubscriberChangeType describes how a subscriber changed between two polls.
+type SubscriberChangeType int
+
+const (
+	SubscriberAdded SubscriberChangeType = iota + 1
+	SubscriberUpdated
+	SubscriberRemoved
+)
+
+func (t SubscriberChangeType) String() string {
+	switch t {
+	case SubscriberAdded:
+		return "added"
+	case SubscriberUpdated:
+		return "updated"
+	case SubscriberRemoved:
+		return "removed"
+	}
+	return fmt.Sprintf("SubscriberChangeType(%d)", int(t))
+}
+
+// SubscriberChange is emitted by WatchSubscribers.
+// For removed subscribers, Subscriber is the last known state.
+type SubscriberChange struct {
+	Type       SubscriberChangeType
+	Subscriber *Subscriber
+}
+
+// WatchSubscribers polls the hospital subscribers every interval and emits only the differences.
+// The initial list is emitted as SubscriberAdded changes.
+// Polls are conditional (If-None-Match) so an unchanged list is not downloaded again.
+//
+// The first poll happens before WatchSubscribers returns, so authentication and
+// connectivity errors are reported immediately. Later poll errors are logged and
+// the next poll is attempted. The channel is closed when ctx is cancelled.
+func (c *DefaultEcloudClient) WatchSubscribers(ctx context.Context, interval time.Duration) (<-chan SubscriberChange, error) {
+	return c.WatchSubscribersMatching(ctx, nil, interval)
+}
+
+// WatchSubscribersMatching is like WatchSubscribers but only watches the subscribers
+// matching filter. Subscribers that stop matching are reported as SubscriberRemoved.
+func (c *DefaultEcloudClient) WatchSubscribersMatching(ctx context.Context, filter *SubscriberFilter,
+	interval time.Duration) (<-chan SubscriberChange, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("watch interval must be greater than zero")
+	}
+
+	subscribers, etag, err := c.pollSubscribers(ctx, filter, "")
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[uint]*Subscriber, len(subscribers))
+	changes := make(chan SubscriberChange, len(subscribers))
+	for _, subscriber := range subscribers {
+		known[subscriber.ID] = subscriber
+		changes <- SubscriberChange{Type: SubscriberAdded, Subscriber: subscriber}
+	}
+
+	go func() {
+		defer close(changes)
+
+		// Later polls are background traffic.
+		ctx := WithBackgroundPriority(ctx)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			var subscribers []*Subscriber
+			var newETag string
+			var err error
+			panicErr := safeCall(c.logger, "WatchSubscribers", func() {
+				subscribers, newETag, err = c.pollSubscribers(ctx, filter, etag)
+			})
+			if panicErr != nil {
+				continue
+			}
+
+			if err != nil {
+				if ctx.Err() == nil {
+					c.logger.Error("unable to poll subscribers: %v\n", err)
+				}
+				continue
+			}
+
+			// Not modified since the last poll.
+			if subscribers == nil {
+				continue
+			}
+			etag = newETag
+
+			for _, change := range diffSubscribers(known, subscribers) {
+				select {
+				case changes <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// pollSubscribers fetches the hospital subscribers matching filter if they changed since etag.
+// It returns nil subscribers when the server reports the list is not modified.
+func (c *DefaultEcloudClient) pollSubscribers(ctx context.Context, filter *SubscriberFilter, etag string) ([]*Subscriber, string, error) {
+	var headers map[string]string
+	if etag != "" {
+		headers = map[string]string{"If-None-Match": etag}
+	}
+
+	target := c.subscribersURL(filter)
+	resp, err := c.performRequest(ctx, http.MethodGet, target, nil, headers)
+	if err != nil {
+		return nil, "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", c.decodeError(resp)
+	}
+
+	subscribers := []*Subscriber{}
+	err = json.NewDecoder(resp.Body).Decode(&subscribers)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to decode json: %w", err)
+	}
+	return subscribers, resp.Header.Get("ETag"), nil
+}
+
+// diffSubscribers compares the latest list with the known subscribers,
+// updates known in place and returns the changes.
+func diffSubscribers(known map[uint]*Subscriber, latest []*Subscriber) []SubscriberChange {
+	var changes []SubscriberChange
+
+	seen := make(map[uint]bool, len(latest))
+	for _, subscriber := range latest {
+		seen[subscriber.ID] = true
+
+		previous, ok := known[subscriber.ID]
+		switch {
+		case !ok:
+			changes = append(changes, SubscriberChange{Type: SubscriberAdded, Subscriber: subscriber})
+		case !sameSubscriber(previous, subscriber):
+			changes = append(changes, SubscriberChange{Type: SubscriberUpdated, Subscriber: subscriber})
+		}
+		known[subscriber.ID] = subscriber
+	}
+
+	for id, subscriber := range known {
+		if !seen[id] {
+			changes = append(changes, SubscriberChange{Type: SubscriberRemoved, Subscriber: subscriber})
+			delete(known, id)
+		}
+	}
+	return changes
+}
+
+// sameSubscriber compares the persisted fields of two subscribers.
+func sameSubscriber(a, b *Subscriber) bool {
+	return a.ID == b.ID &&
+		a.EclinicID == b.EclinicID &&
+		a.PatientID == b.PatientID &&
+		a.PatientName == b.PatientName &&
+		a.Email == b.Email &&
+		a.HospitalNumber == b.HospitalNumber &&
+		a.HospitalName == b.HospitalName &&
+		a.RegisteredBy == b.RegisteredBy &&
+		a.CreatedAt.Equal(b.CreatedAt)
+}